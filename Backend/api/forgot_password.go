@@ -1,19 +1,24 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/services"
 )
 
 type ForgotPasswordHandler struct {
-	UserService *services.UserService
+	UserService  *services.UserService
+	EmailService *services.EmailService
 }
 
-func NewForgotPasswordHandler(userService *services.UserService) http.Handler {
-	return &ForgotPasswordHandler{UserService: userService}
+func NewForgotPasswordHandler(userService *services.UserService, emailService *services.EmailService) http.Handler {
+	return &ForgotPasswordHandler{UserService: userService, EmailService: emailService}
 }
 
 func (h *ForgotPasswordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -22,30 +27,36 @@ func (h *ForgotPasswordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var req struct {
-		Email string `json:"email"`
-	}
+	var req models.ForgotPasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	otp, err := h.UserService.CreatePasswordResetOTP(r.Context(), req.Email)
+	// The code is generated and queued in the background, and the response is the same
+	// whether or not the email belongs to an account, so that neither the status
+	// nor the response time tells which emails are registered
+	// The code is written in the language of the browser asking for it
+	go h.sendResetCode(req, mail.MatchLocale(r.Header.Get("Accept-Language")))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("If an account exists for this email, a password reset code has been sent"))
+}
+
+func (h *ForgotPasswordHandler) sendResetCode(req models.ForgotPasswordRequest, locale string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	otp, err := h.UserService.RequestPasswordReset(ctx, &req)
 	if err != nil {
 		log.Printf("ForgotPassword error: %v", err)
-		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-
-	subject := "Your Password Reset Code"
-	body := "Your password reset code is: " + otp + "\nThis code will expire in 10 minutes."
-	err = services.SendNoReplyEmail(req.Email, subject, body)
-	if err != nil {
-		log.Printf("SendNoReplyEmail error: %v", err)
-		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+	if otp == "" {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Password reset code sent"))
+	if err := h.EmailService.SendPasswordResetCode(ctx, req.Email, locale, otp); err != nil {
+		log.Printf("SendPasswordResetCode error: %v", err)
+	}
 }
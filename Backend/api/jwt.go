@@ -1,138 +0,0 @@
-// backend/api/auth.go
-package api
-
-import (
-	"context"
-	"fmt"
-	"net/http"
-	"os"
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
-func GenerateJWT(userID int, username string, role string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"role":     role,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, `{"error": "Authorization header missing"}`, http.StatusUnauthorized)
-			return
-		}
-
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, `{"error": "Invalid token claims"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Handle user_id as string or float64
-		var userID int
-		switch v := claims["user_id"].(type) {
-		case string:
-			id, err := strconv.Atoi(v)
-			if err != nil {
-				http.Error(w, `{"error": "Invalid user ID in token"}`, http.StatusUnauthorized)
-				return
-			}
-			userID = id
-		case float64:
-			userID = int(v)
-		default:
-			http.Error(w, `{"error": "User ID not found in token"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Add userID to context
-		ctx := context.WithValue(r.Context(), "userID", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-func TeacherOnlyMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Remove "Bearer " from token
-		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-			tokenString = tokenString[7:]
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			fmt.Println("JWT parse error:", err)
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			fmt.Println("JWT claims not ok")
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
-			return
-		}
-
-		// Check if user is teacher
-		role, ok := claims["role"].(string)
-		fmt.Println("JWT claims:", claims)
-		if !ok || role != "teacher" {
-			fmt.Println("JWT role not teacher:", role)
-			http.Error(w, `{"error": "Forbidden - Teachers only"}`, http.StatusForbidden)
-			return
-		}
-
-		// Handle user_id as string or float64
-		var userID int
-		switch v := claims["user_id"].(type) {
-		case string:
-			id, err := strconv.Atoi(v)
-			if err != nil {
-				http.Error(w, `{"error": "Invalid user ID"}`, http.StatusUnauthorized)
-				return
-			}
-			userID = id
-		case float64:
-			userID = int(v)
-		default:
-			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), "userID", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
@@ -3,10 +3,14 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/services"
 )
 
@@ -16,11 +20,15 @@ type APIError struct {
 }
 
 type LoginHandler struct {
-	UserService *services.UserService
+	UserService  *services.UserService
+	TokenService *services.TokenService
+	LoginGuard   *services.LoginGuard
+	TwoFactor    *services.TwoFactorService
+	TrustProxy   bool // take the client address from X-Forwarded-For (behind a reverse proxy only)
 }
 
-func NewLoginHandler(userService *services.UserService) http.Handler {
-	return &LoginHandler{UserService: userService}
+func NewLoginHandler(userService *services.UserService, tokenService *services.TokenService, loginGuard *services.LoginGuard, twoFactor *services.TwoFactorService, trustProxy bool) http.Handler {
+	return &LoginHandler{UserService: userService, TokenService: tokenService, LoginGuard: loginGuard, TwoFactor: twoFactor, TrustProxy: trustProxy}
 }
 
 func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -45,28 +53,108 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse throttled attempts before the (costly) password check
+	attempt, err := h.LoginGuard.Begin(r.Context(), creds.Username, ClientIP(r, h.TrustProxy))
+	if err != nil {
+		respondWithLoginGuardError(w, err)
+		return
+	}
+
 	// Authenticate user and get user object
 	user, err := h.UserService.Authenticate(r.Context(), creds.Username, creds.Password)
+	if errors.Is(err, services.ErrAccountDisabled) || errors.Is(err, services.ErrPasswordResetRequired) {
+		cancelLoginAttempt(r, h.LoginGuard, attempt)
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil || user == nil {
+		if err := h.LoginGuard.Failed(r.Context(), attempt); err != nil {
+			log.Printf("LoginGuard error: %v", err)
+		}
 		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	// Generate JWT token
-	token, err := GenerateJWT(user.ID, user.Username, user.Role)
+	// Users with two-factor authentication continue with their code (POST /login/2fa)
+	// The failures of the account are only cleared once the second step succeeds
+	challenge, err := h.TwoFactor.LoginChallenge(r.Context(), user)
+	if err != nil || challenge != nil {
+		cancelLoginAttempt(r, h.LoginGuard, attempt)
+	}
 	if err != nil {
+		log.Printf("LoginChallenge error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not log in")
+		return
+	}
+	if challenge != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"message":                        "Two-factor authentication required",
+			"two_factor_required":            true,
+			"two_factor_enrollment_required": challenge.Purpose == models.MFAPurposeEnroll,
+			"mfa_token":                      challenge.Token,
+			"expires_in":                     challenge.ExpiresIn,
+		})
+		return
+	}
+
+	if err := h.LoginGuard.Succeeded(r.Context(), attempt); err != nil {
+		log.Printf("LoginGuard error: %v", err)
+	}
+	respondLoggedIn(w, r, h.TokenService, user, nil)
+}
+
+// cancelLoginAttempt gives back an attempt which did not fail
+func cancelLoginAttempt(r *http.Request, guard *services.LoginGuard, attempt *services.LoginAttempt) {
+	if err := guard.Cancel(r.Context(), attempt); err != nil {
+		log.Printf("LoginGuard error: %v", err)
+	}
+}
+
+// respondLoggedIn opens a session with an access and a refresh token and sends them
+func respondLoggedIn(w http.ResponseWriter, r *http.Request, tokenService *services.TokenService, user *models.User, extra map[string]any) {
+	tokens, err := tokenService.IssueTokens(r.Context(), user)
+	if errors.Is(err, services.ErrAccountDisabled) {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("IssueTokens error: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not generate token")
 		return
 	}
 
+	resp := map[string]any{
+		"message":        "User logged in successfully",
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"expires_in":     tokens.ExpiresIn,
+		"username":       user.Username,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified(),
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]any{
-		"message":  "User logged in successfully",
-		"token":    token,
-		"username": user.Username,
-		"role":     user.Role,
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// respondWithLoginGuardError answers a login refused by the LoginGuard, with a Retry-After header when throttled
+func respondWithLoginGuardError(w http.ResponseWriter, err error) {
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		status := http.StatusTooManyRequests
+		if throttled.Locked && !throttled.IP {
+			status = http.StatusLocked
+		}
+		respondWithError(w, status, throttled.Error())
+		return
+	}
+	log.Printf("LoginGuard error: %v", err)
+	respondWithError(w, http.StatusInternalServerError, "Could not log in")
 }
 
 func respondWithError(w http.ResponseWriter, status int, message string) {
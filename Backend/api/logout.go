@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+type LogoutHandler struct {
+	TokenService *services.TokenService
+}
+
+// NewLogoutHandler revokes the session of the access token (or all the sessions of the user)
+// It shall be mounted behind the auth middleware
+func NewLogoutHandler(tokenService *services.TokenService) http.Handler {
+	return &LogoutHandler{TokenService: tokenService}
+}
+
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// The body is optional
+	var req models.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var err error
+	if req.All {
+		err = h.TokenService.RevokeUserSessions(r.Context(), claims.UserID, "logout")
+	} else {
+		err = h.TokenService.Logout(r.Context(), claims.SessionID)
+	}
+	if err != nil {
+		log.Printf("Logout error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not log out")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User logged out successfully"})
+}
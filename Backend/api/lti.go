@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/lti"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+// ltiStateCookie binds a pending launch to the browser which started it
+const ltiStateCookie = "lti_state"
+
+type LTIHandler struct {
+	LTIService   *services.LTIService
+	TokenService *services.TokenService
+	TwoFactor    *services.TwoFactorService
+	FrontendURL  string // the callback page of the frontend receives the tokens in the URL fragment
+}
+
+// NewLTIHandler launches the tool from the LTI 1.3 platforms
+// Routes: GET/POST /lti/login (login initiation), POST /lti/launch, POST /lti/deep-linking and GET /lti/jwks
+func NewLTIHandler(ltiService *services.LTIService, tokenService *services.TokenService, twoFactor *services.TwoFactorService, frontendURL string) *LTIHandler {
+	return &LTIHandler{LTIService: ltiService, TokenService: tokenService, TwoFactor: twoFactor, FrontendURL: strings.TrimRight(frontendURL, "/")}
+}
+
+// JWKS publishes the public keys of the tool
+func (h *LTIHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.LTIService.Keys())
+}
+
+// Login handles the third party login initiation of a platform and redirects to its authentication endpoint
+func (h *LTIHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid login initiation")
+		return
+	}
+	authURL, state, err := h.LTIService.BeginLaunch(r.Context(), r.Form.Get("iss"), r.Form.Get("client_id"),
+		r.Form.Get("login_hint"), r.Form.Get("lti_message_hint"), r.Form.Get("target_link_uri"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownLTIPlatform):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, services.ErrInvalidLTILaunch):
+			respondWithError(w, http.StatusBadRequest, "Invalid login initiation")
+		default:
+			log.Printf("LTI login error: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not start the launch")
+		}
+		return
+	}
+	http.SetCookie(w, h.stateCookie(r, state, 600))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// stateCookie returns the state cookie; launches come back with a cross-site POST, possibly in an
+// iframe of the platform, which only carries SameSite=None cookies (that shall be Secure)
+func (h *LTIHandler) stateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	secure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+	cookie := &http.Cookie{
+		Name:     ltiStateCookie,
+		Value:    value,
+		Path:     "/lti/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode, // development over http, with the platform on the same site
+	}
+	if secure {
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// Launch verifies the id token posted by the platform, signs the user in and opens the test of the
+// resource link, or shows the tests a teacher can add to the course
+func (h *LTIHandler) Launch(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		redirectSignInError(w, r, h.FrontendURL, services.ErrInvalidLTILaunch.Error())
+		return
+	}
+	http.SetCookie(w, h.stateCookie(r, "", -1))
+	if e := r.PostForm.Get("error"); e != "" {
+		log.Printf("LTI launch error from the platform: %s %s", e, r.PostForm.Get("error_description"))
+		redirectSignInError(w, r, h.FrontendURL, "The launch was refused by the platform")
+		return
+	}
+	state := r.PostForm.Get("state")
+	cookie, err := r.Cookie(ltiStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		redirectSignInError(w, r, h.FrontendURL, services.ErrInvalidLTILaunch.Error())
+		return
+	}
+
+	result, err := h.LTIService.CompleteLaunch(r.Context(), state, r.PostForm.Get("id_token"))
+	if err != nil {
+		log.Printf("LTI launch error: %v", err)
+		message := "The launch failed, please try again"
+		for _, known := range []error{services.ErrInvalidLTILaunch, services.ErrUnknownLTIPlatform, services.ErrLTINotTeacher,
+			services.ErrSSONoEmail, services.ErrSSOEmailTaken, lti.ErrUnknownDeployment} {
+			if errors.Is(err, known) {
+				message = err.Error()
+			}
+		}
+		if errors.Is(err, lti.ErrInvalidLaunch) {
+			message = services.ErrInvalidLTILaunch.Error()
+		}
+		redirectSignInError(w, r, h.FrontendURL, message)
+		return
+	}
+
+	if result.DeepLink != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		chooseTestPage.Execute(w, map[string]any{"Request": result.DeepLink.ID, "Tests": result.Tests})
+		return
+	}
+	next := ""
+	switch {
+	case result.TestID != nil:
+		next = "/classroom-test/" + strconv.Itoa(*result.TestID)
+	case result.User.Role == models.RoleTeacher:
+		next = "/teacher-classrooms"
+	}
+	signInRedirect(w, r, h.TokenService, h.TwoFactor, h.FrontendURL, result.User, next)
+}
+
+var chooseTestPage = template.Must(template.New("choose").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Add a test to the course</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; margin: 24px; color: #222; }
+li { margin: 8px 0; }
+button { cursor: pointer; }
+</style></head>
+<body>
+<h1>Add a test to the course</h1>
+{{if .Tests}}<p>Students opening the activity take the test; their scores go to the gradebook of the course.</p>
+<ul>{{range .Tests}}<li>
+<form method="post" action="/lti/deep-linking">
+<input type="hidden" name="request" value="{{$.Request}}">
+<input type="hidden" name="test_id" value="{{.ID}}">
+<button type="submit">{{.Title}}</button> {{.Type}}{{if .Description}}: {{.Description}}{{end}}
+</form>
+</li>{{end}}</ul>
+{{else}}<p>You have no tests yet: create one in Personalised English, then add the activity again.</p>{{end}}
+</body>
+</html>`))
+
+var deepLinkingResponsePage = template.Must(template.New("response").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Returning to the course</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.ReturnURL}}">
+<input type="hidden" name="JWT" value="{{.JWT}}">
+<noscript><button type="submit">Return to the course</button></noscript>
+</form>
+</body>
+</html>`))
+
+// DeepLinking returns the test chosen by a teacher to the platform, through an auto-submitted form
+func (h *LTIHandler) DeepLinking(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	testID, err := strconv.Atoi(r.PostForm.Get("test_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test")
+		return
+	}
+	returnURL, response, err := h.LTIService.CompleteDeepLink(r.Context(), r.PostForm.Get("request"), testID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidLTILaunch):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrLTITestNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			log.Printf("LTI deep linking error: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not add the test to the course")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	deepLinkingResponsePage.Execute(w, map[string]string{"ReturnURL": returnURL, "JWT": response})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+// oidcStateCookie binds a pending login to the browser which started it (login CSRF)
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	SSOService   *services.SSOService
+	TokenService *services.TokenService
+	TwoFactor    *services.TwoFactorService
+	FrontendURL  string // the callback page of the frontend receives the tokens in the URL fragment
+}
+
+// NewOIDCHandler signs users in with the configured OpenID Connect providers
+// Routes: GET /auth/oidc/providers, /auth/oidc/{provider}/login and /auth/oidc/{provider}/callback
+func NewOIDCHandler(ssoService *services.SSOService, tokenService *services.TokenService, twoFactor *services.TwoFactorService, frontendURL string) *OIDCHandler {
+	return &OIDCHandler{SSOService: ssoService, TokenService: tokenService, TwoFactor: twoFactor, FrontendURL: strings.TrimRight(frontendURL, "/")}
+}
+
+// Providers lists the identity providers for the login page
+func (h *OIDCHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.SSOService.Providers())
+}
+
+// Login redirects the user to the identity provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	authURL, state, err := h.SSOService.BeginLogin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownProvider) {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("OIDC login error (%s): %v", provider, err)
+		respondWithError(w, http.StatusBadGateway, "The identity provider is unavailable")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode, // sent on the top-level redirect back from the provider
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the login and hands the tokens over to the frontend
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	q := r.URL.Query()
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc/", MaxAge: -1, HttpOnly: true})
+
+	if e := q.Get("error"); e != "" {
+		log.Printf("OIDC callback error from %s: %s %s", provider, e, q.Get("error_description"))
+		h.redirectError(w, r, "Sign-in was cancelled or refused by the identity provider")
+		return
+	}
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.redirectError(w, r, services.ErrInvalidSSOState.Error())
+		return
+	}
+
+	user, err := h.SSOService.CompleteLogin(r.Context(), provider, state, q.Get("code"))
+	if err != nil {
+		log.Printf("OIDC callback error (%s): %v", provider, err)
+		message := "Sign-in failed, please try again"
+		for _, known := range []error{services.ErrInvalidSSOState, services.ErrUnknownProvider, services.ErrSSONoEmail, services.ErrSSOEmailTaken} {
+			if errors.Is(err, known) {
+				message = err.Error()
+			}
+		}
+		h.redirectError(w, r, message)
+		return
+	}
+
+	signInRedirect(w, r, h.TokenService, h.TwoFactor, h.FrontendURL, user, "")
+}
+
+func (h *OIDCHandler) redirectError(w http.ResponseWriter, r *http.Request, message string) {
+	redirectSignInError(w, r, h.FrontendURL, message)
+}
+
+// signInRedirect opens a session for a user signed in by an external provider and hands the tokens over
+// to the callback page of the frontend, which then opens next (the dashboard of the role if empty)
+func signInRedirect(w http.ResponseWriter, r *http.Request, tokenService *services.TokenService, twoFactor *services.TwoFactorService, frontendURL string, user *models.User, next string) {
+	if user.Disabled() {
+		redirectSignInError(w, r, frontendURL, services.ErrAccountDisabled.Error())
+		return
+	}
+	// Users with two-factor authentication (and teachers when it is required) continue with their
+	// code on the login page (POST /login/2fa), as after a password
+	challenge, err := twoFactor.LoginChallenge(r.Context(), user)
+	if err != nil {
+		log.Printf("LoginChallenge error: %v", err)
+		redirectSignInError(w, r, frontendURL, "Could not log in")
+		return
+	}
+	if challenge != nil {
+		callbackRedirect(w, r, frontendURL, url.Values{
+			"two_factor_required":            {"true"},
+			"two_factor_enrollment_required": {strconv.FormatBool(challenge.Purpose == models.MFAPurposeEnroll)},
+			"mfa_token":                      {challenge.Token},
+			"expires_in":                     {strconv.Itoa(challenge.ExpiresIn)},
+		}, next)
+		return
+	}
+
+	tokens, err := tokenService.IssueTokens(r.Context(), user)
+	if errors.Is(err, services.ErrAccountDisabled) {
+		redirectSignInError(w, r, frontendURL, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("IssueTokens error: %v", err)
+		redirectSignInError(w, r, frontendURL, "Could not generate token")
+		return
+	}
+	callbackRedirect(w, r, frontendURL, url.Values{
+		"token":          {tokens.AccessToken},
+		"refresh_token":  {tokens.RefreshToken},
+		"expires_in":     {strconv.Itoa(tokens.ExpiresIn)},
+		"username":       {user.Username},
+		"role":           {user.Role},
+		"email_verified": {strconv.FormatBool(user.EmailVerified())},
+	}, next)
+}
+
+// callbackRedirect redirects to the callback page of the frontend with values in the URL fragment,
+// which is not sent to servers (nor in the Referer header)
+func callbackRedirect(w http.ResponseWriter, r *http.Request, frontendURL string, fragment url.Values, next string) {
+	if next != "" {
+		fragment.Set("next", next)
+	}
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, frontendURL+"/oidc/callback#"+fragment.Encode(), http.StatusFound)
+}
+
+func redirectSignInError(w http.ResponseWriter, r *http.Request, frontendURL, message string) {
+	http.Redirect(w, r, frontendURL+"/oidc/callback#"+url.Values{"error": {message}}.Encode(), http.StatusFound)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+)
+
+// OutboxHandler shows the emails kept by the development outbox
+// It must only be mounted in development: the emails hold reset codes and verification links
+type OutboxHandler struct {
+	Outbox *mail.MemoryMailer
+}
+
+// NewOutboxHandler serves the development outbox
+// Routes: GET /dev/outbox (HTML), GET /dev/outbox/messages, GET /dev/outbox/messages/{id},
+// GET /dev/outbox/messages/{id}/html and DELETE /dev/outbox/messages
+func NewOutboxHandler(outbox *mail.MemoryMailer) *OutboxHandler {
+	return &OutboxHandler{Outbox: outbox}
+}
+
+var outboxPage = template.Must(template.New("outbox").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Development outbox</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; vertical-align: top; }
+pre { white-space: pre-wrap; margin: 0; font-size: 13px; }
+</style></head>
+<body>
+<h1>Development outbox</h1>
+<p>{{len .}} email(s), latest first. Nothing here was delivered unless a real mailer is configured too.</p>
+<table>
+<tr><th>Sent</th><th>To</th><th>Subject</th><th>Template</th><th>Text</th></tr>
+{{range .}}<tr>
+<td>{{.SentAt.Format "2006-01-02 15:04:05"}}</td>
+<td>{{range .To}}{{.}}<br>{{end}}</td>
+<td>{{if .HTML}}<a href="/dev/outbox/messages/{{.ID}}/html">{{.Subject}}</a>{{else}}{{.Subject}}{{end}}</td>
+<td>{{.Template}} ({{.Locale}})</td>
+<td><pre>{{.Text}}</pre></td>
+</tr>{{end}}
+</table>
+</body>
+</html>`))
+
+// Index lists the emails as an HTML page
+func (h *OutboxHandler) Index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	outboxPage.Execute(w, h.Outbox.Messages())
+}
+
+// List returns the emails, latest first; ?to= keeps the ones sent to an address
+func (h *OutboxHandler) List(w http.ResponseWriter, r *http.Request) {
+	messages := h.Outbox.Messages()
+	if to := r.URL.Query().Get("to"); to != "" {
+		filtered := []mail.Message{}
+		for _, msg := range messages {
+			for _, recipient := range msg.To {
+				if recipient == to {
+					filtered = append(filtered, msg)
+					break
+				}
+			}
+		}
+		messages = filtered
+	}
+	json.NewEncoder(w).Encode(messages)
+}
+
+// Get returns an email
+func (h *OutboxHandler) Get(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.Outbox.Message(mux.Vars(r)["id"])
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Email not found")
+		return
+	}
+	json.NewEncoder(w).Encode(msg)
+}
+
+// HTML shows the HTML body of an email as it would be displayed
+func (h *OutboxHandler) HTML(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.Outbox.Message(mux.Vars(r)["id"])
+	if !ok || msg.HTML == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(msg.HTML))
+}
+
+// Clear empties the outbox
+func (h *OutboxHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	h.Outbox.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
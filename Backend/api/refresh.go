@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+type RefreshHandler struct {
+	TokenService *services.TokenService
+}
+
+func NewRefreshHandler(tokenService *services.TokenService) http.Handler {
+	return &RefreshHandler{TokenService: tokenService}
+}
+
+func (h *RefreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tokens, err := h.TokenService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			respondWithError(w, http.StatusUnauthorized, "Refresh token reused, please log in again")
+			return
+		}
+		if errors.Is(err, services.ErrAccountDisabled) {
+			respondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		log.Printf("Refresh error: %v", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
@@ -10,11 +10,13 @@ import (
 )
 
 type RegisterHandler struct {
-	userService *services.UserService
+	userService         *services.UserService
+	tokenService        *services.TokenService
+	verificationService *services.EmailVerificationService
 }
 
-func NewRegisterHandler(us *services.UserService) *RegisterHandler {
-	return &RegisterHandler{userService: us}
+func NewRegisterHandler(us *services.UserService, ts *services.TokenService, vs *services.EmailVerificationService) *RegisterHandler {
+	return &RegisterHandler{userService: us, tokenService: ts, verificationService: vs}
 }
 
 func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +37,10 @@ func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := GenerateJWT(user.ID, user.Username, user.Role)
+	// New accounts start unverified
+	sendVerification(h.verificationService, user)
+
+	tokens, err := h.tokenService.IssueTokens(r.Context(), user)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Failed to generate token"))
@@ -44,9 +49,12 @@ func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{
-		"token":    token,
-		"username": user.Username,
-		"email":    user.Email,
-		"role":     user.Role,
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"expires_in":     tokens.ExpiresIn,
+		"username":       user.Username,
+		"email":          user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified(),
 	})
 }
@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/services"
 )
 
@@ -21,18 +25,24 @@ func (h *ResetPasswordOTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	var req struct {
-		Code        string `json:"code"`
-		NewPassword string `json:"new_password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.NewPassword == "" {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Code == "" || req.NewPassword == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	err := h.UserService.ResetPasswordWithOTP(r.Context(), req.Code, req.NewPassword)
+	err := h.UserService.ResetPasswordWithOTP(r.Context(), &req)
 	if err != nil {
-		http.Error(w, "Invalid or expired code", http.StatusBadRequest)
+		var validationErrs validator.ValidationErrors
+		switch {
+		case errors.Is(err, services.ErrInvalidResetCode):
+			http.Error(w, "Invalid or expired code", http.StatusBadRequest)
+		case errors.As(err, &validationErrs):
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		default:
+			log.Printf("ResetPassword error: %v", err)
+			http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		}
 		return
 	}
 
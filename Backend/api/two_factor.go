@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+type TwoFactorLoginHandler struct {
+	TwoFactor    *services.TwoFactorService
+	TokenService *services.TokenService
+	LoginGuard   *services.LoginGuard
+	TrustProxy   bool // take the client address from X-Forwarded-For (behind a reverse proxy only)
+}
+
+// NewTwoFactorLoginHandler completes the logins which need a second step, with the mfa_token of POST /login
+// Routes: POST /login/2fa and /login/2fa/enroll
+func NewTwoFactorLoginHandler(twoFactor *services.TwoFactorService, tokenService *services.TokenService, loginGuard *services.LoginGuard, trustProxy bool) *TwoFactorLoginHandler {
+	return &TwoFactorLoginHandler{TwoFactor: twoFactor, TokenService: tokenService, LoginGuard: loginGuard, TrustProxy: trustProxy}
+}
+
+// Verify checks the TOTP or recovery code (or the first code of a required enrolment) and logs the user in
+func (h *TwoFactorLoginHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginSecondStepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Wrong codes are throttled like wrong passwords of the account
+	userID, err := h.TwoFactor.PendingLogin(r.Context(), req.MFAToken)
+	if err != nil {
+		respondWithTwoFactorError(w, err)
+		return
+	}
+	attempt, err := h.LoginGuard.BeginSecondStep(r.Context(), userID, ClientIP(r, h.TrustProxy))
+	if err != nil {
+		respondWithLoginGuardError(w, err)
+		return
+	}
+
+	result, err := h.TwoFactor.CompleteLogin(r.Context(), &req)
+	if err != nil {
+		var failure *services.TwoFactorFailure
+		if errors.As(err, &failure) {
+			if err := h.LoginGuard.Failed(r.Context(), attempt); err != nil {
+				log.Printf("LoginGuard error: %v", err)
+			}
+		} else {
+			cancelLoginAttempt(r, h.LoginGuard, attempt)
+		}
+		respondWithTwoFactorError(w, err)
+		return
+	}
+	if err := h.LoginGuard.Succeeded(r.Context(), attempt); err != nil {
+		log.Printf("LoginGuard error: %v", err)
+	}
+
+	var extra map[string]any
+	if result.RecoveryCodes != nil {
+		extra = map[string]any{"recovery_codes": result.RecoveryCodes}
+	}
+	respondLoggedIn(w, r, h.TokenService, result.User, extra)
+}
+
+// Enroll starts the enrolment required of the user before they can log in
+func (h *TwoFactorLoginHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginSecondStepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	setup, err := h.TwoFactor.EnrollWithChallenge(r.Context(), req.MFAToken)
+	if err != nil {
+		respondWithTwoFactorError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(setup)
+}
+
+func respondWithTwoFactorError(w http.ResponseWriter, err error) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		respondWithLoginGuardError(w, err)
+	case errors.Is(err, services.ErrInvalidMFAToken):
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		respondWithError(w, http.StatusUnauthorized, "Invalid two-factor code")
+	case errors.Is(err, services.ErrNoTwoFactorEnrollment):
+		respondWithError(w, http.StatusBadRequest, "Start the enrolment first (POST /login/2fa/enroll)")
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("Two-factor login error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not log in")
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 4em">
+<h2>{{.Message}}</h2>
+{{if .Token}}<form method="post" action="unsubscribe">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit" style="font-size: 1em; padding: 0.5em 1.5em">Unsubscribe</button>
+</form>{{end}}
+</body></html>`))
+
+type UnsubscribeHandler struct {
+	NotificationService *services.NotificationService
+}
+
+// NewUnsubscribeHandler turns off a type of email with the token of an unsubscribe link
+// GET (the link itself) asks for a confirmation, so that link scanners do not unsubscribe anyone;
+// POST unsubscribes, from the confirmation form or from the mail client (one-click, RFC 8058)
+func NewUnsubscribeHandler(notificationService *services.NotificationService) http.Handler {
+	return &UnsubscribeHandler{NotificationService: notificationService}
+}
+
+func (h *UnsubscribeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	type page struct {
+		Message string
+		Token   string
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	switch r.Method {
+	case http.MethodGet:
+		unsubscribePage.Execute(w, page{"Stop receiving these emails?", r.URL.Query().Get("token")})
+	case http.MethodPost:
+		// One-click unsubscribes post to the link itself, the form posts the token
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = r.PostFormValue("token")
+		}
+		_, err := h.NotificationService.Unsubscribe(r.Context(), token)
+		if err != nil {
+			status, message := http.StatusBadRequest, "This unsubscribe link is invalid"
+			if !errors.Is(err, services.ErrInvalidUnsubscribeToken) {
+				log.Printf("Unsubscribe error: %v", err)
+				status, message = http.StatusInternalServerError, "Could not unsubscribe, please try again later"
+			}
+			w.WriteHeader(status)
+			unsubscribePage.Execute(w, page{Message: message})
+			return
+		}
+		unsubscribePage.Execute(w, page{Message: "You will no longer receive these emails. You can turn them on again from your account."})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		unsubscribePage.Execute(w, page{Message: "Method not allowed"})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+var verifyEmailPage = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Email verification</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 4em">
+<h2>{{.}}</h2>
+</body></html>`))
+
+type VerifyEmailHandler struct {
+	VerificationService *services.EmailVerificationService
+}
+
+// NewVerifyEmailHandler confirms an email with the token of a verification link
+// GET (the link itself) answers with a page, POST {"token"} with JSON
+func NewVerifyEmailHandler(verificationService *services.EmailVerificationService) http.Handler {
+	return &VerifyEmailHandler{VerificationService: verificationService}
+}
+
+func (h *VerifyEmailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Token = r.URL.Query().Get("token")
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	default:
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	_, err := h.VerificationService.Verify(r.Context(), req.Token)
+	status, message := http.StatusOK, "Your email address has been confirmed"
+	if err != nil {
+		status, message = http.StatusBadRequest, "This verification link is invalid or has expired"
+		if !errors.Is(err, services.ErrInvalidVerificationToken) {
+			log.Printf("VerifyEmail error: %v", err)
+			status, message = http.StatusInternalServerError, "Could not verify the email address"
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		verifyEmailPage.Execute(w, message)
+		return
+	}
+	if err != nil {
+		respondWithError(w, status, message)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"message": message, "email_verified": true})
+}
+
+type ResendVerificationHandler struct {
+	VerificationService *services.EmailVerificationService
+}
+
+// NewResendVerificationHandler emails a new verification link to the authenticated user
+// It shall be mounted behind the auth middleware
+func NewResendVerificationHandler(verificationService *services.EmailVerificationService) http.Handler {
+	return &ResendVerificationHandler{VerificationService: verificationService}
+}
+
+func (h *ResendVerificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err := h.VerificationService.Resend(r.Context(), userID)
+	if err != nil {
+		var tooSoon *services.ResendTooSoonError
+		switch {
+		case errors.As(err, &tooSoon):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooSoon.RetryAfter.Seconds()))))
+			respondWithError(w, http.StatusTooManyRequests, tooSoon.Error())
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("ResendVerification error: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not send the verification email")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// sendVerification emails the verification link of a new account in the background
+func sendVerification(verificationService *services.EmailVerificationService, user *models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := verificationService.SendVerification(ctx, user); err != nil {
+			log.Printf("SendVerification error for userID %d: %v", user.ID, err)
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an access token
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+
+	// Set when the request is authenticated with a personal access token instead of a session
+	PersonalTokenID int      `json:"-"`
+	Scopes          []string `json:"-"`
+}
+
+// PersonalToken tells whether the claims come from a personal access token
+func (c *Claims) PersonalToken() bool {
+	return c.PersonalTokenID != 0
+}
+
+// HasScope tells whether the claims allow a scope; session tokens allow every scope
+func (c *Claims) HasScope(scope string) bool {
+	if !c.PersonalToken() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const claimsKey contextKey = iota
+
+// WithClaims returns a copy of ctx carrying the claims of the authenticated user
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the claims of the authenticated user, if any
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// UserID returns the id of the authenticated user, if any
+func UserID(ctx context.Context) (int, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.UserID == 0 {
+		return 0, false
+	}
+	return claims.UserID, true
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// LoadKeySet builds the key set from the environment
+//
+//	JWT_SIGNING_ALG          HS256 (default), RS256 or EdDSA
+//	JWT_KEY_ID               kid of the active key ("default")
+//	JWT_SECRET               secret of the active key (HS256)
+//	JWT_PRIVATE_KEY_FILE     PEM private key of the active key (RS256, EdDSA)
+//	JWT_PREVIOUS_SECRETS     rotated out HS256 keys still accepted: kid=secret,...
+//	JWT_PREVIOUS_PUBLIC_KEYS rotated out RS256/EdDSA keys still accepted: kid=public.pem,...
+func LoadKeySet() (*KeySet, error) {
+	kid := os.Getenv("JWT_KEY_ID")
+	if kid == "" {
+		kid = "default"
+	}
+
+	var active *Key
+	switch alg := os.Getenv("JWT_SIGNING_ALG"); alg {
+	case "", "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			log.Printf("Warning: JWT_SECRET is empty, tokens can be forged")
+		}
+		active = NewHMACKey(kid, []byte(secret))
+	case "RS256", "EdDSA":
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", alg)
+		}
+		key, err := LoadPrivateKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != alg {
+			return nil, fmt.Errorf("%s is a %s key, not %s", path, key.Method.Alg(), alg)
+		}
+		active = key
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q", alg)
+	}
+
+	var previous []*Key
+	secrets, err := parsePairs(os.Getenv("JWT_PREVIOUS_SECRETS"))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_PREVIOUS_SECRETS: %w", err)
+	}
+	for _, p := range secrets {
+		previous = append(previous, NewHMACKey(p[0], []byte(p[1])))
+	}
+	publics, err := parsePairs(os.Getenv("JWT_PREVIOUS_PUBLIC_KEYS"))
+	if err != nil {
+		return nil, fmt.Errorf("JWT_PREVIOUS_PUBLIC_KEYS: %w", err)
+	}
+	for _, p := range publics {
+		key, err := LoadPublicKey(p[0], p[1])
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return NewKeySet(active, previous...)
+}
+
+// parsePairs parses a comma separated list of kid=value
+func parsePairs(s string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kid, value, ok := strings.Cut(item, "=")
+		if !ok || kid == "" || value == "" {
+			return nil, fmt.Errorf("expected kid=value, got %q", item)
+		}
+		pairs = append(pairs, [2]string{kid, value})
+	}
+	return pairs, nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key returns the verify-only key of a JWK (RSA, EC or Ed25519)
+// The algorithm is the one of the JWK, or the usual one of the key type when it is not given
+func (j JWK) Key() (*Key, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", j.Kid, err)
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("key %s: invalid exponent", j.Kid)
+		}
+		method := jwt.GetSigningMethod(j.Alg)
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		case nil:
+			method = jwt.SigningMethodRS256
+		default:
+			return nil, fmt.Errorf("key %s: algorithm %s does not match a RSA key", j.Kid, j.Alg)
+		}
+		return &Key{ID: j.Kid, Method: method, verify: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var method jwt.SigningMethod
+		switch j.Crv {
+		case "P-256":
+			curve, method = elliptic.P256(), jwt.SigningMethodES256
+		case "P-384":
+			curve, method = elliptic.P384(), jwt.SigningMethodES384
+		case "P-521":
+			curve, method = elliptic.P521(), jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("key %s: unsupported curve %q", j.Kid, j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", j.Kid, err)
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", j.Kid, err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %s: point not on curve", j.Kid)
+		}
+		return &Key{ID: j.Kid, Method: method, verify: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("key %s: unsupported curve %q", j.Kid, j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", j.Kid)
+		}
+		return &Key{ID: j.Kid, Method: jwt.SigningMethodEdDSA, verify: ed25519.PublicKey(x)}, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %q", j.Kid, j.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Verifier verifies tokens signed by third party keys (e.g. the JWKS of an identity provider)
+type Verifier struct {
+	keys map[string]*Key
+}
+
+// NewVerifier creates a Verifier of the given keys
+func NewVerifier(keys ...*Key) *Verifier {
+	v := &Verifier{keys: map[string]*Key{}}
+	for _, k := range keys {
+		v.keys[k.ID] = k
+	}
+	return v
+}
+
+// HasKey tells whether the verifier knows a key id
+func (v *Verifier) HasKey(kid string) bool {
+	_, ok := v.keys[kid]
+	return ok
+}
+
+// ParseWithClaims verifies a token with the key given by its kid and decodes its claims
+// The algorithm of the token shall be the one of the key; tokens without kid are accepted
+// when the verifier holds a single key
+func (v *Verifier) ParseWithClaims(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := v.keys[kid]
+		if !ok && kid == "" && len(v.keys) == 1 {
+			for _, k := range v.keys {
+				key, ok = k, true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.verify, nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
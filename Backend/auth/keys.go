@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a signing key identified by its kid
+// Keys without private part only verify tokens (rotated out keys)
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   any // secret or private key, nil for verify-only keys
+	verify any // secret or public key
+}
+
+// NewHMACKey returns a HS256 key
+func NewHMACKey(kid string, secret []byte) *Key {
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// NewRSAKey returns a RS256 key
+func NewRSAKey(kid string, private *rsa.PrivateKey) *Key {
+	return &Key{ID: kid, Method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}
+}
+
+// NewEdDSAKey returns an Ed25519 key
+func NewEdDSAKey(kid string, private ed25519.PrivateKey) *Key {
+	return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, sign: private, verify: private.Public()}
+}
+
+// NewPublicKey returns a verify-only key from a RSA or Ed25519 public key
+func NewPublicKey(kid string, public crypto.PublicKey) (*Key, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, verify: pub}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, verify: pub}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported public key type %T", kid, public)
+	}
+}
+
+// KeySet holds the active signing key and the keys accepted to verify tokens
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet creates a key set signing with active and verifying with active and others
+func NewKeySet(active *Key, others ...*Key) (*KeySet, error) {
+	if active == nil || active.sign == nil {
+		return nil, errors.New("the active key shall be able to sign")
+	}
+	ks := &KeySet{active: active, keys: map[string]*Key{active.ID: active}}
+	for _, k := range others {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// ActiveKeyID returns the kid of the key used to sign new tokens
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.active.ID
+}
+
+// Sign signs claims with the active key, setting its kid in the header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.sign)
+}
+
+// Parse verifies a token with the key given by its kid and returns its claims
+// The algorithm of the token shall be the one of the key
+func (ks *KeySet) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.verify, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// JWK is a public key in the JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS returns the public keys of the set (HMAC keys are never published)
+func (ks *KeySet) JWKS() map[string][]JWK {
+	keys := []JWK{}
+	for _, k := range ks.keys {
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA", Kid: k.ID, Use: "sig", Alg: k.Method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP", Kid: k.ID, Use: "sig", Alg: k.Method.Alg(),
+				Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return map[string][]JWK{"keys": keys}
+}
+
+// LoadPrivateKey reads a RSA or Ed25519 private key from a PEM file
+func LoadPrivateKey(kid, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return NewRSAKey(kid, private), nil
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch priv := private.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(kid, priv), nil
+	case ed25519.PrivateKey:
+		return NewEdDSAKey(kid, priv), nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported private key type %T", path, private)
+	}
+}
+
+// LoadPublicKey reads a verify-only RSA or Ed25519 public key from a PEM file
+func LoadPublicKey(kid, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewPublicKey(kid, public)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
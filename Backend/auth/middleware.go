@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// PersonalTokenPrefix starts every personal access token, so that they are told apart from JWTs
+const PersonalTokenPrefix = "pe_pat_"
+
+var (
+	ErrInvalidToken   = errors.New("invalid or expired token")
+	ErrSessionRevoked = errors.New("session revoked or expired")
+	ErrScopeRequired  = errors.New("personal access tokens are not accepted on this route")
+)
+
+// ScopeError is returned when a personal access token lacks the scope of a route
+type ScopeError struct {
+	Scope string
+}
+
+func (e *ScopeError) Error() string {
+	return "personal access token lacks the " + e.Scope + " scope"
+}
+
+// SessionChecker tells whether the session of a token is still active
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID string, userID int) (bool, error)
+}
+
+// PersonalTokenResolver resolves personal access tokens to the claims of their user and their scopes
+type PersonalTokenResolver interface {
+	ResolvePersonalToken(ctx context.Context, token string) (*Claims, error)
+}
+
+// Authenticator validates access tokens
+type Authenticator struct {
+	keys           *KeySet
+	sessions       SessionChecker
+	personalTokens PersonalTokenResolver // nil to refuse personal access tokens
+}
+
+// NewAuthenticator creates an authenticator verifying tokens with keys and checking their session
+// Personal access tokens are resolved by personalTokens and only accepted on scoped routes
+func NewAuthenticator(keys *KeySet, sessions SessionChecker, personalTokens PersonalTokenResolver) *Authenticator {
+	return &Authenticator{keys: keys, sessions: sessions, personalTokens: personalTokens}
+}
+
+// Authenticate validates an access token and checks that its session was not revoked
+// Personal access tokens are resolved instead; their claims carry no session
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Claims, error) {
+	if strings.HasPrefix(token, PersonalTokenPrefix) {
+		if a.personalTokens == nil {
+			return nil, ErrInvalidToken
+		}
+		return a.personalTokens.ResolvePersonalToken(ctx, token)
+	}
+	claims, err := a.keys.Parse(token)
+	if err != nil || claims.UserID == 0 || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	active, err := a.sessions.IsSessionActive(ctx, claims.SessionID, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+// Required rejects requests without a valid access token
+func (a *Authenticator) Required(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			http.Error(w, `{"error": "Authorization header missing"}`, http.StatusUnauthorized)
+			return
+		}
+		claims, err := a.Authenticate(r.Context(), token)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := checkScope(r, claims); err != nil {
+			http.Error(w, `{"error": "Forbidden - `+err.Error()+`"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
+
+// RequireRole rejects requests without a valid access token of a user with the role
+func (a *Authenticator) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return a.Required(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			if claims.Role != role {
+				http.Error(w, `{"error": "Forbidden - `+role+` only"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// Optional authenticates the request if it carries a valid access token
+// Requests without token, or with an invalid one, are served anonymously
+func (a *Authenticator) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := bearerToken(r); token != "" {
+			if claims, err := a.Authenticate(r.Context(), token); err == nil && checkScope(r, claims) == nil {
+				r = r.WithContext(WithClaims(r.Context(), claims))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scopedHandler is a route handler that personal access tokens with its scope may call
+type scopedHandler struct {
+	scope   string
+	handler http.Handler
+}
+
+// Scoped declares the scope a personal access token needs to call a route
+// Routes that are not scoped only accept session tokens
+func Scoped(scope string, handler http.HandlerFunc) http.Handler {
+	return scopedHandler{scope: scope, handler: handler}
+}
+
+func (h scopedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Also checked here in case the route is served without the authentication middleware
+	if claims, ok := ClaimsFromContext(r.Context()); ok && !claims.HasScope(h.scope) {
+		http.Error(w, `{"error": "Forbidden - `+(&ScopeError{Scope: h.scope}).Error()+`"}`, http.StatusForbidden)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// checkScope refuses personal access tokens on routes that are not scoped or need another scope
+func checkScope(r *http.Request, claims *Claims) error {
+	if !claims.PersonalToken() {
+		return nil
+	}
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ErrScopeRequired
+	}
+	scoped, ok := route.GetHandler().(scopedHandler)
+	if !ok {
+		return ErrScopeRequired
+	}
+	if !claims.HasScope(scoped.scope) {
+		return &ScopeError{Scope: scoped.scope}
+	}
+	return nil
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
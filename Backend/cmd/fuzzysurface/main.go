@@ -0,0 +1,83 @@
+// fuzzysurface exports the control surface and membership functions of the level engine, the current
+// one (FUZZY_LEVEL_DEFINITION or the built-in definition) unless -definition names another
+//
+// Usage:
+//
+//	go run ./cmd/fuzzysurface -format csv -n 41 > surface.csv
+//	go run ./cmd/fuzzysurface -format svg -out surface.svg
+//	go run ./cmd/fuzzysurface -membership speed_ratio -out speed.svg
+//	go run ./cmd/fuzzysurface -definition learned.json -format svg -out learned.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+)
+
+func main() {
+	format := flag.String("format", "csv", "output format of the surface: csv, json or svg")
+	n := flag.Int("n", fuzzylogic.DefaultGridSize, "number of samples per axis")
+	x := flag.String("x", string(fuzzylogic.ScoreID), "input swept on the x axis")
+	y := flag.String("y", string(fuzzylogic.SpeedRatioID), "input swept on the y axis")
+	membership := flag.String("membership", "", "render the membership functions of this value as svg instead of the surface")
+	out := flag.String("out", "", "output file (stdout by default)")
+	defPath := flag.String("definition", "", "engine definition file (default: the current engine)")
+	flag.Parse()
+
+	engine, err := loadEngine(*defPath)
+	if err != nil {
+		log.Fatalf("Cannot build level engine: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Cannot create output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := run(w, engine, *format, *x, *y, *membership, *n); err != nil {
+		log.Fatalf("fuzzysurface: %v", err)
+	}
+}
+
+func run(w io.Writer, engine *fuzzylogic.LevelEngine, format, x, y, membership string, n int) error {
+	if membership != "" {
+		return engine.RenderMembershipSVG(w, membership, n)
+	}
+
+	s, err := engine.Surface(x, y, n)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "csv":
+		return s.WriteCSV(w)
+	case "json":
+		return s.WriteJSON(w)
+	case "svg":
+		return s.RenderSVG(w, "English level control surface")
+	default:
+		return fmt.Errorf("unknown format %q (expected csv, json or svg)", format)
+	}
+}
+
+// loadEngine builds the engine from a definition file or the current engine if path is empty
+func loadEngine(path string) (*fuzzylogic.LevelEngine, error) {
+	if path == "" {
+		return fuzzylogic.CurrentLevelEngine()
+	}
+	def, err := fuzzylogic.LoadDefinition(path)
+	if err != nil {
+		return nil, err
+	}
+	return fuzzylogic.NewLevelEngine(def)
+}
@@ -0,0 +1,173 @@
+// learnrules learns the rules of the level engine from teacher-confirmed levels (Wang-Mendel)
+// and compares the learned engine with the current one on held-out data
+//
+// Usage:
+//
+//	go run ./cmd/learnrules -out learned.json
+//	go run ./cmd/learnrules -csv samples.csv -holdout 0.3 -report report.json
+//
+// The csv file has a header and the columns: score, speed_ratio, level
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/config"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/learn"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+func main() {
+	csvPath := flag.String("csv", "", "read labelled samples from a csv file instead of the database")
+	holdout := flag.Float64("holdout", 0.2, "ratio of samples held out for the evaluation")
+	seed := flag.Int64("seed", 1, "seed used to split the samples")
+	out := flag.String("out", "learned_level_engine.json", "output definition file")
+	reportPath := flag.String("report", "", "also write the evaluation report as JSON to this file")
+	flag.Parse()
+
+	if *holdout < 0 || *holdout >= 1 {
+		log.Fatalf("holdout shall be in [0 ; 1)")
+	}
+
+	var samples []learn.Sample
+	var err error
+	if *csvPath != "" {
+		samples, err = readCSV(*csvPath)
+	} else {
+		samples, err = readDB()
+	}
+	if err != nil {
+		log.Fatalf("Cannot load samples: %v", err)
+	}
+	log.Printf("Loaded %d labelled samples", len(samples))
+
+	train, test := learn.Split(samples, *holdout, *seed)
+	learned, report, err := learn.Compare(fuzzylogic.LevelDefinition(), train, test, fuzzylogic.LevelLabel)
+	if err != nil {
+		log.Fatalf("Cannot learn rules: %v", err)
+	}
+
+	if err := writeFile(*out, learned.Write); err != nil {
+		log.Fatalf("Cannot write definition: %v", err)
+	}
+	log.Printf("Learned definition written to %s", *out)
+
+	if *reportPath != "" {
+		err := writeFile(*reportPath, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		})
+		if err != nil {
+			log.Fatalf("Cannot write report: %v", err)
+		}
+	}
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatalf("Cannot print report: %v", err)
+	}
+}
+
+// toSample converts a labelled level result into a learning sample
+func toSample(score, speedRatio float64, level string) (learn.Sample, error) {
+	target, ok := fuzzylogic.LevelTargets[level]
+	if !ok {
+		return learn.Sample{}, fmt.Errorf("unknown level %q", level)
+	}
+	return learn.Sample{
+		Inputs: map[string]float64{
+			string(fuzzylogic.ScoreID):      score,
+			string(fuzzylogic.SpeedRatioID): speedRatio,
+		},
+		Output: target,
+		Label:  level,
+	}, nil
+}
+
+// readDB loads the teacher-confirmed levels from test_results_level
+func readDB() ([]learn.Sample, error) {
+	config.Init()
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results, err := repositories.NewLevelRepository(db).GetConfirmedLevelResults(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]learn.Sample, 0, len(results))
+	for _, r := range results {
+		sample, err := toSample(r.Score, services.ResultSpeedRatio(r), *r.ConfirmedLevel)
+		if err != nil {
+			return nil, fmt.Errorf("result %d: %w", r.ID, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// readCSV loads labelled samples from a csv file (score, speed_ratio, level)
+func readCSV(path string) ([]learn.Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s: no samples", path)
+	}
+
+	samples := make([]learn.Sample, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		if len(rec) != 3 {
+			return nil, fmt.Errorf("%s: line %d: expected 3 columns", path, i+2)
+		}
+		score, err := strconv.ParseFloat(rec[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, i+2, err)
+		}
+		speedRatio, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, i+2, err)
+		}
+		sample, err := toSample(score, speedRatio, rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, i+2, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// writeFile creates a file and fills it with the write function
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,58 @@
+// makeadmin gives the admin role to an existing account, to set up the first administrator
+// (accounts cannot register as administrators; administrators then manage roles with /admin/users)
+//
+// Usage:
+//
+//	go run ./cmd/makeadmin -user alice
+//	go run ./cmd/makeadmin -user alice@school.example
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/config"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+func main() {
+	identifier := flag.String("user", "", "username or email of the account")
+	flag.Parse()
+	if *identifier == "" {
+		flag.Usage()
+		log.Fatalf("-user is required")
+	}
+
+	config.Init()
+	db, err := config.GetDB()
+	if err != nil {
+		log.Fatalf("DB connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	userRepo := repositories.NewUserRepository(db)
+	user, err := userRepo.GetUserByUsernameOrEmail(ctx, *identifier)
+	if err != nil {
+		log.Fatalf("Cannot read the user: %v", err)
+	}
+	if user == nil {
+		log.Fatalf("No account %q", *identifier)
+	}
+	if user.Role == models.RoleAdmin {
+		log.Printf("%s is already an administrator", user.Username)
+		return
+	}
+	if err := userRepo.UpdateUserRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		log.Fatalf("Cannot change the role: %v", err)
+	}
+	// Tokens carry the role: the user logs in again to use it
+	if err := repositories.NewSessionRepository(db).RevokeUserSessions(ctx, user.ID, "role changed"); err != nil {
+		log.Fatalf("Cannot revoke the sessions: %v", err)
+	}
+	log.Printf("%s (%s) is now an administrator (was %s)", user.Username, user.Email, user.Role)
+}
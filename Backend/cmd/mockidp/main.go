@@ -0,0 +1,55 @@
+// Command mockidp runs a local OpenID Connect identity provider to try single sign-on
+//
+//	go run ./cmd/mockidp -addr :9000
+//
+// and configure the backend with
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=personalisedenglish
+//	OIDC_MOCK_SCOPES=openid email profile groups
+//	OIDC_MOCK_ROLE_CLAIM=groups
+//	OIDC_MOCK_TEACHER_VALUES=teachers
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL (the address the provider is reached at)")
+	clientID := flag.String("client-id", "personalisedenglish", "client id of the backend")
+	clientSecret := flag.String("client-secret", "", "client secret of the backend (empty: public client)")
+	redirects := flag.String("redirect-uris", "", "comma separated allowed redirect URIs (any if empty)")
+	usersFile := flag.String("users", "", "JSON file of users (sub, email, email_verified, name, preferred_username, groups)")
+	flag.Parse()
+
+	cfg := mockidp.Config{Issuer: *issuer, ClientID: *clientID, ClientSecret: *clientSecret}
+	if *redirects != "" {
+		cfg.RedirectURIs = strings.Split(*redirects, ",")
+	}
+	if *usersFile != "" {
+		data, err := os.ReadFile(*usersFile)
+		if err != nil {
+			log.Fatalf("users: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg.Users); err != nil {
+			log.Fatalf("users: %v", err)
+		}
+	}
+
+	server, err := mockidp.NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Mock identity provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
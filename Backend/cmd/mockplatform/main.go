@@ -0,0 +1,64 @@
+// Command mockplatform runs a local LTI 1.3 platform (LMS) to try launches, Deep Linking and score passback
+//
+//	go run ./cmd/mockplatform -addr :9100
+//
+// and configure the backend with
+//
+//	LTI_PLATFORMS=mock
+//	LTI_MOCK_ISSUER=http://localhost:9100
+//	LTI_MOCK_CLIENT_ID=personalisedenglish
+//	LTI_MOCK_DEPLOYMENT_IDS=mock-deployment
+//	LTI_MOCK_AUTH_URL=http://localhost:9100/auth
+//	LTI_MOCK_JWKS_URL=http://localhost:9100/jwks
+//	LTI_MOCK_TOKEN_URL=http://localhost:9100/token
+//	LTI_MOCK_TRUST_EMAIL=true
+//
+// then open http://localhost:9100, add an activity as the instructor and launch it as a student
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/lti/mockplatform"
+)
+
+func main() {
+	addr := flag.String("addr", ":9100", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9100", "issuer URL (the address the platform is reached at)")
+	clientID := flag.String("client-id", "personalisedenglish", "client id of the tool")
+	deploymentID := flag.String("deployment-id", "mock-deployment", "deployment id of the tool")
+	tool := flag.String("tool", "http://localhost:8080", "public URL of the backend (PUBLIC_API_URL)")
+	usersFile := flag.String("users", "", "JSON file of users (sub, email, name, given_name, family_name, roles)")
+	flag.Parse()
+
+	toolURL := strings.TrimRight(*tool, "/")
+	cfg := mockplatform.Config{
+		Issuer:        *issuer,
+		ClientID:      *clientID,
+		DeploymentID:  *deploymentID,
+		ToolLoginURL:  toolURL + "/lti/login",
+		ToolLaunchURL: toolURL + "/lti/launch",
+		ToolJWKSURL:   toolURL + "/lti/jwks",
+	}
+	if *usersFile != "" {
+		data, err := os.ReadFile(*usersFile)
+		if err != nil {
+			log.Fatalf("users: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg.Users); err != nil {
+			log.Fatalf("users: %v", err)
+		}
+	}
+
+	server, err := mockplatform.NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Mock LTI platform %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
@@ -0,0 +1,155 @@
+// recomputelevels re-evaluates the historical level results with an engine definition
+// By default it only prints the before/after diff; -apply stores the new levels
+// and keeps the previous ones in test_results_level_history
+//
+// Usage:
+//
+//	go run ./cmd/recomputelevels
+//	go run ./cmd/recomputelevels -definition learned.json -report diff.json
+//	go run ./cmd/recomputelevels -definition learned.json -apply
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/config"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+func main() {
+	defPath := flag.String("definition", "", "engine definition file (default: the current engine)")
+	apply := flag.Bool("apply", false, "store the recomputed levels")
+	yes := flag.Bool("yes", false, "do not ask for confirmation before applying")
+	reportPath := flag.String("report", "", "also write the diff report as JSON to this file")
+	flag.Parse()
+
+	engine, err := loadEngine(*defPath)
+	if err != nil {
+		log.Fatalf("Cannot build engine: %v", err)
+	}
+
+	config.Init()
+	db, err := config.GetDB()
+	if err != nil {
+		log.Fatalf("DB connection error: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	// Recomputed levels are not published as level changes (no event bus)
+	levelService := services.NewLevelService(repositories.NewLevelRepository(db), repositories.NewClassroomRepository(db), repositories.NewUserRepository(db), engine, nil)
+
+	report, err := levelService.PlanRecompute(ctx, engine)
+	if err != nil {
+		log.Fatalf("Cannot recompute levels: %v", err)
+	}
+	writeText(os.Stdout, report)
+
+	if *reportPath != "" {
+		if err := writeJSON(*reportPath, report); err != nil {
+			log.Fatalf("Cannot write report: %v", err)
+		}
+	}
+
+	if !*apply {
+		return
+	}
+	if !*yes && !confirm(fmt.Sprintf("Apply engine %s to %d results?", report.EngineVersion, report.Total)) {
+		log.Printf("Aborted")
+		return
+	}
+	if err := levelService.ApplyRecompute(ctx, engine, report); err != nil {
+		log.Fatalf("Cannot apply levels: %v", err)
+	}
+	log.Printf("Levels recomputed with engine %s", report.EngineVersion)
+}
+
+// loadEngine builds the engine from a definition file or the current engine if path is empty
+func loadEngine(path string) (*fuzzylogic.LevelEngine, error) {
+	if path == "" {
+		return fuzzylogic.CurrentLevelEngine()
+	}
+	def, err := fuzzylogic.LoadDefinition(path)
+	if err != nil {
+		return nil, err
+	}
+	return fuzzylogic.NewLevelEngine(def)
+}
+
+// writeText prints the transitions and the results whose level changed
+func writeText(w io.Writer, report *models.RecomputeReport) {
+	fmt.Fprintf(w, "Engine version: %s\n", report.EngineVersion)
+	fmt.Fprintf(w, "Results: %d, changed level: %d\n\n", report.Total, report.Changed)
+
+	fmt.Fprintln(w, "Transitions:")
+	olds := make([]string, 0, len(report.Transitions))
+	for old := range report.Transitions {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		news := make([]string, 0, len(report.Transitions[old]))
+		for n := range report.Transitions[old] {
+			news = append(news, n)
+		}
+		sort.Strings(news)
+		for _, n := range news {
+			fmt.Fprintf(w, "  %-14s -> %-14s %d\n", labelOrNone(old), n, report.Transitions[old][n])
+		}
+	}
+
+	if report.Changed == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nChanged results:")
+	for _, c := range report.Changes {
+		if c.OldLevel == c.NewLevel {
+			continue
+		}
+		fmt.Fprintf(w, "  result %d (user %d): %s -> %s (%.2f)\n",
+			c.ResultID, c.UserID, labelOrNone(c.OldLevel), c.NewLevel, c.NewLevelScore)
+	}
+}
+
+func labelOrNone(level string) string {
+	if level == "" {
+		return "(none)"
+	}
+	return level
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func writeJSON(path string, v any) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,98 @@
+// senddigests queues the weekly progress digests of a week in the email outbox, which the
+// running backend delivers. The backend sends them by itself every Monday; this command
+// sends a week again (the digests already queued are not sent twice) or the digest of one user,
+// whether or not they turned digests off
+//
+// Usage:
+//
+//	go run ./cmd/senddigests
+//	go run ./cmd/senddigests -week 2026-10-12
+//	go run ./cmd/senddigests -week 2026-10-12 -user alice
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/config"
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/services"
+)
+
+func main() {
+	week := flag.String("week", "", "a day of the week to send, YYYY-MM-DD (default: last week)")
+	identifier := flag.String("user", "", "only send the digest of this username or email")
+	flag.Parse()
+
+	weekStart := services.WeekStart(time.Now()).AddDate(0, 0, -7)
+	if *week != "" {
+		day, err := time.Parse("2006-01-02", *week)
+		if err != nil {
+			log.Fatalf("Invalid -week: %v", err)
+		}
+		weekStart = services.WeekStart(day)
+	}
+
+	config.Init()
+	db, err := config.GetDB()
+	if err != nil {
+		log.Fatalf("DB connection error: %v", err)
+	}
+	defer db.Close()
+
+	// The unsubscribe links are signed like the backend signs them
+	secret := []byte(os.Getenv("EMAIL_VERIFICATION_SECRET"))
+	if len(secret) == 0 {
+		secret = []byte(os.Getenv("JWT_SECRET"))
+	}
+	if len(secret) == 0 {
+		log.Fatalf("EMAIL_VERIFICATION_SECRET or JWT_SECRET must be set")
+	}
+	publicURL := os.Getenv("PUBLIC_API_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + os.Getenv("SERVER_PORT")
+	}
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	templates, err := mail.LoadTemplates()
+	if err != nil {
+		log.Fatalf("Email templates error: %v", err)
+	}
+	emailService := services.NewEmailService(repositories.NewEmailOutboxRepository(db), templates)
+	notificationService := services.NewNotificationService(repositories.NewNotificationRepository(db), secret, publicURL)
+	digestService := services.NewDigestService(repositories.NewDigestRepository(db), emailService, notificationService, frontendURL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	if *identifier == "" {
+		queued, err := digestService.SendWeeklyDigests(ctx, weekStart)
+		if err != nil {
+			log.Fatalf("Cannot send the digests: %v", err)
+		}
+		log.Printf("%d digest(s) queued for the week of %s", queued, weekStart.Format("2006-01-02"))
+		return
+	}
+
+	user, err := repositories.NewUserRepository(db).GetUserByUsernameOrEmail(ctx, *identifier)
+	if err != nil {
+		log.Fatalf("Cannot read the user: %v", err)
+	}
+	if user == nil {
+		log.Fatalf("No account %q", *identifier)
+	}
+	sent, err := digestService.SendDigest(ctx, user, weekStart)
+	if err != nil {
+		log.Fatalf("Cannot send the digest: %v", err)
+	}
+	if !sent {
+		log.Printf("Nothing to report to %s for the week of %s", user.Username, weekStart.Format("2006-01-02"))
+		return
+	}
+	log.Printf("Digest of %s queued for the week of %s", user.Username, weekStart.Format("2006-01-02"))
+}
@@ -0,0 +1,69 @@
+// webhookreceiver is a webhook endpoint for development: it checks the signature of the
+// webhook requests and prints their events. It also shows how a school's system verifies them.
+// Run the backend with WEBHOOK_ALLOW_INSECURE=true to deliver to it over http on localhost.
+//
+// Usage:
+//
+//	go run ./cmd/webhookreceiver -secret whsec_...
+//	go run ./cmd/webhookreceiver -addr :9100 -secret whsec_... -fail 3
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", ":9100", "address to listen on")
+	secret := flag.String("secret", "", "the secret of the webhook subscription")
+	fail := flag.Int("fail", 0, "answer 503 to this many requests first, to watch the retries")
+	flag.Parse()
+	if *secret == "" {
+		log.Fatal("-secret is required")
+	}
+
+	var mu sync.Mutex
+	seen := map[string]bool{} // event ids, to spot retries and redeliveries
+	failures := *fail
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil || r.Method != http.MethodPost {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := webhooks.Verify(*secret, r.Header.Get(webhooks.SignatureHeader), body, 5*time.Minute, time.Now()); err != nil {
+			log.Printf("Rejected %s: %v", r.Header.Get(webhooks.EventHeader), err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			log.Printf("Failing %s on purpose (%d failure(s) left)", r.Header.Get(webhooks.EventHeader), failures)
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		id := r.Header.Get(webhooks.DeliveryHeader)
+		again := ""
+		if seen[id] {
+			again = " (seen before)"
+		}
+		seen[id] = true
+		var pretty bytes.Buffer
+		json.Indent(&pretty, body, "", "  ")
+		log.Printf("%s %s%s\n%s", r.Header.Get(webhooks.EventHeader), id, again, pretty.String())
+		w.Write([]byte("ok"))
+	})
+	log.Printf("Webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
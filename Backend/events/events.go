@@ -0,0 +1,138 @@
+// Package events carries the domain events of the services (a test assigned, a student
+// joining a classroom, ...) to the subsystems reacting to them, such as notifications
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of domain events
+const (
+	TestAssigned       = "test.assigned"             // ClassroomTest
+	TestUnassigned     = "test.unassigned"           // ClassroomTest
+	TestUpdated        = "test.updated"              // TestChange
+	TestDeleted        = "test.deleted"              // TestChange
+	TestCompleted      = "test.completed"            // TestResult, a classroom test submitted
+	ClassroomJoined    = "classroom.joined"          // ClassroomMember
+	StudentRemoved     = "classroom.student_removed" // ClassroomMember
+	PlacementCompleted = "placement.completed"       // LevelResult, a placement or personalized test scored by the level engine
+	LevelChanged       = "level.changed"             // LevelChange, by a new result or a teacher confirming another level
+)
+
+// Event is something that happened, with a payload depending on its type
+type Event struct {
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// ClassroomTest is a test assigned to or removed from a classroom
+type ClassroomTest struct {
+	ClassroomID int    `json:"classroom_id"`
+	Classroom   string `json:"classroom"`
+	TeacherID   int    `json:"teacher_id"`
+	TestID      int    `json:"test_id"`
+	Test        string `json:"test"`
+	StudentIDs  []int  `json:"student_ids"` // the members of the classroom
+}
+
+// TestChange is a test of a teacher changed or deleted
+type TestChange struct {
+	TestID     int    `json:"test_id"`
+	Test       string `json:"test"`
+	TeacherID  int    `json:"teacher_id"`
+	StudentIDs []int  `json:"student_ids"` // the students it is assigned to
+}
+
+// TestResult is a classroom test completed by a student
+type TestResult struct {
+	ResultID       int     `json:"result_id"`
+	TestID         int     `json:"test_id"`
+	Test           string  `json:"test"`
+	TeacherID      int     `json:"teacher_id"`
+	StudentID      int     `json:"student_id"`
+	Student        string  `json:"student"`
+	Score          float64 `json:"score"`
+	CorrectAnswers int     `json:"correct_answers"`
+	TotalQuestions int     `json:"total_questions"`
+}
+
+// ClassroomMember is a student joining or removed from a classroom
+type ClassroomMember struct {
+	ClassroomID int    `json:"classroom_id"`
+	Classroom   string `json:"classroom"`
+	TeacherID   int    `json:"teacher_id"`
+	StudentID   int    `json:"student_id"`
+	Student     string `json:"student"`
+}
+
+// LevelResult is a test of a student scored by the level engine
+type LevelResult struct {
+	ResultID   int       `json:"result_id"`
+	StudentID  int       `json:"student_id"`
+	Student    string    `json:"student"`
+	TestType   string    `json:"test_type"`
+	Score      float64   `json:"score"`
+	Level      string    `json:"level"`
+	LevelScore *float64  `json:"level_score,omitempty"`
+	TakenAt    time.Time `json:"taken_at"`
+}
+
+// LevelChange is the level of a student changed, from the level of their previous result
+type LevelChange struct {
+	ResultID    int    `json:"result_id"` // the result bringing the new level
+	StudentID   int    `json:"student_id"`
+	Student     string `json:"student"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	ConfirmedBy *int   `json:"confirmed_by,omitempty"` // the teacher, when the level was confirmed
+}
+
+// Handler reacts to an event; it runs in the request that published the event and should be quick
+type Handler func(ctx context.Context, e Event)
+
+// Bus delivers the published events to every subscribed handler, in the order they subscribed
+// A nil *Bus drops the events
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler for all the events
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish delivers an event to the handlers
+// A failing handler cannot fail the change that happened: it logs its errors, and its panics are recovered
+func (b *Bus) Publish(ctx context.Context, eventType string, data any) {
+	if b == nil {
+		return
+	}
+	e := Event{Type: eventType, OccurredAt: time.Now(), Data: data}
+	// The change is done: the handlers finish even if the client went away
+	ctx = context.WithoutCancel(ctx)
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("events: handler of %s panicked: %v", e.Type, r)
+				}
+			}()
+			h(ctx, e)
+		}()
+	}
+}
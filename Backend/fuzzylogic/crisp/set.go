@@ -67,6 +67,16 @@ func (set Set) Values() []float64 {
 	return result
 }
 
+// Min returns the lower bound of the interval
+func (set Set) Min() float64 {
+	return set.xmin
+}
+
+// Max returns the upper bound of the interval
+func (set Set) Max() float64 {
+	return set.xmax
+}
+
 // N creates a new set with a new number of values
 func (set Set) N(n int) (Set, error) {
 	return NewSetN(set.xmin, set.xmax, n)
@@ -0,0 +1,252 @@
+package fuzzylogic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/builder"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/crisp"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/id"
+)
+
+// EngineDefinition is a serializable description of a Mamdani engine
+// It can be written to / read from a JSON definition file
+type EngineDefinition struct {
+	Name   string     `json:"name"`
+	Inputs []ValueDef `json:"inputs"`
+	Output ValueDef   `json:"output"`
+	Rules  []RuleDef  `json:"rules"`
+}
+
+// ValueDef describes a fuzzy value: its universe and its sets
+type ValueDef struct {
+	ID   string   `json:"id"`
+	Min  float64  `json:"min"`
+	Max  float64  `json:"max"`
+	Step float64  `json:"step"`
+	Sets []SetDef `json:"sets"`
+}
+
+// SetDef describes a membership function
+// Type is one of the fuzzy set names (tri, trap, step-up, step-down, gauss, gbell, sig)
+type SetDef struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Params []float64 `json:"params"`
+}
+
+// RuleDef describes a rule: if <input_1 is set_1> and ... and <input_n is set_n> then <output is set>
+// Degree and Support are only filled for learned rules
+type RuleDef struct {
+	If      map[string]string `json:"if"`
+	Then    string            `json:"then"`
+	Degree  float64           `json:"degree,omitempty"`
+	Support int               `json:"support,omitempty"`
+}
+
+// LevelDefinition returns the hand-written definition of the English level engine
+func LevelDefinition() EngineDefinition {
+	score, speed, level := string(ScoreID), string(SpeedRatioID), string(EnglishLevelID)
+	rule := func(s, t, l string) RuleDef {
+		return RuleDef{If: map[string]string{score: s, speed: t}, Then: l}
+	}
+	return EngineDefinition{
+		Name: "english_level",
+		Inputs: []ValueDef{
+			{
+				// Score (0-100, discrete steps of 1)
+				ID: score, Min: 0, Max: 100, Step: 1,
+				Sets: []SetDef{
+					{ID: "low", Type: fuzzy.TRI, Params: []float64{0, 20, 40}},     // Low: 0-40
+					{ID: "medium", Type: fuzzy.TRI, Params: []float64{30, 50, 70}}, // Medium: 30-70
+					{ID: "high", Type: fuzzy.TRI, Params: []float64{60, 80, 100}},  // High: 60-100
+				},
+			},
+			{
+				// Speed ratio (0-2.5, steps of 0.05): response time over the expected time of the questions
+				// 1 is the expected pace; the sets scale the seconds of an 8s question (timing.ReferenceSeconds)
+				ID: speed, Min: 0, Max: 2.5, Step: 0.05,
+				Sets: []SetDef{
+					{ID: "slow", Type: fuzzy.STEPUP, Params: []float64{1.25, 2.5}},  // Slow: 1.25+
+					{ID: "normal", Type: fuzzy.TRI, Params: []float64{0.5, 1, 1.5}}, // Normal: 0.5-1.5
+					{ID: "fast", Type: fuzzy.STEPDOWN, Params: []float64{0, 0.625}}, // Fast: 0-0.625
+				},
+			},
+		},
+		Output: ValueDef{
+			// Output Level (0-100)
+			ID: level, Min: 0, Max: 100, Step: 1,
+			Sets: []SetDef{
+				{ID: "beginner", Type: fuzzy.TRI, Params: []float64{0, 20, 40}},      // Beginner: 0-40
+				{ID: "intermediate", Type: fuzzy.TRI, Params: []float64{30, 50, 70}}, // Intermediate: 30-70
+				{ID: "advanced", Type: fuzzy.TRI, Params: []float64{60, 80, 100}},    // Advanced: 60-100
+			},
+		},
+		// Score is more important than time: even with slow time, a high score is advanced
+		Rules: []RuleDef{
+			rule("low", "slow", "beginner"),
+			rule("low", "normal", "beginner"),
+			rule("low", "fast", "beginner"),
+			rule("medium", "slow", "intermediate"),
+			rule("medium", "normal", "intermediate"),
+			rule("medium", "fast", "intermediate"),
+			rule("high", "slow", "advanced"),
+			rule("high", "normal", "advanced"),
+			rule("high", "fast", "advanced"),
+		},
+	}
+}
+
+// LoadDefinition reads a JSON definition file
+func LoadDefinition(path string) (EngineDefinition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return EngineDefinition{}, err
+	}
+	defer f.Close()
+	return ReadDefinition(f)
+}
+
+// ReadDefinition decodes a JSON definition
+func ReadDefinition(r io.Reader) (EngineDefinition, error) {
+	var def EngineDefinition
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return EngineDefinition{}, fmt.Errorf("definition: %w", err)
+	}
+	return def, nil
+}
+
+// Write encodes the definition as indented JSON
+func (def EngineDefinition) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(def)
+}
+
+// NewSetBuilder converts a set definition into a fuzzy set builder
+func (sd SetDef) NewSetBuilder() (fuzzy.SetBuilder, error) {
+	expected := map[string]int{
+		fuzzy.GAUSS:    2,
+		fuzzy.GBELL:    3,
+		fuzzy.TRAP:     4,
+		fuzzy.TRI:      3,
+		fuzzy.STEPUP:   2,
+		fuzzy.STEPDOWN: 2,
+		fuzzy.SIG:      2,
+	}
+	n, ok := expected[sd.Type]
+	if !ok {
+		return nil, fmt.Errorf("set `%s`: unknown type `%s`", sd.ID, sd.Type)
+	}
+	if len(sd.Params) != n {
+		return nil, fmt.Errorf("set `%s`: %s expects %d params (found %d)", sd.ID, sd.Type, n, len(sd.Params))
+	}
+	p := sd.Params
+	switch sd.Type {
+	case fuzzy.GAUSS:
+		return fuzzy.Gauss{Sigma: p[0], C: p[1]}, nil
+	case fuzzy.GBELL:
+		return fuzzy.Gbell{A: p[0], B: p[1], C: p[2]}, nil
+	case fuzzy.TRAP:
+		return fuzzy.Trapezoid{A: p[0], B: p[1], C: p[2], D: p[3]}, nil
+	case fuzzy.TRI:
+		return fuzzy.Triangular{A: p[0], B: p[1], C: p[2]}, nil
+	case fuzzy.STEPUP:
+		return fuzzy.StepUp{A: p[0], B: p[1]}, nil
+	case fuzzy.STEPDOWN:
+		return fuzzy.StepDown{A: p[0], B: p[1]}, nil
+	default:
+		return fuzzy.Sigmoid{A: p[0], C: p[1]}, nil
+	}
+}
+
+// NewIDVal builds the fuzzy value described by the definition
+func (vd ValueDef) NewIDVal() (*fuzzy.IDVal, error) {
+	universe, err := crisp.NewSet(vd.Min, vd.Max, vd.Step)
+	if err != nil {
+		return nil, fmt.Errorf("value `%s`: %w", vd.ID, err)
+	}
+	builders := make(map[id.ID]fuzzy.SetBuilder, len(vd.Sets))
+	for _, sd := range vd.Sets {
+		sb, err := sd.NewSetBuilder()
+		if err != nil {
+			return nil, fmt.Errorf("value `%s`: %w", vd.ID, err)
+		}
+		builders[id.ID(sd.ID)] = sb
+	}
+	sets, err := fuzzy.NewIDSets(builders)
+	if err != nil {
+		return nil, fmt.Errorf("value `%s`: %w", vd.ID, err)
+	}
+	return fuzzy.NewIDVal(id.ID(vd.ID), universe, sets)
+}
+
+// Values builds the input values and the output value of the definition
+func (def EngineDefinition) Values() ([]*fuzzy.IDVal, *fuzzy.IDVal, error) {
+	inputs := make([]*fuzzy.IDVal, len(def.Inputs))
+	for i, vd := range def.Inputs {
+		val, err := vd.NewIDVal()
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs[i] = val
+	}
+	output, err := def.Output.NewIDVal()
+	if err != nil {
+		return nil, nil, err
+	}
+	return inputs, output, nil
+}
+
+// FuzzyLogic fills a Mamdani rules builder with the rules of the definition, using the given values
+func (def EngineDefinition) FuzzyLogic(inputs []*fuzzy.IDVal, output *fuzzy.IDVal) (builder.FuzzyLogic, error) {
+	fl := builder.Mamdani().FuzzyLogic()
+	for i, rd := range def.Rules {
+		var premises []fuzzy.Premise
+		for _, in := range inputs {
+			name, ok := rd.If[string(in.ID())]
+			if !ok {
+				continue // input not used by this rule
+			}
+			set, ok := in.Fetch(id.ID(name))
+			if !ok {
+				return builder.FuzzyLogic{}, fmt.Errorf("rule %d: unknown set `%s` for `%s`", i, name, in.ID())
+			}
+			premises = append(premises, set)
+		}
+		if len(premises) == 0 || len(premises) != len(rd.If) {
+			return builder.FuzzyLogic{}, fmt.Errorf("rule %d: premises do not match the inputs", i)
+		}
+		then, ok := output.Fetch(id.ID(rd.Then))
+		if !ok {
+			return builder.FuzzyLogic{}, fmt.Errorf("rule %d: unknown output set `%s`", i, rd.Then)
+		}
+
+		exp := fl.If(premises[0])
+		for _, premise := range premises[1:] {
+			exp = exp.And(premise)
+		}
+		exp.Then(then)
+	}
+	return fl, nil
+}
+
+// Build creates the engine and its values from the definition
+func (def EngineDefinition) Build() (fuzzy.Engine, []*fuzzy.IDVal, *fuzzy.IDVal, error) {
+	inputs, output, err := def.Values()
+	if err != nil {
+		return fuzzy.Engine{}, nil, nil, err
+	}
+	fl, err := def.FuzzyLogic(inputs, output)
+	if err != nil {
+		return fuzzy.Engine{}, nil, nil, err
+	}
+	engine, err := fl.Engine()
+	if err != nil {
+		return fuzzy.Engine{}, nil, nil, err
+	}
+	return engine, inputs, output, nil
+}
@@ -2,6 +2,7 @@ package fuzzy
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/crisp"
 	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/id"
@@ -19,6 +20,16 @@ func (is IDSet) ID() id.ID {
 	return is.uuid
 }
 
+// Set returns the membership function
+func (is IDSet) Set() Set {
+	return is.set
+}
+
+// Parent returns the IDVal owning the set
+func (is IDSet) Parent() *IDVal {
+	return is.parent
+}
+
 // Evaluate fetches the right input and returns the Set value
 func (is IDSet) Evaluate(input DataInput) (float64, error) {
 	x, err := input.value(is)
@@ -97,3 +108,15 @@ func (iv IDVal) Fetch(name id.ID) (IDSet, bool) {
 	idSet, ok := iv.idSets[name]
 	return idSet, ok
 }
+
+// Sets lists all fuzzy sets of the value, sorted by identifier
+func (iv IDVal) Sets() []IDSet {
+	result := make([]IDSet, 0, len(iv.idSets))
+	for _, idSet := range iv.idSets {
+		result = append(result, idSet)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].uuid < result[j].uuid
+	})
+	return result
+}
@@ -0,0 +1,166 @@
+package learn
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+)
+
+// Split shuffles the samples (deterministically for a given seed) and holds out a ratio of them
+// Returns the training and the held-out samples
+func Split(samples []Sample, holdout float64, seed int64) ([]Sample, []Sample) {
+	shuffled := make([]Sample, len(samples))
+	copy(shuffled, samples)
+	rnd := rand.New(rand.NewSource(seed))
+	rnd.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	n := int(math.Round(float64(len(shuffled)) * holdout))
+	return shuffled[n:], shuffled[:n]
+}
+
+// Metrics measures how well an engine predicts the samples
+type Metrics struct {
+	N         int                       `json:"n"`
+	Accuracy  float64                   `json:"accuracy"`  // ratio of samples with the expected label
+	MAE       float64                   `json:"mae"`       // mean absolute error of the crisp output
+	Confusion map[string]map[string]int `json:"confusion"` // expected label -> predicted label -> count
+}
+
+// Evaluate runs the engine described by the definition on every sample
+// label maps a crisp output to a label (e.g. fuzzylogic.LevelLabel)
+func Evaluate(def fuzzylogic.EngineDefinition, samples []Sample, label func(float64) string) (Metrics, error) {
+	engine, inputs, output, err := def.Build()
+	if err != nil {
+		return Metrics{}, err
+	}
+
+	m := Metrics{N: len(samples), Confusion: make(map[string]map[string]int)}
+	if len(samples) == 0 {
+		return m, nil
+	}
+
+	var correct int
+	var absErr float64
+	for i, sample := range samples {
+		input := make(fuzzy.DataInput, len(inputs))
+		for _, in := range inputs {
+			x, ok := sample.Inputs[string(in.ID())]
+			if !ok {
+				return Metrics{}, fmt.Errorf("evaluate: sample %d: missing input `%s`", i, in.ID())
+			}
+			input[in] = x
+		}
+		out, err := engine.Evaluate(input)
+		if err != nil {
+			return Metrics{}, err
+		}
+		y := out[output]
+		absErr += math.Abs(y - sample.Output)
+
+		predicted := label(y)
+		if predicted == sample.Label {
+			correct++
+		}
+		if m.Confusion[sample.Label] == nil {
+			m.Confusion[sample.Label] = make(map[string]int)
+		}
+		m.Confusion[sample.Label][predicted]++
+	}
+	m.Accuracy = float64(correct) / float64(len(samples))
+	m.MAE = absErr / float64(len(samples))
+	return m, nil
+}
+
+// Report compares the current engine and a learned engine on held-out data
+type Report struct {
+	Train        int     `json:"train_samples"`
+	Holdout      int     `json:"holdout_samples"`
+	LearnedRules int     `json:"learned_rules"`
+	Current      Metrics `json:"current"`
+	Learned      Metrics `json:"learned"`
+}
+
+// Compare learns a rule base on the training samples and evaluates both engines on the held-out samples
+// The learned definition reuses the sets of the current one
+func Compare(current fuzzylogic.EngineDefinition, train, holdout []Sample, label func(float64) string) (fuzzylogic.EngineDefinition, Report, error) {
+	learned, err := WangMendel(current, train)
+	if err != nil {
+		return fuzzylogic.EngineDefinition{}, Report{}, err
+	}
+	report := Report{
+		Train:        len(train),
+		Holdout:      len(holdout),
+		LearnedRules: len(learned.Rules),
+	}
+	if report.Current, err = Evaluate(current, holdout, label); err != nil {
+		return fuzzylogic.EngineDefinition{}, Report{}, err
+	}
+	if report.Learned, err = Evaluate(learned, holdout, label); err != nil {
+		return fuzzylogic.EngineDefinition{}, Report{}, err
+	}
+	return learned, report, nil
+}
+
+// WriteText prints a human readable version of the report
+func (r Report) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "Samples: %d training, %d held out\nLearned rules: %d\n\n", r.Train, r.Holdout, r.LearnedRules)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%-10s %10s %10s\n%-10s %9.1f%% %9.1f%%\n%-10s %10.2f %10.2f\n\n",
+		"", "current", "learned",
+		"accuracy", r.Current.Accuracy*100, r.Learned.Accuracy*100,
+		"mae", r.Current.MAE, r.Learned.MAE)
+	if err != nil {
+		return err
+	}
+	for _, section := range []struct {
+		name string
+		m    Metrics
+	}{{"current", r.Current}, {"learned", r.Learned}} {
+		if err := writeConfusion(w, section.name, section.m.Confusion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConfusion prints a confusion matrix (rows: expected, columns: predicted)
+func writeConfusion(w io.Writer, name string, confusion map[string]map[string]int) error {
+	labelSet := make(map[string]struct{})
+	for expected, row := range confusion {
+		labelSet[expected] = struct{}{}
+		for predicted := range row {
+			labelSet[predicted] = struct{}{}
+		}
+	}
+	labels := make([]string, 0, len(labelSet))
+	for l := range labelSet {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+
+	if _, err := fmt.Fprintf(w, "Confusion matrix (%s), rows: expected, columns: predicted\n%-14s", name, ""); err != nil {
+		return err
+	}
+	for _, l := range labels {
+		fmt.Fprintf(w, "%14s", l)
+	}
+	fmt.Fprintln(w)
+	for _, expected := range labels {
+		fmt.Fprintf(w, "%-14s", expected)
+		for _, predicted := range labels {
+			fmt.Fprintf(w, "%14d", confusion[expected][predicted])
+		}
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
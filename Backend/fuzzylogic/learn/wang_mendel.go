@@ -0,0 +1,112 @@
+package learn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+)
+
+// Sample is a labelled observation
+type Sample struct {
+	Inputs map[string]float64 // crisp inputs by value id
+	Output float64            // expected crisp output
+	Label  string             // expected output label (optional, used for accuracy)
+}
+
+// candidate is the best rule found so far for an antecedent
+type candidate struct {
+	rule    fuzzylogic.RuleDef
+	key     string
+	support int
+}
+
+// WangMendel induces a rule base from samples using the sets of the given definition
+// https://doi.org/10.1109/21.199466
+//
+// The algo is:
+//
+//   - For each sample, pick for every input (and the output) the set with the highest membership
+//   - The rule degree is the product of these memberships
+//   - Samples sharing the same antecedent are in conflict: the rule with the highest degree wins
+//
+// Returns a copy of the definition where the rules are replaced by the learned ones
+// Support is the number of samples sharing the antecedent of the rule
+func WangMendel(def fuzzylogic.EngineDefinition, samples []Sample) (fuzzylogic.EngineDefinition, error) {
+	if len(samples) == 0 {
+		return fuzzylogic.EngineDefinition{}, errors.New("wang-mendel: no samples")
+	}
+	inputs, output, err := def.Values()
+	if err != nil {
+		return fuzzylogic.EngineDefinition{}, err
+	}
+
+	best := make(map[string]*candidate)
+	for i, sample := range samples {
+		degree := 1.0
+		antecedent := make(map[string]string, len(inputs))
+		parts := make([]string, len(inputs))
+		for k, in := range inputs {
+			x, ok := sample.Inputs[string(in.ID())]
+			if !ok {
+				return fuzzylogic.EngineDefinition{}, fmt.Errorf("wang-mendel: sample %d: missing input `%s`", i, in.ID())
+			}
+			name, mu := maxMembership(in, x)
+			degree *= mu
+			antecedent[string(in.ID())] = name
+			parts[k] = name
+		}
+		then, mu := maxMembership(output, sample.Output)
+		degree *= mu
+		if degree == 0 {
+			continue // the sample is not covered by the sets
+		}
+
+		key := strings.Join(parts, "|")
+		c, exists := best[key]
+		if !exists {
+			c = &candidate{key: key}
+			best[key] = c
+		}
+		c.support++
+		if !exists || degree > c.rule.Degree {
+			c.rule = fuzzylogic.RuleDef{If: antecedent, Then: then, Degree: degree}
+		}
+	}
+	if len(best) == 0 {
+		return fuzzylogic.EngineDefinition{}, errors.New("wang-mendel: no sample is covered by the fuzzy sets")
+	}
+
+	// Sort rules by antecedent for a stable output
+	candidates := make([]*candidate, 0, len(best))
+	for _, c := range best {
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].key < candidates[j].key
+	})
+
+	learned := def
+	learned.Name = def.Name + "_learned"
+	learned.Rules = make([]fuzzylogic.RuleDef, len(candidates))
+	for i, c := range candidates {
+		c.rule.Support = c.support
+		learned.Rules[i] = c.rule
+	}
+	return learned, nil
+}
+
+// maxMembership returns the set with the highest membership for x (first one by id on ties)
+func maxMembership(val *fuzzy.IDVal, x float64) (string, float64) {
+	var name string
+	var mu float64
+	for _, idSet := range val.Sets() {
+		if y := idSet.Set()(x); y > mu {
+			name, mu = string(idSet.ID()), y
+		}
+	}
+	return name, mu
+}
@@ -0,0 +1,105 @@
+package fuzzylogic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+)
+
+// LevelEngine is a built level engine along with its definition and version
+type LevelEngine struct {
+	def      EngineDefinition
+	version  string
+	engine   fuzzy.Engine
+	scoreVal *fuzzy.IDVal
+	timeVal  *fuzzy.IDVal
+	levelVal *fuzzy.IDVal
+}
+
+// LevelEvaluation is the outcome of a level engine evaluation
+type LevelEvaluation struct {
+	Level         string  // Beginner, Intermediate or Advanced
+	LevelScore    float64 // raw defuzzified value (0-100)
+	EngineVersion string  // version of the engine which produced the level
+}
+
+// Version returns the content hash of the definition
+// Two definitions with the same sets and rules share the same version
+func (def EngineDefinition) Version() (string, error) {
+	// encoding/json sorts map keys, so the encoding is canonical
+	content, err := json.Marshal(def)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// NewLevelEngine builds a versioned level engine from a definition
+func NewLevelEngine(def EngineDefinition) (*LevelEngine, error) {
+	version, err := def.Version()
+	if err != nil {
+		return nil, err
+	}
+	engine, scoreVal, timeVal, levelVal, err := BuildLevelEngine(def)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelEngine{
+		def:      def,
+		version:  version,
+		engine:   engine,
+		scoreVal: scoreVal,
+		timeVal:  timeVal,
+		levelVal: levelVal,
+	}, nil
+}
+
+// CurrentLevelEngine builds the engine used by the application
+// The definition file given by FUZZY_LEVEL_DEFINITION is used if set, LevelDefinition otherwise
+func CurrentLevelEngine() (*LevelEngine, error) {
+	path := os.Getenv("FUZZY_LEVEL_DEFINITION")
+	if path == "" {
+		return NewLevelEngine(LevelDefinition())
+	}
+	def, err := LoadDefinition(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s: %w", path, err)
+	}
+	return NewLevelEngine(def)
+}
+
+// Version returns the content hash of the engine definition
+func (le *LevelEngine) Version() string {
+	return le.version
+}
+
+// Definition returns the definition the engine was built from
+func (le *LevelEngine) Definition() EngineDefinition {
+	return le.def
+}
+
+// Evaluate runs the engine and maps the output to a level string
+// speedRatio is the response time over the expected time of the questions (1 = expected pace)
+func (le *LevelEngine) Evaluate(score, speedRatio float64) (LevelEvaluation, error) {
+	output, err := le.engine.Evaluate(fuzzy.DataInput{
+		le.scoreVal: score,
+		le.timeVal:  speedRatio,
+	})
+	if err != nil {
+		return LevelEvaluation{}, err
+	}
+	levelScore, ok := output[le.levelVal]
+	if !ok {
+		return LevelEvaluation{}, fmt.Errorf("no output level found")
+	}
+	return LevelEvaluation{
+		Level:         LevelLabel(levelScore),
+		LevelScore:    levelScore,
+		EngineVersion: le.version,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package surface
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/id"
+)
+
+// Surface is the output of an engine sampled over a grid of two inputs
+// Z[i][j] is the output for X[j] and Y[i]
+type Surface struct {
+	XID id.ID       `json:"x_id"`
+	YID id.ID       `json:"y_id"`
+	ZID id.ID       `json:"z_id"`
+	X   []float64   `json:"x"`
+	Y   []float64   `json:"y"`
+	Z   [][]float64 `json:"z"`
+}
+
+// Sweep evaluates the engine over a nx * ny grid spanning the universes of x and y
+//   - out is the engine output to record
+//   - fixed gives the crisp values of the remaining inputs (may be nil)
+func Sweep(eng fuzzy.Engine, x, y, out *fuzzy.IDVal, nx, ny int, fixed fuzzy.DataInput) (Surface, error) {
+	if x == nil || y == nil || out == nil {
+		return Surface{}, fmt.Errorf("surface: x, y and output values are required")
+	}
+	if x == y {
+		return Surface{}, fmt.Errorf("surface: x and y shall be different inputs")
+	}
+
+	// Check that x and y are really inputs of the engine
+	in, _ := eng.IO()
+	inputs := fuzzy.IDSets(in).IDVals()
+	for _, v := range []*fuzzy.IDVal{x, y} {
+		if _, ok := inputs[v]; !ok {
+			return Surface{}, fmt.Errorf("surface: `%s` is not an input of the engine", v.ID())
+		}
+	}
+
+	xu, err := x.U().N(nx)
+	if err != nil {
+		return Surface{}, fmt.Errorf("surface: x axis: %w", err)
+	}
+	yu, err := y.U().N(ny)
+	if err != nil {
+		return Surface{}, fmt.Errorf("surface: y axis: %w", err)
+	}
+
+	result := Surface{
+		XID: x.ID(),
+		YID: y.ID(),
+		ZID: out.ID(),
+		X:   xu.Values(),
+		Y:   yu.Values(),
+	}
+	result.Z = make([][]float64, len(result.Y))
+
+	// Prepare a reusable input with the fixed values
+	input := make(fuzzy.DataInput, len(fixed)+2)
+	for k, v := range fixed {
+		input[k] = v
+	}
+
+	for i, yv := range result.Y {
+		row := make([]float64, len(result.X))
+		for j, xv := range result.X {
+			input[x] = xv
+			input[y] = yv
+			output, err := eng.Evaluate(input)
+			if err != nil {
+				return Surface{}, err
+			}
+			z, ok := output[out]
+			if !ok {
+				return Surface{}, fmt.Errorf("surface: output `%s` not produced by the engine", out.ID())
+			}
+			row[j] = z
+		}
+		result.Z[i] = row
+	}
+	return result, nil
+}
+
+// Range returns the minimum and maximum output values
+func (s Surface) Range() (float64, float64) {
+	var zmin, zmax float64
+	first := true
+	for _, row := range s.Z {
+		for _, z := range row {
+			if first || z < zmin {
+				zmin = z
+			}
+			if first || z > zmax {
+				zmax = z
+			}
+			first = false
+		}
+	}
+	return zmin, zmax
+}
+
+// WriteCSV writes the surface in long format: one `x,y,z` line per grid point
+func (s Surface) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{string(s.XID), string(s.YID), string(s.ZID)}); err != nil {
+		return err
+	}
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	for i, yv := range s.Y {
+		for j, xv := range s.X {
+			if err := cw.Write([]string{format(xv), format(yv), format(s.Z[i][j])}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the surface as a JSON document
+func (s Surface) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
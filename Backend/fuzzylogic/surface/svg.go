@@ -0,0 +1,203 @@
+package surface
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+)
+
+// Plot layout (in pixels)
+const (
+	plotWidth   = 480
+	plotHeight  = 360
+	marginLeft  = 60
+	marginRight = 110
+	marginTop   = 30
+	marginBot   = 50
+	tickCount   = 5
+)
+
+// palette used to draw the membership functions
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2"}
+
+// svgWriter wraps a buffered writer and keeps the first error
+type svgWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (sw *svgWriter) printf(format string, args ...any) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = fmt.Fprintf(sw.w, format, args...)
+}
+
+func (sw *svgWriter) flush() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	return sw.w.Flush()
+}
+
+// header opens the svg document and draws the title
+func (sw *svgWriter) header(title string) {
+	width := marginLeft + plotWidth + marginRight
+	height := marginTop + plotHeight + marginBot
+	sw.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	sw.printf(`<rect width="100%%" height="100%%" fill="white"/>` + "\n")
+	sw.printf(`<text x="%d" y="%d" font-size="14" text-anchor="middle">%s</text>`+"\n", marginLeft+plotWidth/2, marginTop-10, html.EscapeString(title))
+}
+
+// axes draws the plot frame, ticks and labels
+func (sw *svgWriter) axes(xmin, xmax, ymin, ymax float64, xLabel, yLabel string) {
+	sw.printf(`<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", marginLeft, marginTop, plotWidth, plotHeight)
+	for i := 0; i <= tickCount; i++ {
+		k := float64(i) / tickCount
+		xv := xmin + k*(xmax-xmin)
+		px := marginLeft + k*plotWidth
+		sw.printf(`<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="black"/>`+"\n", px, marginTop+plotHeight, px, marginTop+plotHeight+5)
+		sw.printf(`<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", px, marginTop+plotHeight+18, formatTick(xv))
+
+		yv := ymin + k*(ymax-ymin)
+		py := marginTop + plotHeight - k*plotHeight
+		sw.printf(`<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="black"/>`+"\n", marginLeft-5, py, marginLeft, py)
+		sw.printf(`<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", marginLeft-8, py, formatTick(yv))
+	}
+	sw.printf(`<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", marginLeft+plotWidth/2, marginTop+plotHeight+40, html.EscapeString(xLabel))
+	sw.printf(`<text x="15" y="%d" text-anchor="middle" transform="rotate(-90 15 %d)">%s</text>`+"\n", marginTop+plotHeight/2, marginTop+plotHeight/2, html.EscapeString(yLabel))
+}
+
+// RenderSVG draws the surface as a heat map with a color bar
+func (s Surface) RenderSVG(w io.Writer, title string) error {
+	if len(s.X) < 2 || len(s.Y) < 2 {
+		return fmt.Errorf("surface: at least a 2x2 grid is required to render")
+	}
+	sw := &svgWriter{w: bufio.NewWriter(w)}
+	sw.header(title)
+
+	zmin, zmax := s.Range()
+	xmin, xmax := s.X[0], s.X[len(s.X)-1]
+	ymin, ymax := s.Y[0], s.Y[len(s.Y)-1]
+
+	// One cell per grid point, centered on the point
+	cw := float64(plotWidth) / float64(len(s.X)-1)
+	ch := float64(plotHeight) / float64(len(s.Y)-1)
+	// The nested svg clips the half cells drawn outside of the frame
+	sw.printf(`<svg x="%d" y="%d" width="%d" height="%d">`+"\n", marginLeft, marginTop, plotWidth, plotHeight)
+	for i := range s.Y {
+		for j := range s.X {
+			px := float64(j)*cw - cw/2
+			py := float64(plotHeight) - float64(i)*ch - ch/2
+			sw.printf(`<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"/>`+"\n", px, py, cw+0.5, ch+0.5, heatColor(normalize(s.Z[i][j], zmin, zmax)))
+		}
+	}
+	sw.printf("</svg>\n")
+	sw.axes(xmin, xmax, ymin, ymax, string(s.XID), string(s.YID))
+
+	// Color bar
+	barX := marginLeft + plotWidth + 30
+	const steps = 50
+	for k := 0; k < steps; k++ {
+		t := float64(k) / (steps - 1)
+		py := float64(marginTop+plotHeight) - t*plotHeight
+		sw.printf(`<rect x="%d" y="%.2f" width="15" height="%.2f" fill="%s"/>`+"\n", barX, py-plotHeight/steps, float64(plotHeight)/steps+0.5, heatColor(t))
+	}
+	sw.printf(`<rect x="%d" y="%d" width="15" height="%d" fill="none" stroke="black"/>`+"\n", barX, marginTop, plotHeight)
+	for i := 0; i <= tickCount; i++ {
+		k := float64(i) / tickCount
+		py := marginTop + plotHeight - k*plotHeight
+		sw.printf(`<text x="%d" y="%.1f" dominant-baseline="middle">%s</text>`+"\n", barX+20, py, formatTick(zmin+k*(zmax-zmin)))
+	}
+	sw.printf(`<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", barX+8, marginTop+plotHeight+18, html.EscapeString(string(s.ZID)))
+
+	sw.printf("</svg>\n")
+	return sw.flush()
+}
+
+// RenderMembershipSVG draws all membership functions of a fuzzy value over its universe
+// n is the number of samples per function
+func RenderMembershipSVG(w io.Writer, val *fuzzy.IDVal, n int, title string) error {
+	if val == nil {
+		return fmt.Errorf("surface: value is required")
+	}
+	u, err := val.U().N(n)
+	if err != nil {
+		return err
+	}
+	xs := u.Values()
+	xmin, xmax := u.Min(), u.Max()
+
+	sw := &svgWriter{w: bufio.NewWriter(w)}
+	sw.header(title)
+	sw.axes(xmin, xmax, 0, 1, string(val.ID()), "membership")
+
+	toPx := func(x, y float64) (float64, float64) {
+		return marginLeft + normalize(x, xmin, xmax)*plotWidth, marginTop + plotHeight - y*plotHeight
+	}
+
+	for k, idSet := range val.Sets() {
+		color := palette[k%len(palette)]
+		set := idSet.Set()
+		points := make([]string, len(xs))
+		for i, x := range xs {
+			px, py := toPx(x, set(x))
+			points[i] = fmt.Sprintf("%.2f,%.2f", px, py)
+		}
+		sw.printf(`<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`+"\n", color, strings.Join(points, " "))
+
+		// Legend
+		ly := marginTop + 10 + k*18
+		lx := marginLeft + plotWidth + 15
+		sw.printf(`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"/>`+"\n", lx, ly, lx+20, ly, color)
+		sw.printf(`<text x="%d" y="%d" dominant-baseline="middle">%s</text>`+"\n", lx+25, ly, html.EscapeString(string(idSet.ID())))
+	}
+
+	sw.printf("</svg>\n")
+	return sw.flush()
+}
+
+// normalize maps v from [vmin ; vmax] to [0 ; 1]
+func normalize(v, vmin, vmax float64) float64 {
+	if vmax == vmin {
+		return 0
+	}
+	return (v - vmin) / (vmax - vmin)
+}
+
+// heatColor maps t in [0 ; 1] to a blue -> yellow -> red ramp
+func heatColor(t float64) string {
+	t = math.Max(0, math.Min(1, t))
+	stops := [][3]float64{
+		{49, 54, 149},
+		{69, 117, 180},
+		{116, 173, 209},
+		{254, 224, 144},
+		{244, 109, 67},
+		{165, 0, 38},
+	}
+	pos := t * float64(len(stops)-1)
+	i := int(math.Floor(pos))
+	if i >= len(stops)-1 {
+		i = len(stops) - 2
+	}
+	f := pos - float64(i)
+	var rgb [3]int
+	for c := 0; c < 3; c++ {
+		rgb[c] = int(math.Round(stops[i][c] + f*(stops[i+1][c]-stops[i][c])))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// formatTick prints a tick value without useless decimals
+func formatTick(v float64) string {
+	if math.Abs(v-math.Round(v)) < 1e-9 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
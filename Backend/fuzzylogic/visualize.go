@@ -0,0 +1,57 @@
+package fuzzylogic
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/fuzzy"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/id"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic/surface"
+)
+
+// DefaultGridSize is the number of samples per axis used for surfaces
+const DefaultGridSize = 41
+
+// Surface sweeps the level engine over a n*n grid of two of its inputs
+// x and y are value identifiers (score or speed_ratio)
+func (le *LevelEngine) Surface(x, y string, n int) (surface.Surface, error) {
+	vals := []*fuzzy.IDVal{le.scoreVal, le.timeVal}
+	xVal, err := findValue(vals, id.ID(x))
+	if err != nil {
+		return surface.Surface{}, err
+	}
+	yVal, err := findValue(vals, id.ID(y))
+	if err != nil {
+		return surface.Surface{}, err
+	}
+	return surface.Sweep(le.engine, xVal, yVal, le.levelVal, n, n, nil)
+}
+
+// RenderSurfaceSVG writes the score x speed ratio control surface of the level engine as SVG
+func (le *LevelEngine) RenderSurfaceSVG(w io.Writer, n int) error {
+	s, err := le.Surface(string(ScoreID), string(SpeedRatioID), n)
+	if err != nil {
+		return err
+	}
+	return s.RenderSVG(w, "English level control surface")
+}
+
+// RenderMembershipSVG writes the membership functions of one level engine value as SVG
+// name is the identifier of the value (score, speed_ratio or english_level)
+func (le *LevelEngine) RenderMembershipSVG(w io.Writer, name string, n int) error {
+	val, err := findValue([]*fuzzy.IDVal{le.scoreVal, le.timeVal, le.levelVal}, id.ID(name))
+	if err != nil {
+		return err
+	}
+	return surface.RenderMembershipSVG(w, val, n, fmt.Sprintf("Membership functions: %s", name))
+}
+
+// findValue fetches a fuzzy value by identifier
+func findValue(vals []*fuzzy.IDVal, uuid id.ID) (*fuzzy.IDVal, error) {
+	for _, val := range vals {
+		if val.ID() == uuid {
+			return val, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown fuzzy value `%s`", uuid)
+}
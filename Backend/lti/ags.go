@@ -0,0 +1,188 @@
+package lti
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+)
+
+const (
+	scoreContentType     = "application/vnd.ims.lis.v1.score+json"
+	clientAssertionType  = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionTTL   = 5 * time.Minute
+	accessTokenMargin    = time.Minute // a cached token is renewed this long before it expires
+	maxErrorResponseBody = 1024        // bytes of an error response kept in the error
+)
+
+// accessToken is an OAuth 2 token of the platform for Assignment and Grade Services
+type accessToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Score is the result of a user on a line item (Assignment and Grade Services, score publish service)
+type Score struct {
+	UserID           string    `json:"userId"` // the subject of the user at the platform
+	ScoreGiven       float64   `json:"scoreGiven"`
+	ScoreMaximum     float64   `json:"scoreMaximum"`
+	Comment          string    `json:"comment,omitempty"`
+	ActivityProgress string    `json:"activityProgress"`
+	GradingProgress  string    `json:"gradingProgress"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// NewScore returns the score of a completed and fully graded attempt
+func NewScore(userID string, given, maximum float64, at time.Time) Score {
+	return Score{
+		UserID:           userID,
+		ScoreGiven:       given,
+		ScoreMaximum:     maximum,
+		ActivityProgress: "Completed",
+		GradingProgress:  "FullyGraded",
+		Timestamp:        at,
+	}
+}
+
+// StatusError is a request the platform answered with an error status
+type StatusError struct {
+	StatusCode int
+	Body       string // the start of the response
+}
+
+func (e *StatusError) Error() string {
+	return "lti: platform answered " + strconv.Itoa(e.StatusCode) + ": " + e.Body
+}
+
+// IsRejected tells whether the platform rejected the score itself (400, 403, 404, 422):
+// posting it again as it is fails again
+func IsRejected(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return false
+	}
+	switch status.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// PostScore publishes a score to a line item of the platform, authenticated with an access token
+// requested with a client assertion signed by the tool keys
+func (p *Platform) PostScore(ctx context.Context, keys *auth.KeySet, lineItem string, score Score) error {
+	token, err := p.accessToken(ctx, keys, ScopeScore)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	// The scores resource is the line item URL with /scores appended to its path, before its query
+	u, err := url.Parse(lineItem)
+	if err != nil {
+		return fmt.Errorf("lti: invalid line item %q: %w", lineItem, err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/scores"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", scoreContentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The token was revoked or expired early: the next attempt requests a new one
+		p.mu.Lock()
+		delete(p.tokens, ScopeScore)
+		p.mu.Unlock()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorResponseBody))
+		return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(strings.ToValidUTF8(string(response), ""))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// accessToken returns a token of the platform for a scope, cached until shortly before it expires
+// It is requested with the client credentials grant and a JWT client assertion (LTI Security Framework 4.1)
+func (p *Platform) accessToken(ctx context.Context, keys *auth.KeySet, scope string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tokens[scope]; ok && time.Now().Before(t.expiresAt) {
+		return t.value, nil
+	}
+	if p.TokenURL == "" {
+		return "", fmt.Errorf("lti: no token URL for %s", p.Name)
+	}
+
+	jti, err := oidc.RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	assertion, err := keys.Sign(jwt.MapClaims{
+		"iss": p.ClientID,
+		"sub": p.ClientID,
+		"aud": p.TokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(clientAssertionTTL).Unix(),
+		"jti": jti,
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+		"scope":                 {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(&tr); err != nil {
+		return "", fmt.Errorf("lti token response of %s: %w", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" || tr.AccessToken == "" {
+		return "", fmt.Errorf("lti token request to %s failed: %s %s", p.Name, tr.Error, tr.ErrorDescription)
+	}
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= accessTokenMargin {
+		lifetime = 2 * accessTokenMargin // not given: assume a short lived token
+	}
+	p.tokens[scope] = accessToken{value: tr.AccessToken, expiresAt: now.Add(lifetime - accessTokenMargin)}
+	return tr.AccessToken, nil
+}
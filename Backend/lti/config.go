@@ -0,0 +1,101 @@
+package lti
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+)
+
+var platformName = regexp.MustCompile(`^[a-z0-9_-]{1,40}$`)
+
+// LoadPlatforms reads the platforms the tool is registered at from the environment:
+//
+//	LTI_PLATFORMS                  comma separated platform names, e.g. "moodle,canvas"
+//	LTI_<NAME>_ISSUER              issuer of the platform, e.g. https://moodle.school.example
+//	LTI_<NAME>_CLIENT_ID           client id of the tool at the platform
+//	LTI_<NAME>_DEPLOYMENT_IDS      comma separated deployments accepted (any if empty)
+//	LTI_<NAME>_AUTH_URL            OpenID Connect authentication endpoint of the platform
+//	LTI_<NAME>_JWKS_URL            public keys of the platform
+//	LTI_<NAME>_TOKEN_URL           OAuth 2 token endpoint of the platform (score passback)
+//	LTI_<NAME>_TRUST_EMAIL         true: launches sign in to the accounts of the same email
+//
+// The tool URLs to register at the platform are publicURL/lti/login (login initiation),
+// publicURL/lti/launch (launch and redirect URL) and publicURL/lti/jwks (public keyset)
+func LoadPlatforms() ([]*Platform, error) {
+	var platforms []*Platform
+	for _, name := range splitList(os.Getenv("LTI_PLATFORMS")) {
+		name = strings.ToLower(name)
+		if !platformName.MatchString(name) {
+			return nil, fmt.Errorf("invalid LTI platform name %q", name)
+		}
+		prefix := "LTI_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := Config{
+			Name:          name,
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			DeploymentIDs: splitList(os.Getenv(prefix + "DEPLOYMENT_IDS")),
+			AuthURL:       os.Getenv(prefix + "AUTH_URL"),
+			JWKSURL:       os.Getenv(prefix + "JWKS_URL"),
+			TokenURL:      os.Getenv(prefix + "TOKEN_URL"),
+			TrustEmail:    os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.AuthURL == "" || cfg.JWKSURL == "" {
+			return nil, fmt.Errorf("LTI platform %s: %sISSUER, %sCLIENT_ID, %sAUTH_URL and %sJWKS_URL are required", name, prefix, prefix, prefix, prefix)
+		}
+		for _, other := range platforms {
+			if other.Issuer == cfg.Issuer && other.ClientID == cfg.ClientID {
+				return nil, fmt.Errorf("LTI platforms %s and %s have the same issuer and client id", other.Name, name)
+			}
+		}
+		platforms = append(platforms, NewPlatform(cfg, nil))
+	}
+	return platforms, nil
+}
+
+// LoadToolKeys returns the keys the tool signs its messages to the platforms with
+// (Deep Linking responses and client assertions), published at /lti/jwks:
+//
+//	LTI_PRIVATE_KEY_FILE  PEM RSA private key of the tool
+//	LTI_KEY_ID            kid of the key ("lti")
+//
+// Without a key file a key is generated: the platforms have to fetch the keyset again after each restart
+func LoadToolKeys() (*auth.KeySet, error) {
+	kid := os.Getenv("LTI_KEY_ID")
+	if kid == "" {
+		kid = "lti"
+	}
+	path := os.Getenv("LTI_PRIVATE_KEY_FILE")
+	if path == "" {
+		log.Printf("Warning: LTI_PRIVATE_KEY_FILE is empty, LTI messages are signed with a key generated at startup")
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeySet(auth.NewRSAKey(kid, private))
+	}
+	key, err := auth.LoadPrivateKey(kid, path)
+	if err != nil {
+		return nil, err
+	}
+	// Platforms only support RS256
+	if key.Method.Alg() != "RS256" {
+		return nil, fmt.Errorf("%s is a %s key, LTI requires RS256", path, key.Method.Alg())
+	}
+	return auth.NewKeySet(key)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
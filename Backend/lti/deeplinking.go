@@ -0,0 +1,65 @@
+package lti
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+)
+
+// deepLinkingResponseTTL is the time the platform has to receive a Deep Linking response
+const deepLinkingResponseTTL = 5 * time.Minute
+
+// LineItem asks the platform to create a gradebook column for a resource link
+type LineItem struct {
+	ScoreMaximum float64 `json:"scoreMaximum"`
+	Label        string  `json:"label,omitempty"`
+	ResourceID   string  `json:"resourceId,omitempty"`
+}
+
+// ContentItem is a resource link returned to the platform by Deep Linking
+type ContentItem struct {
+	Type     string            `json:"type"` // always ltiResourceLink
+	Title    string            `json:"title,omitempty"`
+	Text     string            `json:"text,omitempty"`
+	URL      string            `json:"url,omitempty"` // the launch URL, the one of the tool if empty
+	Custom   map[string]string `json:"custom,omitempty"`
+	LineItem *LineItem         `json:"lineItem,omitempty"`
+}
+
+// NewResourceLink returns a content item launching url with custom parameters, graded out of scoreMaximum
+// (ungraded if scoreMaximum is 0)
+func NewResourceLink(title, text, url string, custom map[string]string, scoreMaximum float64, resourceID string) ContentItem {
+	item := ContentItem{Type: "ltiResourceLink", Title: title, Text: text, URL: url, Custom: custom}
+	if scoreMaximum > 0 {
+		item.LineItem = &LineItem{ScoreMaximum: scoreMaximum, Label: title, ResourceID: resourceID}
+	}
+	return item
+}
+
+// DeepLinkingResponse returns the signed JWT of a Deep Linking response, to be posted by the browser
+// to the return URL of the request in a form field named JWT
+// data is the data claim of the request, returned as it was received
+func (p *Platform) DeepLinkingResponse(keys *auth.KeySet, deploymentID, data string, items []ContentItem) (string, error) {
+	nonce, err := oidc.RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":              p.ClientID,
+		"aud":              p.Issuer,
+		"iat":              now.Unix(),
+		"exp":              now.Add(deepLinkingResponseTTL).Unix(),
+		"nonce":            nonce,
+		ClaimMessageType:   DeepLinkingResponse,
+		ClaimVersion:       Version,
+		ClaimDeploymentID:  deploymentID,
+		ClaimDeepLinkItems: items,
+	}
+	if data != "" {
+		claims[ClaimDeepLinkData] = data
+	}
+	return keys.Sign(claims)
+}
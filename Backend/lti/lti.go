@@ -0,0 +1,316 @@
+// Package lti implements the tool side of LTI 1.3: the OpenID Connect launches from a platform (an LMS such
+// as Moodle or Canvas), Deep Linking responses and score passback with Assignment and Grade Services
+package lti
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+)
+
+// Message types and claims of the LTI 1.3 and LTI Advantage specifications
+const (
+	Version                = "1.3.0"
+	ResourceLinkRequest    = "LtiResourceLinkRequest"
+	DeepLinkingRequest     = "LtiDeepLinkingRequest"
+	DeepLinkingResponse    = "LtiDeepLinkingResponse"
+	claimPrefix            = "https://purl.imsglobal.org/spec/lti/claim/"
+	ClaimMessageType       = claimPrefix + "message_type"
+	ClaimVersion           = claimPrefix + "version"
+	ClaimDeploymentID      = claimPrefix + "deployment_id"
+	ClaimTargetLinkURI     = claimPrefix + "target_link_uri"
+	ClaimResourceLink      = claimPrefix + "resource_link"
+	ClaimRoles             = claimPrefix + "roles"
+	ClaimContext           = claimPrefix + "context"
+	ClaimCustom            = claimPrefix + "custom"
+	ClaimDeepLinkSettings  = "https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"
+	ClaimDeepLinkItems     = "https://purl.imsglobal.org/spec/lti-dl/claim/content_items"
+	ClaimDeepLinkData      = "https://purl.imsglobal.org/spec/lti-dl/claim/data"
+	ClaimAGSEndpoint       = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+	ScopeScore             = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+	roleMembershipPrefix   = "http://purl.imsglobal.org/vocab/lis/v2/membership#"
+	roleInstitutionPrefix  = "http://purl.imsglobal.org/vocab/lis/v2/institution/person#"
+	maxResponseBody        = 1 << 20
+	allowedClockSkew       = time.Minute
+	platformRequestTimeout = 10 * time.Second
+)
+
+// allowedAlgorithms are the id token signatures accepted; LTI requires RS256
+var allowedAlgorithms = []string{"RS256", "RS384", "RS512"}
+
+var (
+	ErrUnknownPlatform   = errors.New("lti: unknown platform or client id")
+	ErrUnknownDeployment = errors.New("lti: unknown deployment")
+	ErrInvalidLaunch     = errors.New("lti: invalid launch")
+)
+
+// teacherRoles are the roles, in a course or the institution, of the users who become teachers
+var teacherRoles = []string{
+	roleMembershipPrefix + "Instructor",
+	roleMembershipPrefix + "Administrator",
+	roleMembershipPrefix + "ContentDeveloper",
+	roleInstitutionPrefix + "Administrator",
+	roleInstitutionPrefix + "Instructor",
+	roleInstitutionPrefix + "Faculty",
+	"Instructor", // short forms of the context roles, deprecated but still sent
+	"Administrator",
+	"ContentDeveloper",
+}
+
+// Config is the registration of the tool at a platform
+type Config struct {
+	Name          string   // identifies the platform in the linked identities (lti-<name>) and the logs
+	Issuer        string   // the iss of the platform
+	ClientID      string   // the client id the platform gave the tool
+	DeploymentIDs []string // the deployments accepted, any if empty
+	AuthURL       string   // OpenID Connect authentication endpoint of the platform
+	JWKSURL       string   // public keys of the platform
+	TokenURL      string   // OAuth 2 token endpoint, for Assignment and Grade Services
+	TrustEmail    bool     // the platform verifies emails: link launches to the accounts of the same email
+}
+
+// Platform is a platform the tool is registered at
+// Its keys are downloaded on first use and refreshed on unknown key ids
+type Platform struct {
+	Config
+	client *http.Client
+
+	jwks   *oidc.RemoteKeys
+	mu     sync.Mutex
+	tokens map[string]accessToken // by scope
+}
+
+// NewPlatform creates a Platform; nothing is downloaded before the first launch
+func NewPlatform(cfg Config, client *http.Client) *Platform {
+	if client == nil {
+		client = &http.Client{Timeout: platformRequestTimeout}
+	}
+	return &Platform{Config: cfg, client: client, jwks: oidc.NewRemoteKeys(client), tokens: map[string]accessToken{}}
+}
+
+// Provider is the name of the linked identities of the users of the platform
+func (p *Platform) Provider() string {
+	return "lti-" + p.Name
+}
+
+// AuthRequestURL returns the URL of the platform the browser is sent to, after a login initiation,
+// for the platform to post the id token of the launch to redirectURI
+func (p *Platform) AuthRequestURL(redirectURI, state, nonce, loginHint, messageHint string) (string, error) {
+	u, err := url.Parse(p.AuthURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("scope", "openid")
+	q.Set("response_type", "id_token")
+	q.Set("response_mode", "form_post")
+	q.Set("prompt", "none")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("login_hint", loginHint)
+	if messageHint != "" {
+		q.Set("lti_message_hint", messageHint)
+	}
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Context is the course of a launch
+type Context struct {
+	ID    string   `json:"id"`
+	Label string   `json:"label"`
+	Title string   `json:"title"`
+	Type  []string `json:"type"`
+}
+
+// ResourceLink is the placement of the tool in the course that was launched
+type ResourceLink struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// AGSEndpoint is the Assignment and Grade Services claim: where the scores of the resource link go
+type AGSEndpoint struct {
+	Scope     []string `json:"scope"`
+	LineItems string   `json:"lineitems"`
+	LineItem  string   `json:"lineitem"` // the line item of the resource link, if the platform created one
+}
+
+// DeepLinkSettings is where and what a Deep Linking response returns
+type DeepLinkSettings struct {
+	ReturnURL      string   `json:"deep_link_return_url"`
+	AcceptTypes    []string `json:"accept_types"`
+	AcceptMultiple bool     `json:"accept_multiple"`
+	Data           string   `json:"data"`
+}
+
+// Launch holds the verified claims of a launch id token
+type Launch struct {
+	MessageType   string
+	DeploymentID  string
+	TargetLinkURI string
+	Subject       string
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Email         string
+	Roles         []string
+	Context       *Context
+	ResourceLink  *ResourceLink
+	Custom        map[string]string
+	AGS           *AGSEndpoint
+	DeepLinking   *DeepLinkSettings
+}
+
+// IsTeacher tells whether the user launched as an instructor or administrator
+func (l *Launch) IsTeacher() bool {
+	return slices.ContainsFunc(l.Roles, func(role string) bool { return slices.Contains(teacherRoles, role) })
+}
+
+// Issuer reads the issuer and audience of an id token before it is verified, to find its platform
+func Issuer(raw string) (string, []string, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidLaunch, err)
+	}
+	iss, _ := unverified.Claims.GetIssuer()
+	aud, _ := unverified.Claims.GetAudience()
+	return iss, aud, nil
+}
+
+// VerifyLaunch checks the signature, issuer, audience, lifetime, nonce, deployment and message of a launch id token
+func (p *Platform) VerifyLaunch(ctx context.Context, raw, nonce string) (*Launch, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLaunch, err)
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	verifier, err := p.keys(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	err = verifier.ParseWithClaims(raw, claims,
+		jwt.WithValidMethods(allowedAlgorithms),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(allowedClockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLaunch, err)
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, fmt.Errorf("%w: azp is not the tool", ErrInvalidLaunch)
+		}
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidLaunch)
+	}
+
+	var l Launch
+	l.Subject, _ = claims.GetSubject()
+	l.MessageType, _ = claims[ClaimMessageType].(string)
+	l.DeploymentID, _ = claims[ClaimDeploymentID].(string)
+	l.TargetLinkURI, _ = claims[ClaimTargetLinkURI].(string)
+	l.Name, _ = claims["name"].(string)
+	l.GivenName, _ = claims["given_name"].(string)
+	l.FamilyName, _ = claims["family_name"].(string)
+	l.Email, _ = claims["email"].(string)
+	version, _ := claims[ClaimVersion].(string)
+	if version != Version {
+		return nil, fmt.Errorf("%w: unsupported LTI version %q", ErrInvalidLaunch, version)
+	}
+	if l.Subject == "" {
+		// Anonymous launches cannot be signed in
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidLaunch)
+	}
+	if l.DeploymentID == "" {
+		return nil, fmt.Errorf("%w: no deployment id", ErrInvalidLaunch)
+	}
+	if len(p.DeploymentIDs) > 0 && !slices.Contains(p.DeploymentIDs, l.DeploymentID) {
+		return nil, ErrUnknownDeployment
+	}
+	for claim, dst := range map[string]any{
+		ClaimRoles:            &l.Roles,
+		ClaimContext:          &l.Context,
+		ClaimResourceLink:     &l.ResourceLink,
+		ClaimCustom:           &l.Custom,
+		ClaimAGSEndpoint:      &l.AGS,
+		ClaimDeepLinkSettings: &l.DeepLinking,
+	} {
+		if err := decodeClaim(claims, claim, dst); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidLaunch, claim, err)
+		}
+	}
+
+	switch l.MessageType {
+	case ResourceLinkRequest:
+		if l.ResourceLink == nil || l.ResourceLink.ID == "" {
+			return nil, fmt.Errorf("%w: no resource link", ErrInvalidLaunch)
+		}
+	case DeepLinkingRequest:
+		if l.DeepLinking == nil || l.DeepLinking.ReturnURL == "" {
+			return nil, fmt.Errorf("%w: no deep linking settings", ErrInvalidLaunch)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported message type %q", ErrInvalidLaunch, l.MessageType)
+	}
+	return &l, nil
+}
+
+// decodeClaim decodes an object claim into dst, left alone when the claim is absent
+// Custom parameters are strings, but some platforms send numbers or booleans: they are converted
+func decodeClaim(claims jwt.MapClaims, name string, dst any) error {
+	value, ok := claims[name]
+	if !ok || value == nil {
+		return nil
+	}
+	if custom, isCustom := dst.(*map[string]string); isCustom {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return errors.New("not an object")
+		}
+		*custom = map[string]string{}
+		for k, v := range object {
+			if s, ok := v.(string); ok {
+				(*custom)[k] = s
+			} else {
+				(*custom)[k] = fmt.Sprint(v)
+			}
+		}
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// keys returns the verifier of the platform keys, downloaded again on unknown key ids
+func (p *Platform) keys(ctx context.Context, kid string) (*auth.Verifier, error) {
+	verifier, err := p.jwks.Verifier(ctx, p.JWKSURL, kid)
+	if err != nil {
+		return nil, fmt.Errorf("lti keys of %s: %w", p.Name, err)
+	}
+	return verifier, nil
+}
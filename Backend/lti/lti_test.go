@@ -0,0 +1,144 @@
+package lti
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+)
+
+const (
+	testIssuer   = "https://lms.example.edu"
+	testClientID = "tool-client"
+	testNonce    = "nonce-1"
+)
+
+// testPlatform returns a platform whose keys are served by a test server, and the keys signing its launches
+func testPlatform(t *testing.T) (*Platform, *auth.KeySet) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.NewKeySet(auth.NewRSAKey("platform-1", private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}))
+	t.Cleanup(server.Close)
+	return NewPlatform(Config{
+		Name:          "lms",
+		Issuer:        testIssuer,
+		ClientID:      testClientID,
+		DeploymentIDs: []string{"deployment-1"},
+		JWKSURL:       server.URL,
+	}, server.Client()), keys
+}
+
+func launchClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":              testIssuer,
+		"aud":              testClientID,
+		"sub":              "user-42",
+		"iat":              now.Unix(),
+		"exp":              now.Add(5 * time.Minute).Unix(),
+		"nonce":            testNonce,
+		ClaimVersion:       Version,
+		ClaimMessageType:   ResourceLinkRequest,
+		ClaimDeploymentID:  "deployment-1",
+		ClaimResourceLink:  map[string]any{"id": "link-1", "title": "Unit 1 test"},
+		ClaimCustom:        map[string]any{"test_id": 7},
+		ClaimTargetLinkURI: "https://tool.example.com/lti/launch",
+	}
+}
+
+func TestVerifyLaunch(t *testing.T) {
+	platform, keys := testPlatform(t)
+	tests := []struct {
+		name    string
+		edit    func(jwt.MapClaims)
+		nonce   string
+		wantErr error
+	}{
+		{"valid", func(jwt.MapClaims) {}, testNonce, nil},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, testNonce, ErrInvalidLaunch},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "other-tool" }, testNonce, ErrInvalidLaunch},
+		{"several audiences with the tool as azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-tool", testClientID}
+			c["azp"] = testClientID
+		}, testNonce, nil},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{"other-tool", testClientID} }, testNonce, ErrInvalidLaunch},
+		{"several audiences with another azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-tool", testClientID}
+			c["azp"] = "other-tool"
+		}, testNonce, ErrInvalidLaunch},
+		{"other nonce", func(jwt.MapClaims) {}, "nonce-2", ErrInvalidLaunch},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, testNonce, ErrInvalidLaunch},
+		{"unknown deployment", func(c jwt.MapClaims) { c[ClaimDeploymentID] = "deployment-2" }, testNonce, ErrUnknownDeployment},
+		{"no deployment", func(c jwt.MapClaims) { delete(c, ClaimDeploymentID) }, testNonce, ErrInvalidLaunch},
+		{"expired", func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(-time.Hour).Unix()
+			c["exp"] = time.Now().Add(-2 * allowedClockSkew).Unix()
+		}, testNonce, ErrInvalidLaunch},
+		{"expired within the clock skew", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-allowedClockSkew / 2).Unix() }, testNonce, nil},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, testNonce, ErrInvalidLaunch},
+		{"other LTI version", func(c jwt.MapClaims) { c[ClaimVersion] = "1.1" }, testNonce, ErrInvalidLaunch},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, testNonce, ErrInvalidLaunch},
+		{"no resource link", func(c jwt.MapClaims) { delete(c, ClaimResourceLink) }, testNonce, ErrInvalidLaunch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := launchClaims()
+			tt.edit(claims)
+			raw, err := keys.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			launch, err := platform.VerifyLaunch(context.Background(), raw, tt.nonce)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("VerifyLaunch: %v", err)
+				}
+				if launch.Subject != "user-42" || launch.ResourceLink.ID != "link-1" || launch.Custom["test_id"] != "7" {
+					t.Errorf("launch = %+v", launch)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyLaunch: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A launch signed by a key the platform does not publish is refused
+func TestVerifyLaunchUnknownKey(t *testing.T) {
+	platform, _ := testPlatform(t)
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.NewKeySet(auth.NewRSAKey("platform-1", private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := other.Sign(launchClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := platform.VerifyLaunch(context.Background(), raw, testNonce); !errors.Is(err, ErrInvalidLaunch) {
+		t.Errorf("VerifyLaunch: err = %v, want ErrInvalidLaunch", err)
+	}
+}
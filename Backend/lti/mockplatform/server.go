@@ -0,0 +1,507 @@
+// Package mockplatform is a minimal LTI 1.3 platform (LMS) for local development and tests
+// It launches the tool as any of its users in a single course, accepts Deep Linking responses
+// as new activities and keeps the scores the tool posts in a gradebook
+package mockplatform
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/lti"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+)
+
+const (
+	idTokenTTL      = 5 * time.Minute
+	accessTokenTTL  = time.Hour
+	deepLinkingHint = "deep-linking"
+	roleVocabulary  = "http://purl.imsglobal.org/vocab/lis/v2/membership#"
+)
+
+// User is a member of the course of the mock platform
+type User struct {
+	Subject    string   `json:"sub"`
+	Email      string   `json:"email"`
+	Name       string   `json:"name"`
+	GivenName  string   `json:"given_name"`
+	FamilyName string   `json:"family_name"`
+	Roles      []string `json:"roles"` // membership roles, e.g. Learner or Instructor
+}
+
+// DefaultUsers are an instructor and two learners
+var DefaultUsers = []User{
+	{Subject: "lms-teacher-1", Email: "teacher1@lms.example", Name: "Teacher One", GivenName: "Teacher", FamilyName: "One", Roles: []string{"Instructor"}},
+	{Subject: "lms-student-1", Email: "student1@lms.example", Name: "Student One", GivenName: "Student", FamilyName: "One", Roles: []string{"Learner"}},
+	{Subject: "lms-student-2", Email: "student2@lms.example", Name: "Student Two", GivenName: "Student", FamilyName: "Two", Roles: []string{"Learner"}},
+}
+
+// Config configures the mock platform
+type Config struct {
+	Issuer        string // base URL the platform is served at
+	ClientID      string // of the tool
+	DeploymentID  string
+	ToolLoginURL  string // login initiation URL of the tool
+	ToolLaunchURL string // launch (redirect) URL of the tool, the only redirect URI allowed
+	ToolJWKSURL   string // public keys of the tool, to verify its client assertions and Deep Linking responses
+	CourseID      string
+	CourseTitle   string
+	Users         []User
+}
+
+// Activity is a resource link of the course, created by a Deep Linking response
+type Activity struct {
+	ID       string
+	Title    string
+	URL      string
+	Custom   map[string]string
+	LineItem string // URL of its gradebook column, empty if ungraded
+	Maximum  float64
+}
+
+// GradebookEntry is a score posted by the tool
+type GradebookEntry struct {
+	LineItem   string
+	Activity   string
+	User       string
+	Score      float64
+	Maximum    float64
+	Progress   string
+	Timestamp  time.Time
+	ReceivedAt time.Time
+}
+
+// Server is the mock platform
+type Server struct {
+	cfg    Config
+	keys   *auth.KeySet
+	client *http.Client
+
+	mu         sync.Mutex
+	activities []Activity
+	gradebook  []GradebookEntry
+	tokens     map[string]time.Time // access tokens of the tool and their expiry
+}
+
+// NewServer creates a mock platform with a fresh RSA signing key
+func NewServer(cfg Config) (*Server, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.NewKeySet(auth.NewRSAKey("mock-platform", private))
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Users) == 0 {
+		cfg.Users = DefaultUsers
+	}
+	if cfg.CourseID == "" {
+		cfg.CourseID = "course-1"
+	}
+	if cfg.CourseTitle == "" {
+		cfg.CourseTitle = "English B1 (mock course)"
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Server{cfg: cfg, keys: keys, client: &http.Client{Timeout: 10 * time.Second}, tokens: map[string]time.Time{}}, nil
+}
+
+// Handler serves the course page, the keys, the authentication and token endpoints, the Deep Linking
+// return URL and the scores of the line items
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.course)
+	mux.HandleFunc("GET /launch", s.launch)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /auth", s.authorize)
+	mux.HandleFunc("POST /auth", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("POST /deep-linking/return", s.deepLinkingReturn)
+	mux.HandleFunc("POST /lineitems/{id}/scores", s.scores)
+	return mux
+}
+
+var coursePage = template.Must(template.New("course").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; margin: 3em">
+<h2>{{.Title}}</h2>
+<h3>Activities</h3>
+{{if .Activities}}<ul>{{range $a := .Activities}}<li><b>{{$a.Title}}</b>{{if $a.LineItem}} (graded out of {{$a.Maximum}}){{end}}:
+{{range $.Users}} <a href="/launch?user={{.Subject}}&amp;activity={{$a.ID}}">launch as {{.Name}}</a>{{end}}</li>{{end}}</ul>
+{{else}}<p>No activities yet.</p>{{end}}
+<p>Add an activity (Deep Linking):{{range .Users}} <a href="/launch?user={{.Subject}}&amp;deep_linking=1">as {{.Name}}</a>{{end}}</p>
+<h3>Gradebook</h3>
+{{if .Gradebook}}<table cellpadding="6">
+<tr><th align="left">Activity</th><th align="left">User</th><th>Score</th><th>Progress</th><th>Received</th></tr>
+{{range .Gradebook}}<tr><td>{{.Activity}}</td><td>{{.User}}</td><td>{{.Score}} / {{.Maximum}}</td><td>{{.Progress}}</td><td>{{.ReceivedAt.Format "15:04:05"}}</td></tr>{{end}}
+</table>{{else}}<p>No scores yet.</p>{{end}}
+</body></html>`))
+
+// course shows the activities, the launch links and the gradebook
+func (s *Server) course(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data := map[string]any{
+		"Title":      s.cfg.CourseTitle,
+		"Users":      s.cfg.Users,
+		"Activities": slices.Clone(s.activities),
+		"Gradebook":  slices.Clone(s.gradebook),
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	coursePage.Execute(w, data)
+}
+
+// launch starts a launch as a user: the browser is sent to the login initiation URL of the tool
+func (s *Server) launch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if _, ok := s.user(q.Get("user")); !ok {
+		http.Error(w, "unknown user", http.StatusBadRequest)
+		return
+	}
+	hint := deepLinkingHint
+	if q.Get("deep_linking") == "" {
+		if _, ok := s.activity(q.Get("activity")); !ok {
+			http.Error(w, "unknown activity", http.StatusBadRequest)
+			return
+		}
+		hint = q.Get("activity")
+	}
+	u, err := url.Parse(s.cfg.ToolLoginURL)
+	if err != nil {
+		http.Error(w, "invalid tool login URL", http.StatusInternalServerError)
+		return
+	}
+	lq := u.Query()
+	lq.Set("iss", s.cfg.Issuer)
+	lq.Set("login_hint", q.Get("user"))
+	lq.Set("lti_message_hint", hint)
+	lq.Set("target_link_uri", s.cfg.ToolLaunchURL)
+	lq.Set("client_id", s.cfg.ClientID)
+	lq.Set("lti_deployment_id", s.cfg.DeploymentID)
+	u.RawQuery = lq.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+var formPostPage = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Launching</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body></html>`))
+
+// authorize answers the authentication request of the tool with the id token of the launch, posted by the browser
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+	if q.Get("client_id") != s.cfg.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if q.Get("redirect_uri") != s.cfg.ToolLaunchURL {
+		http.Error(w, "redirect_uri not allowed", http.StatusBadRequest)
+		return
+	}
+	fields := map[string]string{"state": q.Get("state")}
+	if q.Get("response_type") != "id_token" || q.Get("response_mode") != "form_post" || q.Get("nonce") == "" ||
+		!slices.Contains(strings.Fields(q.Get("scope")), "openid") {
+		fields["error"] = "invalid_request"
+		s.formPost(w, q.Get("redirect_uri"), fields)
+		return
+	}
+	user, ok := s.user(q.Get("login_hint"))
+	if !ok {
+		fields["error"] = "login_required"
+		s.formPost(w, q.Get("redirect_uri"), fields)
+		return
+	}
+
+	now := time.Now()
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = roleVocabulary + role
+	}
+	claims := jwt.MapClaims{
+		"iss":                 s.cfg.Issuer,
+		"sub":                 user.Subject,
+		"aud":                 s.cfg.ClientID,
+		"iat":                 now.Unix(),
+		"exp":                 now.Add(idTokenTTL).Unix(),
+		"nonce":               q.Get("nonce"),
+		"email":               user.Email,
+		"name":                user.Name,
+		"given_name":          user.GivenName,
+		"family_name":         user.FamilyName,
+		lti.ClaimVersion:      lti.Version,
+		lti.ClaimDeploymentID: s.cfg.DeploymentID,
+		lti.ClaimRoles:        roles,
+		lti.ClaimContext:      map[string]any{"id": s.cfg.CourseID, "label": s.cfg.CourseID, "title": s.cfg.CourseTitle},
+	}
+	if hint := q.Get("lti_message_hint"); hint == deepLinkingHint {
+		claims[lti.ClaimMessageType] = lti.DeepLinkingRequest
+		claims[lti.ClaimTargetLinkURI] = s.cfg.ToolLaunchURL
+		claims[lti.ClaimDeepLinkSettings] = map[string]any{
+			"deep_link_return_url": s.cfg.Issuer + "/deep-linking/return",
+			"accept_types":         []string{"ltiResourceLink"},
+			"accept_multiple":      false,
+			"data":                 "mock-" + strconv.FormatInt(now.UnixNano(), 36),
+		}
+	} else {
+		activity, ok := s.activity(hint)
+		if !ok {
+			fields["error"] = "invalid_request"
+			s.formPost(w, q.Get("redirect_uri"), fields)
+			return
+		}
+		claims[lti.ClaimMessageType] = lti.ResourceLinkRequest
+		claims[lti.ClaimTargetLinkURI] = activity.URL
+		claims[lti.ClaimResourceLink] = map[string]any{"id": activity.ID, "title": activity.Title}
+		if len(activity.Custom) > 0 {
+			claims[lti.ClaimCustom] = activity.Custom
+		}
+		ags := map[string]any{
+			"scope":     []string{lti.ScopeScore},
+			"lineitems": s.cfg.Issuer + "/lineitems",
+		}
+		if activity.LineItem != "" {
+			ags["lineitem"] = activity.LineItem
+		}
+		claims[lti.ClaimAGSEndpoint] = ags
+	}
+	idToken, err := s.keys.Sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fields["id_token"] = idToken
+	s.formPost(w, q.Get("redirect_uri"), fields)
+}
+
+// token issues access tokens to the tool for the client credentials grant with a client assertion
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	if r.PostForm.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	claims := jwt.MapClaims{}
+	if err := s.verifyTool(r.Context(), r.PostForm.Get("client_assertion"), claims, s.cfg.Issuer+"/token"); err != nil {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if sub, _ := claims.GetSubject(); sub != s.cfg.ClientID {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+	if len(scopes) == 0 || slices.ContainsFunc(scopes, func(scope string) bool { return scope != lti.ScopeScore }) {
+		tokenError(w, http.StatusBadRequest, "invalid_scope")
+		return
+	}
+	accessToken, err := oidc.RandomString(24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.tokens[accessToken] = time.Now().Add(accessTokenTTL)
+	s.mu.Unlock()
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(accessTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// deepLinkingReturn adds the resource links of a Deep Linking response to the course
+func (s *Server) deepLinkingReturn(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	claims := jwt.MapClaims{}
+	if err := s.verifyTool(r.Context(), r.PostForm.Get("JWT"), claims, s.cfg.Issuer); err != nil {
+		http.Error(w, "invalid Deep Linking response: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if iss, _ := claims.GetIssuer(); iss != s.cfg.ClientID {
+		http.Error(w, "invalid Deep Linking response: issuer is not the tool", http.StatusBadRequest)
+		return
+	}
+	if claims[lti.ClaimMessageType] != lti.DeepLinkingResponse || claims[lti.ClaimDeploymentID] != s.cfg.DeploymentID {
+		http.Error(w, "invalid Deep Linking response: message type or deployment", http.StatusBadRequest)
+		return
+	}
+	var items []lti.ContentItem
+	data, _ := json.Marshal(claims[lti.ClaimDeepLinkItems])
+	if err := json.Unmarshal(data, &items); err != nil {
+		http.Error(w, "invalid content items", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	for _, item := range items {
+		if item.Type != "ltiResourceLink" {
+			continue
+		}
+		n := len(s.activities) + 1
+		activity := Activity{ID: fmt.Sprintf("link-%d", n), Title: item.Title, URL: item.URL, Custom: item.Custom}
+		if activity.URL == "" {
+			activity.URL = s.cfg.ToolLaunchURL
+		}
+		if item.LineItem != nil {
+			activity.LineItem = fmt.Sprintf("%s/lineitems/%d", s.cfg.Issuer, n)
+			activity.Maximum = item.LineItem.ScoreMaximum
+		}
+		s.activities = append(s.activities, activity)
+	}
+	s.mu.Unlock()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// scores records a score posted to a line item
+func (s *Server) scores(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	expiresAt, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(expiresAt) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/vnd.ims.lis.v1.score+json") {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	lineItem := s.cfg.Issuer + "/lineitems/" + r.PathValue("id")
+	var score lti.Score
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&score); err != nil || score.UserID == "" || score.Timestamp.IsZero() {
+		http.Error(w, "invalid score", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.activities, func(a Activity) bool { return a.LineItem == lineItem })
+	if i < 0 {
+		http.Error(w, "unknown line item", http.StatusNotFound)
+		return
+	}
+	user := score.UserID
+	if u, ok := s.user(score.UserID); ok {
+		user = u.Name
+	}
+	s.gradebook = append(s.gradebook, GradebookEntry{
+		LineItem:   lineItem,
+		Activity:   s.activities[i].Title,
+		User:       user,
+		Score:      score.ScoreGiven,
+		Maximum:    score.ScoreMaximum,
+		Progress:   score.ActivityProgress + ", " + score.GradingProgress,
+		Timestamp:  score.Timestamp,
+		ReceivedAt: time.Now(),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Gradebook returns the scores received
+func (s *Server) Gradebook() []GradebookEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.gradebook)
+}
+
+// verifyTool verifies a JWT signed by the tool for audience, with the keys of the tool fetched from its JWKS URL
+func (s *Server) verifyTool(ctx context.Context, raw string, claims jwt.MapClaims, audience string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.ToolJWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var set struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return err
+	}
+	var keys []*auth.Key
+	for _, j := range set.Keys {
+		if k, err := j.Key(); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	return auth.NewVerifier(keys...).ParseWithClaims(raw, claims,
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+}
+
+func (s *Server) user(subject string) (User, bool) {
+	i := slices.IndexFunc(s.cfg.Users, func(u User) bool { return u.Subject == subject })
+	if i < 0 {
+		return User{}, false
+	}
+	return s.cfg.Users[i], true
+}
+
+func (s *Server) activity(id string) (Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.activities, func(a Activity) bool { return a.ID == id })
+	if i < 0 {
+		return Activity{}, false
+	}
+	return s.activities[i], true
+}
+
+func (s *Server) formPost(w http.ResponseWriter, action string, fields map[string]string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	formPostPage.Execute(w, map[string]any{"Action": action, "Fields": fields})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// DefaultFrom is the sender address when SMTP_FROM is not set
+const DefaultFrom = "no-reply@localhost"
+
+// LoadMailer builds the mailer from the environment:
+//
+//	MAILER       smtp, log, file or memory (default: smtp when SMTP_HOST is set, log otherwise)
+//	SMTP_FROM    sender address of every email
+//	SMTP_HOST    SMTP server, with SMTP_PORT (default 587)
+//	SMTP_USER    SMTP user name (SMTP_FROM if empty)
+//	SMTP_PASS    SMTP password (no authentication if empty)
+//	MAIL_FILE    file the file mailer appends the emails to (default outbox.eml)
+//	MAIL_OUTBOX  "true" to also keep the last emails in the development outbox
+//
+// The outbox is nil unless MAILER=memory or MAIL_OUTBOX=true
+func LoadMailer() (Mailer, *MemoryMailer, error) {
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = DefaultFrom
+	}
+	kind := os.Getenv("MAILER")
+	if kind == "" {
+		kind = "log"
+		if os.Getenv("SMTP_HOST") != "" {
+			kind = "smtp"
+		}
+	}
+
+	var mailer Mailer
+	var outbox *MemoryMailer
+	switch kind {
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" {
+			return nil, nil, fmt.Errorf("SMTP_HOST is required for MAILER=smtp")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		mailer = &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     from,
+		}
+	case "log":
+		mailer = &LogMailer{From: from}
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "outbox.eml"
+		}
+		mailer = &FileMailer{Path: path, From: from}
+	case "memory":
+		outbox = NewMemoryMailer(from, 0)
+		mailer = outbox
+	default:
+		return nil, nil, fmt.Errorf("unknown MAILER %q (smtp, log, file or memory)", kind)
+	}
+
+	if os.Getenv("MAIL_OUTBOX") == "true" && outbox == nil {
+		outbox = NewMemoryMailer(from, 0)
+		mailer = Tee(mailer, outbox)
+	}
+	if outbox != nil {
+		log.Printf("Warning: the development outbox is enabled, the emails sent can be read at /dev/outbox")
+	}
+	return mailer, outbox, nil
+}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogMailer writes the messages to the log instead of sending them
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.From
+	}
+	log.Printf("mail: to %v, subject %q (%s, %s):\n%s", msg.To, msg.Subject, msg.Template, msg.Locale, msg.Text)
+	return nil
+}
+
+// FileMailer appends the messages, formatted as emails, to a file
+type FileMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.From
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "From %s %s\r\n", msg.From, msg.SentAt.UTC().Format("Mon Jan _2 15:04:05 2006")); err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\r', '\n')); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package mail sends emails through pluggable mailers and renders them from localised templates
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text body and an optional HTML alternative
+type Message struct {
+	ID       string    `json:"id"`            // set by the development outbox
+	Key      string    `json:"key,omitempty"` // idempotency key: every attempt to send it has the same Message-ID
+	From     string    `json:"from"`
+	To       []string  `json:"to"`
+	Subject  string    `json:"subject"`
+	Text     string    `json:"text"`
+	HTML     string    `json:"html,omitempty"`
+	Template string    `json:"template,omitempty"` // the template the message was rendered from
+	Locale   string    `json:"locale,omitempty"`
+	SentAt   time.Time `json:"sent_at"`
+	// Unsubscribe is a URL turning off this kind of email, with a POST for one-click unsubscribe (RFC 8058)
+	Unsubscribe string `json:"unsubscribe,omitempty"`
+}
+
+// Mailer sends messages; implementations must be safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Tee sends every message with each mailer in turn, e.g. SMTP and the development outbox
+// It stops at the first error
+func Tee(mailers ...Mailer) Mailer {
+	return tee(mailers)
+}
+
+type tee []Mailer
+
+func (t tee) Send(ctx context.Context, msg *Message) error {
+	for _, m := range t {
+		if err := m.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes formats the message as an RFC 5322 email, multipart/alternative when it has an HTML body
+func (m *Message) Bytes() ([]byte, error) {
+	if m.From == "" || len(m.To) == 0 {
+		return nil, errors.New("mail: message without sender or recipient")
+	}
+	sentAt := m.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", sentAt.Format(time.RFC1123Z))
+	header("Message-ID", "<"+m.messageID()+"@"+domainOf(m.From)+">")
+	if m.Unsubscribe != "" {
+		header("List-Unsubscribe", "<"+m.Unsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	header("MIME-Version", "1.0")
+	if m.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "base64")
+		b.WriteString("\r\n")
+		writeBase64(&b, m.Text)
+		return b.Bytes(), nil
+	}
+
+	boundary := "alt-" + randomHex(12)
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	b.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, m.Text},
+		{`text/html; charset="utf-8"`, m.HTML},
+	} {
+		b.WriteString("--" + boundary + "\r\n")
+		header("Content-Type", part.contentType)
+		header("Content-Transfer-Encoding", "base64")
+		b.WriteString("\r\n")
+		writeBase64(&b, part.body)
+	}
+	b.WriteString("--" + boundary + "--\r\n")
+	return b.Bytes(), nil
+}
+
+// writeBase64 writes a body in base64 lines of 76 characters
+func writeBase64(b *bytes.Buffer, body string) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+}
+
+// messageID derives the local part of the Message-ID from the key, random without one
+func (m *Message) messageID() string {
+	if m.Key == "" {
+		return randomHex(16)
+	}
+	sum := sha256.Sum256([]byte(m.Key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// IsPermanent tells whether a sending error will happen again on retry: the SMTP server
+// rejected the message or a recipient for good (5xx reply)
+func IsPermanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.Trim(address[i+1:], "> ")
+	}
+	return "localhost"
+}
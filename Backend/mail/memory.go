@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemoryMailer keeps the last messages in memory; it backs the development outbox and tests
+type MemoryMailer struct {
+	From     string
+	capacity int
+	mu       sync.Mutex
+	messages []Message // oldest first
+	nextID   int
+}
+
+// NewMemoryMailer creates a MemoryMailer keeping the last capacity messages
+func NewMemoryMailer(from string, capacity int) *MemoryMailer {
+	if capacity <= 0 {
+		capacity = 100
+	}
+	return &MemoryMailer{From: from, capacity: capacity}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	stored := *msg
+	stored.ID = strconv.Itoa(m.nextID)
+	if stored.From == "" {
+		stored.From = m.From
+	}
+	stored.To = append([]string(nil), msg.To...)
+	m.messages = append(m.messages, stored)
+	if len(m.messages) > m.capacity {
+		m.messages = m.messages[len(m.messages)-m.capacity:]
+	}
+	return nil
+}
+
+// Messages returns the messages kept, latest first
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]Message, len(m.messages))
+	for i, msg := range m.messages {
+		messages[len(m.messages)-1-i] = msg
+	}
+	return messages
+}
+
+// Message returns a message by id
+func (m *MemoryMailer) Message(id string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range m.messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// Clear removes all the messages
+func (m *MemoryMailer) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
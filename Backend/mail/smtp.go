@@ -0,0 +1,80 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server, upgrading to TLS with STARTTLS when offered
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string // the sender address if empty
+	Password string // no authentication if empty
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.From
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// Connect (plain) and then upgrade to TLS with STARTTLS
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.Host, m.Port))
+	if err != nil {
+		return fmt.Errorf("dial error: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return fmt.Errorf("smtp client error: %w", err)
+	}
+	defer client.Quit()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			return fmt.Errorf("starttls error: %w", err)
+		}
+	}
+	if m.Password != "" {
+		username := m.Username
+		if username == "" {
+			username = m.From
+		}
+		if err = client.Auth(smtp.PlainAuth("", username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("smtp auth error: %w", err)
+		}
+	}
+
+	if err = client.Mail(m.From); err != nil {
+		return fmt.Errorf("mail from error: %w", err)
+	}
+	for _, recipient := range msg.To {
+		if err = client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("rcpt to error: %w", err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data error: %w", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("close error: %w", err)
+	}
+	return nil
+}
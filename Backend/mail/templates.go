@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used for users without a locale and for templates missing in a locale
+const DefaultLocale = "en"
+
+// Locales are the languages the emails are written in
+var Locales = []string{"en", "el"}
+
+//go:embed templates
+var templateFiles embed.FS
+
+// Templates renders the emails from the embedded templates
+//
+// Each email has, in templates/<locale>/, a <name>.txt text body starting with
+// {{define "subject"}}...{{end}}, and an optional <name>.html body rendered in layout.html
+type Templates struct {
+	emails map[string]*emailTemplate // by locale/name
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template // nil for text only emails
+}
+
+// LoadTemplates parses the embedded templates
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{emails: map[string]*emailTemplate{}}
+	for _, locale := range Locales {
+		dir := path.Join("templates", locale)
+		layout, err := templateFiles.ReadFile(path.Join(dir, "layout.html"))
+		if err != nil {
+			return nil, err
+		}
+		names, err := fs.Glob(templateFiles, path.Join(dir, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range names {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+			email := &emailTemplate{}
+			if email.text, err = texttemplate.ParseFS(templateFiles, file); err != nil {
+				return nil, err
+			}
+			if email.text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("mail: %s has no subject", file)
+			}
+			htmlFile := path.Join(dir, name+".html")
+			if _, err := fs.Stat(templateFiles, htmlFile); err == nil {
+				if email.html, err = htmltemplate.New("layout").Parse(string(layout)); err != nil {
+					return nil, err
+				}
+				if email.html, err = email.html.ParseFS(templateFiles, htmlFile); err != nil {
+					return nil, err
+				}
+			}
+			t.emails[locale+"/"+name] = email
+		}
+	}
+	return t, nil
+}
+
+// Render renders an email in the locale, falling back to the default locale
+func (t *Templates) Render(name, locale string, data any) (*Message, error) {
+	email, ok := t.emails[locale+"/"+name]
+	if !ok {
+		locale = DefaultLocale
+		if email, ok = t.emails[locale+"/"+name]; !ok {
+			return nil, fmt.Errorf("mail: unknown template %q", name)
+		}
+	}
+
+	msg := &Message{Template: name, Locale: locale}
+	var b bytes.Buffer
+	if err := email.text.ExecuteTemplate(&b, "subject", data); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.TrimSpace(b.String())
+	b.Reset()
+	if err := email.text.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	msg.Text = strings.TrimSpace(b.String()) + "\n"
+	if email.html != nil {
+		b.Reset()
+		if err := email.html.ExecuteTemplate(&b, "layout", data); err != nil {
+			return nil, err
+		}
+		msg.HTML = b.String()
+	}
+	return msg, nil
+}
+
+// MatchLocale returns the first supported locale of an Accept-Language header, or the default locale
+func MatchLocale(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		for _, locale := range Locales {
+			if primary == locale {
+				return locale
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+// SupportedLocale tells whether emails are written in a locale
+func SupportedLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
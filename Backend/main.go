@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
 	"log"
 	"net/http"
 	"os"
@@ -9,10 +12,19 @@ import (
 	"time"
 
 	"github.com/panosmaurikos/personalisedenglish/backend/api"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
 	"github.com/panosmaurikos/personalisedenglish/backend/config"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/lti"
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
 	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
 	"github.com/panosmaurikos/personalisedenglish/backend/router"
 	"github.com/panosmaurikos/personalisedenglish/backend/services"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+	"github.com/panosmaurikos/personalisedenglish/backend/webhooks"
+	"github.com/panosmaurikos/personalisedenglish/backend/xapi"
 )
 
 func main() {
@@ -25,18 +37,183 @@ func main() {
 	defer db.Close()
 	userRepo := repositories.NewUserRepository(db)
 	userSvc := services.NewUserService(userRepo)
-	registerHandler := api.NewRegisterHandler(userSvc)
-	loginHandler := api.NewLoginHandler(userSvc)
-	forgotPasswordHandler := api.NewForgotPasswordHandler(userSvc)
+	accessTTL := services.DefaultAccessTokenTTL
+	if v := os.Getenv("ACCESS_TOKEN_TTL"); v != "" {
+		if accessTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid ACCESS_TOKEN_TTL: %v", err)
+		}
+	}
+	keys, err := auth.LoadKeySet()
+	if err != nil {
+		log.Fatalf("JWT keys error: %v", err)
+	}
+	sessionRepo := repositories.NewSessionRepository(db)
+	tokenService := services.NewTokenService(sessionRepo, userRepo, keys, accessTTL)
+	securityEventRepo := repositories.NewSecurityEventRepository(db)
+	personalTokenService := services.NewPersonalTokenService(repositories.NewPersonalTokenRepository(db), userRepo, securityEventRepo)
+	authenticator := auth.NewAuthenticator(keys, sessionRepo, personalTokenService)
+	classroomRepo := repositories.NewClassroomRepository(db)
+	var throttleStore throttle.Store
+	store := os.Getenv("THROTTLE_STORE")
+	if store == "" {
+		store = os.Getenv("LOGIN_THROTTLE_STORE") // its name before the store also limited emails
+	}
+	switch store {
+	case "", "postgres":
+		throttleStore = repositories.NewThrottleRepository(db)
+	case "memory":
+		throttleStore = throttle.NewMemoryStore(services.EmailVerificationPolicy.Window) // the longest window
+	default:
+		log.Fatalf("Invalid THROTTLE_STORE: %s", store)
+	}
+	verificationSecret := []byte(os.Getenv("EMAIL_VERIFICATION_SECRET"))
+	if jwtSecret := os.Getenv("JWT_SECRET"); len(verificationSecret) == 0 && jwtSecret != "" {
+		// A key of its own, so that the links do not sign with the key of the access tokens
+		if verificationSecret, err = hkdf.Key(sha256.New, []byte(jwtSecret), nil, "email-links", 32); err != nil {
+			log.Fatalf("Verification key error: %v", err)
+		}
+	}
+	if len(verificationSecret) == 0 {
+		log.Printf("Warning: EMAIL_VERIFICATION_SECRET is empty, verification links are signed with a random key and expire on restart")
+		verificationSecret = make([]byte, 32)
+		if _, err := rand.Read(verificationSecret); err != nil {
+			log.Fatalf("Verification key error: %v", err)
+		}
+	}
+	publicURL := os.Getenv("PUBLIC_API_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + os.Getenv("SERVER_PORT")
+	}
+	mailer, outbox, err := mail.LoadMailer()
+	if err != nil {
+		log.Fatalf("Mailer configuration error: %v", err)
+	}
+	mailTemplates, err := mail.LoadTemplates()
+	if err != nil {
+		log.Fatalf("Email templates error: %v", err)
+	}
+	emailOutboxRepo := repositories.NewEmailOutboxRepository(db)
+	emailService := services.NewEmailService(emailOutboxRepo, mailTemplates)
+	var outboxHandler *api.OutboxHandler
+	if outbox != nil {
+		outboxHandler = api.NewOutboxHandler(outbox)
+	}
+	verificationService := services.NewEmailVerificationService(userRepo, emailService, throttleStore, verificationSecret, publicURL)
+	registerHandler := api.NewRegisterHandler(userSvc, tokenService, verificationService)
+	verifyEmailHandler := api.NewVerifyEmailHandler(verificationService)
+	resendVerificationHandler := api.NewResendVerificationHandler(verificationService)
+	loginGuard := services.NewLoginGuard(throttleStore, securityEventRepo, userRepo, classroomRepo)
+	totpKey := []byte(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if jwtSecret := os.Getenv("JWT_SECRET"); len(totpKey) == 0 && jwtSecret != "" {
+		log.Printf("Warning: TOTP_ENCRYPTION_KEY is empty, two-factor secrets are encrypted with a key derived from JWT_SECRET")
+		// A key of its own, so that the secrets are not encrypted with the key of the access tokens
+		if totpKey, err = hkdf.Key(sha256.New, []byte(jwtSecret), nil, "totp-secrets", 32); err != nil {
+			log.Fatalf("Two-factor key error: %v", err)
+		}
+	}
+	if len(totpKey) == 0 {
+		log.Fatalf("TOTP_ENCRYPTION_KEY or JWT_SECRET must be set")
+	}
+	twoFactorService := services.NewTwoFactorService(repositories.NewTwoFactorRepository(db), userRepo, securityEventRepo, throttleStore, totpKey, "Personalised English", os.Getenv("REQUIRE_TEACHER_2FA") == "true")
+	trustProxy := os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	loginHandler := api.NewLoginHandler(userSvc, tokenService, loginGuard, twoFactorService, trustProxy)
+	twoFactorLoginHandler := api.NewTwoFactorLoginHandler(twoFactorService, tokenService, loginGuard, trustProxy)
+	refreshHandler := api.NewRefreshHandler(tokenService)
+	logoutHandler := api.NewLogoutHandler(tokenService)
+	forgotPasswordHandler := api.NewForgotPasswordHandler(userSvc, emailService)
+	oidcProviders, err := oidc.LoadProviders(publicURL)
+	if err != nil {
+		log.Fatalf("OIDC configuration error: %v", err)
+	}
+	ssoService := services.NewSSOService(repositories.NewIdentityRepository(db), userRepo, securityEventRepo, oidcProviders)
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	oidcHandler := api.NewOIDCHandler(ssoService, tokenService, twoFactorService, frontendURL)
+	ltiPlatforms, err := lti.LoadPlatforms()
+	if err != nil {
+		log.Fatalf("LTI configuration error: %v", err)
+	}
 	resetPasswordOTPHandler := api.NewResetPasswordOTPHandler(userSvc)
+	// Domain events of the classrooms and tests, subscribed to below
+	bus := events.NewBus()
 	testRepo := repositories.NewTestRepository(db)
-	testService := services.NewTestService(testRepo, userRepo)
-	classroomRepo := repositories.NewClassroomRepository(db)
-	classroomService := services.NewClassroomService(classroomRepo, userRepo, testRepo)
+	testService := services.NewTestService(testRepo, userRepo, bus)
+	accommodationRepo := repositories.NewAccommodationRepository(db)
+	classroomService := services.NewClassroomService(classroomRepo, userRepo, testRepo, accommodationRepo, bus)
+	accommodationService := services.NewAccommodationService(accommodationRepo, classroomRepo)
+	levelRepo := repositories.NewLevelRepository(db)
+	levelEngine, err := fuzzylogic.CurrentLevelEngine()
+	if err != nil {
+		log.Fatalf("Fuzzy engine error: %v", err)
+	}
+	levelService := services.NewLevelService(levelRepo, classroomRepo, userRepo, levelEngine, bus)
+	if err := levelService.RegisterEngine(context.Background(), levelEngine); err != nil {
+		log.Fatalf("Fuzzy engine registration error: %v", err)
+	}
+	log.Printf("Fuzzy level engine version %s", levelEngine.Version())
+	responseTimeService := services.NewResponseTimeService(repositories.NewResponseTimeRepository(db))
+	adminService := services.NewAdminService(userRepo, classroomRepo, userSvc, tokenService, emailService, securityEventRepo)
+	accountService := services.NewAccountService(userRepo, repositories.NewAccountRepository(db), sessionRepo, verificationService, throttleStore)
+	notificationService := services.NewNotificationService(repositories.NewNotificationRepository(db), verificationSecret, publicURL)
+	bus.Subscribe(notificationService.HandleEvent)
+	unsubscribeHandler := api.NewUnsubscribeHandler(notificationService)
+	digestService := services.NewDigestService(repositories.NewDigestRepository(db), emailService, notificationService, frontendURL)
+	guardianService := services.NewGuardianService(repositories.NewGuardianRepository(db), userRepo, classroomRepo, levelRepo, securityEventRepo, emailService, throttleStore)
+	// Development only: webhooks to http URLs and to private addresses (e.g. a receiver on localhost)
+	webhooksInsecure := os.Getenv("WEBHOOK_ALLOW_INSECURE") == "true"
+	webhookRepo := repositories.NewWebhookRepository(db)
+	webhookService := services.NewWebhookService(webhookRepo, classroomRepo, webhooksInsecure)
+	bus.Subscribe(webhookService.HandleEvent)
+	// xAPI statements of the learning of the students, recorded only when XAPI_SINK is set
+	xapiSink, err := xapi.LoadSink()
+	if err != nil {
+		log.Fatalf("xAPI configuration error: %v", err)
+	}
+	xapiRepo := repositories.NewXAPIRepository(db)
+	if xapiSink != nil {
+		xapiBase := os.Getenv("XAPI_BASE_IRI")
+		if xapiBase == "" {
+			xapiBase = publicURL
+		}
+		bus.Subscribe(services.NewXAPIService(xapiRepo, levelRepo, classroomRepo, xapiBase).HandleEvent)
+	}
+
+	// LTI 1.3 launches from the platforms, with the scores posted back to their gradebooks
+	var ltiHandler *api.LTIHandler
+	var ltiWorker *services.LTIWorker
+	if len(ltiPlatforms) > 0 {
+		ltiKeys, err := lti.LoadToolKeys()
+		if err != nil {
+			log.Fatalf("LTI keys error: %v", err)
+		}
+		ltiRepo := repositories.NewLTIRepository(db)
+		ltiService := services.NewLTIService(ltiRepo, ssoService, classroomRepo, testRepo, bus, ltiKeys, ltiPlatforms, publicURL)
+		bus.Subscribe(ltiService.HandleEvent)
+		ltiHandler = api.NewLTIHandler(ltiService, tokenService, twoFactorService, frontendURL)
+		ltiWorker = services.NewLTIWorker(ltiRepo, ltiKeys, ltiPlatforms)
+	}
 
 	// 4. Router setup
 	h := router.NewHandler()
-	r := h.SetupRouter(registerHandler, loginHandler, forgotPasswordHandler, resetPasswordOTPHandler, testService, classroomService, db)
+	r := h.SetupRouter(registerHandler, loginHandler, forgotPasswordHandler, resetPasswordOTPHandler, refreshHandler, logoutHandler, verifyEmailHandler, resendVerificationHandler, unsubscribeHandler, oidcHandler, ssoService, ltiHandler, twoFactorLoginHandler, twoFactorService, authenticator, keys, testService, classroomService, levelService, responseTimeService, accommodationService, loginGuard, adminService, accountService, guardianService, personalTokenService, notificationService, webhookService, outboxHandler, db)
+
+	// 5. Background jobs: delivery of the queued emails, webhooks, xAPI statements and LTI scores, weekly digests and purge of the read notifications
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go services.NewEmailOutboxWorker(emailOutboxRepo, mailer).Run(workerCtx)
+	go services.NewWebhookWorker(webhookRepo, webhooks.NewClient(webhooksInsecure)).Run(workerCtx)
+	if xapiSink != nil {
+		go services.NewXAPIWorker(xapiRepo, xapiSink).Run(workerCtx)
+	}
+	if ltiWorker != nil {
+		go ltiWorker.Run(workerCtx)
+	}
+	go notificationService.Run(workerCtx)
+	if os.Getenv("WEEKLY_DIGEST") != "false" {
+		go digestService.Run(workerCtx)
+	}
 
 	// 6. Server setup
 	srv := &http.Server{
@@ -59,6 +236,7 @@ func main() {
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Accommodation is the time accommodation profile of a student
+type Accommodation struct {
+	UserID         int        `json:"user_id"`
+	TimeMultiplier float64    `json:"time_multiplier"`
+	Untimed        bool       `json:"untimed"`
+	Notes          string     `json:"notes,omitempty"`
+	UpdatedBy      *int       `json:"updated_by,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// AccommodationRequest represents a teacher setting the accommodation of a student
+type AccommodationRequest struct {
+	TimeMultiplier float64 `json:"time_multiplier" validate:"required,gte=1,lte=4"`
+	Untimed        bool    `json:"untimed"`
+	Notes          string  `json:"notes" validate:"max=1000"`
+}
+
+// ResultTiming records the time limit and the accommodation a result was taken under
+type ResultTiming struct {
+	TimeLimitSeconds *int       `json:"time_limit_seconds,omitempty"` // nil when the test was untimed
+	TimeMultiplier   float64    `json:"time_multiplier"`
+	Untimed          bool       `json:"untimed"`
+	StartedAt        *time.Time `json:"started_at,omitempty"` // start of the attempt at a timed test
+	OverTime         bool       `json:"over_time"`            // submitted after the time limit
+}
+
+// TestAttempt is the attempt of a student at a classroom test, started when the test is opened
+// The time limit runs from its start, also when the test is opened again
+type TestAttempt struct {
+	TestID           int       `json:"test_id"`
+	StartedAt        time.Time `json:"started_at"`
+	TimeLimitSeconds *int      `json:"time_limit_seconds,omitempty"` // granted to the student, nil if untimed
+	RemainingSeconds *int      `json:"remaining_seconds,omitempty"`
+}
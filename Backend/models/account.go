@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// UpdateProfileRequest changes the username and/or the email of the current user
+// A new email must be verified again
+type UpdateProfileRequest struct {
+	Username        string `json:"username" validate:"omitempty,min=3,max=50,alphanum"`
+	Email           string `json:"email" validate:"omitempty,email"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// UpdatePreferencesRequest changes the preferences of the current user
+type UpdatePreferencesRequest struct {
+	Locale string `json:"locale" validate:"omitempty,oneof=en el"`
+}
+
+// ChangePasswordRequest changes the password of the current user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+// DeleteAccountRequest confirms the deletion of the current user's account
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// AccountExport is all the data of a user, downloaded as a JSON archive
+// The sections are lists of rows with their database columns
+type AccountExport struct {
+	ExportedAt           time.Time                `json:"exported_at"`
+	Profile              *User                    `json:"profile"`
+	LevelResults         []map[string]interface{} `json:"level_results"`
+	Answers              []map[string]interface{} `json:"answers"`
+	ClassroomTestResults []map[string]interface{} `json:"classroom_test_results"`
+	ClassroomTestAnswers []map[string]interface{} `json:"classroom_test_answers"`
+	LearningPreferences  []map[string]interface{} `json:"learning_preferences"`
+	ClassroomMemberships []map[string]interface{} `json:"classroom_memberships"`
+	Accommodation        []map[string]interface{} `json:"accommodation"`
+	LinkedIdentities     []map[string]interface{} `json:"linked_identities"`
+	SecurityEvents       []map[string]interface{} `json:"security_events"`
+	GuardianLinks        []map[string]interface{} `json:"guardian_links"`
+	// Teachers only
+	ClassroomsOwned []map[string]interface{} `json:"classrooms_owned,omitempty"`
+	TestsCreated    []map[string]interface{} `json:"tests_created,omitempty"`
+	PersonalTokens  []map[string]interface{} `json:"personal_tokens,omitempty"` // without their secret
+}
@@ -28,7 +28,8 @@ type JoinClassroomRequest struct {
 
 // AssignTestRequest represents the request to assign a test to a classroom
 type AssignTestRequest struct {
-	TestID int `json:"test_id" validate:"required,min=1"`
+	TestID           int  `json:"test_id" validate:"required,min=1"`
+	TimeLimitMinutes *int `json:"time_limit_minutes" validate:"omitempty,min=1,max=600"` // nil for untimed
 }
 
 // SubmitTestResultRequest represents a student's test submission
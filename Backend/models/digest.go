@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// DigestTest is a test a student took during the week of a digest
+type DigestTest struct {
+	Title   string    `json:"title"` // the type of a placement or practice test
+	Score   float64   `json:"score"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// DigestAssignment is a classroom test a student has not attempted yet
+type DigestAssignment struct {
+	Classroom string `json:"classroom"`
+	Title     string `json:"title"`
+}
+
+// StudentDigest is the week of a student
+type StudentDigest struct {
+	Tests       []DigestTest       `json:"tests"`
+	LevelBefore string             `json:"level_before,omitempty"` // the latest level before the week
+	LevelAfter  string             `json:"level_after,omitempty"`  // the latest level at the end of the week
+	Phenomena   []MistakeCount     `json:"phenomena"`              // most missed during the week
+	Pending     []DigestAssignment `json:"pending"`
+}
+
+// DigestStudent is a student who has not attempted some of the tests assigned in a classroom
+type DigestStudent struct {
+	Username string `json:"username"`
+	Missing  int    `json:"missing"`
+}
+
+// ClassroomDigest is the week of a classroom, for its teacher
+type ClassroomDigest struct {
+	ID             int             `json:"id"`
+	Name           string          `json:"name"`
+	Students       int             `json:"students"`
+	Tests          int             `json:"tests"`
+	Completed      int             `json:"completed"` // (student, test) pairs with a result
+	CompletedWeek  int             `json:"completed_week"`
+	CompletionRate float64         `json:"completion_rate"` // percentage of the assigned (student, test) pairs
+	NotAttempted   []DigestStudent `json:"not_attempted"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Delivery states of the emails in the outbox
+const (
+	OutboxPending = "pending" // waiting for its next attempt
+	OutboxSent    = "sent"
+	OutboxDead    = "dead" // given up on, until an administrator retries it
+)
+
+// OutboxEmail is an email queued in the outbox
+// Its bodies are erased once it is sent
+type OutboxEmail struct {
+	ID             int64      `json:"id"`
+	IdempotencyKey string     `json:"idempotency_key"`
+	Recipients     []string   `json:"recipients"`
+	Subject        string     `json:"subject"`
+	Text           string     `json:"-"`
+	HTML           string     `json:"-"`
+	Unsubscribe    *string    `json:"unsubscribe_url,omitempty"`
+	Template       string     `json:"template"`
+	Locale         string     `json:"locale"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// GuardianInvite is a single use code a student or teacher hands to a guardian
+type GuardianInvite struct {
+	Code      string    `json:"code"` // only returned when the invite is created
+	StudentID int       `json:"student_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	EmailSent bool      `json:"email_sent"`
+}
+
+// CreateGuardianInviteRequest optionally emails the invite code to the guardian
+type CreateGuardianInviteRequest struct {
+	Email  string `json:"email" validate:"omitempty,email"`
+	Locale string `json:"locale" validate:"omitempty,oneof=en el"` // of the email, the inviter's if empty
+}
+
+// RedeemGuardianInviteRequest represents a guardian linking a student with an invite code
+type RedeemGuardianInviteRequest struct {
+	Code string `json:"code" validate:"required,len=12"`
+}
+
+// GuardianLink is a guardian's read-only access to a student
+type GuardianLink struct {
+	GuardianID int       `json:"guardian_id"`
+	StudentID  int       `json:"student_id"`
+	Username   string    `json:"username"` // of the other side of the link
+	Email      string    `json:"email,omitempty"`
+	InvitedBy  *int      `json:"invited_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TestHistoryEntry is one completed test in the history of a student
+type TestHistoryEntry struct {
+	TestID      int     `json:"test_id"`
+	Score       float64 `json:"score"`
+	AvgTime     float64 `json:"avg_time"`
+	Level       string  `json:"level"`
+	TestType    string  `json:"test_type"`
+	CompletedAt string  `json:"completed_at"`
+}
+
+// MistakeCount is the number of wrong answers of a student in a category or phenomenon
+type MistakeCount struct {
+	Category   string `json:"category,omitempty"`
+	Phenomenon string `json:"phenomenon,omitempty"`
+	Count      int    `json:"count"`
+}
+
+// StudentMistakes groups the mistakes of a student by category and by phenomenon
+type StudentMistakes struct {
+	Categories []MistakeCount `json:"categories"`
+	Phenomena  []MistakeCount `json:"phenomena"`
+}
+
+// GuardianAssignment is a test assigned to a student in a classroom, with the student's latest result
+type GuardianAssignment struct {
+	ClassroomID   int        `json:"classroom_id"`
+	ClassroomName string     `json:"classroom_name"`
+	Teacher       string     `json:"teacher"`
+	TestID        int        `json:"test_id"`
+	Title         string     `json:"title"`
+	Type          string     `json:"type"`
+	Completed     bool       `json:"completed"`
+	Score         *float64   `json:"score,omitempty"`
+	TakenAt       *time.Time `json:"taken_at,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// LevelResult is a placement/practice result with its fuzzy level
+type LevelResult struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	Score           float64    `json:"score"`
+	AvgResponseTime float64    `json:"avg_response_time"`
+	SpeedRatio      *float64   `json:"speed_ratio,omitempty"` // before the accommodation is applied
+	TimeMultiplier  float64    `json:"time_multiplier"`
+	Untimed         bool       `json:"untimed"`
+	FuzzyLevel      string     `json:"fuzzy_level"`
+	LevelScore      *float64   `json:"level_score,omitempty"`
+	EngineVersion   *string    `json:"engine_version,omitempty"`
+	ConfirmedLevel  *string    `json:"confirmed_level,omitempty"`
+	ConfirmedBy     *int       `json:"confirmed_by,omitempty"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	TestType        string     `json:"test_type"`
+	TakenAt         time.Time  `json:"taken_at"`
+}
+
+// ConfirmLevelRequest represents a teacher confirming the level of a student's result
+type ConfirmLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=Beginner Intermediate Advanced"`
+}
+
+// LevelChange is the level of a result before and after a recomputation
+type LevelChange struct {
+	ResultID      int      `json:"result_id"`
+	UserID        int      `json:"user_id"`
+	OldLevel      string   `json:"old_level"`
+	NewLevel      string   `json:"new_level"`
+	OldLevelScore *float64 `json:"old_level_score,omitempty"`
+	NewLevelScore float64  `json:"new_level_score"`
+	OldVersion    *string  `json:"old_version,omitempty"`
+}
+
+// RecomputeReport is the before/after diff of recomputing historical levels under an engine version
+type RecomputeReport struct {
+	EngineVersion string                    `json:"engine_version"`
+	Total         int                       `json:"total"`
+	Changed       int                       `json:"changed"`
+	Transitions   map[string]map[string]int `json:"transitions"` // old level -> new level -> count
+	Changes       []LevelChange             `json:"changes"`     // all recomputed results
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Delivery states of the scores posted to the LTI platforms
+const (
+	LTIScorePending = "pending" // waiting for its next attempt
+	LTIScoreSent    = "sent"
+	LTIScoreFailed  = "failed" // rejected by the platform, or given up on
+)
+
+// LTILaunchState is a pending LTI launch, from the login initiation to the launch
+type LTILaunchState struct {
+	State         string
+	Platform      string
+	Nonce         string
+	TargetLinkURI string
+	ExpiresAt     time.Time
+}
+
+// LTIContext is a course of a platform (LMS) mapped to a classroom
+type LTIContext struct {
+	ID          int       `json:"id"`
+	Platform    string    `json:"platform"`
+	ContextID   string    `json:"context_id"`
+	ClassroomID int       `json:"classroom_id"`
+	Title       string    `json:"title"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LTIResourceLink is a placement of the tool in a course, launching a teacher test
+type LTIResourceLink struct {
+	ID             int       `json:"id"`
+	Platform       string    `json:"platform"`
+	ResourceLinkID string    `json:"resource_link_id"`
+	DeploymentID   string    `json:"deployment_id"`
+	ContextID      *int      `json:"context_id,omitempty"` // the LTIContext, nil for links outside a course
+	TestID         *int      `json:"test_id,omitempty"`    // nil until a test is linked
+	LineItem       string    `json:"line_item,omitempty"`  // where its scores go, empty if ungraded
+	Title          string    `json:"title"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LTIDeepLinkRequest is a Deep Linking request of a teacher waiting for the choice of a test
+type LTIDeepLinkRequest struct {
+	ID           string
+	Platform     string
+	DeploymentID string
+	UserID       int
+	ReturnURL    string
+	Data         string
+	ExpiresAt    time.Time
+}
+
+// LTIScore is the score of a classroom test result queued for the line item of a resource link
+type LTIScore struct {
+	ID             int64      `json:"id"`
+	ResourceLinkID int        `json:"resource_link_id"`
+	ResultID       int        `json:"result_id"`
+	Platform       string     `json:"platform"`
+	LineItem       string     `json:"line_item"`
+	UserSubject    string     `json:"user_subject"`
+	Score          float64    `json:"score"`
+	ScoreMaximum   float64    `json:"score_maximum"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+}
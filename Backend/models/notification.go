@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of notifications users can turn off
+const (
+	NotificationWeeklyDigest     = "weekly_digest"
+	NotificationTestAssigned     = "test_assigned"     // a test assigned in a classroom of the student
+	NotificationTestChanged      = "test_changed"      // an assigned test changed, unassigned or deleted
+	NotificationClassroomRemoved = "classroom_removed" // the student removed from a classroom
+	NotificationStudentJoined    = "student_joined"    // a student joined a classroom of the teacher
+	NotificationTestCompleted    = "test_completed"    // a student completed a test of the teacher
+)
+
+// Channels the notifications are delivered by
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "in_app"
+)
+
+// NotificationTypes lists the notification types, in the order they are shown
+var NotificationTypes = []string{
+	NotificationTestAssigned,
+	NotificationTestChanged,
+	NotificationClassroomRemoved,
+	NotificationStudentJoined,
+	NotificationTestCompleted,
+	NotificationWeeklyDigest,
+}
+
+// NotificationKind tells who gets a type of notification, and by which channels
+type NotificationKind struct {
+	Roles    []string
+	Channels []string
+}
+
+// NotificationKinds describes the notification types
+var NotificationKinds = map[string]NotificationKind{
+	NotificationWeeklyDigest:     {Roles: []string{RoleStudent, RoleTeacher}, Channels: []string{ChannelEmail}},
+	NotificationTestAssigned:     {Roles: []string{RoleStudent}, Channels: []string{ChannelInApp}},
+	NotificationTestChanged:      {Roles: []string{RoleStudent}, Channels: []string{ChannelInApp}},
+	NotificationClassroomRemoved: {Roles: []string{RoleStudent}, Channels: []string{ChannelInApp}},
+	NotificationStudentJoined:    {Roles: []string{RoleTeacher}, Channels: []string{ChannelInApp}},
+	NotificationTestCompleted:    {Roles: []string{RoleTeacher}, Channels: []string{ChannelInApp}},
+}
+
+// NotificationPreference tells whether a user gets a type of notification, by channel
+// In updates a channel left out keeps its setting
+type NotificationPreference struct {
+	Type      string     `json:"type" validate:"required,oneof=weekly_digest test_assigned test_changed classroom_removed student_joined test_completed"`
+	Email     *bool      `json:"email,omitempty"`
+	InApp     *bool      `json:"in_app,omitempty"`
+	Channels  []string   `json:"channels,omitempty"`   // the channels of the type, in responses
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // nil while the default applies
+}
+
+// UpdateNotificationPreferencesRequest changes some notification preferences of the current user
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreference `json:"preferences" validate:"required,min=1,dive"`
+}
+
+// Notification is a message in the notification center of a user
+type Notification struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Link      string          `json:"link,omitempty"` // a page of the frontend
+	Data      json.RawMessage `json:"data,omitempty"` // ids of what it is about, by type
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+}
+
+// NotificationList is a page of the notifications of a user, newest first
+type NotificationList struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"` // unread notifications in all
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Scopes of personal access tokens
+const (
+	ScopeReadTests       = "read:tests"
+	ScopeWriteTests      = "write:tests"
+	ScopeReadClassrooms  = "read:classrooms"
+	ScopeWriteClassrooms = "write:classrooms"
+	ScopeReadResults     = "read:results"
+)
+
+// PersonalTokenScopes lists the scopes a personal access token can be given
+var PersonalTokenScopes = []string{ScopeReadTests, ScopeWriteTests, ScopeReadClassrooms, ScopeWriteClassrooms, ScopeReadResults}
+
+// PersonalToken is a named, scoped token for scripts and integrations
+// Only its SHA-256 hash is stored; the token itself is shown once, when created
+type PersonalToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the token, to recognise it
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil when the token does not expire
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatePersonalTokenRequest represents a teacher creating a personal access token
+type CreatePersonalTokenRequest struct {
+	Name          string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=read:tests write:tests read:classrooms write:classrooms read:results"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"` // 0 for no expiry
+}
+
+// CreatedPersonalToken is returned once, when a token is created
+type CreatedPersonalToken struct {
+	PersonalToken
+	Token string `json:"token"`
+}
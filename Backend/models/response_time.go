@@ -0,0 +1,15 @@
+package models
+
+// QuestionFeatures are the properties of a placement question which explain its response time
+type QuestionFeatures struct {
+	QuestionID   int    `json:"question_id"`
+	QuestionType string `json:"question_type"`
+	TextLength   int    `json:"text_length"`
+	Difficulty   int    `json:"difficulty"`
+}
+
+// TimedAnswer is the response time of an answer to a placement question
+type TimedAnswer struct {
+	QuestionFeatures
+	ResponseTime float64 `json:"response_time"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Security event types
+const (
+	EventLoginFailed     = "login_failed"
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventLoginBlocked    = "login_blocked" // attempt on a locked account
+	EventAccountUnlocked = "account_unlocked"
+	EventIdentityLinked  = "identity_linked" // external identity linked or account provisioned from it
+	EventTwoFactorFailed = "two_factor_failed"
+	EventTwoFactorChange = "two_factor_changed" // enabled, disabled or recovery codes regenerated
+	// Administrator actions (ActorID is the administrator)
+	EventRoleChanged         = "role_changed"
+	EventAccountDisabled     = "account_disabled"
+	EventAccountEnabled      = "account_enabled"
+	EventPasswordResetForced = "password_reset_forced"
+	// Guardian links (UserID is the student, ActorID the guardian or the student)
+	EventGuardianLinked   = "guardian_linked"
+	EventGuardianUnlinked = "guardian_unlinked"
+	// Personal access token created or revoked
+	EventPersonalTokenChange = "personal_token_changed"
+)
+
+// SecurityEvent is an entry of the security audit log
+type SecurityEvent struct {
+	ID        int       `json:"id"`
+	EventType string    `json:"event_type"`
+	UserID    *int      `json:"user_id,omitempty"`  // the account concerned, if known
+	ActorID   *int      `json:"actor_id,omitempty"` // who performed the action (e.g. the unlocking teacher)
+	IP        string    `json:"ip,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Session is a login session: the family of the refresh tokens rotated from a login
+type Session struct {
+	ID            string     `json:"id"`
+	UserID        int        `json:"user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason *string    `json:"revoked_reason,omitempty"`
+}
+
+// RefreshToken is a single use refresh token of a session (only its hash is stored)
+type RefreshToken struct {
+	ID        int
+	SessionID string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time // set when the token is rotated
+}
+
+// TokenPair is returned on login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // lifetime of the access token in seconds
+}
+
+// RefreshRequest represents a request to rotate a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest represents a logout, of the current session or of all sessions of the user
+type LogoutRequest struct {
+	All bool `json:"all"`
+}
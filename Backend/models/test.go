@@ -11,6 +11,8 @@ type Test struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	Questions   []Question `json:"questions,omitempty"`
+	// Time limit of a classroom assignment (students get it with their accommodation applied)
+	TimeLimitSeconds *int `json:"time_limit_seconds,omitempty"` // nil for untimed assignments
 }
 
 type Question struct {
@@ -37,3 +39,28 @@ type UpdateTestRequest struct {
 	Type        string     `json:"type" validate:"omitempty,oneof=vocabulary grammar reading listening mixed"`
 	Questions   []Question `json:"questions" validate:"omitempty,dive"`
 }
+
+// ImportTestRequest holds the form fields of a test import; the file comes alongside
+type ImportTestRequest struct {
+	Format       string `json:"format" validate:"omitempty,oneof=qti moodle gift aiken"` // detected when empty
+	Title        string `json:"title" validate:"omitempty,max=255"`                      // the one of the file when empty
+	Description  string `json:"description" validate:"max=1000"`
+	Type         string `json:"type" validate:"required,oneof=vocabulary grammar reading listening mixed"`
+	QuestionType string `json:"question_type" validate:"omitempty,oneof=vocabulary grammar reading listening"` // required for mixed tests
+}
+
+// ImportIssue is an item of an imported file which could not be converted to a question
+type ImportIssue struct {
+	Item   int    `json:"item"` // position in the file, from 1
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// TestImport is the outcome of an import: the test the file converts to, and the test created from it
+// unless the import was a preview
+type TestImport struct {
+	Format  string            `json:"format"`
+	Test    CreateTestRequest `json:"test"`
+	Skipped []ImportIssue     `json:"skipped"`
+	Created *Test             `json:"created,omitempty"`
+}
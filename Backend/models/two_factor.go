@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Purposes of a second step challenge
+const (
+	MFAPurposeVerify = "verify" // the user enters a code of their authenticator
+	MFAPurposeEnroll = "enroll" // 2FA is required and the user sets it up
+)
+
+// TOTPEnrollment is the TOTP secret of a user
+type TOTPEnrollment struct {
+	UserID      int
+	Secret      string // encrypted as stored, decrypted by the service
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+// MFAChallenge is the pending second step of a login (only the hash of its token is stored)
+type MFAChallenge struct {
+	UserID    int
+	Purpose   string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// TwoFactorStatus describes the 2FA of a user
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Required               bool       `json:"required"`
+	ConfirmedAt            *time.Time `json:"confirmed_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetup is returned when enrolling: the secret to enter or scan in an authenticator app
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code (or a recovery code)
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginSecondStepRequest completes a login with the token of its first step
+type LoginSecondStepRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
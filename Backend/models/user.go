@@ -9,12 +9,91 @@ type User struct {
 	Username   string    `json:"username" validate:"required,min=3,max=50,alphanum"`
 	Email      string    `json:"email" validate:"required,email"`
 	Password   string    `json:"-"`
-	Role       string    `json:"role" validate:"required,oneof=student teacher"`
+	Role       string    `json:"role" validate:"required,oneof=student teacher guardian admin"`
+	// EmailVerifiedAt is nil until the user confirms their email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// DisabledAt is set while an administrator has disabled the account
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// PasswordResetRequired refuses password logins until the password is reset with an emailed code
+	PasswordResetRequired bool `json:"password_reset_required"`
+	// DeletedAt is set once the user deleted their account (the account is anonymised and disabled)
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Locale is the language of the emails sent to the user
+	Locale string `json:"locale"`
+}
+
+// User roles
+const (
+	RoleStudent  = "student"
+	RoleTeacher  = "teacher"
+	RoleGuardian = "guardian" // read-only access to the progress of linked students
+	RoleAdmin    = "admin"
+)
+
+// EmailVerified tells whether the user has confirmed their email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// Disabled tells whether the account is disabled
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
 }
 
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required,min=3,max=50,alphanum"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
-	Role     string `json:"role" validate:"required,oneof=student teacher"`
+	Role     string `json:"role" validate:"required,oneof=student teacher guardian"`
+}
+
+// PasswordReset is the active password reset code of a user (only its hash is stored)
+type PasswordReset struct {
+	ID          int
+	UserID      int
+	Email       string // the email the code was sent to
+	CodeHash    string
+	Attempts    int
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LockedUntil *time.Time
+}
+
+// ForgotPasswordRequest represents a request for a password reset code
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents a password reset with the code sent by email
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required,len=6,numeric"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+// VerifyEmailRequest represents the confirmation of an email with the token of a verification link
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// UserFilter selects and pages the users listed to administrators
+type UserFilter struct {
+	Query    string // part of the username or email
+	Role     string
+	Status   string // "active", "disabled" or empty for all
+	Page     int    // from 1
+	PageSize int
+}
+
+// UserPage is a page of users
+type UserPage struct {
+	Users    []User `json:"users"`
+	Total    int    `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+// ChangeRoleRequest represents an administrator changing the role of a user
+type ChangeRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=student teacher guardian admin"`
 }
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Events teachers can subscribe webhooks to
+const (
+	WebhookTestCompleted      = "test.completed"
+	WebhookPlacementCompleted = "placement.completed"
+	WebhookClassroomJoined    = "classroom.joined"
+	WebhookLevelChanged       = "level.changed"
+	WebhookPing               = "ping" // sent on request, to test a subscription
+)
+
+// WebhookEvents lists the events webhooks can be subscribed to
+var WebhookEvents = []string{WebhookTestCompleted, WebhookPlacementCompleted, WebhookClassroomJoined, WebhookLevelChanged}
+
+// Delivery states of the webhook deliveries
+const (
+	WebhookPending   = "pending" // waiting for its next attempt
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed" // given up on, until redelivered
+)
+
+// WebhookSubscription is an endpoint of a teacher receiving some events
+// Its secret signs the requests; it is only shown when the subscription is created or the secret rotated
+type WebhookSubscription struct {
+	ID          int       `json:"id"`
+	TeacherID   int       `json:"teacher_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CreateWebhookRequest represents a teacher subscribing an endpoint to some events
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Description string   `json:"description" validate:"max=255"`
+	Events      []string `json:"events" validate:"required,min=1,dive,oneof=test.completed placement.completed classroom.joined level.changed"`
+}
+
+// UpdateWebhookRequest changes a subscription; the fields left out are kept
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url" validate:"omitempty,url,max=2048"`
+	Description *string  `json:"description" validate:"omitempty,max=255"`
+	Events      []string `json:"events" validate:"omitempty,min=1,dive,oneof=test.completed placement.completed classroom.joined level.changed"`
+	Active      *bool    `json:"active"`
+}
+
+// WebhookDelivery is an event sent, or to send, to a subscription, with the outcome of its last attempt
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	LastResponse   *string         `json:"last_response,omitempty"`
+	RedeliveryOf   *int64          `json:"redelivery_of,omitempty"` // the delivery this one sends again
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// The endpoint, when the delivery is claimed for an attempt
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookPayload is the body of the webhook requests
+type WebhookPayload struct {
+	ID        string    `json:"id"` // the id of the event, to deduplicate retries and redeliveries
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Delivery states of the queued xAPI statements
+const (
+	XAPIPending = "pending" // waiting for its next attempt
+	XAPISent    = "sent"
+	XAPIFailed  = "failed" // rejected by the LRS, or given up on
+)
+
+// XAPIStatement is an xAPI statement queued for the Learning Record Store
+type XAPIStatement struct {
+	ID            int64           `json:"id"`
+	StatementID   string          `json:"statement_id"`
+	Statement     json.RawMessage `json:"statement"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	SentAt        *time.Time      `json:"sent_at,omitempty"`
+}
+
+// AnsweredQuestion is an answer of a result with its question, recorded as an xAPI statement
+type AnsweredQuestion struct {
+	ID            int // the id of the answer
+	QuestionID    int
+	QuestionText  string
+	QuestionType  string
+	Options       map[string]string // the choices, by letter
+	Selected      string
+	CorrectAnswer string
+	IsCorrect     bool
+	ResponseTime  *float64 // seconds
+	AnsweredAt    time.Time
+}
@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// LoadProviders reads the identity providers from the environment:
+//
+//	OIDC_PROVIDERS                 comma separated provider names, e.g. "school"
+//	OIDC_<NAME>_ISSUER             issuer URL (discovery)
+//	OIDC_<NAME>_CLIENT_ID
+//	OIDC_<NAME>_CLIENT_SECRET      empty for a public client
+//	OIDC_<NAME>_DISPLAY_NAME       login button label (default: the name)
+//	OIDC_<NAME>_SCOPES             default "openid email profile"
+//	OIDC_<NAME>_ROLE_CLAIM         claim mapped to the teacher role, e.g. "groups"
+//	OIDC_<NAME>_TEACHER_VALUES     comma separated values of the claim meaning teacher
+//
+// The callback URL to register at the provider is publicURL/auth/oidc/<name>/callback
+func LoadProviders(publicURL string) ([]*Provider, error) {
+	var providers []*Provider
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		name = strings.ToLower(name)
+		if !providerName.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := Config{
+			Name:          name,
+			DisplayName:   os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:   strings.TrimRight(publicURL, "/") + "/auth/oidc/" + name + "/callback",
+			Scopes:        strings.Fields(os.Getenv(prefix + "SCOPES")),
+			RoleClaim:     os.Getenv(prefix + "ROLE_CLAIM"),
+			TeacherValues: splitList(os.Getenv(prefix + "TEACHER_VALUES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+		if cfg.DisplayName == "" {
+			cfg.DisplayName = name
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers = append(providers, NewProvider(cfg, nil))
+	}
+	return providers, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// allowedAlgorithms are the id token signatures accepted (never "none" nor HMAC)
+var allowedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// IDToken holds the verified claims of an id token
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string // preferred_username
+	Claims        jwt.MapClaims
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce of an id token
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	// The kid is read before verification to refresh the provider keys if needed
+	unverified, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	verifier, err := p.keys(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	err = verifier.ParseWithClaims(raw, claims,
+		jwt.WithValidMethods(allowedAlgorithms),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	// With several audiences, the authorized party shall be us (OpenID Connect Core 3.1.3.7)
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, errors.New("invalid id token: azp is not the client")
+		}
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, errors.New("invalid id token: no subject")
+	}
+
+	token := &IDToken{Issuer: p.Issuer, Subject: sub, Claims: claims}
+	token.Email, _ = claims["email"].(string)
+	token.Name, _ = claims["name"].(string)
+	token.Username, _ = claims["preferred_username"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		token.EmailVerified = v
+	case string: // some providers send it as a string
+		token.EmailVerified = v == "true"
+	}
+	return token, nil
+}
+
+// IsTeacher tells whether the role claim of the token holds one of the teacher values
+// The claim may be a string (space or comma separated) or an array of strings
+func (p *Provider) IsTeacher(token *IDToken) bool {
+	if p.RoleClaim == "" || len(p.TeacherValues) == 0 {
+		return false
+	}
+	var values []string
+	switch v := token.Claims[p.RoleClaim].(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, value := range values {
+		if slices.ContainsFunc(p.TeacherValues, func(t string) bool { return strings.EqualFold(t, value) }) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+)
+
+const (
+	// jwksRefreshInterval is the minimum delay between two downloads of the keys of an issuer
+	jwksRefreshInterval = 5 * time.Minute
+	maxResponseBody     = 1 << 20
+)
+
+// RemoteKeys caches the signing keys an issuer (identity provider, LTI platform) publishes at a JWKS URL
+// The keys are downloaded on first use and again on unknown key ids (key rotation at the issuer)
+type RemoteKeys struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	url       string // of the cached keys
+	verifier  *auth.Verifier
+	fetchedAt time.Time
+}
+
+// NewRemoteKeys creates a RemoteKeys; nothing is downloaded before the first verification
+func NewRemoteKeys(client *http.Client) *RemoteKeys {
+	return &RemoteKeys{client: client}
+}
+
+// Verifier returns the verifier of the keys at url, downloading them again when kid is unknown,
+// at most once per jwksRefreshInterval
+func (k *RemoteKeys) Verifier(ctx context.Context, url, kid string) (*auth.Verifier, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.verifier != nil && k.url == url && (k.verifier.HasKey(kid) || time.Since(k.fetchedAt) < jwksRefreshInterval) {
+		return k.verifier, nil
+	}
+	var set struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+	if err := GetJSON(ctx, k.client, url, &set); err != nil {
+		return nil, err
+	}
+	var keys []*auth.Key
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		key, err := j.Key()
+		if err != nil {
+			continue // Key types we do not support
+		}
+		keys = append(keys, key)
+	}
+	k.url = url
+	k.verifier = auth.NewVerifier(keys...)
+	k.fetchedAt = time.Now()
+	return k.verifier, nil
+}
+
+// GetJSON downloads a JSON document (discovery documents, key sets) into v
+func GetJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(v)
+}
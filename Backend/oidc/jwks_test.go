@@ -0,0 +1,86 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+)
+
+func TestRemoteKeysRotation(t *testing.T) {
+	newKeys := func(kid string) *auth.KeySet {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := auth.NewKeySet(auth.NewEdDSAKey(kid, private))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	var published atomic.Pointer[auth.KeySet]
+	published.Store(newKeys("k1"))
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		json.NewEncoder(w).Encode(published.Load().JWKS())
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	remote := NewRemoteKeys(server.Client())
+	for range 3 {
+		v, err := remote.Verifier(ctx, server.URL, "k1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.HasKey("k1") {
+			t.Fatal("k1 missing")
+		}
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("%d downloads of known keys, want 1", n)
+	}
+
+	// Unknown kids do not download the keys again within the refresh interval
+	published.Store(newKeys("k2"))
+	if v, err := remote.Verifier(ctx, server.URL, "k2"); err != nil || v.HasKey("k2") || downloads.Load() != 1 {
+		t.Fatalf("keys downloaded again within the interval (%d downloads, %v)", downloads.Load(), err)
+	}
+
+	// The issuer rotated its key: after the interval, the unknown kid downloads the keys again
+	remote.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	v, err := remote.Verifier(ctx, server.URL, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.HasKey("k2") || downloads.Load() != 2 {
+		t.Errorf("rotated key not downloaded (%d downloads)", downloads.Load())
+	}
+
+	// Keys of another URL are not taken from the cache
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(newKeys("k3").JWKS())
+	}))
+	defer other.Close()
+	if v, err := remote.Verifier(ctx, other.URL, "k3"); err != nil || !v.HasKey("k3") {
+		t.Errorf("keys of another URL: %v", err)
+	}
+}
+
+func TestGetJSONStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	var v map[string]any
+	if err := GetJSON(context.Background(), server.Client(), server.URL, &v); err == nil {
+		t.Error("no error on a 404")
+	}
+}
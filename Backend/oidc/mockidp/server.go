@@ -0,0 +1,264 @@
+// Package mockidp is a minimal OpenID Connect identity provider for local development and tests
+// It signs in any of its configured users without password
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+)
+
+const codeTTL = time.Minute
+
+// User is an identity of the mock provider
+type User struct {
+	Subject       string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+	Username      string   `json:"preferred_username"`
+	Groups        []string `json:"groups"`
+}
+
+// DefaultUsers are a student, a teacher and a student with an unverified email
+var DefaultUsers = []User{
+	{Subject: "mock-student-1", Email: "student1@school.example", EmailVerified: true, Name: "Student One", Username: "student1", Groups: []string{"students"}},
+	{Subject: "mock-teacher-1", Email: "teacher1@school.example", EmailVerified: true, Name: "Teacher One", Username: "teacher1", Groups: []string{"teachers"}},
+	{Subject: "mock-student-2", Email: "student2@school.example", EmailVerified: false, Name: "Student Two", Username: "student2", Groups: []string{"students"}},
+}
+
+// Config configures the mock provider
+type Config struct {
+	Issuer       string // base URL the provider is served at
+	ClientID     string
+	ClientSecret string   // empty: public client, authenticated by PKCE only
+	RedirectURIs []string // allowed redirect URIs, any if empty
+	Users        []User
+}
+
+type pendingCode struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+	expiresAt   time.Time
+}
+
+// Server is the mock provider
+type Server struct {
+	cfg   Config
+	keys  *auth.KeySet
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+// NewServer creates a mock provider with a fresh RSA signing key
+func NewServer(cfg Config) (*Server, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.NewKeySet(auth.NewRSAKey("mock-idp", private))
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Users) == 0 {
+		cfg.Users = DefaultUsers
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Server{cfg: cfg, keys: keys, codes: map[string]pendingCode{}}, nil
+}
+
+// Handler serves the discovery document, the keys and the authorization and token endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	return mux
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.cfg.Issuer,
+		"authorization_endpoint":                s.cfg.Issuer + "/authorize",
+		"token_endpoint":                        s.cfg.Issuer + "/token",
+		"jwks_uri":                              s.cfg.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile", "groups"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+var chooseUserPage = template.Must(template.New("choose").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mock identity provider</title></head>
+<body style="font-family: sans-serif; margin: 3em">
+<h2>Mock identity provider</h2>
+<p>Sign in as:</p>
+<ul>{{range .}}<li><a href="{{.URL}}">{{.User.Name}}</a> ({{.User.Email}}, groups: {{range .User.Groups}}{{.}} {{end}})</li>{{end}}</ul>
+</body></html>`))
+
+// authorize signs in the user given by login_hint, or lets the user choose one
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("client_id") != s.cfg.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if redirectURI == "" || (len(s.cfg.RedirectURIs) > 0 && !slices.Contains(s.cfg.RedirectURIs, redirectURI)) {
+		http.Error(w, "redirect_uri not allowed", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		redirectWith(w, r, redirectURI, url.Values{"error": {"invalid_request"}, "state": {q.Get("state")}})
+		return
+	}
+	if !slices.Contains(strings.Fields(q.Get("scope")), "openid") {
+		redirectWith(w, r, redirectURI, url.Values{"error": {"invalid_scope"}, "state": {q.Get("state")}})
+		return
+	}
+
+	hint := q.Get("login_hint")
+	i := slices.IndexFunc(s.cfg.Users, func(u User) bool { return hint != "" && (u.Subject == hint || u.Username == hint || u.Email == hint) })
+	if i < 0 {
+		type choice struct {
+			User User
+			URL  string
+		}
+		var choices []choice
+		for _, u := range s.cfg.Users {
+			cq := r.URL.Query()
+			cq.Set("login_hint", u.Subject)
+			choices = append(choices, choice{User: u, URL: "/authorize?" + cq.Encode()})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		chooseUserPage.Execute(w, choices)
+		return
+	}
+
+	code, err := oidc.RandomString(24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.codes[code] = pendingCode{
+		user:        s.cfg.Users[i],
+		redirectURI: redirectURI,
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		expiresAt:   time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+	redirectWith(w, r, redirectURI, url.Values{"code": {code}, "state": {q.Get("state")}})
+}
+
+// token redeems an authorization code for an id token
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.cfg.ClientID || subtle.ConstantTimeCompare([]byte(secret), []byte(s.cfg.ClientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mock-idp"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	pending, ok := s.codes[code]
+	delete(s.codes, code) // single use
+	s.mu.Unlock()
+	if !ok || time.Now().After(pending.expiresAt) || pending.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	if oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != pending.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	u := pending.user
+	idToken, err := s.keys.Sign(jwt.MapClaims{
+		"iss":                s.cfg.Issuer,
+		"sub":                u.Subject,
+		"aud":                s.cfg.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              pending.nonce,
+		"email":              u.Email,
+		"email_verified":     u.EmailVerified,
+		"name":               u.Name,
+		"preferred_username": u.Username,
+		"groups":             u.Groups,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, _ := oidc.RandomString(24)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func redirectWith(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
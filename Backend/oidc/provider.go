@@ -0,0 +1,183 @@
+// Package oidc implements the relying party side of OpenID Connect (authorization code flow with PKCE)
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+)
+
+// Config is the configuration of an identity provider
+type Config struct {
+	Name         string // identifies the provider in URLs and linked identities
+	DisplayName  string // shown on the login button
+	Issuer       string // discovery is done at Issuer + /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string   // empty for a public client (PKCE only)
+	RedirectURL  string   // our callback URL, registered at the provider
+	Scopes       []string // openid is always requested
+	// RoleClaim is the claim mapped to the teacher role (e.g. "groups", "roles", "eduPersonAffiliation")
+	// Users whose claim holds one of TeacherValues are teachers, the others students
+	RoleClaim     string
+	TeacherValues []string
+}
+
+// Metadata is the part of the discovery document used by the relying party
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an identity provider the users can sign in with
+// Its metadata and keys are downloaded on first use and the keys refreshed on unknown key ids
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	jwks     *RemoteKeys
+}
+
+// NewProvider creates a Provider; nothing is downloaded before the first login
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{Config: cfg, client: client, jwks: NewRemoteKeys(client)}
+}
+
+// Metadata returns the discovery document of the provider
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discover(ctx)
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var m Metadata
+	wellKnown := strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := GetJSON(ctx, p.client, wellKnown, &m); err != nil {
+		return nil, fmt.Errorf("oidc discovery of %s: %w", p.Name, err)
+	}
+	// The issuer shall be the one configured (OpenID Connect Discovery 4.3)
+	if m.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery of %s: issuer %q does not match %q", p.Name, m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery of %s: incomplete metadata", p.Name)
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// keys returns the verifier of the provider keys, downloaded again on unknown key ids
+func (p *Provider) keys(ctx context.Context, kid string) (*auth.Verifier, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := p.jwks.Verifier(ctx, m.JWKSURI, kid)
+	if err != nil {
+		return nil, fmt.Errorf("oidc keys of %s: %w", p.Name, err)
+	}
+	return verifier, nil
+}
+
+// AuthCodeURL returns the URL of the provider the user is redirected to
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.scopes(), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, s := range p.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// tokenResponse is the answer of the token endpoint
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code (with its PKCE verifier) and returns the verified id token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tr tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("oidc token response of %s: %w", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("oidc token request to %s failed: %s %s", p.Name, tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return nil, errors.New("oidc token response without id_token")
+	}
+	return p.VerifyIDToken(ctx, tr.IDToken, nonce)
+}
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type AccommodationRepository struct {
+	db *sql.DB
+}
+
+func NewAccommodationRepository(db *sql.DB) *AccommodationRepository {
+	return &AccommodationRepository{db: db}
+}
+
+func (r *AccommodationRepository) GetAccommodation(ctx context.Context, userID int) (*models.Accommodation, error) {
+	query := `
+        SELECT user_id, time_multiplier, untimed, COALESCE(notes, ''), updated_by, updated_at
+        FROM student_accommodations
+        WHERE user_id = $1`
+	var a models.Accommodation
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&a.UserID, &a.TimeMultiplier, &a.Untimed, &a.Notes, &a.UpdatedBy, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *AccommodationRepository) SetAccommodation(ctx context.Context, a *models.Accommodation) error {
+	query := `
+        INSERT INTO student_accommodations (user_id, time_multiplier, untimed, notes, updated_by, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        ON CONFLICT (user_id) DO UPDATE
+        SET time_multiplier = EXCLUDED.time_multiplier, untimed = EXCLUDED.untimed,
+            notes = EXCLUDED.notes, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+        RETURNING updated_at`
+	return r.db.QueryRowContext(ctx, query, a.UserID, a.TimeMultiplier, a.Untimed, a.Notes, a.UpdatedBy).Scan(&a.UpdatedAt)
+}
@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+// AccountRepository reads all the data of a user (export) and anonymises deleted accounts
+type AccountRepository struct {
+	db *sql.DB
+}
+
+func NewAccountRepository(db *sql.DB) *AccountRepository {
+	return &AccountRepository{db: db}
+}
+
+// ExportUserData reads the data of a user, the profile excepted
+func (r *AccountRepository) ExportUserData(ctx context.Context, userID int, teacher bool) (*models.AccountExport, error) {
+	export := &models.AccountExport{}
+	sections := []struct {
+		dest  *[]map[string]interface{}
+		query string
+	}{
+		{&export.LevelResults, `SELECT * FROM test_results_level WHERE user_id = $1 ORDER BY taken_at`},
+		{&export.Answers, `SELECT * FROM test_answers WHERE user_id = $1 ORDER BY answered_at`},
+		{&export.ClassroomTestResults, `
+            SELECT r.*, t.title AS test_title
+            FROM Teacher_test_results r JOIN Teachers_tests t ON t.id = r.test_id
+            WHERE r.user_id = $1 ORDER BY r.taken_at`},
+		{&export.ClassroomTestAnswers, `
+            SELECT a.*, q.question_text
+            FROM Teacher_test_answers a
+            JOIN Teacher_test_results r ON r.id = a.result_id
+            JOIN Teachers_questions q ON q.id = a.question_id
+            WHERE r.user_id = $1 ORDER BY a.answered_at`},
+		{&export.LearningPreferences, `SELECT * FROM learning_preferences WHERE user_id = $1 ORDER BY category, question_type`},
+		{&export.ClassroomMemberships, `
+            SELECT c.id AS classroom_id, c.name AS classroom_name, u.username AS teacher, m.joined_at
+            FROM Classroom_members m
+            JOIN Classrooms c ON c.id = m.classroom_id
+            JOIN users u ON u.id = c.teacher_id
+            WHERE m.user_id = $1 ORDER BY m.joined_at`},
+		{&export.Accommodation, `SELECT time_multiplier, untimed, notes, updated_at FROM student_accommodations WHERE user_id = $1`},
+		{&export.LinkedIdentities, `SELECT provider, subject, email, created_at, last_login_at FROM user_identities WHERE user_id = $1`},
+		{&export.SecurityEvents, `SELECT event_type, ip, details, created_at FROM security_events WHERE user_id = $1 ORDER BY created_at`},
+		{&export.GuardianLinks, `
+            SELECT g.username AS guardian, s.username AS student, l.created_at
+            FROM guardian_links l
+            JOIN users g ON g.id = l.guardian_id
+            JOIN users s ON s.id = l.student_id
+            WHERE l.guardian_id = $1 OR l.student_id = $1 ORDER BY l.created_at`},
+	}
+	if teacher {
+		sections = append(sections, []struct {
+			dest  *[]map[string]interface{}
+			query string
+		}{
+			{&export.ClassroomsOwned, `SELECT id, name, description, invite_code, created_at FROM Classrooms WHERE teacher_id = $1 ORDER BY id`},
+			{&export.PersonalTokens, `
+                SELECT name, token_prefix, array_to_json(scopes) AS scopes, created_at, expires_at, last_used_at, revoked_at
+                FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at`},
+			{&export.TestsCreated, `
+                SELECT t.id, t.title, t.description, t.type, t.created_at,
+                       COALESCE((SELECT json_agg(q ORDER BY q.order_index) FROM Teachers_questions q WHERE q.test_id = t.id), '[]') AS questions
+                FROM Teachers_tests t WHERE t.teacher_id = $1 ORDER BY t.id`},
+		}...)
+	}
+	for _, section := range sections {
+		rows, err := r.queryRows(ctx, section.query, userID)
+		if err != nil {
+			return nil, err
+		}
+		*section.dest = rows
+	}
+	return export, nil
+}
+
+// queryRows returns the rows of a query as column name -> value maps
+func (r *AccountRepository) queryRows(ctx context.Context, query string, args ...any) ([]map[string]interface{}, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				if json.Valid(b) {
+					values[i] = json.RawMessage(b) // JSON columns
+				} else {
+					values[i] = string(b)
+				}
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// AnonymizeUser deletes an account without breaking the aggregates of teachers, in a transaction:
+// the user row is kept with its results, answers and classroom memberships, but its username,
+// email and password are replaced, and the personal data (sessions, second factors, linked
+// identities and LMS subjects, preferences, accommodation notes, emails in the outbox, addresses in
+// the audit log) is deleted
+func (r *AccountRepository) AnonymizeUser(ctx context.Context, userID int, unusablePassword string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The emails to the account, queued or sent, while its address is still known
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM email_outbox
+        WHERE (SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL) = ANY (recipients)`, userID)
+	if err != nil {
+		return err
+	}
+
+	id := strconv.Itoa(userID)
+	query := `
+        UPDATE users SET username = $1, email = $2, password = $3,
+            email_verified_at = NULL, password_reset_required = FALSE,
+            disabled_at = COALESCE(disabled_at, NOW()), deleted_at = NOW()
+        WHERE id = $4 AND deleted_at IS NULL`
+	res, err := tx.ExecContext(ctx, query, "deleted-user-"+id, "deleted-"+id+"@deleted.invalid", unusablePassword, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows // Already deleted
+	}
+
+	statements := []string{
+		`UPDATE auth_sessions SET revoked_at = NOW(), revoked_reason = 'account deleted' WHERE user_id = $1 AND revoked_at IS NULL`,
+		`DELETE FROM password_resets WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM totp_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`, // also the LTI subjects (provider lti-<name>)
+		`DELETE FROM lti_link_users WHERE user_id = $1`,
+		`DELETE FROM lti_scores WHERE result_id IN (SELECT id FROM Teacher_test_results WHERE user_id = $1)`,
+		`DELETE FROM lti_deep_link_requests WHERE user_id = $1`,
+		`DELETE FROM learning_preferences WHERE user_id = $1`,
+		`DELETE FROM student_accommodations WHERE user_id = $1`,
+		`DELETE FROM guardian_links WHERE guardian_id = $1 OR student_id = $1`,
+		`DELETE FROM guardian_invites WHERE student_id = $1`,
+		`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+		`DELETE FROM notification_preferences WHERE user_id = $1`,
+		`DELETE FROM notifications WHERE user_id = $1`,
+		`DELETE FROM webhook_subscriptions WHERE teacher_id = $1`,
+		`UPDATE security_events SET ip = NULL, details = NULL WHERE user_id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
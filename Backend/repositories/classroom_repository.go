@@ -85,7 +85,8 @@ func (r *ClassroomRepository) GetClassroomsByTeacher(ctx context.Context, teache
 
 		// Fetch tests for this classroom
 		tQuery := `
-			SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at
+			SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at,
+			       ct.time_limit_minutes * 60
 			FROM Classroom_tests ct
 			JOIN Teachers_tests t ON ct.test_id = t.id
 			WHERE ct.classroom_id = $1`
@@ -95,7 +96,7 @@ func (r *ClassroomRepository) GetClassroomsByTeacher(ctx context.Context, teache
 		}
 		for tRows.Next() {
 			var t models.Test
-			if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt, &t.TimeLimitSeconds); err != nil {
 				tRows.Close()
 				return nil, err
 			}
@@ -141,7 +142,8 @@ func (r *ClassroomRepository) GetClassroomByID(ctx context.Context, id int) (*mo
 	}
 	// Fetch tests
 	tQuery := `
-        SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at
+        SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at,
+               ct.time_limit_minutes * 60
         FROM Classroom_tests ct
         JOIN Teachers_tests t ON ct.test_id = t.id
         WHERE ct.classroom_id = $1`
@@ -152,7 +154,7 @@ func (r *ClassroomRepository) GetClassroomByID(ctx context.Context, id int) (*mo
 	defer tRows.Close()
 	for tRows.Next() {
 		var t models.Test
-		if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt, &t.TimeLimitSeconds); err != nil {
 			return nil, err
 		}
 		c.Tests = append(c.Tests, t)
@@ -169,18 +171,37 @@ func (r *ClassroomRepository) JoinClassroom(ctx context.Context, classroomID, us
 	return err
 }
 
-func (r *ClassroomRepository) AssignTestToClassroom(ctx context.Context, classroomID, testID int) error {
+// AssignTestToClassroom assigns a test, or updates the time limit of an already assigned test
+func (r *ClassroomRepository) AssignTestToClassroom(ctx context.Context, classroomID, testID int, timeLimitMinutes *int) error {
 	query := `
-        INSERT INTO Classroom_tests (classroom_id, test_id, assigned_at)
-        VALUES ($1, $2, NOW())
-        ON CONFLICT DO NOTHING`
-	_, err := r.db.ExecContext(ctx, query, classroomID, testID)
+        INSERT INTO Classroom_tests (classroom_id, test_id, time_limit_minutes, assigned_at)
+        VALUES ($1, $2, $3, NOW())
+        ON CONFLICT (classroom_id, test_id) DO UPDATE SET time_limit_minutes = EXCLUDED.time_limit_minutes`
+	_, err := r.db.ExecContext(ctx, query, classroomID, testID, timeLimitMinutes)
 	return err
 }
 
+// GetStudentTestTimeLimit returns the time limit in seconds of a test assigned to the classrooms of a student
+// The longest limit is used when the test is assigned to several classrooms (nil if one of them is untimed)
+// assigned is false if the test is not assigned to the student
+func (r *ClassroomRepository) GetStudentTestTimeLimit(ctx context.Context, userID, testID int) (limit *int, assigned bool, err error) {
+	query := `
+        SELECT COUNT(*) > 0, BOOL_OR(ct.time_limit_minutes IS NULL), MAX(ct.time_limit_minutes) * 60
+        FROM Classroom_tests ct
+        JOIN Classroom_members cm ON cm.classroom_id = ct.classroom_id
+        WHERE cm.user_id = $1 AND ct.test_id = $2`
+	var untimed sql.NullBool
+	err = r.db.QueryRowContext(ctx, query, userID, testID).Scan(&assigned, &untimed, &limit)
+	if err != nil || !assigned || untimed.Bool {
+		return nil, assigned, err
+	}
+	return limit, true, nil
+}
+
 func (r *ClassroomRepository) GetClassroomResults(ctx context.Context, classroomID, testID int) ([]map[string]interface{}, error) {
 	query := `
-        SELECT u.id, u.email, tr.score, tr.avg_response_time, tr.total_questions, tr.correct_answers, tr.taken_at
+        SELECT u.id, u.email, tr.score, tr.avg_response_time, tr.total_questions, tr.correct_answers,
+               tr.time_limit_seconds, tr.time_multiplier, tr.untimed, tr.started_at, tr.over_time, tr.taken_at
         FROM Teacher_test_results tr
         JOIN users u ON tr.user_id = u.id
         JOIN Classroom_members cm ON cm.user_id = u.id
@@ -200,9 +221,11 @@ func (r *ClassroomRepository) GetClassroomResults(ctx context.Context, classroom
 			AvgResponseTime float64
 			TotalQuestions  int
 			CorrectAnswers  int
+			Timing          models.ResultTiming
 			TakenAt         time.Time
 		}
-		if err := rows.Scan(&r.UserID, &r.Email, &r.Score, &r.AvgResponseTime, &r.TotalQuestions, &r.CorrectAnswers, &r.TakenAt); err != nil {
+		if err := rows.Scan(&r.UserID, &r.Email, &r.Score, &r.AvgResponseTime, &r.TotalQuestions, &r.CorrectAnswers,
+			&r.Timing.TimeLimitSeconds, &r.Timing.TimeMultiplier, &r.Timing.Untimed, &r.Timing.StartedAt, &r.Timing.OverTime, &r.TakenAt); err != nil {
 			return nil, err
 		}
 		results = append(results, map[string]interface{}{
@@ -212,6 +235,7 @@ func (r *ClassroomRepository) GetClassroomResults(ctx context.Context, classroom
 			"avg_time":        r.AvgResponseTime,
 			"total_questions": r.TotalQuestions,
 			"correct_answers": r.CorrectAnswers,
+			"timing":          r.Timing,
 			"completed_at":    r.TakenAt,
 		})
 	}
@@ -226,17 +250,20 @@ func (r *ClassroomRepository) GetStudentTestDetails(ctx context.Context, userID,
 		TotalQuestions  int
 		CorrectAnswers  int
 		AvgResponseTime float64
+		Timing          models.ResultTiming
 		TakenAt         time.Time
 	}
 	resultQuery := `
-        SELECT id, score, total_questions, correct_answers, avg_response_time, taken_at
+        SELECT id, score, total_questions, correct_answers, avg_response_time,
+               time_limit_seconds, time_multiplier, untimed, started_at, over_time, taken_at
         FROM Teacher_test_results
         WHERE user_id = $1 AND test_id = $2
         ORDER BY taken_at DESC
         LIMIT 1`
 	err := r.db.QueryRowContext(ctx, resultQuery, userID, testID).Scan(
 		&result.ID, &result.Score, &result.TotalQuestions, &result.CorrectAnswers,
-		&result.AvgResponseTime, &result.TakenAt,
+		&result.AvgResponseTime, &result.Timing.TimeLimitSeconds, &result.Timing.TimeMultiplier, &result.Timing.Untimed,
+		&result.Timing.StartedAt, &result.Timing.OverTime, &result.TakenAt,
 	)
 	if err != nil {
 		return nil, err
@@ -293,6 +320,7 @@ func (r *ClassroomRepository) GetStudentTestDetails(ctx context.Context, userID,
 		"total_questions": result.TotalQuestions,
 		"correct_answers": result.CorrectAnswers,
 		"avg_time":        result.AvgResponseTime,
+		"timing":          result.Timing,
 		"completed_at":    result.TakenAt,
 		"answers":         answers,
 	}, rows.Err()
@@ -339,7 +367,8 @@ func (r *ClassroomRepository) GetClassroomsByStudent(ctx context.Context, userID
 
 		// Fetch tests for this classroom
 		tQuery := `
-			SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at
+			SELECT t.id, t.teacher_id, t.title, t.description, t.type, t.created_at, t.updated_at,
+			       ct.time_limit_minutes * 60
 			FROM Classroom_tests ct
 			JOIN Teachers_tests t ON ct.test_id = t.id
 			WHERE ct.classroom_id = $1`
@@ -349,7 +378,7 @@ func (r *ClassroomRepository) GetClassroomsByStudent(ctx context.Context, userID
 		}
 		for tRows.Next() {
 			var t models.Test
-			if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			if err := tRows.Scan(&t.ID, &t.TeacherID, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt, &t.TimeLimitSeconds); err != nil {
 				tRows.Close()
 				return nil, err
 			}
@@ -362,23 +391,58 @@ func (r *ClassroomRepository) GetClassroomsByStudent(ctx context.Context, userID
 	return classrooms, rows.Err()
 }
 
-func (r *ClassroomRepository) SubmitTeacherTestResult(ctx context.Context, userID, testID int, score float64, totalQuestions, correctAnswers int, avgResponseTime float64, answers []map[string]interface{}) error {
+// StartTestAttempt records the start of the attempt of a student at a test, unless one is already
+// running, and returns its start and the seconds elapsed since
+func (r *ClassroomRepository) StartTestAttempt(ctx context.Context, userID, testID int) (startedAt time.Time, elapsed float64, err error) {
+	query := `
+        INSERT INTO teacher_test_attempts (user_id, test_id, started_at) VALUES ($1, $2, NOW())
+        ON CONFLICT (user_id, test_id) DO UPDATE SET started_at = teacher_test_attempts.started_at
+        RETURNING started_at, EXTRACT(EPOCH FROM NOW() - started_at)`
+	err = r.db.QueryRowContext(ctx, query, userID, testID).Scan(&startedAt, &elapsed)
+	return startedAt, elapsed, err
+}
+
+// GetTestAttempt returns the start of the running attempt of a student at a test and the seconds
+// elapsed since (nil if none was started)
+func (r *ClassroomRepository) GetTestAttempt(ctx context.Context, userID, testID int) (*time.Time, float64, error) {
+	query := `
+        SELECT started_at, EXTRACT(EPOCH FROM NOW() - started_at)
+        FROM teacher_test_attempts WHERE user_id = $1 AND test_id = $2`
+	var startedAt time.Time
+	var elapsed float64
+	err := r.db.QueryRowContext(ctx, query, userID, testID).Scan(&startedAt, &elapsed)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &startedAt, elapsed, nil
+}
+
+// SubmitTeacherTestResult stores a result with its answers and ends the running attempt at the test
+func (r *ClassroomRepository) SubmitTeacherTestResult(ctx context.Context, userID, testID int, score float64, totalQuestions, correctAnswers int, avgResponseTime float64, timing models.ResultTiming, answers []map[string]interface{}) (int, error) {
 	// Start transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	// Insert test result
 	var resultID int
 	resultQuery := `
-        INSERT INTO Teacher_test_results (user_id, test_id, score, total_questions, correct_answers, avg_response_time, taken_at)
-        VALUES ($1, $2, $3, $4, $5, $6, NOW())
+        INSERT INTO Teacher_test_results (user_id, test_id, score, total_questions, correct_answers, avg_response_time,
+                                          time_limit_seconds, time_multiplier, untimed, started_at, over_time, taken_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
         RETURNING id`
-	err = tx.QueryRowContext(ctx, resultQuery, userID, testID, score, totalQuestions, correctAnswers, avgResponseTime).Scan(&resultID)
+	err = tx.QueryRowContext(ctx, resultQuery, userID, testID, score, totalQuestions, correctAnswers, avgResponseTime,
+		timing.TimeLimitSeconds, timing.TimeMultiplier, timing.Untimed, timing.StartedAt, timing.OverTime).Scan(&resultID)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM teacher_test_attempts WHERE user_id = $1 AND test_id = $2`, userID, testID); err != nil {
+		return 0, err
 	}
 
 	// Insert individual answers
@@ -394,11 +458,11 @@ func (r *ClassroomRepository) SubmitTeacherTestResult(ctx context.Context, userI
 			answer["response_time"],
 		)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit()
+	return resultID, tx.Commit()
 }
 
 func (r *ClassroomRepository) RemoveStudentFromClassroom(ctx context.Context, classroomID, userID int) error {
@@ -413,6 +477,64 @@ func (r *ClassroomRepository) RemoveTestFromClassroom(ctx context.Context, class
 	return err
 }
 
+// IsTeacherOfStudent checks if the student is a member of one of the teacher's classrooms
+func (r *ClassroomRepository) IsTeacherOfStudent(ctx context.Context, teacherID, studentID int) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM Classroom_members cm
+            JOIN Classrooms c ON c.id = cm.classroom_id
+            WHERE c.teacher_id = $1 AND cm.user_id = $2
+        )`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, teacherID, studentID).Scan(&exists)
+	return exists, err
+}
+
+// GetTeacherIDsOfStudent returns the ids of the teachers of the classrooms a student is a member of
+func (r *ClassroomRepository) GetTeacherIDsOfStudent(ctx context.Context, studentID int) ([]int, error) {
+	query := `
+        SELECT DISTINCT c.teacher_id
+        FROM Classroom_members cm
+        JOIN Classrooms c ON c.id = cm.classroom_id
+        WHERE cm.user_id = $1
+        ORDER BY c.teacher_id`
+	rows, err := r.db.QueryContext(ctx, query, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetStudentIDs returns the ids of the members of a classroom
+func (r *ClassroomRepository) GetStudentIDs(ctx context.Context, classroomID int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id FROM Classroom_members WHERE classroom_id = $1 ORDER BY user_id`, classroomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 // Helper function to generate a random invite code
 func generateInviteCode() string {
 	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -423,3 +545,19 @@ func generateInviteCode() string {
 	}
 	return string(b)
 }
+
+// GetTeacherResultAnswers returns the answers of a teacher test result with their question, in the order of the test
+func (r *ClassroomRepository) GetTeacherResultAnswers(ctx context.Context, resultID int) ([]models.AnsweredQuestion, error) {
+	query := `
+        SELECT a.id, a.question_id, q.question_text, q.question_type, q.options,
+               a.selected_answer, q.correct_answer, a.is_correct, a.response_time, a.answered_at
+        FROM Teacher_test_answers a
+        JOIN Teachers_questions q ON q.id = a.question_id
+        WHERE a.result_id = $1
+        ORDER BY q.order_index, a.id`
+	rows, err := r.db.QueryContext(ctx, query, resultID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAnsweredQuestions(rows)
+}
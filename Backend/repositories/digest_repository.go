@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+// maxDigestNotAttempted is the number of students listed per classroom in a teacher digest
+const maxDigestNotAttempted = 10
+
+type DigestRepository struct {
+	db *sql.DB
+}
+
+func NewDigestRepository(db *sql.DB) *DigestRepository {
+	return &DigestRepository{db: db}
+}
+
+// GetRecipients returns the active users of a role with a verified email who did not turn off a notification type
+func (r *DigestRepository) GetRecipients(ctx context.Context, role, notificationType string) ([]models.User, error) {
+	query := `SELECT ` + userColumns + `
+        FROM users
+        WHERE role = $1 AND email_verified_at IS NOT NULL AND disabled_at IS NULL AND deleted_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM notification_preferences np
+              WHERE np.user_id = users.id AND np.type = $2 AND NOT np.email
+          )
+        ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, role, notificationType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// ClaimRun starts sending the digests of a week; false if they were sent or another instance is sending them
+// A run not completed within an hour is taken over
+func (r *DigestRepository) ClaimRun(ctx context.Context, weekStart time.Time) (bool, error) {
+	query := `
+        INSERT INTO digest_runs (week_start) VALUES ($1)
+        ON CONFLICT (week_start) DO UPDATE SET started_at = NOW()
+        WHERE digest_runs.completed_at IS NULL AND digest_runs.started_at < NOW() - INTERVAL '1 hour'
+        RETURNING week_start`
+	var week time.Time
+	err := r.db.QueryRowContext(ctx, query, weekStart).Scan(&week)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompleteRun records that the digests of a week were queued
+func (r *DigestRepository) CompleteRun(ctx context.Context, weekStart time.Time, queued int) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE digest_runs SET completed_at = NOW(), emails_queued = $2
+        WHERE week_start = $1`, weekStart, queued)
+	return err
+}
+
+// GetStudentWeek returns what a student did between from and to, and the classroom tests left to do
+func (r *DigestRepository) GetStudentWeek(ctx context.Context, userID int, from, to time.Time) (*models.StudentDigest, error) {
+	digest := &models.StudentDigest{Tests: []models.DigestTest{}, Phenomena: []models.MistakeCount{}, Pending: []models.DigestAssignment{}}
+
+	// Placement and practice tests, then classroom tests
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT test_type, score, taken_at FROM test_results_level
+        WHERE user_id = $1 AND taken_at >= $2 AND taken_at < $3
+        UNION ALL
+        SELECT t.title, r.score, r.taken_at
+        FROM Teacher_test_results r JOIN Teachers_tests t ON t.id = r.test_id
+        WHERE r.user_id = $1 AND r.taken_at >= $2 AND r.taken_at < $3
+        ORDER BY 3`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.DigestTest
+		if err := rows.Scan(&t.Title, &t.Score, &t.TakenAt); err != nil {
+			return nil, err
+		}
+		digest.Tests = append(digest.Tests, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The latest level before the week and at its end; a level confirmed by a teacher prevails
+	levelQuery := `
+        SELECT COALESCE(confirmed_level, fuzzy_level) FROM test_results_level
+        WHERE user_id = $1 AND taken_at < $2 AND COALESCE(confirmed_level, fuzzy_level) IS NOT NULL
+        ORDER BY taken_at DESC LIMIT 1`
+	for _, level := range []struct {
+		before time.Time
+		dest   *string
+	}{{from, &digest.LevelBefore}, {to, &digest.LevelAfter}} {
+		err := r.db.QueryRowContext(ctx, levelQuery, userID, level.before).Scan(level.dest)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+        SELECT pq.phenomenon, COUNT(*) AS mistake_count
+        FROM test_answers ta
+        JOIN placement_questions pq ON ta.question_id = pq.id
+        WHERE ta.user_id = $1 AND ta.is_correct = FALSE AND pq.phenomenon IS NOT NULL
+          AND ta.answered_at >= $2 AND ta.answered_at < $3
+        GROUP BY pq.phenomenon
+        ORDER BY mistake_count DESC, pq.phenomenon
+        LIMIT 3`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.MistakeCount
+		if err := rows.Scan(&m.Phenomenon, &m.Count); err != nil {
+			return nil, err
+		}
+		digest.Phenomena = append(digest.Phenomena, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+        SELECT c.name, t.title
+        FROM Classroom_members cm
+        JOIN Classrooms c ON c.id = cm.classroom_id
+        JOIN Classroom_tests ct ON ct.classroom_id = c.id
+        JOIN Teachers_tests t ON t.id = ct.test_id
+        WHERE cm.user_id = $1
+          AND NOT EXISTS (SELECT 1 FROM Teacher_test_results r WHERE r.user_id = cm.user_id AND r.test_id = t.id)
+        ORDER BY ct.assigned_at, c.name, t.title`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.DigestAssignment
+		if err := rows.Scan(&a.Classroom, &a.Title); err != nil {
+			return nil, err
+		}
+		digest.Pending = append(digest.Pending, a)
+	}
+	return digest, rows.Err()
+}
+
+// GetTeacherWeek returns the completion of the tests assigned in each classroom of a teacher,
+// the tests completed between from and to, and the students with tests not attempted
+func (r *DigestRepository) GetTeacherWeek(ctx context.Context, teacherID int, from, to time.Time) ([]models.ClassroomDigest, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT c.id, c.name,
+            (SELECT COUNT(*) FROM Classroom_members cm WHERE cm.classroom_id = c.id),
+            (SELECT COUNT(*) FROM Classroom_tests ct WHERE ct.classroom_id = c.id),
+            (SELECT COUNT(*) FROM Classroom_members cm JOIN Classroom_tests ct ON ct.classroom_id = cm.classroom_id
+             WHERE cm.classroom_id = c.id
+               AND EXISTS (SELECT 1 FROM Teacher_test_results r WHERE r.user_id = cm.user_id AND r.test_id = ct.test_id)),
+            (SELECT COUNT(*) FROM Classroom_members cm JOIN Classroom_tests ct ON ct.classroom_id = cm.classroom_id
+             JOIN Teacher_test_results r ON r.user_id = cm.user_id AND r.test_id = ct.test_id
+             WHERE cm.classroom_id = c.id AND r.taken_at >= $2 AND r.taken_at < $3)
+        FROM Classrooms c
+        WHERE c.teacher_id = $1
+        ORDER BY c.name`, teacherID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	classrooms := []models.ClassroomDigest{}
+	for rows.Next() {
+		c := models.ClassroomDigest{NotAttempted: []models.DigestStudent{}}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Students, &c.Tests, &c.Completed, &c.CompletedWeek); err != nil {
+			return nil, err
+		}
+		if assigned := c.Students * c.Tests; assigned > 0 {
+			c.CompletionRate = float64(c.Completed) * 100 / float64(assigned)
+		}
+		classrooms = append(classrooms, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range classrooms {
+		rows, err := r.db.QueryContext(ctx, `
+            SELECT u.username, COUNT(*) AS missing
+            FROM Classroom_members cm
+            JOIN users u ON u.id = cm.user_id
+            JOIN Classroom_tests ct ON ct.classroom_id = cm.classroom_id
+            WHERE cm.classroom_id = $1
+              AND NOT EXISTS (SELECT 1 FROM Teacher_test_results r WHERE r.user_id = cm.user_id AND r.test_id = ct.test_id)
+            GROUP BY u.username
+            ORDER BY missing DESC, u.username
+            LIMIT $2`, classrooms[i].ID, maxDigestNotAttempted)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var s models.DigestStudent
+			if err := rows.Scan(&s.Username, &s.Missing); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			classrooms[i].NotAttempted = append(classrooms[i].NotAttempted, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return classrooms, nil
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type EmailOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewEmailOutboxRepository(db *sql.DB) *EmailOutboxRepository {
+	return &EmailOutboxRepository{db: db}
+}
+
+const outboxColumns = `id, idempotency_key, recipients, subject, text_body, html_body, unsubscribe_url, template, locale, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+func scanOutboxEmail(row rowScanner) (*models.OutboxEmail, error) {
+	var e models.OutboxEmail
+	err := row.Scan(&e.ID, &e.IdempotencyKey, pq.Array(&e.Recipients), &e.Subject, &e.Text, &e.HTML, &e.Unsubscribe, &e.Template, &e.Locale,
+		&e.Status, &e.Attempts, &e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.SentAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Enqueue queues an email for delivery
+// It returns false, and queues nothing, when an email with the same idempotency key was already queued
+func (r *EmailOutboxRepository) Enqueue(ctx context.Context, e *models.OutboxEmail) (bool, error) {
+	query := `
+        INSERT INTO email_outbox (idempotency_key, recipients, subject, text_body, html_body, unsubscribe_url, template, locale)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (idempotency_key) DO NOTHING
+        RETURNING id, status, next_attempt_at, created_at`
+	err := r.db.QueryRowContext(ctx, query, e.IdempotencyKey, pq.Array(e.Recipients), e.Subject, e.Text, e.HTML, e.Unsubscribe, e.Template, e.Locale).
+		Scan(&e.ID, &e.Status, &e.NextAttemptAt, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClaimDue takes up to limit pending emails whose next attempt is due, counting the attempt
+// and leasing them until leaseUntil: an email a crashed worker did not finish is retried after it
+// Concurrent workers claim different emails
+func (r *EmailOutboxRepository) ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]models.OutboxEmail, error) {
+	query := `
+        UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = $2
+        WHERE id IN (
+            SELECT id FROM email_outbox
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY next_attempt_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING ` + outboxColumns
+	rows, err := r.db.QueryContext(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []models.OutboxEmail{}
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, *e)
+	}
+	return emails, rows.Err()
+}
+
+// MarkSent records the delivery of an email and erases its bodies
+func (r *EmailOutboxRepository) MarkSent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE email_outbox SET status = 'sent', sent_at = NOW(), text_body = '', html_body = '', last_error = NULL
+        WHERE id = $1`, id)
+	return err
+}
+
+// MarkFailed records a failed attempt: the email is retried at nextAttempt, or dead-lettered when dead is true
+func (r *EmailOutboxRepository) MarkFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time, dead bool) error {
+	status := models.OutboxPending
+	if dead {
+		status = models.OutboxDead
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE email_outbox SET status = $2, last_error = $3, next_attempt_at = $4
+        WHERE id = $1`, id, status, lastError, nextAttempt)
+	return err
+}
+
+// GetEmails returns the latest emails, optionally of one status
+func (r *EmailOutboxRepository) GetEmails(ctx context.Context, status string, limit int) ([]models.OutboxEmail, error) {
+	query := `SELECT ` + outboxColumns + `
+        FROM email_outbox
+        WHERE ($1::text = '' OR status = $1)
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []models.OutboxEmail{}
+	for rows.Next() {
+		e, err := scanOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, *e)
+	}
+	return emails, rows.Err()
+}
+
+// Requeue gives a dead email a new series of attempts, due now; false if there is no such dead email
+func (r *EmailOutboxRepository) Requeue(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE email_outbox SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+        WHERE id = $1 AND status = 'dead'`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteSentBefore removes the emails sent before a time and returns how many were removed
+func (r *EmailOutboxRepository) DeleteSentBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM email_outbox WHERE status = 'sent' AND sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
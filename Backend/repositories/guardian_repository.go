@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type GuardianRepository struct {
+	db *sql.DB
+}
+
+func NewGuardianRepository(db *sql.DB) *GuardianRepository {
+	return &GuardianRepository{db: db}
+}
+
+// CreateInvite stores the hash of an invite code for a student
+func (r *GuardianRepository) CreateInvite(ctx context.Context, studentID, createdBy int, codeHash string, expiresAt time.Time) error {
+	query := `
+        INSERT INTO guardian_invites (student_id, created_by, code_hash, expires_at)
+        VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, studentID, createdBy, codeHash, expiresAt)
+	return err
+}
+
+// RedeemInvite consumes an invite code and links the guardian to its student
+// It returns nil when the code is unknown, expired or already used
+func (r *GuardianRepository) RedeemInvite(ctx context.Context, codeHash string, guardianID int) (*models.GuardianLink, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	link := models.GuardianLink{GuardianID: guardianID}
+	err = tx.QueryRowContext(ctx, `
+        UPDATE guardian_invites SET used_at = NOW()
+        WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING student_id, created_by`, codeHash).Scan(&link.StudentID, &link.InvitedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Linking an already linked student keeps the first link
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO guardian_links (guardian_id, student_id, invited_by)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (guardian_id, student_id) DO UPDATE SET guardian_id = EXCLUDED.guardian_id
+        RETURNING invited_by, created_at`, guardianID, link.StudentID, link.InvitedBy).Scan(&link.InvitedBy, &link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT username FROM users WHERE id = $1`, link.StudentID).Scan(&link.Username); err != nil {
+		return nil, err
+	}
+	return &link, tx.Commit()
+}
+
+// IsGuardianOf checks if the guardian is linked to the student
+func (r *GuardianRepository) IsGuardianOf(ctx context.Context, guardianID, studentID int) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM guardian_links WHERE guardian_id = $1 AND student_id = $2)`
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, guardianID, studentID).Scan(&exists)
+	return exists, err
+}
+
+// GetStudentsOfGuardian returns the links of a guardian with the students' usernames
+func (r *GuardianRepository) GetStudentsOfGuardian(ctx context.Context, guardianID int) ([]models.GuardianLink, error) {
+	query := `
+        SELECT l.guardian_id, l.student_id, u.username, '', l.invited_by, l.created_at
+        FROM guardian_links l
+        JOIN users u ON u.id = l.student_id
+        WHERE l.guardian_id = $1
+        ORDER BY u.username`
+	return r.queryLinks(ctx, query, guardianID)
+}
+
+// GetGuardiansOfStudent returns the links of a student with the guardians' usernames and emails
+func (r *GuardianRepository) GetGuardiansOfStudent(ctx context.Context, studentID int) ([]models.GuardianLink, error) {
+	query := `
+        SELECT l.guardian_id, l.student_id, u.username, u.email, l.invited_by, l.created_at
+        FROM guardian_links l
+        JOIN users u ON u.id = l.guardian_id
+        WHERE l.student_id = $1
+        ORDER BY l.created_at`
+	return r.queryLinks(ctx, query, studentID)
+}
+
+func (r *GuardianRepository) queryLinks(ctx context.Context, query string, args ...any) ([]models.GuardianLink, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.GuardianLink{}
+	for rows.Next() {
+		var l models.GuardianLink
+		if err := rows.Scan(&l.GuardianID, &l.StudentID, &l.Username, &l.Email, &l.InvitedBy, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// DeleteLink removes the link between a guardian and a student; false if there was none
+func (r *GuardianRepository) DeleteLink(ctx context.Context, guardianID, studentID int) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM guardian_links WHERE guardian_id = $1 AND student_id = $2`, guardianID, studentID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetTestHistory returns the placement and level tests taken by a user, latest first
+func (r *GuardianRepository) GetTestHistory(ctx context.Context, userID int) ([]models.TestHistoryEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, score, avg_response_time, fuzzy_level, test_type, taken_at
+        FROM test_results_level
+        WHERE user_id = $1
+        ORDER BY taken_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.TestHistoryEntry{}
+	for rows.Next() {
+		var h models.TestHistoryEntry
+		if err := rows.Scan(&h.TestID, &h.Score, &h.AvgTime, &h.Level, &h.TestType, &h.CompletedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+// GetMistakes returns the wrong answers of a user counted by category and by phenomenon (top 5)
+func (r *GuardianRepository) GetMistakes(ctx context.Context, userID int) (*models.StudentMistakes, error) {
+	mistakes := &models.StudentMistakes{Categories: []models.MistakeCount{}, Phenomena: []models.MistakeCount{}}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT pq.category, COUNT(*) AS mistake_count
+        FROM test_answers ta
+        JOIN placement_questions pq ON ta.question_id = pq.id
+        WHERE ta.user_id = $1 AND ta.is_correct = FALSE
+        GROUP BY pq.category
+        ORDER BY mistake_count DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.MistakeCount
+		if err := rows.Scan(&m.Category, &m.Count); err != nil {
+			return nil, err
+		}
+		mistakes.Categories = append(mistakes.Categories, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+        SELECT pq.phenomenon, COUNT(*) AS mistake_count
+        FROM test_answers ta
+        JOIN placement_questions pq ON ta.question_id = pq.id
+        WHERE ta.user_id = $1 AND ta.is_correct = FALSE AND pq.phenomenon IS NOT NULL
+        GROUP BY pq.phenomenon
+        ORDER BY mistake_count DESC
+        LIMIT 5`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.MistakeCount
+		if err := rows.Scan(&m.Phenomenon, &m.Count); err != nil {
+			return nil, err
+		}
+		mistakes.Phenomena = append(mistakes.Phenomena, m)
+	}
+	return mistakes, rows.Err()
+}
+
+// GetAssignments returns the tests assigned to a student in their classrooms with the latest result of each
+func (r *GuardianRepository) GetAssignments(ctx context.Context, userID int) ([]models.GuardianAssignment, error) {
+	query := `
+        SELECT c.id, c.name, u.username, t.id, t.title, t.type, res.score, res.taken_at
+        FROM Classroom_members cm
+        JOIN Classrooms c ON c.id = cm.classroom_id
+        JOIN users u ON u.id = c.teacher_id
+        JOIN Classroom_tests ct ON ct.classroom_id = c.id
+        JOIN Teachers_tests t ON t.id = ct.test_id
+        LEFT JOIN LATERAL (
+            SELECT score, taken_at FROM Teacher_test_results
+            WHERE user_id = cm.user_id AND test_id = t.id
+            ORDER BY taken_at DESC LIMIT 1
+        ) res ON TRUE
+        WHERE cm.user_id = $1
+        ORDER BY c.name, t.title`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.GuardianAssignment{}
+	for rows.Next() {
+		var a models.GuardianAssignment
+		if err := rows.Scan(&a.ClassroomID, &a.ClassroomName, &a.Teacher, &a.TestID, &a.Title, &a.Type, &a.Score, &a.TakenAt); err != nil {
+			return nil, err
+		}
+		a.Completed = a.TakenAt != nil
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type IdentityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// CreateLoginState stores a pending OpenID Connect login
+func (r *IdentityRepository) CreateLoginState(ctx context.Context, s *models.OIDCLoginState) error {
+	query := `
+        INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expires_at)
+        VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, query, s.State, s.Provider, s.Nonce, s.CodeVerifier, s.ExpiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes and returns a pending login of the provider, nil if unknown or expired
+// Expired logins are purged along the way
+func (r *IdentityRepository) ConsumeLoginState(ctx context.Context, state, provider string) (*models.OIDCLoginState, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return nil, err
+	}
+	query := `
+        DELETE FROM oidc_login_states
+        WHERE state = $1 AND provider = $2
+        RETURNING state, provider, nonce, code_verifier, expires_at`
+	var s models.OIDCLoginState
+	err := r.db.QueryRowContext(ctx, query, state, provider).Scan(&s.State, &s.Provider, &s.Nonce, &s.CodeVerifier, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetUserByIdentity returns the user an external identity is linked to, nil if it is not linked
+func (r *IdentityRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	query := `
+        SELECT ` + userColumns + `
+        FROM users
+        WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, provider, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity links an external identity to an existing user
+func (r *IdentityRepository) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateUserWithIdentity provisions a user along with its external identity
+func (r *IdentityRepository) CreateUserWithIdentity(ctx context.Context, u *models.User, identity *models.Identity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO users (username, email, password, role, email_verified_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, create_time`
+	if err := tx.QueryRowContext(ctx, query, u.Username, u.Email, u.Password, u.Role, u.EmailVerifiedAt).Scan(&u.ID, &u.CreateTime); err != nil {
+		return err
+	}
+	identity.UserID = u.ID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertIdentity(ctx context.Context, tx *sql.Tx, identity *models.Identity) error {
+	query := `
+        INSERT INTO user_identities (user_id, provider, subject, email)
+        VALUES ($1, $2, $3, NULLIF($4, ''))
+        RETURNING id, created_at, last_login_at`
+	return tx.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+}
+
+// TouchIdentity records a login with an external identity
+func (r *IdentityRepository) TouchIdentity(ctx context.Context, provider, subject, email string) error {
+	query := `
+        UPDATE user_identities SET last_login_at = NOW(), email = COALESCE(NULLIF($3, ''), email)
+        WHERE provider = $1 AND subject = $2`
+	_, err := r.db.ExecContext(ctx, query, provider, subject, email)
+	return err
+}
+
+// SetUserRole changes the role of a user
+func (r *IdentityRepository) SetUserRole(ctx context.Context, userID int, role string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, role)
+	return err
+}
+
+// GetUserIdentities returns the external identities linked to a user
+func (r *IdentityRepository) GetUserIdentities(ctx context.Context, userID int) ([]models.Identity, error) {
+	query := `
+        SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
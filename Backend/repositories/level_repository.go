@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type LevelRepository struct {
+	db *sql.DB
+}
+
+func NewLevelRepository(db *sql.DB) *LevelRepository {
+	return &LevelRepository{db: db}
+}
+
+const levelResultColumns = `
+        id, user_id, score, COALESCE(avg_response_time, 0), speed_ratio,
+        time_multiplier, untimed, COALESCE(fuzzy_level, ''),
+        level_score, engine_version, confirmed_level, confirmed_by, confirmed_at, test_type, taken_at`
+
+func scanLevelResult(scan func(dest ...any) error) (models.LevelResult, error) {
+	var lr models.LevelResult
+	err := scan(&lr.ID, &lr.UserID, &lr.Score, &lr.AvgResponseTime, &lr.SpeedRatio,
+		&lr.TimeMultiplier, &lr.Untimed, &lr.FuzzyLevel,
+		&lr.LevelScore, &lr.EngineVersion, &lr.ConfirmedLevel, &lr.ConfirmedBy, &lr.ConfirmedAt, &lr.TestType, &lr.TakenAt)
+	return lr, err
+}
+
+func (r *LevelRepository) queryLevelResults(ctx context.Context, query string, args ...any) ([]models.LevelResult, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []models.LevelResult{}
+	for rows.Next() {
+		lr, err := scanLevelResult(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, lr)
+	}
+	return results, rows.Err()
+}
+
+func (r *LevelRepository) GetLevelResultByID(ctx context.Context, id int) (*models.LevelResult, error) {
+	query := `SELECT ` + levelResultColumns + `
+        FROM test_results_level
+        WHERE id = $1`
+	lr, err := scanLevelResult(r.db.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
+func (r *LevelRepository) GetLevelResultsByUser(ctx context.Context, userID int) ([]models.LevelResult, error) {
+	query := `SELECT ` + levelResultColumns + `
+        FROM test_results_level
+        WHERE user_id = $1
+        ORDER BY taken_at DESC`
+	return r.queryLevelResults(ctx, query, userID)
+}
+
+// GetLatestLevelResult returns the latest result of a user, nil if they have none
+func (r *LevelRepository) GetLatestLevelResult(ctx context.Context, userID int) (*models.LevelResult, error) {
+	query := `SELECT ` + levelResultColumns + `
+        FROM test_results_level
+        WHERE user_id = $1
+        ORDER BY taken_at DESC, id DESC
+        LIMIT 1`
+	lr, err := scanLevelResult(r.db.QueryRowContext(ctx, query, userID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
+// GetPreviousLevel returns the level of the user of a result before it: the level of their previous result,
+// where a level confirmed by a teacher prevails; empty for a first result
+func (r *LevelRepository) GetPreviousLevel(ctx context.Context, userID, resultID int) (string, error) {
+	query := `
+        SELECT COALESCE(prev.confirmed_level, prev.fuzzy_level)
+        FROM test_results_level prev, test_results_level cur
+        WHERE cur.id = $2 AND prev.user_id = $1
+          AND (prev.taken_at, prev.id) < (cur.taken_at, cur.id)
+          AND COALESCE(prev.confirmed_level, prev.fuzzy_level) IS NOT NULL
+        ORDER BY prev.taken_at DESC, prev.id DESC
+        LIMIT 1`
+	var level string
+	err := r.db.QueryRowContext(ctx, query, userID, resultID).Scan(&level)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return level, err
+}
+
+// GetConfirmedLevelResults returns all results whose level was confirmed by a teacher
+func (r *LevelRepository) GetConfirmedLevelResults(ctx context.Context) ([]models.LevelResult, error) {
+	query := `SELECT ` + levelResultColumns + `
+        FROM test_results_level
+        WHERE confirmed_level IS NOT NULL AND (speed_ratio IS NOT NULL OR avg_response_time IS NOT NULL)
+        ORDER BY id`
+	return r.queryLevelResults(ctx, query)
+}
+
+// GetAllLevelResults returns every result (used to recompute levels)
+func (r *LevelRepository) GetAllLevelResults(ctx context.Context) ([]models.LevelResult, error) {
+	query := `SELECT ` + levelResultColumns + `
+        FROM test_results_level
+        ORDER BY id`
+	return r.queryLevelResults(ctx, query)
+}
+
+// RegisterEngineVersion stores an engine definition under its version (no-op if already known)
+func (r *LevelRepository) RegisterEngineVersion(ctx context.Context, version, name string, definition []byte) error {
+	query := `
+        INSERT INTO fuzzy_engine_versions (version, name, definition)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (version) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, version, name, definition)
+	return err
+}
+
+// ApplyLevelChanges updates the results with their recomputed levels in a single transaction
+// Previous values are kept in test_results_level_history
+func (r *LevelRepository) ApplyLevelChanges(ctx context.Context, engineVersion string, changes []models.LevelChange) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	historyQuery := `
+        INSERT INTO test_results_level_history (result_id, fuzzy_level, level_score, engine_version, replaced_by)
+        SELECT id, fuzzy_level, level_score, engine_version, $2
+        FROM test_results_level
+        WHERE id = $1`
+	updateQuery := `
+        UPDATE test_results_level
+        SET fuzzy_level = $1, level_score = $2, difficulty = $3, engine_version = $4
+        WHERE id = $5`
+	for _, c := range changes {
+		if _, err := tx.ExecContext(ctx, historyQuery, c.ResultID, engineVersion); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, updateQuery, c.NewLevel, c.NewLevelScore, int(math.Round(c.NewLevelScore)), engineVersion, c.ResultID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *LevelRepository) ConfirmLevel(ctx context.Context, resultID, teacherID int, level string) error {
+	query := `
+        UPDATE test_results_level
+        SET confirmed_level = $1, confirmed_by = $2, confirmed_at = NOW()
+        WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, level, teacherID, resultID)
+	return err
+}
+
+// GetResultAnswers returns the answers of a level result with their placement question, in the order they were saved
+func (r *LevelRepository) GetResultAnswers(ctx context.Context, resultID int) ([]models.AnsweredQuestion, error) {
+	query := `
+        SELECT ta.id, ta.question_id, COALESCE(pq.question_text, ''), COALESCE(ta.question_type, pq.question_type, ''), pq.options,
+               COALESCE(ta.selected_option, ''), COALESCE(ta.correct_option, ''), COALESCE(ta.is_correct, FALSE), ta.response_time, ta.answered_at
+        FROM test_answers ta
+        LEFT JOIN placement_questions pq ON pq.id = ta.question_id
+        WHERE ta.test_result_id = $1
+        ORDER BY ta.id`
+	rows, err := r.db.QueryContext(ctx, query, resultID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAnsweredQuestions(rows)
+}
+
+// scanAnsweredQuestions reads the answers selected by GetResultAnswers and GetTeacherResultAnswers, and closes the rows
+func scanAnsweredQuestions(rows *sql.Rows) ([]models.AnsweredQuestion, error) {
+	defer rows.Close()
+	answers := []models.AnsweredQuestion{}
+	for rows.Next() {
+		var a models.AnsweredQuestion
+		var options []byte
+		var responseTime sql.NullFloat64
+		if err := rows.Scan(&a.ID, &a.QuestionID, &a.QuestionText, &a.QuestionType, &options,
+			&a.Selected, &a.CorrectAnswer, &a.IsCorrect, &responseTime, &a.AnsweredAt); err != nil {
+			return nil, err
+		}
+		if len(options) > 0 {
+			// Options that are not a map of letters (e.g. of other question formats) are left out
+			_ = json.Unmarshal(options, &a.Options)
+		}
+		if responseTime.Valid {
+			a.ResponseTime = &responseTime.Float64
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
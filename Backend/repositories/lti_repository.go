@@ -0,0 +1,261 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type LTIRepository struct {
+	db *sql.DB
+}
+
+func NewLTIRepository(db *sql.DB) *LTIRepository {
+	return &LTIRepository{db: db}
+}
+
+// CreateLaunchState stores a pending launch, started by the login initiation of a platform
+func (r *LTIRepository) CreateLaunchState(ctx context.Context, s *models.LTILaunchState) error {
+	query := `
+        INSERT INTO lti_launch_states (state, platform, nonce, target_link_uri, expires_at)
+        VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, query, s.State, s.Platform, s.Nonce, s.TargetLinkURI, s.ExpiresAt)
+	return err
+}
+
+// ConsumeLaunchState deletes and returns a pending launch, nil if unknown or expired
+// Expired launches are purged along the way
+func (r *LTIRepository) ConsumeLaunchState(ctx context.Context, state string) (*models.LTILaunchState, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM lti_launch_states WHERE expires_at < NOW()`); err != nil {
+		return nil, err
+	}
+	query := `
+        DELETE FROM lti_launch_states
+        WHERE state = $1
+        RETURNING state, platform, nonce, target_link_uri, expires_at`
+	var s models.LTILaunchState
+	err := r.db.QueryRowContext(ctx, query, state).Scan(&s.State, &s.Platform, &s.Nonce, &s.TargetLinkURI, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetContext returns the course of a platform, nil if it has no classroom yet
+func (r *LTIRepository) GetContext(ctx context.Context, platform, contextID string) (*models.LTIContext, error) {
+	query := `
+        SELECT c.id, c.platform, c.context_id, c.classroom_id, c.title, c.created_at
+        FROM lti_contexts c
+        WHERE c.platform = $1 AND c.context_id = $2`
+	var c models.LTIContext
+	err := r.db.QueryRowContext(ctx, query, platform, contextID).Scan(&c.ID, &c.Platform, &c.ContextID, &c.ClassroomID, &c.Title, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetResourceLinkTestID returns the test recorded on a resource link, nil if the link or its test is unknown
+func (r *LTIRepository) GetResourceLinkTestID(ctx context.Context, platform, resourceLinkID string) (*int, error) {
+	query := `SELECT test_id FROM lti_resource_links WHERE platform = $1 AND resource_link_id = $2`
+	var testID *int
+	err := r.db.QueryRowContext(ctx, query, platform, resourceLinkID).Scan(&testID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return testID, err
+}
+
+// CreateContextClassroom creates the classroom of a course along with its mapping
+// created is false when a concurrent launch mapped the course first: its mapping is returned instead
+func (r *LTIRepository) CreateContextClassroom(ctx context.Context, c *models.LTIContext, classroom *models.Classroom) (created bool, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	classroom.InviteCode = generateInviteCode()
+	query := `
+        INSERT INTO Classrooms (teacher_id, name, description, invite_code, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, NOW(), NOW())
+        RETURNING id, created_at, updated_at`
+	if err := tx.QueryRowContext(ctx, query, classroom.TeacherID, classroom.Name, classroom.Description, classroom.InviteCode).
+		Scan(&classroom.ID, &classroom.CreatedAt, &classroom.UpdatedAt); err != nil {
+		return false, err
+	}
+	query = `
+        INSERT INTO lti_contexts (platform, context_id, classroom_id, title)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (platform, context_id) DO NOTHING
+        RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, c.Platform, c.ContextID, classroom.ID, c.Title).Scan(&c.ID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		existing, err := r.GetContext(ctx, c.Platform, c.ContextID)
+		if err != nil {
+			return false, err
+		}
+		*c = *existing
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.ClassroomID = classroom.ID
+	return true, tx.Commit()
+}
+
+// UpsertResourceLink records a launched resource link, keeping its test and line item when the launch
+// does not give them, and returns it as stored
+func (r *LTIRepository) UpsertResourceLink(ctx context.Context, l *models.LTIResourceLink) error {
+	query := `
+        INSERT INTO lti_resource_links (platform, resource_link_id, deployment_id, context_id, test_id, line_item, title)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (platform, resource_link_id) DO UPDATE SET
+            deployment_id = EXCLUDED.deployment_id,
+            context_id = COALESCE(EXCLUDED.context_id, lti_resource_links.context_id),
+            test_id = COALESCE(EXCLUDED.test_id, lti_resource_links.test_id),
+            line_item = COALESCE(NULLIF(EXCLUDED.line_item, ''), lti_resource_links.line_item),
+            title = COALESCE(NULLIF(EXCLUDED.title, ''), lti_resource_links.title),
+            updated_at = NOW()
+        RETURNING id, context_id, test_id, line_item, title, created_at, updated_at`
+	return r.db.QueryRowContext(ctx, query, l.Platform, l.ResourceLinkID, l.DeploymentID, l.ContextID, l.TestID, l.LineItem, l.Title).
+		Scan(&l.ID, &l.ContextID, &l.TestID, &l.LineItem, &l.Title, &l.CreatedAt, &l.UpdatedAt)
+}
+
+// RecordLinkUser records the launch of a resource link by a user, with the user id at the platform
+func (r *LTIRepository) RecordLinkUser(ctx context.Context, resourceLinkID, userID int, subject string) error {
+	query := `
+        INSERT INTO lti_link_users (resource_link_id, user_id, subject)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (resource_link_id, user_id) DO UPDATE SET subject = EXCLUDED.subject, last_launch_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, resourceLinkID, userID, subject)
+	return err
+}
+
+// CreateDeepLinkRequest stores a Deep Linking request waiting for the choice of a test
+func (r *LTIRepository) CreateDeepLinkRequest(ctx context.Context, d *models.LTIDeepLinkRequest) error {
+	query := `
+        INSERT INTO lti_deep_link_requests (id, platform, deployment_id, user_id, return_url, data, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, d.ID, d.Platform, d.DeploymentID, d.UserID, d.ReturnURL, d.Data, d.ExpiresAt)
+	return err
+}
+
+// ConsumeDeepLinkRequest deletes and returns a pending Deep Linking request, nil if unknown or expired
+// Expired requests are purged along the way
+func (r *LTIRepository) ConsumeDeepLinkRequest(ctx context.Context, id string) (*models.LTIDeepLinkRequest, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM lti_deep_link_requests WHERE expires_at < NOW()`); err != nil {
+		return nil, err
+	}
+	query := `
+        DELETE FROM lti_deep_link_requests
+        WHERE id = $1
+        RETURNING id, platform, deployment_id, user_id, return_url, data, expires_at`
+	var d models.LTIDeepLinkRequest
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&d.ID, &d.Platform, &d.DeploymentID, &d.UserID, &d.ReturnURL, &d.Data, &d.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// EnqueueScores queues the score of a result of a student for the graded resource links of the test
+// the student launched, and returns how many were queued
+// A result already queued for a link is not queued again
+func (r *LTIRepository) EnqueueScores(ctx context.Context, resultID, testID, userID int, score, scoreMaximum float64) (int64, error) {
+	query := `
+        INSERT INTO lti_scores (resource_link_id, result_id, user_subject, score, score_maximum)
+        SELECT l.id, $1, lu.subject, $4, $5
+        FROM lti_resource_links l
+        JOIN lti_link_users lu ON lu.resource_link_id = l.id
+        WHERE l.test_id = $2 AND lu.user_id = $3 AND l.line_item <> ''
+        ON CONFLICT (resource_link_id, result_id) DO NOTHING`
+	res, err := r.db.ExecContext(ctx, query, resultID, testID, userID, score, scoreMaximum)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimDueScores takes up to limit pending scores whose next attempt is due, oldest first, counting the attempt
+// and leasing them until leaseUntil
+// Concurrent workers claim different scores
+func (r *LTIRepository) ClaimDueScores(ctx context.Context, limit int, leaseUntil time.Time) ([]models.LTIScore, error) {
+	query := `
+        WITH claimed AS (
+            UPDATE lti_scores SET attempts = attempts + 1, next_attempt_at = $2
+            WHERE id IN (
+                SELECT id FROM lti_scores
+                WHERE status = 'pending' AND next_attempt_at <= NOW()
+                ORDER BY next_attempt_at
+                LIMIT $1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING *
+        )
+        SELECT s.id, s.resource_link_id, s.result_id, l.platform, l.line_item, s.user_subject, s.score, s.score_maximum,
+               s.status, s.attempts, s.next_attempt_at, s.last_error, s.created_at, s.sent_at
+        FROM claimed s
+        JOIN lti_resource_links l ON l.id = s.resource_link_id
+        ORDER BY s.id`
+	rows, err := r.db.QueryContext(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []models.LTIScore{}
+	for rows.Next() {
+		var s models.LTIScore
+		if err := rows.Scan(&s.ID, &s.ResourceLinkID, &s.ResultID, &s.Platform, &s.LineItem, &s.UserSubject, &s.Score, &s.ScoreMaximum,
+			&s.Status, &s.Attempts, &s.NextAttemptAt, &s.LastError, &s.CreatedAt, &s.SentAt); err != nil {
+			return nil, err
+		}
+		scores = append(scores, s)
+	}
+	return scores, rows.Err()
+}
+
+// MarkScoreSent records the delivery of a score
+func (r *LTIRepository) MarkScoreSent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE lti_scores SET status = 'sent', sent_at = NOW(), last_error = NULL
+        WHERE id = $1`, id)
+	return err
+}
+
+// MarkScoreFailed records a failed attempt: the score is retried at nextAttempt, or given up on when failed is true
+func (r *LTIRepository) MarkScoreFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time, failed bool) error {
+	status := models.LTIScorePending
+	if failed {
+		status = models.LTIScoreFailed
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE lti_scores SET status = $2, last_error = $3, next_attempt_at = $4
+        WHERE id = $1`, id, status, lastError, nextAttempt)
+	return err
+}
+
+// DeleteFinishedScoresBefore removes the scores sent or given up on before a time, and returns how many were removed
+func (r *LTIRepository) DeleteFinishedScoresBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+        DELETE FROM lti_scores
+        WHERE status <> 'pending' AND COALESCE(sent_at, next_attempt_at) < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// GetPreferences returns the notification preferences a user has set; the other types are on
+func (r *NotificationRepository) GetPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT type, email, in_app, updated_at FROM notification_preferences
+        WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := []models.NotificationPreference{}
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Type, &p.Email, &p.InApp, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, p)
+	}
+	return preferences, rows.Err()
+}
+
+// SetPreference turns the channels of a type of notification on or off for a user
+// A nil channel keeps its setting
+func (r *NotificationRepository) SetPreference(ctx context.Context, userID int, p *models.NotificationPreference) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO notification_preferences (user_id, type, email, in_app)
+        VALUES ($1, $2, COALESCE($3::boolean, TRUE), COALESCE($4::boolean, TRUE))
+        ON CONFLICT (user_id, type) DO UPDATE SET
+            email = COALESCE($3::boolean, notification_preferences.email),
+            in_app = COALESCE($4::boolean, notification_preferences.in_app),
+            updated_at = NOW()`,
+		userID, p.Type, p.Email, p.InApp)
+	return err
+}
+
+// CreateNotifications adds a notification for each of the (not deleted) users who did not turn
+// its type off in the app, and returns how many were added
+func (r *NotificationRepository) CreateNotifications(ctx context.Context, userIDs []int, n *models.Notification) (int64, error) {
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO notifications (user_id, type, title, body, link, data)
+        SELECT u.id, $2, $3, $4, $5, $6
+        FROM users u
+        WHERE u.id = ANY($1) AND u.deleted_at IS NULL AND NOT EXISTS (
+            SELECT 1 FROM notification_preferences p
+            WHERE p.user_id = u.id AND p.type = $2 AND NOT p.in_app
+        )`, pq.Array(ids), n.Type, n.Title, n.Body, n.Link, []byte(n.Data))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetNotifications returns up to limit notifications of a user, newest first, older than
+// the notification beforeID when it is not 0, and only the unread ones when unreadOnly is true
+func (r *NotificationRepository) GetNotifications(ctx context.Context, userID int, unreadOnly bool, beforeID int64, limit int) ([]models.Notification, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, type, title, body, link, data, created_at, read_at
+        FROM notifications
+        WHERE user_id = $1
+          AND (NOT $2 OR read_at IS NULL)
+          AND ($3::bigint = 0 OR id < $3)
+        ORDER BY id DESC
+        LIMIT $4`, userID, unreadOnly, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Type, &n.Title, &n.Body, &n.Link, &data, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		n.Data = data
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnread returns how many notifications of a user are unread
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification of a user as read; false if the user has no such notification
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID int, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+        WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkAllRead marks all the notifications of a user as read and returns how many were unread
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteReadBefore removes the notifications read before a time and returns how many were removed
+func (r *NotificationRepository) DeleteReadBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM notifications WHERE read_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type PersonalTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepository(db *sql.DB) *PersonalTokenRepository {
+	return &PersonalTokenRepository{db: db}
+}
+
+const personalTokenColumns = `id, user_id, name, token_prefix, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanPersonalToken(row rowScanner) (*models.PersonalToken, error) {
+	var t models.PersonalToken
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateToken stores a new token with the hash of its secret
+func (r *PersonalTokenRepository) CreateToken(ctx context.Context, t *models.PersonalToken, tokenHash string) error {
+	query := `
+        INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, t.UserID, t.Name, tokenHash, t.Prefix, pq.Array(t.Scopes), t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+}
+
+// GetTokensByUser returns the tokens of a user, the revoked ones included, latest first
+func (r *PersonalTokenRepository) GetTokensByUser(ctx context.Context, userID int) ([]models.PersonalToken, error) {
+	query := `SELECT ` + personalTokenColumns + `
+        FROM personal_access_tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalToken{}
+	for rows.Next() {
+		t, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// CountActiveTokens returns the number of tokens of a user that can still be used
+func (r *PersonalTokenRepository) CountActiveTokens(ctx context.Context, userID int) (int, error) {
+	query := `
+        SELECT COUNT(*) FROM personal_access_tokens
+        WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+	var n int
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&n)
+	return n, err
+}
+
+// RevokeToken revokes a token of a user; false if the user has no such active token
+func (r *PersonalTokenRepository) RevokeToken(ctx context.Context, userID, tokenID int) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE personal_access_tokens SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UseToken marks a token as used and returns it with its user
+// It returns nil when the token is unknown, revoked or expired, or its user disabled or deleted
+func (r *PersonalTokenRepository) UseToken(ctx context.Context, tokenHash string) (*models.PersonalToken, *models.User, error) {
+	query := `
+        UPDATE personal_access_tokens t SET last_used_at = NOW()
+        FROM users u
+        WHERE t.token_hash = $1 AND u.id = t.user_id
+          AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())
+          AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+        RETURNING t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.created_at, t.expires_at, t.last_used_at, t.revoked_at,
+                  u.username, u.role`
+	var user models.User
+	var t models.PersonalToken
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt,
+		&user.Username, &user.Role,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user.ID = t.UserID
+	return &t, &user, nil
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type ResponseTimeRepository struct {
+	db *sql.DB
+}
+
+func NewResponseTimeRepository(db *sql.DB) *ResponseTimeRepository {
+	return &ResponseTimeRepository{db: db}
+}
+
+// GetTimedAnswers returns the answer log of the placement questions with the question features
+// Times of students with extra time are divided by their multiplier, untimed students are left out
+func (r *ResponseTimeRepository) GetTimedAnswers(ctx context.Context) ([]models.TimedAnswer, error) {
+	query := `
+        SELECT pq.id, COALESCE(pq.question_type, ''), LENGTH(COALESCE(pq.question_text, '')),
+               COALESCE(pq.difficulty, 0), ta.response_time / COALESCE(tr.time_multiplier, 1)
+        FROM test_answers ta
+        JOIN placement_questions pq ON ta.question_id = pq.id
+        LEFT JOIN test_results_level tr ON ta.test_result_id = tr.id
+        WHERE ta.response_time IS NOT NULL AND NOT COALESCE(tr.untimed, FALSE)`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	answers := []models.TimedAnswer{}
+	for rows.Next() {
+		var a models.TimedAnswer
+		if err := rows.Scan(&a.QuestionID, &a.QuestionType, &a.TextLength, &a.Difficulty, &a.ResponseTime); err != nil {
+			return nil, err
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+// GetQuestionFeatures returns the features of the given placement questions by id
+func (r *ResponseTimeRepository) GetQuestionFeatures(ctx context.Context, questionIDs []int) (map[int]models.QuestionFeatures, error) {
+	query := `
+        SELECT id, COALESCE(question_type, ''), LENGTH(COALESCE(question_text, '')), COALESCE(difficulty, 0)
+        FROM placement_questions
+        WHERE id = ANY($1)`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(questionIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	features := map[int]models.QuestionFeatures{}
+	for rows.Next() {
+		var f models.QuestionFeatures
+		if err := rows.Scan(&f.QuestionID, &f.QuestionType, &f.TextLength, &f.Difficulty); err != nil {
+			return nil, err
+		}
+		features[f.QuestionID] = f
+	}
+	return features, rows.Err()
+}
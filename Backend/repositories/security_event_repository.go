@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type SecurityEventRepository struct {
+	db *sql.DB
+}
+
+func NewSecurityEventRepository(db *sql.DB) *SecurityEventRepository {
+	return &SecurityEventRepository{db: db}
+}
+
+// RecordEvent appends an event to the security audit log
+func (r *SecurityEventRepository) RecordEvent(ctx context.Context, e *models.SecurityEvent) error {
+	query := `
+        INSERT INTO security_events (event_type, user_id, actor_id, ip, details)
+        VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+        RETURNING id, created_at`
+	return r.db.QueryRowContext(ctx, query, e.EventType, e.UserID, e.ActorID, e.IP, e.Details).Scan(&e.ID, &e.CreatedAt)
+}
+
+// GetUserEvents returns the latest security events of a user
+func (r *SecurityEventRepository) GetUserEvents(ctx context.Context, userID, limit int) ([]models.SecurityEvent, error) {
+	query := `
+        SELECT id, event_type, user_id, actor_id, COALESCE(ip, ''), COALESCE(details, ''), created_at
+        FROM security_events
+        WHERE user_id = $1
+        ORDER BY created_at DESC
+        LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.SecurityEvent
+	for rows.Next() {
+		var e models.SecurityEvent
+		if err := rows.Scan(&e.ID, &e.EventType, &e.UserID, &e.ActorID, &e.IP, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// CreateSession creates a session along with its first refresh token
+func (r *SessionRepository) CreateSession(ctx context.Context, s *models.Session, token *models.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO auth_sessions (id, user_id, expires_at)
+        VALUES ($1, $2, $3)
+        RETURNING created_at, last_used_at`
+	if err := tx.QueryRowContext(ctx, query, s.ID, s.UserID, s.ExpiresAt).Scan(&s.CreatedAt, &s.LastUsedAt); err != nil {
+		return err
+	}
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, t *models.RefreshToken) error {
+	query := `
+        INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+        VALUES ($1, $2, $3)
+        RETURNING id`
+	return tx.QueryRowContext(ctx, query, t.SessionID, t.TokenHash, t.ExpiresAt).Scan(&t.ID)
+}
+
+// GetRefreshToken returns a refresh token by hash along with its session
+func (r *SessionRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, *models.Session, error) {
+	query := `
+        SELECT rt.id, rt.session_id, rt.token_hash, rt.expires_at, rt.used_at,
+               s.id, s.user_id, s.created_at, s.last_used_at, s.expires_at, s.revoked_at, s.revoked_reason
+        FROM refresh_tokens rt
+        JOIN auth_sessions s ON s.id = rt.session_id
+        WHERE rt.token_hash = $1`
+	var t models.RefreshToken
+	var s models.Session
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&t.ID, &t.SessionID, &t.TokenHash, &t.ExpiresAt, &t.UsedAt,
+		&s.ID, &s.UserID, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt, &s.RevokedReason,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &t, &s, nil
+}
+
+// RotateRefreshToken marks a refresh token as used and stores its successor
+// rotated is false if the token was already used (concurrent or replayed rotation)
+func (r *SessionRepository) RotateRefreshToken(ctx context.Context, usedID int, next *models.RefreshToken) (rotated bool, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, usedID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE auth_sessions SET last_used_at = NOW() WHERE id = $1`, next.SessionID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RevokeSession revokes a session, its access and refresh tokens are rejected from then on
+func (r *SessionRepository) RevokeSession(ctx context.Context, sessionID, reason string) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = NOW(), revoked_reason = $2
+        WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, sessionID, reason)
+	return err
+}
+
+// RevokeOtherSessions revokes the sessions of a user but one (the current session)
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID int, keepSessionID, reason string) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = NOW(), revoked_reason = $3
+        WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, keepSessionID, reason)
+	return err
+}
+
+// RevokeUserSessions revokes all the sessions of a user
+func (r *SessionRepository) RevokeUserSessions(ctx context.Context, userID int, reason string) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = NOW(), revoked_reason = $2
+        WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, reason)
+	return err
+}
+
+// IsSessionActive checks that a session of the user exists, is not revoked and has not expired
+func (r *SessionRepository) IsSessionActive(ctx context.Context, sessionID string, userID int) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM auth_sessions
+            WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+        )`
+	var active bool
+	err := r.db.QueryRowContext(ctx, query, sessionID, userID).Scan(&active)
+	return active, err
+}
@@ -158,3 +158,28 @@ func (r *TestRepository) DeleteTest(ctx context.Context, id int) error {
 	_, err = r.db.ExecContext(ctx, query, id)
 	return err
 }
+
+// GetAssignedStudentIDs returns the ids of the students of the classrooms a test is assigned to
+func (r *TestRepository) GetAssignedStudentIDs(ctx context.Context, testID int) ([]int, error) {
+	query := `
+        SELECT DISTINCT cm.user_id
+        FROM Classroom_tests ct
+        JOIN Classroom_members cm ON cm.classroom_id = ct.classroom_id
+        WHERE ct.test_id = $1
+        ORDER BY cm.user_id`
+	rows, err := r.db.QueryContext(ctx, query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
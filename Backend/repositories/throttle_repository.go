@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+// ThrottleRepository is the Postgres throttle.Store, shared by all server instances
+type ThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewThrottleRepository(db *sql.DB) *ThrottleRepository {
+	return &ThrottleRepository{db: db}
+}
+
+func (r *ThrottleRepository) Get(ctx context.Context, key string) (throttle.State, error) {
+	query := `SELECT failures, last_failure, locked_until FROM throttle_records WHERE key = $1`
+	var state throttle.State
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&state.Failures, &state.LastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return throttle.State{}, nil
+	}
+	if err != nil {
+		return throttle.State{}, err
+	}
+	if lockedUntil.Valid {
+		state.LockedUntil = lockedUntil.Time
+	}
+	return state, nil
+}
+
+func (r *ThrottleRepository) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	query := `
+        INSERT INTO throttle_records (key, failures, last_failure)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE WHEN throttle_records.last_failure < $3 THEN 1 ELSE throttle_records.failures + 1 END,
+            last_failure = $2
+        RETURNING failures`
+	var failures int
+	err := r.db.QueryRowContext(ctx, query, key, now, windowStart).Scan(&failures)
+	return failures, err
+}
+
+// Take locks the row of the key for the check, so that concurrent attempts on a key wait for each other
+func (r *ThrottleRepository) Take(ctx context.Context, key string, now, windowStart time.Time, allow func(throttle.State) bool) (throttle.State, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return throttle.State{}, false, err
+	}
+	defer tx.Rollback()
+
+	// The row is created first, so that there is one to lock for a new key
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO throttle_records (key, failures, last_failure)
+        VALUES ($1, 0, $2)
+        ON CONFLICT (key) DO NOTHING`, key, now)
+	if err != nil {
+		return throttle.State{}, false, err
+	}
+	var state throttle.State
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT failures, last_failure, locked_until FROM throttle_records WHERE key = $1 FOR UPDATE`, key).
+		Scan(&state.Failures, &state.LastFailure, &lockedUntil)
+	if err != nil {
+		return throttle.State{}, false, err
+	}
+	if lockedUntil.Valid {
+		state.LockedUntil = lockedUntil.Time
+	}
+	if !allow(state) {
+		return state, false, tx.Commit()
+	}
+
+	if state.LastFailure.Before(windowStart) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailure = now
+	_, err = tx.ExecContext(ctx, `UPDATE throttle_records SET failures = $2, last_failure = $3 WHERE key = $1`, key, state.Failures, now)
+	if err != nil {
+		return throttle.State{}, false, err
+	}
+	return state, true, tx.Commit()
+}
+
+func (r *ThrottleRepository) Forgive(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE throttle_records SET failures = failures - 1 WHERE key = $1 AND failures > 0`, key)
+	return err
+}
+
+func (r *ThrottleRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE throttle_records SET locked_until = $2 WHERE key = $1`
+	_, err := r.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+func (r *ThrottleRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM throttle_records WHERE key = $1`, key)
+	return err
+}
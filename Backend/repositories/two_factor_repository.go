@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// GetTOTP returns the TOTP enrolment of a user, nil if none
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID int) (*models.TOTPEnrollment, error) {
+	query := `SELECT user_id, secret, confirmed_at, last_step FROM user_totp WHERE user_id = $1`
+	var e models.TOTPEnrollment
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&e.UserID, &e.Secret, &e.ConfirmedAt, &e.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// SaveTOTP stores a new unconfirmed secret; a confirmed enrolment is never replaced (false)
+func (r *TwoFactorRepository) SaveTOTP(ctx context.Context, userID int, secret string) (bool, error) {
+	query := `
+        INSERT INTO user_totp (user_id, secret)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+        WHERE user_totp.confirmed_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ConfirmTOTP enables the enrolment of a user with the step of its first code and stores its recovery codes
+func (r *TwoFactorRepository) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryHashes []string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+        UPDATE user_totp SET confirmed_at = NOW(), last_step = $2
+        WHERE user_id = $1 AND confirmed_at IS NULL`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UseStep records the time step of an accepted code; false if it (or a later one) was already used
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE user_totp SET last_step = $2
+        WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteTOTP removes the enrolment and the recovery codes of a user
+func (r *TwoFactorRepository) DeleteTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes replaces all the recovery codes of a user
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceRecoveryCodes(ctx, tx, userID, hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes a recovery code; false if unknown or already used
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE totp_recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (r *TwoFactorRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM totp_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// CreateChallenge stores the second step of a login
+func (r *TwoFactorRepository) CreateChallenge(ctx context.Context, tokenHash string, c *models.MFAChallenge) error {
+	query := `INSERT INTO mfa_challenges (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, tokenHash, c.UserID, c.Purpose, c.ExpiresAt)
+	return err
+}
+
+// GetChallenge returns a pending challenge without counting an attempt, nil when unknown, expired or out of attempts
+func (r *TwoFactorRepository) GetChallenge(ctx context.Context, tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	query := `
+        SELECT user_id, purpose, attempts, expires_at FROM mfa_challenges
+        WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2`
+	var c models.MFAChallenge
+	err := r.db.QueryRowContext(ctx, query, tokenHash, maxAttempts).Scan(&c.UserID, &c.Purpose, &c.Attempts, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ClaimChallengeAttempt counts an attempt on a challenge and returns it
+// It returns nil when the challenge is unknown, expired or out of attempts
+func (r *TwoFactorRepository) ClaimChallengeAttempt(ctx context.Context, tokenHash string, maxAttempts int) (*models.MFAChallenge, error) {
+	query := `
+        UPDATE mfa_challenges SET attempts = attempts + 1
+        WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2
+        RETURNING user_id, purpose, attempts, expires_at`
+	var c models.MFAChallenge
+	err := r.db.QueryRowContext(ctx, query, tokenHash, maxAttempts).Scan(&c.UserID, &c.Purpose, &c.Attempts, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteChallenge removes a challenge once redeemed, and the expired ones
+func (r *TwoFactorRepository) DeleteChallenge(ctx context.Context, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM mfa_challenges WHERE token_hash = $1 OR expires_at < NOW()`, tokenHash)
+	return err
+}
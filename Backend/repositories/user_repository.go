@@ -9,6 +9,24 @@ import (
 	"github.com/panosmaurikos/personalisedenglish/backend/models"
 )
 
+// userColumns are the columns read by scanUser
+const userColumns = `id, username, email, password, role, create_time, email_verified_at, disabled_at, password_reset_required, deleted_at, locale`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreateTime,
+		&user.EmailVerifiedAt, &user.DisabledAt, &user.PasswordResetRequired, &user.DeletedAt, &user.Locale)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -31,14 +49,13 @@ func (r *UserRepository) CreateUser(ctx context.Context, u *models.User) error {
 
 func (r *UserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-        SELECT id, username, email, password, role, create_time
+        SELECT ` + userColumns + `
         FROM users
         WHERE username = $1
         LIMIT 1`
 	row := r.db.QueryRowContext(ctx, query, username)
 
-	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreateTime)
+	user, err := scanUser(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -46,55 +63,100 @@ func (r *UserRepository) GetUserByUsername(ctx context.Context, username string)
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-        SELECT id, username, email, password, role, create_time
+        SELECT ` + userColumns + `
         FROM users
         WHERE email = $1
         LIMIT 1`
 	row := r.db.QueryRowContext(ctx, query, email)
 
-	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreateTime)
+	user, err := scanUser(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
-func (r *UserRepository) CreatePasswordResetOTP(ctx context.Context, userID int, otp string, expiresAt time.Time) error {
+// CreatePasswordReset stores the reset code of a user, replacing the previous one
+// Nothing is stored (false) while the user is locked out or a code was issued after resendAfter
+func (r *UserRepository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset, resendAfter time.Time) (bool, error) {
 	query := `
-        INSERT INTO password_resets (user_id, token, expires_at)
-        VALUES ($1, $2, $3)`
-	_, err := r.db.ExecContext(ctx, query, userID, otp, expiresAt)
-	return err
+        INSERT INTO password_resets (user_id, email, code_hash, attempts, created_at, expires_at)
+        VALUES ($1, $2, $3, 0, NOW(), $4)
+        ON CONFLICT (user_id) DO UPDATE
+        SET email = EXCLUDED.email, code_hash = EXCLUDED.code_hash, attempts = 0,
+            created_at = NOW(), expires_at = EXCLUDED.expires_at, locked_until = NULL
+        WHERE (password_resets.locked_until IS NULL OR password_resets.locked_until <= NOW())
+          AND password_resets.created_at <= $5`
+	res, err := r.db.ExecContext(ctx, query, reset.UserID, reset.Email, reset.CodeHash, reset.ExpiresAt, resendAfter)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
-func (r *UserRepository) GetUserIDByOTP(ctx context.Context, otp string) (int, error) {
+// ClaimPasswordResetAttempt counts an attempt on the active code sent to an email and returns it
+// It returns nil when there is no such code, it has expired, the attempts are exhausted
+// or the email is no longer the user's
+func (r *UserRepository) ClaimPasswordResetAttempt(ctx context.Context, email string, maxAttempts int) (*models.PasswordReset, error) {
 	query := `
-        SELECT user_id FROM password_resets
-        WHERE token = $1 AND expires_at > NOW()
-        LIMIT 1`
-	var userID int
-	err := r.db.QueryRowContext(ctx, query, otp).Scan(&userID)
+        UPDATE password_resets pr
+        SET attempts = pr.attempts + 1
+        FROM users u
+        WHERE u.id = pr.user_id AND u.email = pr.email
+          AND pr.email = $1 AND pr.expires_at > NOW() AND pr.attempts < $2
+        RETURNING pr.id, pr.user_id, pr.email, pr.code_hash, pr.attempts, pr.created_at, pr.expires_at`
+	var reset models.PasswordReset
+	err := r.db.QueryRowContext(ctx, query, email, maxAttempts).Scan(
+		&reset.ID, &reset.UserID, &reset.Email, &reset.CodeHash, &reset.Attempts, &reset.CreatedAt, &reset.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return userID, nil
+	return &reset, nil
 }
 
-func (r *UserRepository) DeletePasswordResetOTP(ctx context.Context, otp string) error {
-	query := `DELETE FROM password_resets WHERE token = $1`
-	_, err := r.db.ExecContext(ctx, query, otp)
+// LockPasswordReset locks a user out of password resets once the attempts on their code are exhausted
+func (r *UserRepository) LockPasswordReset(ctx context.Context, id int, until time.Time) error {
+	query := `UPDATE password_resets SET locked_until = $2, expires_at = LEAST(expires_at, NOW()) WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, until)
 	return err
 }
 
+// ResetPassword updates the password of a user and deletes the code used, in a transaction
+func (r *UserRepository) ResetPassword(ctx context.Context, resetID, userID int, hashedPassword string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE id = $1 AND user_id = $2`, resetID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows // Used concurrently
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password = $1, password_reset_required = FALSE WHERE id = $2`, hashedPassword, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (r *UserRepository) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
 	query := `UPDATE users SET password = $1 WHERE id = $2`
 	_, err := r.db.ExecContext(ctx, query, hashedPassword, userID)
@@ -103,38 +165,121 @@ func (r *UserRepository) UpdateUserPassword(ctx context.Context, userID int, has
 
 func (r *UserRepository) GetUserByUsernameOrEmail(ctx context.Context, identifier string) (*models.User, error) {
 	query := `
-        SELECT id, username, email, password, role, create_time
+        SELECT ` + userColumns + `
         FROM users
         WHERE username = $1 OR email = $1
         LIMIT 1`
 	row := r.db.QueryRowContext(ctx, query, identifier)
 
-	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreateTime)
+	user, err := scanUser(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (r *UserRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-        SELECT id, username, email, password, role, create_time
+        SELECT ` + userColumns + `
         FROM users
         WHERE id = $1
         LIMIT 1`
 	row := r.db.QueryRowContext(ctx, query, id)
 
-	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreateTime)
+	user, err := scanUser(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
+}
+
+// MarkEmailVerified confirms the email of a user, provided it is still the one given
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID int, email string) (bool, error) {
+	query := `
+        UPDATE users SET email_verified_at = NOW()
+        WHERE id = $1 AND email = $2 AND email_verified_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, userID, email)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListUsers returns a page of the users matching the filter, by ID, and the number of matches
+func (r *UserRepository) ListUsers(ctx context.Context, f *models.UserFilter) ([]models.User, int, error) {
+	where := `WHERE ($1 = '' OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+          AND ($2 = '' OR role = $2)
+          AND ($3 = '' OR ($3 = 'disabled') = (disabled_at IS NOT NULL))`
+	args := []any{f.Query, f.Role, f.Status}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users ` + where + ` ORDER BY id LIMIT $4 OFFSET $5`
+	rows, err := r.db.QueryContext(ctx, query, append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		user.Password = ""
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+// UpdateUserRole changes the role of a user
+func (r *UserRepository) UpdateUserRole(ctx context.Context, userID int, role string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID)
+	return err
+}
+
+// SetUserDisabled disables an account, or enables it again
+func (r *UserRepository) SetUserDisabled(ctx context.Context, userID int, disabled bool) error {
+	query := `UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, disabled, userID)
+	return err
+}
+
+// RequirePasswordReset refuses the password logins of a user until they reset their password
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET password_reset_required = TRUE WHERE id = $1`, userID)
+	return err
+}
+
+// CountActiveAdmins returns the number of administrators whose account is not disabled
+func (r *UserRepository) CountActiveAdmins(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = 'admin' AND disabled_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// UpdateProfile changes the username and email of a user; a changed email is unverified again
+func (r *UserRepository) UpdateProfile(ctx context.Context, userID int, username, email string) error {
+	query := `
+        UPDATE users SET username = $1, email = $2,
+            email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
+        WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, username, email, userID)
+	return err
+}
+
+// UpdateLocale sets the language of the emails sent to a user
+func (r *UserRepository) UpdateLocale(ctx context.Context, userID int, locale string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET locale = $1 WHERE id = $2`, locale, userID)
+	return err
 }
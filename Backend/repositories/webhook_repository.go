@@ -0,0 +1,256 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookColumns = `id, teacher_id, url, description, events, active, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (*models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	err := row.Scan(&s.ID, &s.TeacherID, &s.URL, &s.Description, pq.Array(&s.Events), &s.Active, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *WebhookRepository) queryWebhooks(ctx context.Context, query string, args ...any) ([]models.WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.WebhookSubscription{}
+	for rows.Next() {
+		s, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// CreateSubscription stores a new subscription with its secret
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, s *models.WebhookSubscription) error {
+	query := `
+        INSERT INTO webhook_subscriptions (teacher_id, url, description, events, secret, active)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at, updated_at`
+	return r.db.QueryRowContext(ctx, query, s.TeacherID, s.URL, s.Description, pq.Array(s.Events), s.Secret, s.Active).
+		Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// GetSubscriptions returns the subscriptions of a teacher
+func (r *WebhookRepository) GetSubscriptions(ctx context.Context, teacherID int) ([]models.WebhookSubscription, error) {
+	return r.queryWebhooks(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE teacher_id = $1 ORDER BY id`, teacherID)
+}
+
+// CountSubscriptions returns how many subscriptions a teacher has
+func (r *WebhookRepository) CountSubscriptions(ctx context.Context, teacherID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhook_subscriptions WHERE teacher_id = $1`, teacherID).Scan(&count)
+	return count, err
+}
+
+// GetSubscription returns a subscription without its secret, nil if it does not exist
+func (r *WebhookRepository) GetSubscription(ctx context.Context, id int) (*models.WebhookSubscription, error) {
+	s, err := scanWebhook(r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+// GetActiveSubscriptions returns the active subscriptions of some teachers to an event
+func (r *WebhookRepository) GetActiveSubscriptions(ctx context.Context, teacherIDs []int, eventType string) ([]models.WebhookSubscription, error) {
+	ids := make([]int64, len(teacherIDs))
+	for i, id := range teacherIDs {
+		ids[i] = int64(id)
+	}
+	query := `SELECT ` + webhookColumns + `
+        FROM webhook_subscriptions
+        WHERE teacher_id = ANY($1) AND active AND $2 = ANY(events)
+        ORDER BY id`
+	return r.queryWebhooks(ctx, query, pq.Array(ids), eventType)
+}
+
+// UpdateSubscription saves the url, description, events and state of a subscription
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, s *models.WebhookSubscription) error {
+	query := `
+        UPDATE webhook_subscriptions SET url = $2, description = $3, events = $4, active = $5, updated_at = NOW()
+        WHERE id = $1
+        RETURNING updated_at`
+	return r.db.QueryRowContext(ctx, query, s.ID, s.URL, s.Description, pq.Array(s.Events), s.Active).Scan(&s.UpdatedAt)
+}
+
+// SetSecret replaces the secret of a subscription
+func (r *WebhookRepository) SetSecret(ctx context.Context, id int, secret string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE webhook_subscriptions SET secret = $2, updated_at = NOW() WHERE id = $1`, id, secret)
+	return err
+}
+
+// DeleteSubscription removes a subscription and its deliveries
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	return err
+}
+
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+        d.last_status_code, d.last_error, d.last_response, d.redelivery_of, d.created_at, d.delivered_at`
+
+func scanDelivery(row rowScanner, endpoint ...any) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	dest := append([]any{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.LastResponse, &d.RedeliveryOf, &d.CreatedAt, &d.DeliveredAt}, endpoint...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return &d, nil
+}
+
+// EnqueueDeliveries queues an event for delivery to some subscriptions
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, subscriptionIDs []int, eventID, eventType string, payload []byte) error {
+	ids := make([]int64, len(subscriptionIDs))
+	for i, id := range subscriptionIDs {
+		ids[i] = int64(id)
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+        SELECT unnest($1::bigint[]), $2, $3, $4`, pq.Array(ids), eventID, eventType, string(payload))
+	return err
+}
+
+// ClaimDue takes up to limit pending deliveries of active subscriptions whose next attempt is due,
+// counting the attempt and leasing them until leaseUntil, with the URL and secret of their subscription
+// Concurrent workers claim different deliveries
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]models.WebhookDelivery, error) {
+	query := `
+        UPDATE webhook_deliveries d SET attempts = d.attempts + 1, next_attempt_at = $2
+        FROM webhook_subscriptions s
+        WHERE s.id = d.subscription_id AND d.id IN (
+            SELECT due.id FROM webhook_deliveries due
+            JOIN webhook_subscriptions sub ON sub.id = due.subscription_id
+            WHERE due.status = 'pending' AND due.next_attempt_at <= NOW() AND sub.active
+            ORDER BY due.next_attempt_at
+            LIMIT $1
+            FOR UPDATE OF due SKIP LOCKED
+        )
+        RETURNING ` + deliveryColumns + `, s.url, s.secret`
+	rows, err := r.db.QueryContext(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var endpoint, secret string
+		d, err := scanDelivery(rows, &endpoint, &secret)
+		if err != nil {
+			return nil, err
+		}
+		d.URL, d.Secret = endpoint, secret
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records the successful attempt of a delivery
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id int64, statusCode int, response string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = 'delivered', delivered_at = NOW(), last_status_code = $2, last_response = $3, last_error = NULL
+        WHERE id = $1`, id, statusCode, response)
+	return err
+}
+
+// MarkFailed records a failed attempt: the delivery is retried at nextAttempt, or given up on when failed is true
+// statusCode is nil when no response was received
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id int64, statusCode *int, response, lastError string, nextAttempt time.Time, failed bool) error {
+	status := models.WebhookPending
+	if failed {
+		status = models.WebhookFailed
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $2, last_status_code = $3, last_response = $4, last_error = $5, next_attempt_at = $6
+        WHERE id = $1`, id, status, statusCode, response, lastError, nextAttempt)
+	return err
+}
+
+// GetDeliveries returns the latest deliveries of a subscription
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + `
+        FROM webhook_deliveries d
+        WHERE d.subscription_id = $1
+        ORDER BY d.id DESC
+        LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDelivery returns a delivery, nil if it does not exist
+func (r *WebhookRepository) GetDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries d WHERE d.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// Redeliver queues a delivery again, as a new delivery of the same event due now
+func (r *WebhookRepository) Redeliver(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	query := `
+        INSERT INTO webhook_deliveries AS d (subscription_id, event_id, event_type, payload, redelivery_of)
+        SELECT src.subscription_id, src.event_id, src.event_type, src.payload, src.id
+        FROM webhook_deliveries src
+        WHERE src.id = $1
+        RETURNING ` + deliveryColumns
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// DeleteFinishedBefore removes the deliveries delivered or given up on before a time, and returns how many were removed
+func (r *WebhookRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+        DELETE FROM webhook_deliveries
+        WHERE status <> 'pending' AND COALESCE(delivered_at, next_attempt_at) < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type XAPIRepository struct {
+	db *sql.DB
+}
+
+func NewXAPIRepository(db *sql.DB) *XAPIRepository {
+	return &XAPIRepository{db: db}
+}
+
+// Enqueue queues statements for the LRS, keyed by their statement id
+// A statement already queued is not queued again
+func (r *XAPIRepository) Enqueue(ctx context.Context, statements []models.XAPIStatement) error {
+	ids := make([]string, len(statements))
+	bodies := make([]string, len(statements))
+	for i, s := range statements {
+		ids[i], bodies[i] = s.StatementID, string(s.Statement)
+	}
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO xapi_statements (statement_id, statement)
+        SELECT * FROM unnest($1::uuid[], $2::text[])
+        ON CONFLICT (statement_id) DO NOTHING`, pq.Array(ids), pq.Array(bodies))
+	return err
+}
+
+// ClaimDue takes up to limit pending statements whose next attempt is due, oldest first, counting the attempt
+// and leasing them until leaseUntil
+// Concurrent workers claim different statements
+func (r *XAPIRepository) ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]models.XAPIStatement, error) {
+	query := `
+        UPDATE xapi_statements SET attempts = attempts + 1, next_attempt_at = $2
+        WHERE id IN (
+            SELECT id FROM xapi_statements
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, statement_id, statement, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+	rows, err := r.db.QueryContext(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []models.XAPIStatement{}
+	for rows.Next() {
+		var s models.XAPIStatement
+		var body string
+		if err := rows.Scan(&s.ID, &s.StatementID, &body, &s.Status, &s.Attempts, &s.NextAttemptAt, &s.LastError, &s.CreatedAt, &s.SentAt); err != nil {
+			return nil, err
+		}
+		s.Statement = []byte(body)
+		statements = append(statements, s)
+	}
+	return statements, rows.Err()
+}
+
+// MarkSent records the delivery of statements
+func (r *XAPIRepository) MarkSent(ctx context.Context, ids []int64) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE xapi_statements SET status = 'sent', sent_at = NOW(), last_error = NULL
+        WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+// MarkFailed records a failed attempt: the statement is retried at nextAttempt, or given up on when failed is true
+func (r *XAPIRepository) MarkFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time, failed bool) error {
+	status := models.XAPIPending
+	if failed {
+		status = models.XAPIFailed
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE xapi_statements SET status = $2, last_error = $3, next_attempt_at = $4
+        WHERE id = $1`, id, status, lastError, nextAttempt)
+	return err
+}
+
+// DeleteFinishedBefore removes the statements sent or given up on before a time, and returns how many were removed
+func (r *XAPIRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+        DELETE FROM xapi_statements
+        WHERE status <> 'pending' AND COALESCE(sent_at, next_attempt_at) < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
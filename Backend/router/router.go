@@ -1,26 +1,36 @@
 package router
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"math"
+	"mime"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"github.com/lib/pq"
 	"github.com/panosmaurikos/personalisedenglish/backend/api"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
 	"github.com/panosmaurikos/personalisedenglish/backend/feedback"
 	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
 	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/personalization"
 	"github.com/panosmaurikos/personalisedenglish/backend/services"
+	"github.com/panosmaurikos/personalisedenglish/backend/testformat"
 	"github.com/rs/cors"
 )
 
+// maxTestImportSize bounds the files of the test imports
+const maxTestImportSize = 10 << 20
+
 // Helper function to get absolute value of an integer
 func abs(x int) int {
 	if x < 0 {
@@ -29,6 +39,169 @@ func abs(x int) int {
 	return x
 }
 
+// Helper function to read the grid size of a surface from the query (?n=41)
+func gridSize(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 2 || n > 201 {
+		return fuzzylogic.DefaultGridSize
+	}
+	return n
+}
+
+// Helper function to answer a failed two-factor operation of the current user
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many invalid codes, try again later"}`, http.StatusTooManyRequests)
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		http.Error(w, `{"error": "Invalid two-factor code"}`, http.StatusUnauthorized)
+	case errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrNoTwoFactorEnrollment):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+	default:
+		http.Error(w, `{"error": "Two-factor operation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed user management operation
+func writeAdminError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrOutboxEmailNotFound):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidOutboxStatus), errors.Is(err, services.ErrInvalidUserStatus):
+		http.Error(w, `{"error": "Invalid request: `+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCannotModifySelf):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+	case errors.Is(err, services.ErrLastAdmin), errors.Is(err, services.ErrAccountDeleted):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: role must be student, teacher, guardian or admin"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "User management failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed change of the current user's account
+func writeAccountError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many wrong passwords, try again later"}`, http.StatusTooManyRequests)
+	case errors.Is(err, services.ErrWrongPassword):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+	case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken), errors.Is(err, services.ErrLastAdmin):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+	case errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: `+err.Error()+`"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "Account update failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed guardian operation
+func writeGuardianError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many invalid invite codes, try again later"}`, http.StatusTooManyRequests)
+	case errors.Is(err, services.ErrNotGuardianOf):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+	case errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidGuardianInvite), errors.Is(err, services.ErrNotAGuardian), errors.Is(err, services.ErrNotAStudent):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: `+err.Error()+`"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "Guardian operation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed personal access token operation
+func writePersonalTokenError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, services.ErrPersonalTokenNotFound):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrPersonalTokensForbidden):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+	case errors.Is(err, services.ErrTooManyPersonalTokens):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: give a name and scopes among `+strings.Join(models.PersonalTokenScopes, ", ")+`"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "Token operation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed webhook operation
+func writeWebhookError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrWebhookDeliveryNotFound):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrTooManyWebhooks):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidWebhookURL):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: give a URL and events among `+strings.Join(models.WebhookEvents, ", ")+`"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "Webhook operation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed notification operation
+func writeNotificationError(w http.ResponseWriter, err error) {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, services.ErrNotificationNotFound):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+	case errors.Is(err, services.ErrNotificationTypeUnavailable):
+		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+	case errors.As(err, &validationErrs):
+		http.Error(w, `{"error": "Invalid request: give notification types among `+strings.Join(models.NotificationTypes, ", ")+`"}`, http.StatusBadRequest)
+	default:
+		http.Error(w, `{"error": "Notification operation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+	}
+}
+
+// Helper function to answer a failed test import, with the items the file could not convert
+func writeTestImportError(w http.ResponseWriter, result *models.TestImport, err error) {
+	var validationErrs validator.ValidationErrors
+	status := http.StatusInternalServerError
+	body := map[string]interface{}{"error": err.Error()}
+	switch {
+	case errors.Is(err, services.ErrNothingToImport):
+		status = http.StatusUnprocessableEntity
+		body["skipped"] = result.Skipped
+	case errors.Is(err, services.ErrImportQuestionType), errors.Is(err, testformat.ErrUnknownFormat), errors.Is(err, testformat.ErrInvalidFile):
+		status = http.StatusBadRequest
+	case errors.As(err, &validationErrs):
+		status = http.StatusBadRequest
+		body["error"] = "Invalid request: give the type of the test and a format among " + strings.Join(testformat.Formats, ", ")
+	default:
+		body["error"] = "Failed to import test: " + err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
 type Handler struct{}
 
 func NewHandler() *Handler {
@@ -40,8 +213,31 @@ func (h *Handler) SetupRouter(
 	loginHandler http.Handler,
 	forgotPasswordHandler http.Handler,
 	resetPasswordOTPHandler http.Handler,
+	refreshHandler http.Handler,
+	logoutHandler http.Handler,
+	verifyEmailHandler http.Handler,
+	resendVerificationHandler http.Handler,
+	unsubscribeHandler http.Handler,
+	oidcHandler *api.OIDCHandler,
+	ssoService *services.SSOService,
+	ltiHandler *api.LTIHandler,
+	twoFactorLoginHandler *api.TwoFactorLoginHandler,
+	twoFactorService *services.TwoFactorService,
+	authenticator *auth.Authenticator,
+	keys *auth.KeySet,
 	testService *services.TestService,
 	classroomService *services.ClassroomService,
+	levelService *services.LevelService,
+	responseTimeService *services.ResponseTimeService,
+	accommodationService *services.AccommodationService,
+	loginGuard *services.LoginGuard,
+	adminService *services.AdminService,
+	accountService *services.AccountService,
+	guardianService *services.GuardianService,
+	personalTokenService *services.PersonalTokenService,
+	notificationService *services.NotificationService,
+	webhookService *services.WebhookService,
+	outboxHandler *api.OutboxHandler,
 	db *sql.DB,
 ) http.Handler {
 	r := mux.NewRouter()
@@ -49,26 +245,47 @@ func (h *Handler) SetupRouter(
 	r.Handle("/login", loginHandler).Methods("POST")
 	r.Handle("/forgot-password", forgotPasswordHandler).Methods("POST")
 	r.Handle("/reset-password", resetPasswordOTPHandler).Methods("POST")
+	r.Handle("/refresh", refreshHandler).Methods("POST")
+	r.Handle("/verify-email", verifyEmailHandler).Methods("GET", "POST")
+	r.Handle("/unsubscribe", unsubscribeHandler).Methods("GET", "POST")
+
+	// Second step of the logins with two-factor authentication
+	r.HandleFunc("/login/2fa", twoFactorLoginHandler.Verify).Methods("POST")
+	r.HandleFunc("/login/2fa/enroll", twoFactorLoginHandler.Enroll).Methods("POST")
+
+	// Single sign-on with OpenID Connect providers
+	r.HandleFunc("/auth/oidc/providers", oidcHandler.Providers).Methods("GET")
+	r.HandleFunc("/auth/oidc/{provider}/login", oidcHandler.Login).Methods("GET")
+	r.HandleFunc("/auth/oidc/{provider}/callback", oidcHandler.Callback).Methods("GET")
+
+	// LTI 1.3 launches from the platforms (only mounted with LTI_PLATFORMS set)
+	if ltiHandler != nil {
+		r.HandleFunc("/lti/login", ltiHandler.Login).Methods("GET", "POST")
+		r.HandleFunc("/lti/launch", ltiHandler.Launch).Methods("POST")
+		r.HandleFunc("/lti/deep-linking", ltiHandler.DeepLinking).Methods("POST")
+		r.HandleFunc("/lti/jwks", ltiHandler.JWKS).Methods("GET")
+	}
+
+	// Development outbox: the emails sent (only mounted with MAILER=memory or MAIL_OUTBOX=true)
+	if outboxHandler != nil {
+		r.HandleFunc("/dev/outbox", outboxHandler.Index).Methods("GET")
+		r.HandleFunc("/dev/outbox/messages", outboxHandler.List).Methods("GET")
+		r.HandleFunc("/dev/outbox/messages", outboxHandler.Clear).Methods("DELETE")
+		r.HandleFunc("/dev/outbox/messages/{id}", outboxHandler.Get).Methods("GET")
+		r.HandleFunc("/dev/outbox/messages/{id}/html", outboxHandler.HTML).Methods("GET")
+	}
+
+	// Public JSON Web Key Set (asymmetric signing keys only)
+	r.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}).Methods("GET")
 
-	r.HandleFunc("/placement-questions", func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/placement-questions", authenticator.Optional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		limit := 20
 
-		// Try to get userID from token (optional - works for both logged in and anonymous users)
-		var userID int
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "" && len(authHeader) > 7 {
-			tokenString := authHeader[7:] // Remove "Bearer " prefix
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				return []byte("your-secret-key"), nil
-			})
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					if id, ok := claims["user_id"].(float64); ok {
-						userID = int(id)
-					}
-				}
-			}
-		}
+		// userID is set for logged in users (optional - works for both logged in and anonymous users)
+		userID, _ := auth.UserID(r.Context())
 
 		rows, err := db.Query(`SELECT id, question_text, question_type, options, correct_answer, points, category FROM placement_questions ORDER BY RANDOM() LIMIT $1`, limit)
 		if err != nil {
@@ -143,21 +360,23 @@ func (h *Handler) SetupRouter(
 			})
 		}
 		json.NewEncoder(w).Encode(questions)
-	}).Methods("GET")
+	}))).Methods("GET")
 
 	// Apply AuthMiddleware to protected routes
 	protectedRouter := r.PathPrefix("/").Subrouter()
-	protectedRouter.Use(api.AuthMiddleware)
+	protectedRouter.Use(authenticator.Required)
+	protectedRouter.Handle("/logout", logoutHandler).Methods("POST")
+	protectedRouter.Handle("/verify-email/resend", resendVerificationHandler).Methods("POST")
 
 	// Current user info endpoint
 	protectedRouter.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
 		}
-		var username, email, role string
-		err := db.QueryRow("SELECT username, email, role FROM users WHERE id = $1", userID).Scan(&username, &email, &role)
+		var username, email, role, locale string
+		err := db.QueryRow("SELECT username, email, role, locale FROM users WHERE id = $1", userID).Scan(&username, &email, &role, &locale)
 		if err != nil {
 			http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
 			return
@@ -166,12 +385,13 @@ func (h *Handler) SetupRouter(
 			"username": username,
 			"email":    email,
 			"role":     role,
+			"locale":   locale,
 		})
 	}).Methods("GET")
 
 	// Personalized practice questions endpoint - ALWAYS uses learning preferences
 	protectedRouter.HandleFunc("/personalized-practice-questions", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -449,14 +669,33 @@ func (h *Handler) SetupRouter(
 			return
 		}
 
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
 		}
 
+		// Normalize response times by the expected time of each question
+		timedAnswers := make([]models.TimedAnswer, len(req.Answers))
+		for i, ans := range req.Answers {
+			timedAnswers[i].QuestionID = ans.QuestionID
+			timedAnswers[i].ResponseTime = ans.ResponseTime
+		}
+		speedRatio, err := responseTimeService.SpeedRatio(r.Context(), timedAnswers, req.AvgTime)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to normalize response times: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+
+		// Extra time of the student
+		accommodation, err := accommodationService.GetAccommodation(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch accommodation: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+
 		// Calculate fuzzy level and difficulty
-		level, difficulty, err := fuzzylogic.EvaluateLevel(req.Score, req.AvgTime)
+		eval, err := levelService.EvaluateLevel(req.Score, speedRatio, accommodation)
 		if err != nil {
 			http.Error(w, `{"error": "Failed to evaluate level: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
@@ -533,11 +772,13 @@ func (h *Handler) SetupRouter(
 		err = db.QueryRow(`
 			INSERT INTO test_results_level (
 			   user_id, score, avg_response_time, vocabulary_pct, grammar_pct, 
-			   reading_pct, listening_pct, difficulty, fuzzy_level, test_type
+			   reading_pct, listening_pct, difficulty, fuzzy_level, test_type,
+			   level_score, engine_version, speed_ratio, time_multiplier, untimed
 		   )
-		   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		   RETURNING id
-	   `, userID, req.Score, req.AvgTime, vocabPct, grammarPct, readingPct, listeningPct, difficulty, level, testType).Scan(&testResultID)
+	   `, userID, req.Score, req.AvgTime, vocabPct, grammarPct, readingPct, listeningPct, int(math.Round(eval.LevelScore)), eval.Level, testType,
+			eval.LevelScore, eval.EngineVersion, speedRatio, accommodation.TimeMultiplier, accommodation.Untimed).Scan(&testResultID)
 		if err != nil {
 			http.Error(w, `{"error": "Failed to save test result: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
@@ -568,12 +809,13 @@ func (h *Handler) SetupRouter(
 				}
 			}
 		}
+		levelService.ResultRecorded(r.Context(), testResultID)
 
-		json.NewEncoder(w).Encode(map[string]string{"level": level})
+		json.NewEncoder(w).Encode(map[string]string{"level": eval.Level})
 	}).Methods("POST")
 
 	protectedRouter.HandleFunc("/user-mistakes", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -611,7 +853,7 @@ func (h *Handler) SetupRouter(
 
 	// Endpoint for user mistakes by phenomenon
 	protectedRouter.HandleFunc("/user-phenomenon-mistakes", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -648,7 +890,7 @@ func (h *Handler) SetupRouter(
 
 	// Learning preferences endpoint - view user's learning preferences by question type
 	protectedRouter.HandleFunc("/learning-preferences", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -666,7 +908,7 @@ func (h *Handler) SetupRouter(
 
 	// Last 5 tests endpoint - returns user's last 5 test results with learning preferences
 	protectedRouter.HandleFunc("/last-five-tests", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -720,7 +962,7 @@ func (h *Handler) SetupRouter(
 
 	// Learning style analysis endpoint - provides comprehensive learning style analysis
 	protectedRouter.HandleFunc("/learning-style-analysis", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -738,7 +980,7 @@ func (h *Handler) SetupRouter(
 
 	// Recommended question types endpoint - returns best question type per category
 	protectedRouter.HandleFunc("/recommended-question-types", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -755,7 +997,7 @@ func (h *Handler) SetupRouter(
 	}).Methods("GET")
 
 	protectedRouter.HandleFunc("/recommended-questions", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -930,7 +1172,7 @@ func (h *Handler) SetupRouter(
 	}).Methods("GET")
 
 	protectedRouter.HandleFunc("/user-history", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok || userID == 0 {
 			http.Error(w, `{"error": "User ID not found in context"}`, http.StatusUnauthorized)
 			return
@@ -976,7 +1218,7 @@ func (h *Handler) SetupRouter(
 
 	// Misconceptions endpoint
 	protectedRouter.HandleFunc("/misconceptions/{testID}", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+		userID, ok := auth.UserID(r.Context())
 		if !ok {
 			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
 			return
@@ -1017,20 +1259,20 @@ func (h *Handler) SetupRouter(
 
 	// Teacher routes
 	teacherRouter := r.PathPrefix("/teacher").Subrouter()
-	teacherRouter.Use(api.TeacherOnlyMiddleware)
+	teacherRouter.Use(authenticator.RequireRole("teacher"))
 
-	teacherRouter.HandleFunc("/tests", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/tests", auth.Scoped(models.ScopeReadTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		tests, err := testService.GetTests(r.Context(), userID)
 		if err != nil {
 			http.Error(w, `{"error": "Failed to fetch tests: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
 		json.NewEncoder(w).Encode(tests)
-	}).Methods("GET")
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/tests", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/tests", auth.Scoped(models.ScopeWriteTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		var req models.CreateTestRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
@@ -1042,10 +1284,49 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(test)
-	}).Methods("POST")
+	})).Methods("POST")
+
+	// Test import from a file of another quiz system, sent as multipart/form-data with the fields of
+	// ImportTestRequest; ?preview=true converts it without creating the test
+	teacherRouter.Handle("/tests/import", auth.Scoped(models.ScopeWriteTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		r.Body = http.MaxBytesReader(w, r.Body, maxTestImportSize)
+		if err := r.ParseMultipartForm(maxTestImportSize); err != nil {
+			http.Error(w, `{"error": "Send the file as multipart/form-data, 10 MB at most"}`, http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, `{"error": "The file is missing"}`, http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, `{"error": "The file could not be read"}`, http.StatusBadRequest)
+			return
+		}
+		req := models.ImportTestRequest{
+			Format:       r.FormValue("format"),
+			Title:        r.FormValue("title"),
+			Description:  r.FormValue("description"),
+			Type:         r.FormValue("type"),
+			QuestionType: r.FormValue("question_type"),
+		}
+		preview := r.URL.Query().Get("preview") == "true"
+		result, err := testService.ImportTest(r.Context(), userID, &req, header.Filename, data, preview)
+		if err != nil {
+			writeTestImportError(w, result, err)
+			return
+		}
+		if !preview {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(result)
+	})).Methods("POST")
 
-	teacherRouter.HandleFunc("/tests/{id}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/tests/{id}", auth.Scoped(models.ScopeWriteTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		id, _ := strconv.Atoi(vars["id"])
 		log.Printf("Received PUT /teacher/tests/%d by user %d", id, userID)
@@ -1060,10 +1341,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(test)
-	}).Methods("PUT")
+	})).Methods("PUT")
 
-	teacherRouter.HandleFunc("/tests/{id}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/tests/{id}", auth.Scoped(models.ScopeReadTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		id, _ := strconv.Atoi(vars["id"])
 		test, err := testService.GetTest(r.Context(), userID, id)
@@ -1076,10 +1357,35 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(test)
-	}).Methods("GET")
+	})).Methods("GET")
+
+	// Test export: ?format=qti (content package), moodle (Moodle XML) or html (print-ready page with
+	// the answer key); ?variant=<code> shuffles the questions and options the same way for the same code
+	teacherRouter.Handle("/tests/{id}/export", auth.Scoped(models.ScopeReadTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		query := r.URL.Query()
+		file, err := testService.ExportTest(r.Context(), userID, id, query.Get("format"), query.Get("variant"))
+		if errors.Is(err, testformat.ErrUnknownExportFormat) || errors.Is(err, testformat.ErrInvalidVariant) {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error": "Failed to export test: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		// The print-ready page opens in the browser, the other formats are downloaded
+		disposition := "attachment"
+		if query.Get("format") == testformat.Print {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", file.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+		w.Write(file.Data)
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/tests/{id}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/tests/{id}", auth.Scoped(models.ScopeWriteTests, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		id, _ := strconv.Atoi(vars["id"])
 		err := testService.DeleteTest(r.Context(), userID, id)
@@ -1088,21 +1394,21 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
-	}).Methods("DELETE")
+	})).Methods("DELETE")
 
 	// Teacher classroom routes
-	teacherRouter.HandleFunc("/classrooms", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms", auth.Scoped(models.ScopeReadClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		classrooms, err := classroomService.GetClassrooms(r.Context(), userID)
 		if err != nil {
 			http.Error(w, `{"error": "Failed to fetch classrooms: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
 		json.NewEncoder(w).Encode(classrooms)
-	}).Methods("GET")
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/classrooms", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms", auth.Scoped(models.ScopeWriteClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		var req models.CreateClassroomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
@@ -1114,10 +1420,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(classroom)
-	}).Methods("POST")
+	})).Methods("POST")
 
-	teacherRouter.HandleFunc("/classrooms/{id}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms/{id}", auth.Scoped(models.ScopeReadClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		id, _ := strconv.Atoi(vars["id"])
 		classroom, err := classroomService.GetClassroom(r.Context(), userID, id)
@@ -1126,10 +1432,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(classroom)
-	}).Methods("GET")
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/classrooms/{id}/assign-test", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms/{id}/assign-test", auth.Scoped(models.ScopeWriteClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		classroomID, _ := strconv.Atoi(vars["id"])
 		var req models.AssignTestRequest
@@ -1144,10 +1450,10 @@ func (h *Handler) SetupRouter(
 		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Test assigned successfully"})
-	}).Methods("POST")
+	})).Methods("POST")
 
-	teacherRouter.HandleFunc("/classrooms/{id}/results/{testID}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms/{id}/results/{testID}", auth.Scoped(models.ScopeReadResults, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		classroomID, _ := strconv.Atoi(vars["id"])
 		testID, _ := strconv.Atoi(vars["testID"])
@@ -1157,10 +1463,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(results)
-	}).Methods("GET")
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/students/{studentID}/tests/{testID}/details", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/students/{studentID}/tests/{testID}/details", auth.Scoped(models.ScopeReadResults, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		studentID, _ := strconv.Atoi(vars["studentID"])
 		testID, _ := strconv.Atoi(vars["testID"])
@@ -1170,10 +1476,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		json.NewEncoder(w).Encode(details)
-	}).Methods("GET")
+	})).Methods("GET")
 
-	teacherRouter.HandleFunc("/classrooms/{classroomID}/members/{studentID}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms/{classroomID}/members/{studentID}", auth.Scoped(models.ScopeWriteClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		classroomID, _ := strconv.Atoi(vars["classroomID"])
 		studentID, _ := strconv.Atoi(vars["studentID"])
@@ -1183,10 +1489,10 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
-	}).Methods("DELETE")
+	})).Methods("DELETE")
 
-	teacherRouter.HandleFunc("/classrooms/{classroomID}/tests/{testID}", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("userID").(int)
+	teacherRouter.Handle("/classrooms/{classroomID}/tests/{testID}", auth.Scoped(models.ScopeWriteClassrooms, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
 		classroomID, _ := strconv.Atoi(vars["classroomID"])
 		testID, _ := strconv.Atoi(vars["testID"])
@@ -1196,94 +1502,958 @@ func (h *Handler) SetupRouter(
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
-	}).Methods("DELETE")
+	})).Methods("DELETE")
 
-	// Student classroom routes (protected, but for students)
-	protectedRouter.HandleFunc("/classrooms/join", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
-		if !ok {
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+	// Teacher level confirmation routes (confirmed levels are used to learn the fuzzy rules)
+	teacherRouter.Handle("/students/{studentID}/levels", auth.Scoped(models.ScopeReadResults, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		vars := mux.Vars(r)
+		studentID, _ := strconv.Atoi(vars["studentID"])
+		results, err := levelService.GetStudentLevelResults(r.Context(), userID, studentID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch levels: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
-		var req models.JoinClassroomRequest
+		json.NewEncoder(w).Encode(results)
+	})).Methods("GET")
+
+	teacherRouter.HandleFunc("/levels/{resultID}/confirm", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		vars := mux.Vars(r)
+		resultID, _ := strconv.Atoi(vars["resultID"])
+		var req models.ConfirmLevelRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 			return
 		}
-		classroom, err := classroomService.JoinClassroom(r.Context(), userID, &req)
+		if err := levelService.ConfirmLevel(r.Context(), userID, resultID, &req); err != nil {
+			http.Error(w, `{"error": "Failed to confirm level: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Level confirmed successfully"})
+	}).Methods("PUT")
+
+	// Time accommodations of the teacher's students
+	teacherRouter.HandleFunc("/students/{studentID}/accommodations", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		vars := mux.Vars(r)
+		studentID, _ := strconv.Atoi(vars["studentID"])
+		accommodation, err := accommodationService.GetStudentAccommodation(r.Context(), userID, studentID)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to join classroom: `+err.Error()+`"}`, http.StatusBadRequest)
+			http.Error(w, `{"error": "Failed to fetch accommodation: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(classroom)
-	}).Methods("POST")
+		json.NewEncoder(w).Encode(accommodation)
+	}).Methods("GET")
 
-	protectedRouter.HandleFunc("/student/classrooms", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
-		if !ok {
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+	teacherRouter.HandleFunc("/students/{studentID}/accommodations", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		vars := mux.Vars(r)
+		studentID, _ := strconv.Atoi(vars["studentID"])
+		var req models.AccommodationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 			return
 		}
-		classrooms, err := classroomService.GetStudentClassrooms(r.Context(), userID)
+		accommodation, err := accommodationService.SetStudentAccommodation(r.Context(), userID, studentID, &req)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to fetch classrooms: `+err.Error()+`"}`, http.StatusInternalServerError)
+			http.Error(w, `{"error": "Failed to set accommodation: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(classrooms)
-	}).Methods("GET")
+		json.NewEncoder(w).Encode(accommodation)
+	}).Methods("PUT")
 
-	protectedRouter.HandleFunc("/student/classrooms/{id}", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
-		if !ok {
-			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+	// Invite codes for the guardians of the teacher's students
+	teacherRouter.HandleFunc("/students/{studentID}/guardian-invites", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		var req models.CreateGuardianInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		invite, err := guardianService.CreateInvite(r.Context(), userID, studentID, &req)
+		if err != nil {
+			writeGuardianError(w, err)
 			return
 		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(invite)
+	}).Methods("POST")
+
+	// Login lockout of the teacher's students
+	teacherRouter.HandleFunc("/students/{studentID}/lockout", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
-		id, _ := strconv.Atoi(vars["id"])
-		classroom, err := classroomService.GetClassroom(r.Context(), userID, id)
+		studentID, _ := strconv.Atoi(vars["studentID"])
+		lockout, err := loginGuard.GetStudentLockout(r.Context(), userID, studentID)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to fetch classroom: `+err.Error()+`"}`, http.StatusInternalServerError)
+			http.Error(w, `{"error": "Failed to fetch lockout: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(classroom)
+		json.NewEncoder(w).Encode(lockout)
 	}).Methods("GET")
 
-	// Get test questions (accessible by both teachers and students)
-	protectedRouter.HandleFunc("/tests/{id}/questions", func(w http.ResponseWriter, r *http.Request) {
+	teacherRouter.HandleFunc("/students/{studentID}/unlock", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
 		vars := mux.Vars(r)
-		id, _ := strconv.Atoi(vars["id"])
-		test, err := testService.GetTestByID(r.Context(), id)
+		studentID, _ := strconv.Atoi(vars["studentID"])
+		if err := loginGuard.UnlockStudent(r.Context(), userID, studentID); err != nil {
+			http.Error(w, `{"error": "Failed to unlock student: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Student unlocked successfully"})
+	}).Methods("POST")
+
+	// Visualization of the engine scoring the students (surface as svg, csv or json)
+	teacherRouter.HandleFunc("/fuzzy/level-surface", func(w http.ResponseWriter, r *http.Request) {
+		n := gridSize(r)
+		format := r.URL.Query().Get("format")
+		if format == "" || format == "svg" {
+			var buf bytes.Buffer
+			if err := levelService.Engine().RenderSurfaceSVG(&buf, n); err != nil {
+				http.Error(w, `{"error": "Failed to render surface: `+err.Error()+`"}`, http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(buf.Bytes())
+			return
+		}
+
+		s, err := levelService.Engine().Surface(string(fuzzylogic.ScoreID), string(fuzzylogic.SpeedRatioID), n)
 		if err != nil {
-			http.Error(w, `{"error": "Failed to fetch test questions: `+err.Error()+`"}`, http.StatusInternalServerError)
+			http.Error(w, `{"error": "Failed to compute surface: `+err.Error()+`"}`, http.StatusInternalServerError)
 			return
 		}
-		if test == nil {
-			http.Error(w, `{"error": "Test not found"}`, http.StatusNotFound)
+		switch format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			err = s.WriteCSV(w)
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			err = s.WriteJSON(w)
+		default:
+			http.Error(w, `{"error": "Invalid format"}`, http.StatusBadRequest)
 			return
 		}
-		json.NewEncoder(w).Encode(test.Questions)
+		if err != nil {
+			log.Printf("Error writing level surface: %v", err)
+		}
 	}).Methods("GET")
 
-	protectedRouter.HandleFunc("/tests/submit", func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value("userID").(int)
+	teacherRouter.HandleFunc("/fuzzy/membership/{value}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var buf bytes.Buffer
+		if err := levelService.Engine().RenderMembershipSVG(&buf, vars["value"], 201); err != nil {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(buf.Bytes())
+	}).Methods("GET")
+
+	// Personal access tokens of the teacher (session tokens only: these routes are not scoped)
+	teacherRouter.HandleFunc("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		tokens, err := personalTokenService.GetTokens(r.Context(), userID)
+		if err != nil {
+			writePersonalTokenError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens, "scopes": models.PersonalTokenScopes})
+	}).Methods("GET")
+
+	teacherRouter.HandleFunc("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.CreatePersonalTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		token, err := personalTokenService.CreateToken(r.Context(), userID, &req)
+		if err != nil {
+			writePersonalTokenError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+	}).Methods("POST")
+
+	teacherRouter.HandleFunc("/tokens/{tokenID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		tokenID, _ := strconv.Atoi(mux.Vars(r)["tokenID"])
+		if err := personalTokenService.RevokeToken(r.Context(), userID, tokenID); err != nil {
+			writePersonalTokenError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked"})
+	}).Methods("DELETE")
+
+	// Webhook subscriptions of the teacher and their delivery log (session tokens only)
+	teacherRouter.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		subscriptions, err := webhookService.GetSubscriptions(r.Context(), userID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"webhooks": subscriptions, "events": models.WebhookEvents})
+	}).Methods("GET")
+
+	teacherRouter.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.CreateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		subscription, err := webhookService.CreateSubscription(r.Context(), userID, &req)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(subscription)
+	}).Methods("POST")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		subscription, err := webhookService.GetSubscription(r.Context(), userID, webhookID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(subscription)
+	}).Methods("GET")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		var req models.UpdateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		subscription, err := webhookService.UpdateSubscription(r.Context(), userID, webhookID, &req)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(subscription)
+	}).Methods("PUT")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		if err := webhookService.DeleteSubscription(r.Context(), userID, webhookID); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted"})
+	}).Methods("DELETE")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}/secret", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		subscription, err := webhookService.RotateSecret(r.Context(), userID, webhookID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(subscription)
+	}).Methods("POST")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}/ping", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		if err := webhookService.Ping(r.Context(), userID, webhookID); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Ping queued"})
+	}).Methods("POST")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		deliveries, err := webhookService.GetDeliveries(r.Context(), userID, webhookID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(deliveries)
+	}).Methods("GET")
+
+	teacherRouter.HandleFunc("/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		webhookID, _ := strconv.Atoi(mux.Vars(r)["webhookID"])
+		deliveryID, _ := strconv.ParseInt(mux.Vars(r)["deliveryID"], 10, 64)
+		delivery, err := webhookService.Redeliver(r.Context(), userID, webhookID, deliveryID)
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	}).Methods("POST")
+
+	// Student classroom routes (protected, but for students)
+	protectedRouter.HandleFunc("/classrooms/join", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
 		if !ok {
 			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
 			return
 		}
-		var req models.SubmitTestResultRequest
+		var req models.JoinClassroomRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 			return
 		}
-		err := classroomService.SubmitTeacherTestResult(r.Context(), userID, &req)
+		classroom, err := classroomService.JoinClassroom(r.Context(), userID, &req)
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusForbidden)
+			return
+		}
 		if err != nil {
-			http.Error(w, `{"error": "Failed to submit test: `+err.Error()+`"}`, http.StatusInternalServerError)
+			http.Error(w, `{"error": "Failed to join classroom: `+err.Error()+`"}`, http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Test submitted successfully"})
+		json.NewEncoder(w).Encode(classroom)
 	}).Methods("POST")
 
+	protectedRouter.HandleFunc("/auth/identities", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		identities, err := ssoService.GetUserIdentities(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch identities: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(identities)
+	}).Methods("GET")
+
+	// Self-service of the current user's account
+	protectedRouter.HandleFunc("/account/profile", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := accountService.UpdateProfile(r.Context(), userID, &req)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("PUT")
+
+	protectedRouter.HandleFunc("/account/preferences", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.UpdatePreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := accountService.UpdatePreferences(r.Context(), userID, &req)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("PUT")
+
+	protectedRouter.HandleFunc("/account/notifications", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		preferences, err := notificationService.GetPreferences(r.Context(), claims.UserID, claims.Role)
+		if err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(preferences)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/account/notifications", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		var req models.UpdateNotificationPreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		preferences, err := notificationService.UpdatePreferences(r.Context(), claims.UserID, claims.Role, &req)
+		if err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(preferences)
+	}).Methods("PUT")
+
+	// Notification center
+	protectedRouter.HandleFunc("/notifications", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		query := r.URL.Query()
+		var beforeID int64
+		var limit int
+		var err error
+		if v := query.Get("before"); v != "" {
+			if beforeID, err = strconv.ParseInt(v, 10, 64); err != nil || beforeID < 0 {
+				http.Error(w, `{"error": "Invalid before"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+				http.Error(w, `{"error": "Invalid limit"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		list, err := notificationService.GetNotifications(r.Context(), userID, query.Get("unread") == "true", beforeID, limit)
+		if err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(list)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/notifications/unread-count", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		unread, err := notificationService.CountUnread(r.Context(), userID)
+		if err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"unread": unread})
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/notifications/read-all", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		marked, err := notificationService.MarkAllRead(r.Context(), userID)
+		if err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int64{"marked": marked})
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/notifications/{notificationID}/read", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		notificationID, err := strconv.ParseInt(mux.Vars(r)["notificationID"], 10, 64)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid notification ID"}`, http.StatusBadRequest)
+			return
+		}
+		if err := notificationService.MarkRead(r.Context(), userID, notificationID); err != nil {
+			writeNotificationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/account/password", func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		var req models.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		if err := accountService.ChangePassword(r.Context(), claims.UserID, claims.SessionID, &req); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Password changed, your other sessions were logged out"})
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/account/export", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		export, err := accountService.Export(r.Context(), userID)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="personalisedenglish-data-`+export.ExportedAt.Format("2006-01-02")+`.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(export)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		if err := accountService.DeleteAccount(r.Context(), userID, &req); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+	}).Methods("DELETE")
+
+	// Guardians of the current student
+	protectedRouter.HandleFunc("/guardian-invites", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.CreateGuardianInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		invite, err := guardianService.CreateInvite(r.Context(), userID, userID, &req)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(invite)
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/guardians", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		guardians, err := guardianService.GetGuardians(r.Context(), userID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(guardians)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/guardians/{guardianID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		guardianID, _ := strconv.Atoi(mux.Vars(r)["guardianID"])
+		if err := guardianService.Unlink(r.Context(), userID, guardianID, userID); err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Guardian removed"})
+	}).Methods("DELETE")
+
+	// Two-factor authentication (TOTP) of the current user
+	protectedRouter.HandleFunc("/2fa", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		status, err := twoFactorService.Status(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch two-factor status: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/2fa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		setup, err := twoFactorService.Enroll(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+				http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+				return
+			}
+			http.Error(w, `{"error": "Failed to start enrolment: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(setup)
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/2fa/confirm", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req models.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		codes, err := twoFactorService.Confirm(r.Context(), userID, req.Code)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "recovery_codes": codes})
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/2fa/disable", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req models.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		if err := twoFactorService.Disable(r.Context(), userID, &req); err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/2fa/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req models.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		codes, err := twoFactorService.RegenerateRecoveryCodes(r.Context(), userID, &req)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/accommodations", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		accommodation, err := accommodationService.GetAccommodation(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch accommodation: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(accommodation)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/student/classrooms", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		classrooms, err := classroomService.GetStudentClassrooms(r.Context(), userID)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch classrooms: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(classrooms)
+	}).Methods("GET")
+
+	protectedRouter.HandleFunc("/student/classrooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		vars := mux.Vars(r)
+		id, _ := strconv.Atoi(vars["id"])
+		classroom, err := classroomService.GetClassroom(r.Context(), userID, id)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch classroom: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(classroom)
+	}).Methods("GET")
+
+	// Get test questions (accessible by both teachers and students)
+	protectedRouter.HandleFunc("/tests/{id}/questions", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, _ := strconv.Atoi(vars["id"])
+		test, err := testService.GetTestByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to fetch test questions: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		if test == nil {
+			http.Error(w, `{"error": "Test not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(test.Questions)
+	}).Methods("GET")
+
+	// Start of the attempt at an assigned test; the time limit runs from it
+	protectedRouter.HandleFunc("/tests/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid test ID"}`, http.StatusBadRequest)
+			return
+		}
+		attempt, err := classroomService.StartTeacherTest(r.Context(), userID, id)
+		if errors.Is(err, services.ErrTestNotAssigned) {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error": "Failed to start test: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(attempt)
+	}).Methods("POST")
+
+	protectedRouter.HandleFunc("/tests/submit", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req models.SubmitTestResultRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		err := classroomService.SubmitTeacherTestResult(r.Context(), userID, &req)
+		if errors.Is(err, services.ErrTestNotStarted) {
+			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error": "Failed to submit test: `+err.Error()+`"}`, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Test submitted successfully"})
+	}).Methods("POST")
+
+	// Administrator routes: user management
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(authenticator.RequireRole(models.RoleAdmin))
+
+	adminRouter.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		page, _ := strconv.Atoi(q.Get("page"))
+		pageSize, _ := strconv.Atoi(q.Get("page_size"))
+		filter := &models.UserFilter{
+			Query:    q.Get("q"),
+			Role:     q.Get("role"),
+			Status:   q.Get("status"),
+			Page:     page,
+			PageSize: pageSize,
+		}
+		users, err := adminService.ListUsers(r.Context(), filter)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(users)
+	}).Methods("GET")
+
+	adminRouter.HandleFunc("/users/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := adminService.GetUser(r.Context(), userID)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("GET")
+
+	adminRouter.HandleFunc("/users/{userID}/role", func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := auth.UserID(r.Context())
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		var req models.ChangeRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := adminService.ChangeRole(r.Context(), adminID, userID, &req)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("PUT")
+
+	adminRouter.HandleFunc("/users/{userID}/disable", func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := auth.UserID(r.Context())
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := adminService.SetDisabled(r.Context(), adminID, userID, true)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("POST")
+
+	adminRouter.HandleFunc("/users/{userID}/enable", func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := auth.UserID(r.Context())
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		user, err := adminService.SetDisabled(r.Context(), adminID, userID, false)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(user)
+	}).Methods("POST")
+
+	adminRouter.HandleFunc("/users/{userID}/force-password-reset", func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := auth.UserID(r.Context())
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		sent, err := adminService.ForcePasswordReset(r.Context(), adminID, userID)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Password reset required", "code_sent": sent})
+	}).Methods("POST")
+
+	adminRouter.HandleFunc("/users/{userID}/classrooms", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["userID"])
+		if err != nil {
+			http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+			return
+		}
+		classrooms, err := adminService.GetUserClassrooms(r.Context(), userID)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(classrooms)
+	}).Methods("GET")
+
+	// Email outbox: delivery status and dead letters
+	adminRouter.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		emails, err := adminService.ListEmails(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(emails)
+	}).Methods("GET")
+
+	adminRouter.HandleFunc("/emails/{emailID}/retry", func(w http.ResponseWriter, r *http.Request) {
+		adminID, _ := auth.UserID(r.Context())
+		emailID, err := strconv.ParseInt(mux.Vars(r)["emailID"], 10, 64)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid email ID"}`, http.StatusBadRequest)
+			return
+		}
+		if err := adminService.RetryEmail(r.Context(), adminID, emailID); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Email queued again"})
+	}).Methods("POST")
+
+	// Guardian routes: read-only access to the progress of linked students
+	guardianRouter := r.PathPrefix("/guardian").Subrouter()
+	guardianRouter.Use(authenticator.RequireRole(models.RoleGuardian))
+
+	guardianRouter.HandleFunc("/links", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		var req models.RedeemGuardianInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		link, err := guardianService.RedeemInvite(r.Context(), userID, &req)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(link)
+	}).Methods("POST")
+
+	guardianRouter.HandleFunc("/students", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		students, err := guardianService.GetStudents(r.Context(), userID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(students)
+	}).Methods("GET")
+
+	guardianRouter.HandleFunc("/students/{studentID}", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		if err := guardianService.Unlink(r.Context(), userID, userID, studentID); err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Student removed"})
+	}).Methods("DELETE")
+
+	guardianRouter.HandleFunc("/students/{studentID}/history", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		history, err := guardianService.GetStudentHistory(r.Context(), userID, studentID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(history)
+	}).Methods("GET")
+
+	guardianRouter.HandleFunc("/students/{studentID}/levels", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		levels, err := guardianService.GetStudentLevels(r.Context(), userID, studentID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(levels)
+	}).Methods("GET")
+
+	guardianRouter.HandleFunc("/students/{studentID}/mistakes", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		mistakes, err := guardianService.GetStudentMistakes(r.Context(), userID, studentID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(mistakes)
+	}).Methods("GET")
+
+	guardianRouter.HandleFunc("/students/{studentID}/assignments", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := auth.UserID(r.Context())
+		studentID, _ := strconv.Atoi(mux.Vars(r)["studentID"])
+		assignments, err := guardianService.GetStudentAssignments(r.Context(), userID, studentID)
+		if err != nil {
+			writeGuardianError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(assignments)
+	}).Methods("GET")
+
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
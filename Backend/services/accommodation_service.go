@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/timing"
+)
+
+// AccommodationService provides methods for managing the time accommodations of students
+type AccommodationService struct {
+	repo          *repositories.AccommodationRepository // Handles accommodation operations
+	classroomRepo *repositories.ClassroomRepository     // Used to check teacher/student relationships
+	validator     *validator.Validate                   // Validates request structs
+}
+
+// NewAccommodationService creates a new AccommodationService instance
+func NewAccommodationService(repo *repositories.AccommodationRepository, classroomRepo *repositories.ClassroomRepository) *AccommodationService {
+	return &AccommodationService{
+		repo:          repo,
+		classroomRepo: classroomRepo,
+		validator:     validator.New(),
+	}
+}
+
+// GetAccommodation returns the accommodation of a student
+// Students without accommodation get a multiplier of 1
+func (s *AccommodationService) GetAccommodation(ctx context.Context, userID int) (*models.Accommodation, error) {
+	return getAccommodation(ctx, s.repo, userID)
+}
+
+// GetStudentAccommodation returns the accommodation of a student of the teacher
+func (s *AccommodationService) GetStudentAccommodation(ctx context.Context, teacherID, studentID int) (*models.Accommodation, error) {
+	ok, err := s.classroomRepo.IsTeacherOfStudent(ctx, teacherID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("student not found or unauthorized")
+	}
+	return getAccommodation(ctx, s.repo, studentID)
+}
+
+// SetStudentAccommodation sets the accommodation of a student of the teacher
+func (s *AccommodationService) SetStudentAccommodation(ctx context.Context, teacherID, studentID int, req *models.AccommodationRequest) (*models.Accommodation, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.classroomRepo.IsTeacherOfStudent(ctx, teacherID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("student not found or unauthorized")
+	}
+
+	accommodation := &models.Accommodation{
+		UserID:         studentID,
+		TimeMultiplier: req.TimeMultiplier,
+		Untimed:        req.Untimed,
+		Notes:          req.Notes,
+		UpdatedBy:      &teacherID,
+	}
+	if err := s.repo.SetAccommodation(ctx, accommodation); err != nil {
+		return nil, err
+	}
+	return accommodation, nil
+}
+
+// getAccommodation returns the stored accommodation of a student or the default one
+func getAccommodation(ctx context.Context, repo *repositories.AccommodationRepository, userID int) (*models.Accommodation, error) {
+	accommodation, err := repo.GetAccommodation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if accommodation == nil {
+		return &models.Accommodation{UserID: userID, TimeMultiplier: 1}, nil
+	}
+	return accommodation, nil
+}
+
+// toTimingAccommodation converts an accommodation profile for the timing computations
+func toTimingAccommodation(a *models.Accommodation) timing.Accommodation {
+	return timing.Accommodation{Multiplier: a.TimeMultiplier, Untimed: a.Untimed}
+}
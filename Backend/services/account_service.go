@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrWrongPassword = errors.New("the current password is wrong")
+	ErrUsernameTaken = errors.New("username already exists")
+	ErrEmailTaken    = errors.New("email already exists")
+)
+
+// AccountService lets users manage their own account: profile, password, data export and deletion
+// Every change needs the current password; wrong ones count as failed logins of the account
+type AccountService struct {
+	userRepo     *repositories.UserRepository    // Reads and updates the user
+	accountRepo  *repositories.AccountRepository // Exports and anonymises the data of the user
+	sessionRepo  *repositories.SessionRepository // Revokes the other sessions on password change
+	verification *EmailVerificationService       // Verifies a new email address
+	store        throttle.Store                  // Failed logins, shared with the LoginGuard
+	validator    *validator.Validate             // Validates request structs
+}
+
+// NewAccountService creates a new AccountService instance
+func NewAccountService(userRepo *repositories.UserRepository, accountRepo *repositories.AccountRepository, sessionRepo *repositories.SessionRepository, verification *EmailVerificationService, store throttle.Store) *AccountService {
+	return &AccountService{
+		userRepo:     userRepo,
+		accountRepo:  accountRepo,
+		sessionRepo:  sessionRepo,
+		verification: verification,
+		store:        store,
+		validator:    validator.New(),
+	}
+}
+
+// UpdateProfile changes the username and/or the email of a user
+// A new email is unverified until the user opens the link sent to it
+func (s *AccountService) UpdateProfile(ctx context.Context, userID int, req *models.UpdateProfileRequest) (*models.User, error) {
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	user, err := s.checkPassword(ctx, userID, req.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	username, email := user.Username, user.Email
+	if req.Username != "" {
+		username = req.Username
+	}
+	if req.Email != "" {
+		email = req.Email
+	}
+	if username == user.Username && email == user.Email {
+		return user, nil
+	}
+	if err := s.userRepo.UpdateProfile(ctx, userID, username, email); err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			if pgErr.Constraint == "users_email_key" {
+				return nil, ErrEmailTaken
+			}
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	emailChanged := email != user.Email
+	if user, err = s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	if emailChanged {
+		log.Printf("UpdateProfile: email changed for userID %d, sending a verification link", userID)
+		if err := s.verification.SendVerification(ctx, user); err != nil {
+			log.Printf("UpdateProfile: could not send the verification link: %v", err)
+		}
+	}
+	return user, nil
+}
+
+// UpdatePreferences changes the preferences of the user; empty fields are left unchanged
+func (s *AccountService) UpdatePreferences(ctx context.Context, userID int, req *models.UpdatePreferencesRequest) (*models.User, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	if req.Locale != "" {
+		if err := s.userRepo.UpdateLocale(ctx, userID, req.Locale); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// ChangePassword sets a new password and revokes the other sessions of the user
+func (s *AccountService) ChangePassword(ctx context.Context, userID int, sessionID string, req *models.ChangePasswordRequest) error {
+	if err := s.validator.Struct(req); err != nil {
+		return err
+	}
+	if _, err := s.checkPassword(ctx, userID, req.CurrentPassword); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdateUserPassword(ctx, userID, string(hash)); err != nil {
+		return err
+	}
+	log.Printf("ChangePassword: password updated for userID %d", userID)
+	return s.sessionRepo.RevokeOtherSessions(ctx, userID, sessionID, "password changed")
+}
+
+// Export returns all the data of a user
+func (s *AccountService) Export(ctx context.Context, userID int) (*models.AccountExport, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Password = ""
+	export, err := s.accountRepo.ExportUserData(ctx, userID, user.Role == models.RoleTeacher)
+	if err != nil {
+		return nil, err
+	}
+	export.ExportedAt = time.Now().UTC()
+	export.Profile = user
+	return export, nil
+}
+
+// DeleteAccount deletes the account of a user by anonymising it: teachers keep the results
+// of their classrooms, without the name, email or personal data of the user
+func (s *AccountService) DeleteAccount(ctx context.Context, userID int, req *models.DeleteAccountRequest) error {
+	if err := s.validator.Struct(req); err != nil {
+		return err
+	}
+	user, err := s.checkPassword(ctx, userID, req.Password)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin {
+		n, err := s.userRepo.CountActiveAdmins(ctx)
+		if err != nil {
+			return err
+		}
+		if n <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	// Nobody knows the new password
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)[:64]), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.accountRepo.AnonymizeUser(ctx, userID, string(hash)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	log.Printf("DeleteAccount: account of userID %d deleted (anonymised)", userID)
+	return nil
+}
+
+// checkPassword returns the user if the password is theirs
+func (s *AccountService) checkPassword(ctx context.Context, userID int, password string) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	key := accountThrottleKey(userID)
+	now := time.Now()
+	d, failures, err := AccountLoginPolicy.Take(ctx, s.store, key, now)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		return nil, &LoginThrottledError{Locked: d.Locked, RetryAfter: d.RetryAfter}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		if _, err := AccountLoginPolicy.Lockout(ctx, s.store, key, failures, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrWrongPassword
+	}
+	if err := s.store.Forgive(ctx, key); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
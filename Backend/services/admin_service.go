@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+const (
+	defaultUserPageSize = 25
+	maxUserPageSize     = 100
+)
+
+var (
+	ErrCannotModifySelf  = errors.New("administrators cannot change their own role or disable their own account")
+	ErrLastAdmin         = errors.New("the last active administrator cannot be removed")
+	ErrAccountDeleted    = errors.New("the account was deleted by its user")
+	ErrInvalidUserStatus = errors.New("status must be active or disabled")
+
+	ErrInvalidOutboxStatus = errors.New("status must be pending, sent or dead")
+	ErrOutboxEmailNotFound = errors.New("no dead-lettered email with this id")
+)
+
+// AdminService provides the user management of administrators
+// Every change is recorded in the security audit log with the administrator as actor
+type AdminService struct {
+	userRepo      *repositories.UserRepository          // Reads and updates the users
+	classroomRepo *repositories.ClassroomRepository     // Lists the classrooms of a user
+	userService   *UserService                          // Issues password reset codes
+	tokenService  *TokenService                         // Revokes the sessions of changed accounts
+	emails        *EmailService                         // Sends the password reset codes
+	events        *repositories.SecurityEventRepository // Security audit log
+	validator     *validator.Validate                   // Validates request structs
+}
+
+// NewAdminService creates a new AdminService instance
+func NewAdminService(userRepo *repositories.UserRepository, classroomRepo *repositories.ClassroomRepository, userService *UserService, tokenService *TokenService, emails *EmailService, events *repositories.SecurityEventRepository) *AdminService {
+	return &AdminService{
+		userRepo:      userRepo,
+		classroomRepo: classroomRepo,
+		userService:   userService,
+		tokenService:  tokenService,
+		emails:        emails,
+		events:        events,
+		validator:     validator.New(),
+	}
+}
+
+// ListUsers returns a page of the users matching the filter
+func (s *AdminService) ListUsers(ctx context.Context, filter *models.UserFilter) (*models.UserPage, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if filter.Status != "" && filter.Status != "active" && filter.Status != "disabled" {
+		return nil, ErrInvalidUserStatus
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = defaultUserPageSize
+	}
+	if filter.PageSize > maxUserPageSize {
+		filter.PageSize = maxUserPageSize
+	}
+	users, total, err := s.userRepo.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserPage{Users: users, Total: total, Page: filter.Page, PageSize: filter.PageSize}, nil
+}
+
+// GetUser returns a user
+func (s *AdminService) GetUser(ctx context.Context, userID int) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// ChangeRole changes the role of a user and revokes their sessions, so that their tokens carry the new role
+func (s *AdminService) ChangeRole(ctx context.Context, adminID, userID int, req *models.ChangeRoleRequest) (*models.User, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	if adminID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == req.Role {
+		return user, nil
+	}
+	if err := s.checkNotLastAdmin(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateUserRole(ctx, userID, req.Role); err != nil {
+		return nil, err
+	}
+	if err := s.tokenService.RevokeUserSessions(ctx, userID, "role changed"); err != nil {
+		return nil, err
+	}
+	s.record(ctx, models.EventRoleChanged, adminID, userID, user.Role+" -> "+req.Role)
+	user.Role = req.Role
+	return user, nil
+}
+
+// SetDisabled disables an account, revoking its sessions, or enables it again
+func (s *AdminService) SetDisabled(ctx context.Context, adminID, userID int, disabled bool) (*models.User, error) {
+	if adminID == userID {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled() == disabled {
+		return user, nil
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrAccountDeleted
+	}
+	if disabled {
+		if err := s.checkNotLastAdmin(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.userRepo.SetUserDisabled(ctx, userID, disabled); err != nil {
+		return nil, err
+	}
+	if disabled {
+		if err := s.tokenService.RevokeUserSessions(ctx, userID, "account disabled"); err != nil {
+			return nil, err
+		}
+		s.record(ctx, models.EventAccountDisabled, adminID, userID, "")
+	} else {
+		s.record(ctx, models.EventAccountEnabled, adminID, userID, "")
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// ForcePasswordReset refuses the password logins of a user until they set a new password,
+// revokes their sessions and emails them a reset code
+// It tells whether a code was sent: no new code is issued within a minute of the previous one
+// or while the resets of the user are locked out
+func (s *AdminService) ForcePasswordReset(ctx context.Context, adminID, userID int) (bool, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.DeletedAt != nil {
+		return false, ErrAccountDeleted
+	}
+	if err := s.userRepo.RequirePasswordReset(ctx, userID); err != nil {
+		return false, err
+	}
+	if err := s.tokenService.RevokeUserSessions(ctx, userID, "password reset forced"); err != nil {
+		return false, err
+	}
+	s.record(ctx, models.EventPasswordResetForced, adminID, userID, "")
+
+	code, err := s.userService.RequestPasswordReset(ctx, &models.ForgotPasswordRequest{Email: user.Email})
+	if err != nil {
+		return false, err
+	}
+	if code == "" {
+		return false, nil
+	}
+	if err := s.emails.SendPasswordResetCode(ctx, user.Email, user.Locale, code); err != nil {
+		log.Printf("ForcePasswordReset: could not email the code of userID %d: %v", userID, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// GetUserClassrooms returns the classrooms a teacher owns or a student belongs to
+func (s *AdminService) GetUserClassrooms(ctx context.Context, userID int) ([]models.Classroom, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == models.RoleTeacher {
+		return s.classroomRepo.GetClassroomsByTeacher(ctx, userID)
+	}
+	return s.classroomRepo.GetClassroomsByStudent(ctx, userID)
+}
+
+// checkNotLastAdmin refuses to demote or disable the last active administrator
+func (s *AdminService) checkNotLastAdmin(ctx context.Context, user *models.User) error {
+	if user.Role != models.RoleAdmin || user.Disabled() {
+		return nil
+	}
+	n, err := s.userRepo.CountActiveAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if n <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// record writes an administrator action to the security audit log
+func (s *AdminService) record(ctx context.Context, eventType string, adminID, userID int, details string) {
+	event := &models.SecurityEvent{EventType: eventType, UserID: &userID, ActorID: &adminID, Details: details}
+	if err := s.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("AdminService: could not record %s event: %v", eventType, err)
+	}
+}
+
+// ListEmails returns the latest emails of the outbox, optionally of one status
+func (s *AdminService) ListEmails(ctx context.Context, status string) ([]models.OutboxEmail, error) {
+	switch status {
+	case "", models.OutboxPending, models.OutboxSent, models.OutboxDead:
+	default:
+		return nil, ErrInvalidOutboxStatus
+	}
+	return s.emails.GetOutbox(ctx, status)
+}
+
+// RetryEmail queues a dead-lettered email again
+func (s *AdminService) RetryEmail(ctx context.Context, adminID int, emailID int64) error {
+	ok, err := s.emails.Requeue(ctx, emailID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOutboxEmailNotFound
+	}
+	log.Printf("AdminService: admin %d requeued email %d", adminID, emailID)
+	return nil
+}
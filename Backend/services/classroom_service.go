@@ -3,18 +3,32 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
+	"slices"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
 	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
 )
 
+var (
+	ErrTestNotAssigned = errors.New("test not found or not assigned to your classrooms")
+	ErrTestNotStarted  = errors.New("the timed test was not started, open it again")
+)
+
+// timeLimitGrace is the time past the limit a submission is still on time (network, slow devices)
+const timeLimitGrace = 30 * time.Second
+
 // ClassroomService provides methods for managing classrooms
 type ClassroomService struct {
-	repo      *repositories.ClassroomRepository
-	userRepo  *repositories.UserRepository
-	testRepo  *repositories.TestRepository
-	validator *validator.Validate
+	repo              *repositories.ClassroomRepository
+	userRepo          *repositories.UserRepository
+	testRepo          *repositories.TestRepository
+	accommodationRepo *repositories.AccommodationRepository
+	bus               *events.Bus
+	validator         *validator.Validate
 }
 
 // NewClassroomService creates a new ClassroomService instance
@@ -22,12 +36,16 @@ func NewClassroomService(
 	repo *repositories.ClassroomRepository,
 	userRepo *repositories.UserRepository,
 	testRepo *repositories.TestRepository,
+	accommodationRepo *repositories.AccommodationRepository,
+	bus *events.Bus,
 ) *ClassroomService {
 	return &ClassroomService{
-		repo:      repo,
-		userRepo:  userRepo,
-		testRepo:  testRepo,
-		validator: validator.New(),
+		repo:              repo,
+		userRepo:          userRepo,
+		testRepo:          testRepo,
+		accommodationRepo: accommodationRepo,
+		bus:               bus,
+		validator:         validator.New(),
 	}
 }
 
@@ -96,6 +114,9 @@ func (s *ClassroomService) GetClassroom(ctx context.Context, userID, classroomID
 	if user.Role == "student" {
 		for _, member := range classroom.Members {
 			if member.ID == userID {
+				if err := s.accommodateTimeLimits(ctx, userID, classroom.Tests); err != nil {
+					return nil, err
+				}
 				return classroom, nil
 			}
 		}
@@ -116,6 +137,9 @@ func (s *ClassroomService) JoinClassroom(ctx context.Context, userID int, req *m
 	if err != nil || user == nil || user.Role != "student" {
 		return nil, errors.New("unauthorized: only students can join classrooms")
 	}
+	if !user.EmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
 
 	// Find classroom by invite code
 	classroom, err := s.repo.GetClassroomByInviteCode(ctx, req.InviteCode)
@@ -127,10 +151,24 @@ func (s *ClassroomService) JoinClassroom(ctx context.Context, userID int, req *m
 		return nil, errors.New("invalid invite code")
 	}
 
+	members, err := s.repo.GetStudentIDs(ctx, classroom.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Join classroom
 	if err := s.repo.JoinClassroom(ctx, classroom.ID, userID); err != nil {
 		return nil, err
 	}
+	if !slices.Contains(members, userID) {
+		s.bus.Publish(ctx, events.ClassroomJoined, events.ClassroomMember{
+			ClassroomID: classroom.ID,
+			Classroom:   classroom.Name,
+			TeacherID:   classroom.TeacherID,
+			StudentID:   userID,
+			Student:     user.Username,
+		})
+	}
 
 	// Return full classroom details
 	return s.repo.GetClassroomByID(ctx, classroom.ID)
@@ -164,7 +202,32 @@ func (s *ClassroomService) AssignTest(ctx context.Context, userID, classroomID i
 	}
 
 	// Assign test to classroom
-	return s.repo.AssignTestToClassroom(ctx, classroomID, req.TestID)
+	if err := s.repo.AssignTestToClassroom(ctx, classroomID, req.TestID, req.TimeLimitMinutes); err != nil {
+		return err
+	}
+
+	// Changing the time limit of an assigned test is not a new assignment
+	if !slices.ContainsFunc(classroom.Tests, func(t models.Test) bool { return t.ID == req.TestID }) {
+		s.publishClassroomTest(ctx, events.TestAssigned, classroom, test)
+	}
+	return nil
+}
+
+// publishClassroomTest publishes an event about a test of a classroom, to its members
+func (s *ClassroomService) publishClassroomTest(ctx context.Context, eventType string, classroom *models.Classroom, test *models.Test) {
+	members, err := s.repo.GetStudentIDs(ctx, classroom.ID)
+	if err != nil {
+		log.Printf("ClassroomService: could not get the members of classroomID %d for %s: %v", classroom.ID, eventType, err)
+		return
+	}
+	s.bus.Publish(ctx, eventType, events.ClassroomTest{
+		ClassroomID: classroom.ID,
+		Classroom:   classroom.Name,
+		TeacherID:   classroom.TeacherID,
+		TestID:      test.ID,
+		Test:        test.Title,
+		StudentIDs:  members,
+	})
 }
 
 // GetClassroomResults returns test results for a classroom
@@ -191,7 +254,40 @@ func (s *ClassroomService) GetStudentClassrooms(ctx context.Context, userID int)
 		return nil, errors.New("unauthorized: only students can view their classrooms")
 	}
 
-	return s.repo.GetClassroomsByStudent(ctx, userID)
+	classrooms, err := s.repo.GetClassroomsByStudent(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range classrooms {
+		if err := s.accommodateTimeLimits(ctx, userID, classrooms[i].Tests); err != nil {
+			return nil, err
+		}
+	}
+	return classrooms, nil
+}
+
+// accommodateTimeLimits replaces the time limits of the assigned tests with the ones granted to the student
+func (s *ClassroomService) accommodateTimeLimits(ctx context.Context, userID int, tests []models.Test) error {
+	accommodation, err := getAccommodation(ctx, s.accommodationRepo, userID)
+	if err != nil {
+		return err
+	}
+	for i := range tests {
+		tests[i].TimeLimitSeconds = accommodatedLimit(accommodation, tests[i].TimeLimitSeconds)
+	}
+	return nil
+}
+
+// accommodatedLimit returns the time limit granted to a student for a limit (nil for untimed)
+func accommodatedLimit(accommodation *models.Accommodation, limit *int) *int {
+	if limit == nil {
+		return nil
+	}
+	granted, timed := toTimingAccommodation(accommodation).TimeLimit(*limit)
+	if !timed {
+		return nil
+	}
+	return &granted
 }
 
 // GetStudentTestDetails returns detailed test results including mistakes for a student
@@ -210,7 +306,34 @@ func (s *ClassroomService) GetStudentTestDetails(ctx context.Context, teacherID,
 	return s.repo.GetStudentTestDetails(ctx, studentID, testID)
 }
 
+// StartTeacherTest starts the attempt of a student at an assigned test, or returns the one running
+// The time limit granted to the student runs from the start, also when the test is opened again
+func (s *ClassroomService) StartTeacherTest(ctx context.Context, userID, testID int) (*models.TestAttempt, error) {
+	limit, assigned, err := s.repo.GetStudentTestTimeLimit(ctx, userID, testID)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		return nil, ErrTestNotAssigned
+	}
+	accommodation, err := getAccommodation(ctx, s.accommodationRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	startedAt, elapsed, err := s.repo.StartTestAttempt(ctx, userID, testID)
+	if err != nil {
+		return nil, err
+	}
+	attempt := &models.TestAttempt{TestID: testID, StartedAt: startedAt, TimeLimitSeconds: accommodatedLimit(accommodation, limit)}
+	if attempt.TimeLimitSeconds != nil {
+		remaining := max(*attempt.TimeLimitSeconds-int(elapsed), 0)
+		attempt.RemainingSeconds = &remaining
+	}
+	return attempt, nil
+}
+
 // SubmitTeacherTestResult allows a student to submit their test results
+// Submissions of timed tests past the limit (and its grace) are recorded, flagged as over time
 func (s *ClassroomService) SubmitTeacherTestResult(ctx context.Context, userID int, req *models.SubmitTestResultRequest) error {
 	// Validate request
 	if err := s.validator.Struct(req); err != nil {
@@ -246,8 +369,50 @@ func (s *ClassroomService) SubmitTeacherTestResult(ctx context.Context, userID i
 	score := (float64(correctAnswers) / float64(totalQuestions)) * 100
 	avgResponseTime := totalResponseTime / float64(totalQuestions)
 
+	// Record the time limit and the accommodation the test was taken under
+	limit, _, err := s.repo.GetStudentTestTimeLimit(ctx, userID, req.TestID)
+	if err != nil {
+		return err
+	}
+	accommodation, err := getAccommodation(ctx, s.accommodationRepo, userID)
+	if err != nil {
+		return err
+	}
+	resultTiming := models.ResultTiming{
+		TimeLimitSeconds: accommodatedLimit(accommodation, limit),
+		TimeMultiplier:   accommodation.TimeMultiplier,
+		Untimed:          accommodation.Untimed,
+	}
+	if resultTiming.TimeLimitSeconds != nil {
+		startedAt, elapsed, err := s.repo.GetTestAttempt(ctx, userID, req.TestID)
+		if err != nil {
+			return err
+		}
+		if startedAt == nil {
+			return ErrTestNotStarted
+		}
+		resultTiming.StartedAt = startedAt
+		allowed := time.Duration(*resultTiming.TimeLimitSeconds)*time.Second + timeLimitGrace
+		resultTiming.OverTime = time.Duration(elapsed*float64(time.Second)) > allowed
+	}
+
 	// Submit result
-	return s.repo.SubmitTeacherTestResult(ctx, userID, req.TestID, score, totalQuestions, correctAnswers, avgResponseTime, req.Answers)
+	resultID, err := s.repo.SubmitTeacherTestResult(ctx, userID, req.TestID, score, totalQuestions, correctAnswers, avgResponseTime, resultTiming, req.Answers)
+	if err != nil {
+		return err
+	}
+	s.bus.Publish(ctx, events.TestCompleted, events.TestResult{
+		ResultID:       resultID,
+		TestID:         test.ID,
+		Test:           test.Title,
+		TeacherID:      test.TeacherID,
+		StudentID:      userID,
+		Student:        user.Username,
+		Score:          score,
+		CorrectAnswers: correctAnswers,
+		TotalQuestions: totalQuestions,
+	})
+	return nil
 }
 
 // RemoveStudentFromClassroom removes a student from a classroom
@@ -262,7 +427,22 @@ func (s *ClassroomService) RemoveStudentFromClassroom(ctx context.Context, teach
 		return errors.New("classroom not found or unauthorized")
 	}
 
-	return s.repo.RemoveStudentFromClassroom(ctx, classroomID, studentID)
+	members, err := s.repo.GetStudentIDs(ctx, classroomID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.RemoveStudentFromClassroom(ctx, classroomID, studentID); err != nil {
+		return err
+	}
+	if slices.Contains(members, studentID) {
+		s.bus.Publish(ctx, events.StudentRemoved, events.ClassroomMember{
+			ClassroomID: classroom.ID,
+			Classroom:   classroom.Name,
+			TeacherID:   classroom.TeacherID,
+			StudentID:   studentID,
+		})
+	}
+	return nil
 }
 
 // RemoveTestFromClassroom removes a test from a classroom
@@ -277,5 +457,13 @@ func (s *ClassroomService) RemoveTestFromClassroom(ctx context.Context, teacherI
 		return errors.New("classroom not found or unauthorized")
 	}
 
-	return s.repo.RemoveTestFromClassroom(ctx, classroomID, testID)
+	if err := s.repo.RemoveTestFromClassroom(ctx, classroomID, testID); err != nil {
+		return err
+	}
+	for i := range classroom.Tests {
+		if classroom.Tests[i].ID == testID {
+			s.publishClassroomTest(ctx, events.TestUnassigned, classroom, &classroom.Tests[i])
+		}
+	}
+	return nil
 }
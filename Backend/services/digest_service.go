@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+// digestSendHour is the hour (UTC) on Mondays from which the digests of the week before are sent
+const digestSendHour = 7
+
+// DigestService emails the weekly progress digests: their week to the students,
+// and the completion of the assigned tests in their classrooms to the teachers
+type DigestService struct {
+	repo          *repositories.DigestRepository // Recipients, weeks and runs
+	emails        *EmailService                  // Queues the digests
+	notifications *NotificationService           // Signs the unsubscribe links
+	frontendURL   string                         // The digests link to the dashboards
+}
+
+// NewDigestService creates a new DigestService instance
+func NewDigestService(repo *repositories.DigestRepository, emails *EmailService, notifications *NotificationService, frontendURL string) *DigestService {
+	return &DigestService{
+		repo:          repo,
+		emails:        emails,
+		notifications: notifications,
+		frontendURL:   strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+// studentDigestEmail is the data of the weekly_digest_student template
+type studentDigestEmail struct {
+	Username     string
+	From, To     string
+	Tests        []models.DigestTest
+	LevelBefore  string
+	LevelAfter   string
+	LevelChanged bool
+	Phenomena    []models.MistakeCount
+	Pending      []models.DigestAssignment
+	Link         string
+	Unsubscribe  string
+}
+
+// teacherDigestEmail is the data of the weekly_digest_teacher template
+type teacherDigestEmail struct {
+	Username    string
+	From, To    string
+	Classrooms  []models.ClassroomDigest
+	Link        string
+	Unsubscribe string
+}
+
+// WeekStart returns the Monday (UTC) starting the week of t
+func WeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// Run sends the digests of the past week every Monday from digestSendHour, until the context is cancelled
+// Each week is sent by one instance; a run interrupted midway is resumed by the next check
+func (s *DigestService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		now := time.Now().UTC()
+		thisWeek := WeekStart(now)
+		if !now.Before(thisWeek.Add(digestSendHour * time.Hour)) {
+			s.runWeek(ctx, thisWeek.AddDate(0, 0, -7))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DigestService) runWeek(ctx context.Context, weekStart time.Time) {
+	claimed, err := s.repo.ClaimRun(ctx, weekStart)
+	if err != nil {
+		log.Printf("DigestService: could not claim the digests of the week of %s: %v", weekStart.Format("2006-01-02"), err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	queued, err := s.SendWeeklyDigests(ctx, weekStart)
+	if err != nil {
+		log.Printf("DigestService: digests of the week of %s interrupted: %v", weekStart.Format("2006-01-02"), err)
+		return
+	}
+	if err := s.repo.CompleteRun(ctx, weekStart, queued); err != nil {
+		log.Printf("DigestService: could not record the digests of the week of %s: %v", weekStart.Format("2006-01-02"), err)
+	}
+	log.Printf("DigestService: %d digest(s) queued for the week of %s", queued, weekStart.Format("2006-01-02"))
+}
+
+// SendWeeklyDigests queues the digests of the week starting at weekStart and returns how many were queued
+// Users who turned the digest off are skipped, and so are those with nothing to report
+// Sending a week again does not send the digests already queued
+func (s *DigestService) SendWeeklyDigests(ctx context.Context, weekStart time.Time) (int, error) {
+	queued := 0
+	for _, role := range []string{models.RoleStudent, models.RoleTeacher} {
+		users, err := s.repo.GetRecipients(ctx, role, models.NotificationWeeklyDigest)
+		if err != nil {
+			return queued, err
+		}
+		for i := range users {
+			sent, err := s.SendDigest(ctx, &users[i], weekStart)
+			if err != nil {
+				if ctx.Err() != nil {
+					return queued, ctx.Err()
+				}
+				log.Printf("DigestService: could not queue the digest of userID %d: %v", users[i].ID, err)
+				continue
+			}
+			if sent {
+				queued++
+			}
+		}
+	}
+	return queued, nil
+}
+
+// SendDigest queues the digest of a week for a student or a teacher; false if there is nothing to report
+func (s *DigestService) SendDigest(ctx context.Context, user *models.User, weekStart time.Time) (bool, error) {
+	weekStart = WeekStart(weekStart)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+	from, to := weekStart.Format("2006-01-02"), weekEnd.AddDate(0, 0, -1).Format("2006-01-02")
+	unsubscribe := s.notifications.UnsubscribeURL(user.ID, models.NotificationWeeklyDigest)
+
+	switch user.Role {
+	case models.RoleStudent:
+		week, err := s.repo.GetStudentWeek(ctx, user.ID, weekStart, weekEnd)
+		if err != nil {
+			return false, err
+		}
+		// Nothing done and nothing to do: the student never took a test
+		if len(week.Tests) == 0 && len(week.Pending) == 0 && week.LevelAfter == "" {
+			return false, nil
+		}
+		data := studentDigestEmail{
+			Username:     user.Username,
+			From:         from,
+			To:           to,
+			Tests:        week.Tests,
+			LevelBefore:  week.LevelBefore,
+			LevelAfter:   week.LevelAfter,
+			LevelChanged: week.LevelBefore != "" && week.LevelBefore != week.LevelAfter,
+			Phenomena:    week.Phenomena,
+			Pending:      week.Pending,
+			Link:         s.frontendURL + "/dashboard",
+			Unsubscribe:  unsubscribe,
+		}
+		return true, s.emails.SendWeeklyDigest(ctx, user, "weekly_digest_student", weekStart, data, unsubscribe)
+	case models.RoleTeacher:
+		classrooms, err := s.repo.GetTeacherWeek(ctx, user.ID, weekStart, weekEnd)
+		if err != nil {
+			return false, err
+		}
+		if len(classrooms) == 0 {
+			return false, nil
+		}
+		data := teacherDigestEmail{
+			Username:    user.Username,
+			From:        from,
+			To:          to,
+			Classrooms:  classrooms,
+			Link:        s.frontendURL + "/teacher-classrooms",
+			Unsubscribe: unsubscribe,
+		}
+		return true, s.emails.SendWeeklyDigest(ctx, user, "weekly_digest_teacher", weekStart, data, unsubscribe)
+	}
+	return false, nil
+}
@@ -1,88 +1,109 @@
 package services
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
-	"net"
-	"net/smtp"
-	"os"
+	"log"
 	"strings"
-)
+	"time"
 
-func SendNoReplyEmail(to, subject, body string) error {
-	from := os.Getenv("SMTP_FROM")
-	pass := os.Getenv("SMTP_PASS")
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
 
-	// Check required SMTP environment variables
-	if from == "" || pass == "" || smtpHost == "" || smtpPort == "" {
-		return fmt.Errorf("smtp credentials not set")
-	}
+const outboxListLimit = 200
 
-	addr := smtpHost + ":" + smtpPort
+// EmailService renders the emails from their templates, in the language of the recipient,
+// and queues them in the outbox; the EmailOutboxWorker delivers them
+type EmailService struct {
+	outbox    *repositories.EmailOutboxRepository
+	templates *mail.Templates // Localised text and HTML bodies
+}
 
-	// Build email message headers and body
-	msg := "From: " + from + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
-		"\r\n" + body
+// NewEmailService creates a new EmailService instance
+func NewEmailService(outbox *repositories.EmailOutboxRepository, templates *mail.Templates) *EmailService {
+	return &EmailService{outbox: outbox, templates: templates}
+}
 
-	// Connect (plain) and then upgrade to TLS with STARTTLS
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("dial error: %w", err)
-	}
-	defer conn.Close()
+// Send renders a template in the locale and queues it for the recipients (comma separated)
+// The key identifies the email: queuing it again with the same key does nothing
+func (s *EmailService) Send(ctx context.Context, key, to, locale, template string, data any) error {
+	return s.send(ctx, key, to, locale, template, data, "")
+}
 
-	// Create SMTP client
-	client, err := smtp.NewClient(conn, smtpHost)
+// send renders and queues an email, with an unsubscribe URL if not empty
+func (s *EmailService) send(ctx context.Context, key, to, locale, template string, data any, unsubscribe string) error {
+	msg, err := s.templates.Render(template, locale, data)
 	if err != nil {
-		return fmt.Errorf("smtp client error: %w", err)
-	}
-	defer client.Quit()
-
-	// Upgrade connection to TLS if supported
-	tlsconfig := &tls.Config{
-		ServerName: smtpHost,
-	}
-	if ok, _ := client.Extension("STARTTLS"); ok {
-		if err = client.StartTLS(tlsconfig); err != nil {
-			return fmt.Errorf("starttls error: %w", err)
-		}
-	}
-
-	// Authenticate with SMTP server
-	auth := smtp.PlainAuth("", from, pass, smtpHost)
-	if err = client.Auth(auth); err != nil {
-		return fmt.Errorf("smtp auth error: %w", err)
-	}
-
-	// Set sender and recipient
-	if err = client.Mail(from); err != nil {
-		return fmt.Errorf("mail from error: %w", err)
+		return err
 	}
 	for _, recipient := range strings.Split(to, ",") {
-		if err = client.Rcpt(strings.TrimSpace(recipient)); err != nil {
-			return fmt.Errorf("rcpt to error: %w", err)
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			msg.To = append(msg.To, recipient)
 		}
 	}
-
-	// Send email data
-	w, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("data error: %w", err)
+	email := &models.OutboxEmail{
+		IdempotencyKey: key,
+		Recipients:     msg.To,
+		Subject:        msg.Subject,
+		Text:           msg.Text,
+		HTML:           msg.HTML,
+		Template:       msg.Template,
+		Locale:         msg.Locale,
 	}
-	_, err = w.Write([]byte(msg))
-	if err != nil {
-		return fmt.Errorf("write error: %w", err)
+	if unsubscribe != "" {
+		email.Unsubscribe = &unsubscribe
 	}
-	err = w.Close()
+	queued, err := s.outbox.Enqueue(ctx, email)
 	if err != nil {
-		return fmt.Errorf("close error: %w", err)
+		return err
+	}
+	if !queued {
+		log.Printf("EmailService: %s email already queued, key %s", template, key)
 	}
-
 	return nil
 }
+
+// SendPasswordResetCode queues an email with a password reset code
+func (s *EmailService) SendPasswordResetCode(ctx context.Context, to, locale, code string) error {
+	return s.Send(ctx, "password_reset:"+hashToken(to+":"+code), to, locale, "password_reset", struct {
+		Code    string
+		Minutes int
+	}{code, int(resetCodeTTL.Minutes())})
+}
+
+// SendVerification queues an email with an email verification link
+func (s *EmailService) SendVerification(ctx context.Context, user *models.User, link string) error {
+	return s.Send(ctx, "email_verification:"+hashToken(link), user.Email, user.Locale, "email_verification", struct {
+		Username string
+		Link     string
+		Hours    int
+	}{user.Username, link, int(verificationTokenTTL.Hours())})
+}
+
+// SendGuardianInvite queues an email with a guardian invite code
+func (s *EmailService) SendGuardianInvite(ctx context.Context, to, locale, inviter, student, code string) error {
+	return s.Send(ctx, "guardian_invite:"+hashToken(to+":"+code), to, locale, "guardian_invite", struct {
+		Inviter string
+		Student string
+		Code    string
+		Days    int
+	}{inviter, student, code, int(guardianInviteTTL.Hours() / 24)})
+}
+
+// SendWeeklyDigest queues the digest of a week, once per user and week
+func (s *EmailService) SendWeeklyDigest(ctx context.Context, user *models.User, template string, weekStart time.Time, data any, unsubscribe string) error {
+	key := fmt.Sprintf("weekly_digest:%d:%s", user.ID, weekStart.Format("2006-01-02"))
+	return s.send(ctx, key, user.Email, user.Locale, template, data, unsubscribe)
+}
+
+// GetOutbox returns the latest emails of the outbox, optionally of one status
+func (s *EmailService) GetOutbox(ctx context.Context, status string) ([]models.OutboxEmail, error) {
+	return s.outbox.GetEmails(ctx, status, outboxListLimit)
+}
+
+// Requeue gives a dead-lettered email a new series of attempts; false if there is no such dead email
+func (s *EmailService) Requeue(ctx context.Context, id int64) (bool, error) {
+	return s.outbox.Requeue(ctx, id)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/mail"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+// EmailRetryBackoff spaces the attempts to deliver an email: 30 seconds after the first failure,
+// doubled on each failure up to 2 hours
+var EmailRetryBackoff = throttle.Policy{
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  2 * time.Hour,
+}
+
+const (
+	emailMaxAttempts   = 10               // then the email is dead-lettered
+	emailSendTimeout   = 30 * time.Second // per attempt
+	emailLease         = 2 * time.Minute  // a claimed email is retried after this if its worker stopped
+	emailBatchSize     = 20
+	emailPollInterval  = 5 * time.Second
+	emailSentRetention = 30 * 24 * time.Hour // sent emails are then removed from the outbox
+)
+
+// EmailOutboxWorker delivers the emails queued in the outbox
+// Several workers (one per instance) can run against the same database
+type EmailOutboxWorker struct {
+	repo   *repositories.EmailOutboxRepository
+	mailer mail.Mailer
+}
+
+// NewEmailOutboxWorker creates a new EmailOutboxWorker instance
+func NewEmailOutboxWorker(repo *repositories.EmailOutboxRepository, mailer mail.Mailer) *EmailOutboxWorker {
+	return &EmailOutboxWorker{repo: repo, mailer: mailer}
+}
+
+// Run delivers the due emails until the context is cancelled
+func (w *EmailOutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		n, err := w.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("EmailOutboxWorker: %v", err)
+		}
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if _, err := w.repo.DeleteSentBefore(ctx, time.Now().Add(-emailSentRetention)); err != nil && ctx.Err() == nil {
+				log.Printf("EmailOutboxWorker: could not purge the sent emails: %v", err)
+			}
+		}
+		if n == emailBatchSize {
+			continue // more may be due
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends a batch of due emails and returns how many it attempted
+func (w *EmailOutboxWorker) DeliverDue(ctx context.Context) (int, error) {
+	emails, err := w.repo.ClaimDue(ctx, emailBatchSize, time.Now().Add(emailLease))
+	if err != nil {
+		return 0, err
+	}
+	for i := range emails {
+		w.deliver(ctx, &emails[i])
+	}
+	return len(emails), nil
+}
+
+func (w *EmailOutboxWorker) deliver(ctx context.Context, e *models.OutboxEmail) {
+	msg := &mail.Message{
+		Key:      e.IdempotencyKey,
+		To:       e.Recipients,
+		Subject:  e.Subject,
+		Text:     e.Text,
+		HTML:     e.HTML,
+		Template: e.Template,
+		Locale:   e.Locale,
+		SentAt:   time.Now(),
+	}
+	if e.Unsubscribe != nil {
+		msg.Unsubscribe = *e.Unsubscribe
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	err := w.mailer.Send(sendCtx, msg)
+	cancel()
+
+	// The outcome is recorded even when the worker is being stopped
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		if err := w.repo.MarkSent(ctx, e.ID); err != nil {
+			// The lease runs out and the email is sent again, with the same Message-ID
+			log.Printf("EmailOutboxWorker: could not mark email %d as sent: %v", e.ID, err)
+		}
+		return
+	}
+
+	dead := e.Attempts >= emailMaxAttempts || mail.IsPermanent(err)
+	next := time.Now().Add(EmailRetryBackoff.Delay(e.Attempts))
+	if dead {
+		log.Printf("EmailOutboxWorker: gave up on %s email %d after %d attempt(s): %v", e.Template, e.ID, e.Attempts, err)
+	} else {
+		log.Printf("EmailOutboxWorker: %s email %d failed (attempt %d), retrying at %s: %v", e.Template, e.ID, e.Attempts, next.Format(time.RFC3339), err)
+	}
+	if err := w.repo.MarkFailed(ctx, e.ID, err.Error(), next, dead); err != nil {
+		log.Printf("EmailOutboxWorker: could not record the failure of email %d: %v", e.ID, err)
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+const verificationTokenTTL = 48 * time.Hour
+
+// EmailVerificationPolicy limits the verification emails sent to a user:
+// the first resend is immediate, then the delay doubles from a minute up to an hour
+var EmailVerificationPolicy = throttle.Policy{
+	FreeFailures:    1,
+	BaseDelay:       time.Minute,
+	MaxDelay:        time.Hour,
+	LockoutFailures: 10,
+	LockoutDuration: 24 * time.Hour,
+	Window:          24 * time.Hour,
+}
+
+var (
+	ErrEmailNotVerified         = errors.New("email not verified: confirm your email address first")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+)
+
+// ResendTooSoonError is returned when a verification email was sent too recently
+type ResendTooSoonError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResendTooSoonError) Error() string {
+	return fmt.Sprintf("verification email sent recently, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// EmailVerificationService confirms that users own their email address
+// The link sent is signed (HMAC) over the user and the email address: it needs no storage
+// and stops being valid if the address changes
+type EmailVerificationService struct {
+	userRepo *repositories.UserRepository // Reads and marks users
+	emails   *EmailService                // Sends the links
+	store    throttle.Store               // Counts the emails sent
+	secret   []byte                       // Signs the verification links
+	baseURL  string                       // Public URL of the API, the links point to
+	policy   throttle.Policy
+}
+
+// NewEmailVerificationService creates a new EmailVerificationService instance
+func NewEmailVerificationService(userRepo *repositories.UserRepository, emails *EmailService, store throttle.Store, secret []byte, baseURL string) *EmailVerificationService {
+	return &EmailVerificationService{
+		userRepo: userRepo,
+		emails:   emails,
+		store:    store,
+		secret:   secret,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		policy:   EmailVerificationPolicy,
+	}
+}
+
+// SendVerification emails a verification link to the user, within the resend limits
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+	key := "verify:" + strconv.Itoa(user.ID)
+	now := time.Now()
+	// The send is counted with the check, so that concurrent requests send a single email
+	d, sent, err := s.policy.Take(ctx, s.store, key, now)
+	if err != nil {
+		return err
+	}
+	if !d.Allowed {
+		return &ResendTooSoonError{RetryAfter: d.RetryAfter}
+	}
+	if _, err := s.policy.Lockout(ctx, s.store, key, sent, now); err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/verify-email?token=" + url.QueryEscape(s.Token(user, now.Add(verificationTokenTTL)))
+	return s.emails.SendVerification(ctx, user, link)
+}
+
+// Resend emails a new verification link to a user
+func (s *EmailVerificationService) Resend(ctx context.Context, userID int) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// Verify confirms the email of the user a token was issued for
+// Verifying an already verified email succeeds
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) (*models.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidVerificationToken
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	// The signature covers the current email: links sent to a previous address are rejected
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(user.ID, user.Email, expires))) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerified() {
+		return user, nil
+	}
+	if _, err := s.userRepo.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+		return nil, err
+	}
+	log.Printf("Email verified for userID: %d", user.ID)
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
+
+// Token returns a verification token of the user's current email, valid until expires
+func (s *EmailVerificationService) Token(user *models.User, expires time.Time) string {
+	return fmt.Sprintf("%d.%d.%s", user.ID, expires.Unix(), s.signature(user.ID, user.Email, expires.Unix()))
+}
+
+func (s *EmailVerificationService) signature(userID int, email string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "email-verification|%d|%s|%d", userID, email, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+const (
+	guardianInviteTTL      = 7 * 24 * time.Hour
+	guardianInviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O or 1/I to read out loud
+	guardianInviteLength   = 12
+)
+
+// GuardianInvitePolicy limits the invite codes a guardian can try:
+// five free attempts, then the delay doubles from a minute up to an hour
+var GuardianInvitePolicy = throttle.Policy{
+	FreeFailures:    5,
+	BaseDelay:       time.Minute,
+	MaxDelay:        time.Hour,
+	LockoutFailures: 20,
+	LockoutDuration: 24 * time.Hour,
+	Window:          24 * time.Hour,
+}
+
+var (
+	ErrNotGuardianOf         = errors.New("student not found or not linked to this guardian")
+	ErrInvalidGuardianInvite = errors.New("invalid, expired or already used invite code")
+	ErrNotAGuardian          = errors.New("only guardian accounts can be linked to students")
+	ErrNotAStudent           = errors.New("guardians can only be linked to students")
+)
+
+// GuardianService links guardians to students and gives them read-only access to their progress
+// Every read checks the link between the guardian and the student
+type GuardianService struct {
+	repo          *repositories.GuardianRepository      // Handles invites, links and progress queries
+	userRepo      *repositories.UserRepository          // Checks the roles of the accounts linked
+	classroomRepo *repositories.ClassroomRepository     // Used to check teacher/student relationships
+	levelRepo     *repositories.LevelRepository         // Reads the level results of students
+	events        *repositories.SecurityEventRepository // Records links and unlinks
+	emails        *EmailService                         // Emails the invite codes
+	store         throttle.Store                        // Counts the invalid invite codes tried
+	validator     *validator.Validate                   // Validates request structs
+}
+
+// NewGuardianService creates a new GuardianService instance
+func NewGuardianService(repo *repositories.GuardianRepository, userRepo *repositories.UserRepository, classroomRepo *repositories.ClassroomRepository, levelRepo *repositories.LevelRepository, events *repositories.SecurityEventRepository, emails *EmailService, store throttle.Store) *GuardianService {
+	return &GuardianService{
+		repo:          repo,
+		userRepo:      userRepo,
+		classroomRepo: classroomRepo,
+		levelRepo:     levelRepo,
+		events:        events,
+		emails:        emails,
+		store:         store,
+		validator:     validator.New(),
+	}
+}
+
+// CreateInvite creates an invite code for a student's guardian, and emails it if an address is given
+// Students invite their own guardians; teachers can invite the guardians of their students
+func (s *GuardianService) CreateInvite(ctx context.Context, actorID, studentID int, req *models.CreateGuardianInviteRequest) (*models.GuardianInvite, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	student, err := s.userRepo.GetUserByID(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if student == nil || student.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if student.Role != models.RoleStudent {
+		return nil, ErrNotAStudent
+	}
+	inviter := student
+	if actorID != studentID {
+		ok, err := s.classroomRepo.IsTeacherOfStudent(ctx, actorID, studentID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("student not found or unauthorized")
+		}
+		if inviter, err = s.userRepo.GetUserByID(ctx, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := newGuardianInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &models.GuardianInvite{Code: code, StudentID: studentID, ExpiresAt: time.Now().Add(guardianInviteTTL)}
+	if err := s.repo.CreateInvite(ctx, studentID, actorID, hashToken(code), invite.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if req.Email != "" {
+		locale := req.Locale
+		if locale == "" {
+			locale = inviter.Locale
+		}
+		if err := s.emails.SendGuardianInvite(ctx, req.Email, locale, inviter.Username, student.Username, code); err != nil {
+			// The code is returned anyway, it can be handed over another way
+			log.Printf("CreateInvite: could not email the invite code of studentID %d: %v", studentID, err)
+		} else {
+			invite.EmailSent = true
+		}
+	}
+	return invite, nil
+}
+
+// RedeemInvite links the guardian to the student of an invite code
+func (s *GuardianService) RedeemInvite(ctx context.Context, guardianID int, req *models.RedeemGuardianInviteRequest) (*models.GuardianLink, error) {
+	req.Code = normalizeGuardianInviteCode(req.Code)
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	guardian, err := s.userRepo.GetUserByID(ctx, guardianID)
+	if err != nil {
+		return nil, err
+	}
+	if guardian == nil || guardian.Role != models.RoleGuardian {
+		return nil, ErrNotAGuardian
+	}
+
+	key := "guardian:" + strconv.Itoa(guardianID)
+	now := time.Now()
+	d, failures, err := GuardianInvitePolicy.Take(ctx, s.store, key, now)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		return nil, &LoginThrottledError{Locked: d.Locked, RetryAfter: d.RetryAfter}
+	}
+	link, err := s.repo.RedeemInvite(ctx, hashToken(req.Code), guardianID)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		if _, err := GuardianInvitePolicy.Lockout(ctx, s.store, key, failures, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidGuardianInvite
+	}
+	if err := s.store.Reset(ctx, key); err != nil {
+		return nil, err
+	}
+	s.record(ctx, models.EventGuardianLinked, guardianID, link.StudentID, "guardian "+guardian.Username)
+	return link, nil
+}
+
+// GetStudents returns the students linked to a guardian
+func (s *GuardianService) GetStudents(ctx context.Context, guardianID int) ([]models.GuardianLink, error) {
+	return s.repo.GetStudentsOfGuardian(ctx, guardianID)
+}
+
+// GetGuardians returns the guardians linked to a student
+func (s *GuardianService) GetGuardians(ctx context.Context, studentID int) ([]models.GuardianLink, error) {
+	return s.repo.GetGuardiansOfStudent(ctx, studentID)
+}
+
+// Unlink removes the link between a guardian and a student; either side can remove it
+func (s *GuardianService) Unlink(ctx context.Context, actorID, guardianID, studentID int) error {
+	if actorID != guardianID && actorID != studentID {
+		return ErrNotGuardianOf
+	}
+	deleted, err := s.repo.DeleteLink(ctx, guardianID, studentID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotGuardianOf
+	}
+	s.record(ctx, models.EventGuardianUnlinked, actorID, studentID, "guardian "+strconv.Itoa(guardianID))
+	return nil
+}
+
+// GetStudentHistory returns the test history of a student linked to the guardian
+func (s *GuardianService) GetStudentHistory(ctx context.Context, guardianID, studentID int) ([]models.TestHistoryEntry, error) {
+	if err := s.checkLink(ctx, guardianID, studentID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTestHistory(ctx, studentID)
+}
+
+// GetStudentLevels returns the level results of a student linked to the guardian
+func (s *GuardianService) GetStudentLevels(ctx context.Context, guardianID, studentID int) ([]models.LevelResult, error) {
+	if err := s.checkLink(ctx, guardianID, studentID); err != nil {
+		return nil, err
+	}
+	return s.levelRepo.GetLevelResultsByUser(ctx, studentID)
+}
+
+// GetStudentMistakes returns the mistakes of a student linked to the guardian
+func (s *GuardianService) GetStudentMistakes(ctx context.Context, guardianID, studentID int) (*models.StudentMistakes, error) {
+	if err := s.checkLink(ctx, guardianID, studentID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMistakes(ctx, studentID)
+}
+
+// GetStudentAssignments returns the classroom assignments of a student linked to the guardian
+func (s *GuardianService) GetStudentAssignments(ctx context.Context, guardianID, studentID int) ([]models.GuardianAssignment, error) {
+	if err := s.checkLink(ctx, guardianID, studentID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAssignments(ctx, studentID)
+}
+
+// checkLink refuses access to students the guardian is not linked to
+func (s *GuardianService) checkLink(ctx context.Context, guardianID, studentID int) error {
+	ok, err := s.repo.IsGuardianOf(ctx, guardianID, studentID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotGuardianOf
+	}
+	return nil
+}
+
+func (s *GuardianService) record(ctx context.Context, eventType string, actorID, studentID int, details string) {
+	event := &models.SecurityEvent{EventType: eventType, UserID: &studentID, ActorID: &actorID, Details: details}
+	if err := s.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("GuardianService: could not record %s event: %v", eventType, err)
+	}
+}
+
+// newGuardianInviteCode returns a random invite code that is easy to read out and type
+func newGuardianInviteCode() (string, error) {
+	b := make([]byte, guardianInviteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = guardianInviteAlphabet[int(b[i])%len(guardianInviteAlphabet)] // 256 is a multiple of 32: no bias
+	}
+	return string(b), nil
+}
+
+// normalizeGuardianInviteCode accepts invite codes in any case, with spaces or dashes
+func normalizeGuardianInviteCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/fuzzylogic"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/timing"
+)
+
+// LevelService provides methods for managing fuzzy level results
+type LevelService struct {
+	repo          *repositories.LevelRepository     // Handles level result operations
+	classroomRepo *repositories.ClassroomRepository // Used to check teacher/student relationships
+	userRepo      *repositories.UserRepository      // Names the students in the events
+	engine        *fuzzylogic.LevelEngine           // Engine used to evaluate new results
+	bus           *events.Bus                       // Publishes the completed tests and level changes
+	validator     *validator.Validate               // Validates request structs
+}
+
+// NewLevelService creates a new LevelService instance
+func NewLevelService(repo *repositories.LevelRepository, classroomRepo *repositories.ClassroomRepository, userRepo *repositories.UserRepository, engine *fuzzylogic.LevelEngine, bus *events.Bus) *LevelService {
+	return &LevelService{
+		repo:          repo,
+		classroomRepo: classroomRepo,
+		userRepo:      userRepo,
+		engine:        engine,
+		bus:           bus,
+		validator:     validator.New(),
+	}
+}
+
+// RegisterEngine stores the definition of an engine so results can reference its version
+func (s *LevelService) RegisterEngine(ctx context.Context, engine *fuzzylogic.LevelEngine) error {
+	def := engine.Definition()
+	content, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	return s.repo.RegisterEngineVersion(ctx, engine.Version(), def.Name, content)
+}
+
+// Engine returns the engine used to evaluate new results
+func (s *LevelService) Engine() *fuzzylogic.LevelEngine {
+	return s.engine
+}
+
+// EvaluateLevel evaluates a result with the current engine
+// speedRatio is the response time over the expected time of the questions,
+// the time accommodation of the student is applied to it
+func (s *LevelService) EvaluateLevel(score, speedRatio float64, accommodation *models.Accommodation) (fuzzylogic.LevelEvaluation, error) {
+	return s.engine.Evaluate(score, toTimingAccommodation(accommodation).SpeedRatio(speedRatio))
+}
+
+// ResultSpeedRatio returns the speed ratio of a result with the accommodation it was taken under
+// Results recorded before response times were normalized only have their raw average
+func ResultSpeedRatio(r models.LevelResult) float64 {
+	ratio := timing.ReferenceRatio(r.AvgResponseTime)
+	if r.SpeedRatio != nil {
+		ratio = *r.SpeedRatio
+	}
+	accommodation := timing.Accommodation{Multiplier: r.TimeMultiplier, Untimed: r.Untimed}
+	return accommodation.SpeedRatio(ratio)
+}
+
+// PlanRecompute evaluates all historical results with the engine without modifying them
+// The report lists the old and new level of each result
+func (s *LevelService) PlanRecompute(ctx context.Context, engine *fuzzylogic.LevelEngine) (*models.RecomputeReport, error) {
+	results, err := s.repo.GetAllLevelResults(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.RecomputeReport{
+		EngineVersion: engine.Version(),
+		Total:         len(results),
+		Transitions:   map[string]map[string]int{},
+		Changes:       []models.LevelChange{},
+	}
+	for _, r := range results {
+		eval, err := engine.Evaluate(r.Score, ResultSpeedRatio(r))
+		if err != nil {
+			return nil, err
+		}
+		if r.FuzzyLevel != eval.Level {
+			report.Changed++
+		}
+		if report.Transitions[r.FuzzyLevel] == nil {
+			report.Transitions[r.FuzzyLevel] = map[string]int{}
+		}
+		report.Transitions[r.FuzzyLevel][eval.Level]++
+		report.Changes = append(report.Changes, models.LevelChange{
+			ResultID:      r.ID,
+			UserID:        r.UserID,
+			OldLevel:      r.FuzzyLevel,
+			NewLevel:      eval.Level,
+			OldLevelScore: r.LevelScore,
+			NewLevelScore: eval.LevelScore,
+			OldVersion:    r.EngineVersion,
+		})
+	}
+	return report, nil
+}
+
+// ApplyRecompute registers the engine and stores the recomputed levels of the report
+// Results already produced by the engine version are left untouched
+func (s *LevelService) ApplyRecompute(ctx context.Context, engine *fuzzylogic.LevelEngine, report *models.RecomputeReport) error {
+	if report.EngineVersion != engine.Version() {
+		return errors.New("report was not computed with this engine")
+	}
+	if err := s.RegisterEngine(ctx, engine); err != nil {
+		return err
+	}
+	changes := make([]models.LevelChange, 0, len(report.Changes))
+	for _, c := range report.Changes {
+		if c.OldVersion != nil && *c.OldVersion == report.EngineVersion {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return s.repo.ApplyLevelChanges(ctx, report.EngineVersion, changes)
+}
+
+// GetStudentLevelResults returns the level results of a student of the teacher
+func (s *LevelService) GetStudentLevelResults(ctx context.Context, teacherID, studentID int) ([]models.LevelResult, error) {
+	ok, err := s.classroomRepo.IsTeacherOfStudent(ctx, teacherID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("student not found or unauthorized")
+	}
+	return s.repo.GetLevelResultsByUser(ctx, studentID)
+}
+
+// ConfirmLevel records the level a teacher confirmed for a student's result
+// Confirmed levels are used as labels to learn the fuzzy rules
+func (s *LevelService) ConfirmLevel(ctx context.Context, teacherID, resultID int, req *models.ConfirmLevelRequest) error {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return err
+	}
+
+	result, err := s.repo.GetLevelResultByID(ctx, resultID)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return errors.New("result not found or unauthorized")
+	}
+
+	// Only teachers of the student can confirm the level
+	ok, err := s.classroomRepo.IsTeacherOfStudent(ctx, teacherID, result.UserID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("result not found or unauthorized")
+	}
+
+	if err := s.repo.ConfirmLevel(ctx, resultID, teacherID, req.Level); err != nil {
+		return err
+	}
+
+	// Confirming another level of the latest result changes the level of the student
+	previous := result.FuzzyLevel
+	if result.ConfirmedLevel != nil {
+		previous = *result.ConfirmedLevel
+	}
+	if previous == req.Level {
+		return nil
+	}
+	latest, err := s.repo.GetLatestLevelResult(ctx, result.UserID)
+	if err != nil {
+		log.Printf("LevelService: could not get the latest result of userID %d: %v", result.UserID, err)
+		return nil
+	}
+	if latest != nil && latest.ID == resultID {
+		s.bus.Publish(ctx, events.LevelChanged, events.LevelChange{
+			ResultID:    resultID,
+			StudentID:   result.UserID,
+			Student:     s.username(ctx, result.UserID),
+			From:        previous,
+			To:          req.Level,
+			ConfirmedBy: &teacherID,
+		})
+	}
+	return nil
+}
+
+// ResultRecorded publishes a test scored by the level engine, and the change of level it brings
+// The result is already saved: failures are only logged
+func (s *LevelService) ResultRecorded(ctx context.Context, resultID int) {
+	result, err := s.repo.GetLevelResultByID(ctx, resultID)
+	if err != nil || result == nil {
+		log.Printf("LevelService: could not get the result %d to publish: %v", resultID, err)
+		return
+	}
+	previous, err := s.repo.GetPreviousLevel(ctx, result.UserID, resultID)
+	if err != nil {
+		log.Printf("LevelService: could not get the level of userID %d before result %d: %v", result.UserID, resultID, err)
+		return
+	}
+
+	student := s.username(ctx, result.UserID)
+	s.bus.Publish(ctx, events.PlacementCompleted, events.LevelResult{
+		ResultID:   result.ID,
+		StudentID:  result.UserID,
+		Student:    student,
+		TestType:   result.TestType,
+		Score:      result.Score,
+		Level:      result.FuzzyLevel,
+		LevelScore: result.LevelScore,
+		TakenAt:    result.TakenAt,
+	})
+	// A first level is not a change
+	if previous != "" && previous != result.FuzzyLevel {
+		s.bus.Publish(ctx, events.LevelChanged, events.LevelChange{
+			ResultID:  result.ID,
+			StudentID: result.UserID,
+			Student:   student,
+			From:      previous,
+			To:        result.FuzzyLevel,
+		})
+	}
+}
+
+// username returns the username of a student for the events, empty if it cannot be read
+func (s *LevelService) username(ctx context.Context, userID int) string {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		return ""
+	}
+	return user.Username
+}
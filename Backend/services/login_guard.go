@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+var (
+	// AccountLoginPolicy slows down guessing the password of an account and locks it out
+	AccountLoginPolicy = throttle.Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	// IPLoginPolicy slows down an address trying many accounts; it is looser as users may share an address (school network)
+	IPLoginPolicy = throttle.Policy{
+		FreeFailures:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutFailures: 100,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+)
+
+// LoginThrottledError is returned when a login attempt is refused before checking the password
+type LoginThrottledError struct {
+	Locked     bool // the account is locked out, rather than slowed down
+	IP         bool // the limit is the one of the client address
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	minutes := int(e.RetryAfter.Minutes()) + 1
+	switch {
+	case e.Locked && e.IP:
+		return fmt.Sprintf("Too many failed login attempts from your network. Try again in %d minutes.", minutes)
+	case e.Locked:
+		return fmt.Sprintf("Account temporarily locked after too many failed login attempts. Try again in %d minutes or ask your teacher to unlock it.", minutes)
+	default:
+		return fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", int(e.RetryAfter.Seconds())+1)
+	}
+}
+
+// LoginAttempt is a login attempt let through by the LoginGuard
+// It counts as a failure from the start, so that concurrent attempts are throttled by each other, and is
+// given back when it succeeds or is cancelled
+type LoginAttempt struct {
+	userID          *int // the account targeted, if the identifier matches one
+	accountKey      string
+	ipKey           string
+	ip              string
+	secondStep      bool // the second (two-factor) step of a login
+	accountFailures int  // failures of the account and of the address, this attempt included
+	ipFailures      int
+}
+
+// LoginGuard throttles failed logins per account and per client address
+type LoginGuard struct {
+	store         throttle.Store                        // Failure records (Postgres or in memory)
+	events        *repositories.SecurityEventRepository // Security audit log
+	userRepo      *repositories.UserRepository          // Resolves identifiers to accounts
+	classroomRepo *repositories.ClassroomRepository     // Used to check teacher/student relationships
+	account       throttle.Policy
+	ip            throttle.Policy
+}
+
+// NewLoginGuard creates a new LoginGuard instance with the default policies
+func NewLoginGuard(store throttle.Store, events *repositories.SecurityEventRepository, userRepo *repositories.UserRepository, classroomRepo *repositories.ClassroomRepository) *LoginGuard {
+	return &LoginGuard{
+		store:         store,
+		events:        events,
+		userRepo:      userRepo,
+		classroomRepo: classroomRepo,
+		account:       AccountLoginPolicy,
+		ip:            IPLoginPolicy,
+	}
+}
+
+// Begin checks whether a login attempt may proceed to the password check
+// Unknown identifiers are throttled the same way as accounts, so that the responses do not tell them apart
+func (g *LoginGuard) Begin(ctx context.Context, identifier, ip string) (*LoginAttempt, error) {
+	attempt := &LoginAttempt{ipKey: "ip:" + ip, ip: ip}
+	user, err := g.userRepo.GetUserByUsernameOrEmail(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		attempt.userID = &user.ID
+		attempt.accountKey = accountThrottleKey(user.ID)
+	} else {
+		attempt.accountKey = "login:" + normalizeIdentifier(identifier)
+	}
+	return g.check(ctx, attempt)
+}
+
+// BeginSecondStep checks whether the two-factor step of the login of a user may proceed
+// Wrong codes count as failed logins of the account, so the codes cannot be guessed faster than passwords
+func (g *LoginGuard) BeginSecondStep(ctx context.Context, userID int, ip string) (*LoginAttempt, error) {
+	return g.check(ctx, &LoginAttempt{
+		userID:     &userID,
+		accountKey: accountThrottleKey(userID),
+		ipKey:      "ip:" + ip,
+		ip:         ip,
+		secondStep: true,
+	})
+}
+
+// check refuses the attempt while its address or its account is throttled, and counts it otherwise
+func (g *LoginGuard) check(ctx context.Context, attempt *LoginAttempt) (*LoginAttempt, error) {
+	ip := attempt.ip
+	now := time.Now()
+	d, failures, err := g.ip.Take(ctx, g.store, attempt.ipKey, now)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		return nil, &LoginThrottledError{Locked: d.Locked, IP: true, RetryAfter: d.RetryAfter}
+	}
+	attempt.ipFailures = failures
+	d, failures, err = g.account.Take(ctx, g.store, attempt.accountKey, now)
+	if err == nil && !d.Allowed {
+		err = &LoginThrottledError{Locked: d.Locked, RetryAfter: d.RetryAfter}
+		if d.Locked && attempt.userID != nil {
+			g.record(ctx, &models.SecurityEvent{EventType: models.EventLoginBlocked, UserID: attempt.userID, IP: ip})
+		}
+	}
+	if err != nil {
+		// The attempt does not reach the password check
+		if ferr := g.store.Forgive(ctx, attempt.ipKey); ferr != nil {
+			log.Printf("LoginGuard: could not forgive the attempt of %s: %v", ip, ferr)
+		}
+		return nil, err
+	}
+	attempt.accountFailures = failures
+	return attempt, nil
+}
+
+// Failed records a wrong password, locking the account or the address out when they reach their limit
+// The failure itself was counted when the attempt began
+func (g *LoginGuard) Failed(ctx context.Context, attempt *LoginAttempt) error {
+	now := time.Now()
+	eventType := models.EventLoginFailed
+	if attempt.secondStep {
+		eventType = models.EventTwoFactorFailed
+	}
+	g.record(ctx, &models.SecurityEvent{EventType: eventType, UserID: attempt.userID, IP: attempt.ip})
+
+	locked, err := g.account.Lockout(ctx, g.store, attempt.accountKey, attempt.accountFailures, now)
+	if err != nil {
+		return err
+	}
+	if locked && attempt.userID != nil {
+		log.Printf("LoginGuard: account of userID %d locked out", *attempt.userID)
+		g.record(ctx, &models.SecurityEvent{
+			EventType: models.EventAccountLocked,
+			UserID:    attempt.userID,
+			IP:        attempt.ip,
+			Details:   "locked until " + now.Add(g.account.LockoutDuration).Format(time.RFC3339),
+		})
+	}
+
+	locked, err = g.ip.Lockout(ctx, g.store, attempt.ipKey, attempt.ipFailures, now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		log.Printf("LoginGuard: address %s locked out", attempt.ip)
+		g.record(ctx, &models.SecurityEvent{
+			EventType: models.EventIPLocked,
+			IP:        attempt.ip,
+			Details:   "locked until " + now.Add(g.ip.LockoutDuration).Format(time.RFC3339),
+		})
+	}
+	return nil
+}
+
+// Succeeded clears the failures of the account
+// The earlier failures of the address are kept: one valid account must not reset the limit of an address
+func (g *LoginGuard) Succeeded(ctx context.Context, attempt *LoginAttempt) error {
+	if err := g.store.Forgive(ctx, attempt.ipKey); err != nil {
+		return err
+	}
+	return g.store.Reset(ctx, attempt.accountKey)
+}
+
+// Cancel gives back an attempt which neither failed nor succeeded, e.g. a right password of a disabled
+// account or waiting for its second step; the earlier failures of the account are kept
+func (g *LoginGuard) Cancel(ctx context.Context, attempt *LoginAttempt) error {
+	if err := g.store.Forgive(ctx, attempt.ipKey); err != nil {
+		return err
+	}
+	return g.store.Forgive(ctx, attempt.accountKey)
+}
+
+// GetStudentLockout returns the login state of a student of the teacher and their latest security events
+func (g *LoginGuard) GetStudentLockout(ctx context.Context, teacherID, studentID int) (map[string]interface{}, error) {
+	if err := g.checkTeacherOfStudent(ctx, teacherID, studentID); err != nil {
+		return nil, err
+	}
+	state, err := g.store.Get(ctx, accountThrottleKey(studentID))
+	if err != nil {
+		return nil, err
+	}
+	events, err := g.events.GetUserEvents(ctx, studentID, 20)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"locked":   time.Now().Before(state.LockedUntil),
+		"failures": state.Failures,
+		"events":   events,
+	}
+	if !state.LockedUntil.IsZero() {
+		result["locked_until"] = state.LockedUntil
+	}
+	return result, nil
+}
+
+// UnlockStudent clears the failures and the lockout of a student of the teacher
+func (g *LoginGuard) UnlockStudent(ctx context.Context, teacherID, studentID int) error {
+	if err := g.checkTeacherOfStudent(ctx, teacherID, studentID); err != nil {
+		return err
+	}
+	if err := g.store.Reset(ctx, accountThrottleKey(studentID)); err != nil {
+		return err
+	}
+	g.record(ctx, &models.SecurityEvent{EventType: models.EventAccountUnlocked, UserID: &studentID, ActorID: &teacherID})
+	return nil
+}
+
+func (g *LoginGuard) checkTeacherOfStudent(ctx context.Context, teacherID, studentID int) error {
+	ok, err := g.classroomRepo.IsTeacherOfStudent(ctx, teacherID, studentID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("student not found or unauthorized")
+	}
+	return nil
+}
+
+// record writes to the audit log; a failure to do so does not fail the login
+func (g *LoginGuard) record(ctx context.Context, event *models.SecurityEvent) {
+	if err := g.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("LoginGuard: could not record %s event: %v", event.EventType, err)
+	}
+}
+
+func accountThrottleKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// normalizeIdentifier bounds and normalizes an unknown identifier used as a throttle key
+func normalizeIdentifier(identifier string) string {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	if len(identifier) > 255 {
+		identifier = identifier[:255]
+	}
+	return identifier
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/lti"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+const (
+	ltiLaunchTTL    = 10 * time.Minute // from the login initiation to the launch
+	ltiDeepLinkTTL  = 30 * time.Minute // for a teacher to choose the test of a Deep Linking request
+	ltiScoreMaximum = 100              // the scores of the classroom tests are percentages
+	ltiTestIDParam  = "test_id"        // custom parameter of the resource links created by Deep Linking
+)
+
+var (
+	ErrUnknownLTIPlatform = errors.New("unknown LTI platform")
+	ErrInvalidLTILaunch   = errors.New("invalid or expired launch, please open the activity again from your course")
+	ErrLTINotTeacher      = errors.New("only teachers can add tests to a course")
+	ErrLTITestNotFound    = errors.New("test not found or unauthorized")
+)
+
+// LTILaunchResult is what a verified launch leads to: the user signed in and, for a student,
+// the test to take or, for a teacher adding the tool to a course, the Deep Linking request to complete
+type LTILaunchResult struct {
+	User     *models.User
+	TestID   *int
+	DeepLink *models.LTIDeepLinkRequest
+	Tests    []models.Test // the tests the teacher can choose from
+}
+
+// LTIService launches the tool from LTI 1.3 platforms (LMS)
+// The users of a platform sign in with their linked identity (provider lti-<platform>), the courses are
+// mapped to classrooms and the classroom test results are queued for the LTIWorker to post to the gradebooks
+type LTIService struct {
+	repo          *repositories.LTIRepository       // Launches, courses, resource links and queued scores
+	sso           *SSOService                       // Signs in the users of the platforms
+	classroomRepo *repositories.ClassroomRepository // Classrooms of the courses
+	testRepo      *repositories.TestRepository      // Tests of the resource links
+	bus           *events.Bus
+	keys          *auth.KeySet // Signs the Deep Linking responses
+	platforms     []*lti.Platform
+	baseURL       string // public URL of the API, the login initiation and launch URLs are under it
+}
+
+// NewLTIService creates a new LTIService instance
+func NewLTIService(
+	repo *repositories.LTIRepository,
+	sso *SSOService,
+	classroomRepo *repositories.ClassroomRepository,
+	testRepo *repositories.TestRepository,
+	bus *events.Bus,
+	keys *auth.KeySet,
+	platforms []*lti.Platform,
+	publicURL string,
+) *LTIService {
+	return &LTIService{
+		repo:          repo,
+		sso:           sso,
+		classroomRepo: classroomRepo,
+		testRepo:      testRepo,
+		bus:           bus,
+		keys:          keys,
+		platforms:     platforms,
+		baseURL:       strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// LaunchURL is the URL the platforms post the launches to, also the URL of the resource links
+func (s *LTIService) LaunchURL() string {
+	return s.baseURL + "/lti/launch"
+}
+
+// platform returns the platform of a name
+func (s *LTIService) platform(name string) (*lti.Platform, error) {
+	i := slices.IndexFunc(s.platforms, func(p *lti.Platform) bool { return p.Name == name })
+	if i < 0 {
+		return nil, ErrUnknownLTIPlatform
+	}
+	return s.platforms[i], nil
+}
+
+// BeginLaunch handles a login initiation: it stores a pending launch and returns the URL of the platform to
+// redirect the browser to, and its state
+// clientID may be empty when the platform is registered once with the issuer
+func (s *LTIService) BeginLaunch(ctx context.Context, issuer, clientID, loginHint, messageHint, targetLinkURI string) (string, string, error) {
+	var platform *lti.Platform
+	for _, p := range s.platforms {
+		if p.Issuer != issuer || (clientID != "" && p.ClientID != clientID) {
+			continue
+		}
+		if platform != nil {
+			return "", "", fmt.Errorf("%w: several registrations of %s, the platform shall send client_id", ErrUnknownLTIPlatform, issuer)
+		}
+		platform = p
+	}
+	if platform == nil {
+		return "", "", ErrUnknownLTIPlatform
+	}
+	if loginHint == "" || (targetLinkURI != "" && !strings.HasPrefix(targetLinkURI, s.baseURL+"/")) {
+		return "", "", ErrInvalidLTILaunch
+	}
+
+	launch := &models.LTILaunchState{Platform: platform.Name, TargetLinkURI: targetLinkURI, ExpiresAt: time.Now().Add(ltiLaunchTTL)}
+	var err error
+	if launch.State, err = oidc.RandomString(32); err != nil {
+		return "", "", err
+	}
+	if launch.Nonce, err = oidc.RandomString(32); err != nil {
+		return "", "", err
+	}
+	authURL, err := platform.AuthRequestURL(s.LaunchURL(), launch.State, launch.Nonce, loginHint, messageHint)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.CreateLaunchState(ctx, launch); err != nil {
+		return "", "", err
+	}
+	return authURL, launch.State, nil
+}
+
+// CompleteLaunch verifies the id token of a pending launch and signs its user in
+func (s *LTIService) CompleteLaunch(ctx context.Context, state, idToken string) (*LTILaunchResult, error) {
+	pending, err := s.repo.ConsumeLaunchState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil || idToken == "" {
+		return nil, ErrInvalidLTILaunch
+	}
+	platform, err := s.platform(pending.Platform)
+	if err != nil {
+		return nil, err
+	}
+	launch, err := platform.VerifyLaunch(ctx, idToken, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &oidc.IDToken{
+		Issuer:        platform.Issuer,
+		Subject:       launch.Subject,
+		Email:         launch.Email,
+		EmailVerified: platform.TrustEmail,
+		Name:          strings.TrimSpace(launch.GivenName + " " + launch.FamilyName),
+	}
+	if launch.Name != "" {
+		token.Name = launch.Name
+	}
+	if token.Email == "" {
+		return nil, ErrSSONoEmail
+	}
+	user, err := s.sso.SignInIdentity(ctx, platform.Provider(), token, launch.IsTeacher())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LTILaunchResult{User: user}
+	if launch.MessageType == lti.DeepLinkingRequest {
+		if user.Role != models.RoleTeacher {
+			return nil, ErrLTINotTeacher
+		}
+		request := &models.LTIDeepLinkRequest{
+			Platform:     platform.Name,
+			DeploymentID: launch.DeploymentID,
+			UserID:       user.ID,
+			ReturnURL:    launch.DeepLinking.ReturnURL,
+			Data:         launch.DeepLinking.Data,
+			ExpiresAt:    time.Now().Add(ltiDeepLinkTTL),
+		}
+		if request.ID, err = oidc.RandomString(32); err != nil {
+			return nil, err
+		}
+		if err := s.repo.CreateDeepLinkRequest(ctx, request); err != nil {
+			return nil, err
+		}
+		if result.Tests, err = s.testRepo.GetTestsByTeacher(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		result.DeepLink = request
+		return result, nil
+	}
+
+	test, err := s.launchResourceLink(ctx, platform, launch, user)
+	if err != nil {
+		return nil, err
+	}
+	if test != nil && user.Role == models.RoleStudent {
+		result.TestID = &test.ID
+	}
+	return result, nil
+}
+
+// launchResourceLink records the resource link of a launch, maps its course to a classroom with the test
+// of the link assigned, and enrols the students launching it; it returns the test of the link, if any
+func (s *LTIService) launchResourceLink(ctx context.Context, platform *lti.Platform, launch *lti.Launch, user *models.User) (*models.Test, error) {
+	link := &models.LTIResourceLink{
+		Platform:       platform.Name,
+		ResourceLinkID: launch.ResourceLink.ID,
+		DeploymentID:   launch.DeploymentID,
+		Title:          launch.ResourceLink.Title,
+	}
+	if launch.AGS != nil && slices.Contains(launch.AGS.Scope, lti.ScopeScore) {
+		link.LineItem = launch.AGS.LineItem
+	}
+	recordedTestID, err := s.repo.GetResourceLinkTestID(ctx, platform.Name, launch.ResourceLink.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The test of the custom parameter, checked below: it can be edited on the platform
+	var test *models.Test
+	if id, err := strconv.Atoi(launch.Custom[ltiTestIDParam]); err == nil {
+		if test, err = s.testRepo.GetTestByID(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	var classroom *models.Classroom
+	if launch.Context != nil && launch.Context.ID != "" {
+		// The classroom of a course belongs to the first teacher launching the tool in it,
+		// or to the author of the first test launched in it
+		owner := 0
+		if user.Role == models.RoleTeacher {
+			owner = user.ID
+		} else if test != nil {
+			owner = test.TeacherID
+		}
+		course, err := s.courseClassroom(ctx, platform, launch.Context, owner)
+		if err != nil {
+			return nil, err
+		}
+		if course != nil {
+			link.ContextID = &course.ID
+			if classroom, err = s.classroomRepo.GetClassroomByID(ctx, course.ClassroomID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Only the test recorded on the link or a test of the teacher of the course is accepted,
+	// so that a link cannot open (and assign) the tests of other teachers
+	if test != nil {
+		recorded := recordedTestID != nil && *recordedTestID == test.ID
+		if recorded || (classroom != nil && test.TeacherID == classroom.TeacherID) {
+			link.TestID = &test.ID
+		} else {
+			log.Printf("LTI: test %d of resource link %s of %s refused, it belongs to another teacher", test.ID, launch.ResourceLink.ID, platform.Name)
+			test = nil
+		}
+	}
+
+	if err := s.repo.UpsertResourceLink(ctx, link); err != nil {
+		return nil, err
+	}
+	// A link launched before with its test: the custom parameter is not always sent again
+	if test == nil && link.TestID != nil {
+		var err error
+		if test, err = s.testRepo.GetTestByID(ctx, *link.TestID); err != nil {
+			return nil, err
+		}
+	}
+	if classroom != nil && test != nil && !slices.ContainsFunc(classroom.Tests, func(t models.Test) bool { return t.ID == test.ID }) {
+		if err := s.classroomRepo.AssignTestToClassroom(ctx, classroom.ID, test.ID, nil); err != nil {
+			return nil, err
+		}
+		s.bus.Publish(ctx, events.TestAssigned, events.ClassroomTest{
+			ClassroomID: classroom.ID,
+			Classroom:   classroom.Name,
+			TeacherID:   classroom.TeacherID,
+			TestID:      test.ID,
+			Test:        test.Title,
+			StudentIDs:  memberIDs(classroom),
+		})
+	}
+	if user.Role != models.RoleStudent {
+		return test, nil
+	}
+
+	// The enrolment in the course stands for the invite code
+	if classroom != nil && !slices.Contains(memberIDs(classroom), user.ID) {
+		if err := s.classroomRepo.JoinClassroom(ctx, classroom.ID, user.ID); err != nil {
+			return nil, err
+		}
+		s.bus.Publish(ctx, events.ClassroomJoined, events.ClassroomMember{
+			ClassroomID: classroom.ID,
+			Classroom:   classroom.Name,
+			TeacherID:   classroom.TeacherID,
+			StudentID:   user.ID,
+			Student:     user.Username,
+		})
+	}
+	if test != nil {
+		if err := s.repo.RecordLinkUser(ctx, link.ID, user.ID, launch.Subject); err != nil {
+			return nil, err
+		}
+	}
+	return test, nil
+}
+
+// courseClassroom returns the mapping of a course, creating its classroom for owner when it has none
+// It returns nil for a course without classroom when there is no owner yet
+func (s *LTIService) courseClassroom(ctx context.Context, platform *lti.Platform, c *lti.Context, owner int) (*models.LTIContext, error) {
+	course, err := s.repo.GetContext(ctx, platform.Name, c.ID)
+	if err != nil || course != nil || owner == 0 {
+		return course, err
+	}
+	title := c.Title
+	if title == "" {
+		title = c.Label
+	}
+	if title == "" {
+		title = "Course " + c.ID
+	}
+	if len(title) > 255 {
+		title = title[:255]
+	}
+	course = &models.LTIContext{Platform: platform.Name, ContextID: c.ID, Title: title}
+	classroom := &models.Classroom{
+		TeacherID:   owner,
+		Name:        title,
+		Description: fmt.Sprintf("Course of %s, members join by opening its activities", platform.Name),
+	}
+	created, err := s.repo.CreateContextClassroom(ctx, course, classroom)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		log.Printf("LTI: course %s of %s mapped to classroomID %d", c.ID, platform.Name, classroom.ID)
+	}
+	return course, nil
+}
+
+// CompleteDeepLink answers a Deep Linking request with a resource link launching a test of the teacher who made it
+// The id of the request, only known to the browser of the teacher, authenticates the choice; it is single use
+// It returns the return URL of the platform and the signed response the browser posts to it
+func (s *LTIService) CompleteDeepLink(ctx context.Context, requestID string, testID int) (string, string, error) {
+	request, err := s.repo.ConsumeDeepLinkRequest(ctx, requestID)
+	if err != nil {
+		return "", "", err
+	}
+	if request == nil {
+		return "", "", ErrInvalidLTILaunch
+	}
+	test, err := s.testRepo.GetTestByID(ctx, testID)
+	if err != nil {
+		return "", "", err
+	}
+	if test == nil || test.TeacherID != request.UserID {
+		return "", "", ErrLTITestNotFound
+	}
+	platform, err := s.platform(request.Platform)
+	if err != nil {
+		return "", "", err
+	}
+	item := lti.NewResourceLink(test.Title, test.Description, s.LaunchURL(),
+		map[string]string{ltiTestIDParam: strconv.Itoa(test.ID)}, ltiScoreMaximum, fmt.Sprintf("test-%d", test.ID))
+	response, err := platform.DeepLinkingResponse(s.keys, request.DeploymentID, request.Data, []lti.ContentItem{item})
+	if err != nil {
+		return "", "", err
+	}
+	log.Printf("LTI: test %d linked in %s by userID %d", test.ID, platform.Name, request.UserID)
+	return request.ReturnURL, response, nil
+}
+
+// Keys returns the public keys of the tool, fetched by the platforms
+func (s *LTIService) Keys() map[string][]auth.JWK {
+	return s.keys.JWKS()
+}
+
+// HandleEvent queues the score of a classroom test completed by a student for the gradebooks of the
+// courses where the student launched the test
+func (s *LTIService) HandleEvent(ctx context.Context, e events.Event) {
+	result, ok := e.Data.(events.TestResult)
+	if !ok {
+		return
+	}
+	n, err := s.repo.EnqueueScores(ctx, result.ResultID, result.TestID, result.StudentID, result.Score, ltiScoreMaximum)
+	if err != nil {
+		log.Printf("LTIService: could not queue the score of resultID %d: %v", result.ResultID, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("LTIService: score of resultID %d queued for %d gradebook(s)", result.ResultID, n)
+	}
+}
+
+func memberIDs(classroom *models.Classroom) []int {
+	ids := make([]int, 0, len(classroom.Members))
+	for _, m := range classroom.Members {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
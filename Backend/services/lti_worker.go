@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/lti"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+)
+
+// LTIScoreRetryBackoff spaces the attempts to post a score: 1 minute after the first failure,
+// doubled on each failure up to 6 hours
+var LTIScoreRetryBackoff = throttle.Policy{
+	BaseDelay: time.Minute,
+	MaxDelay:  6 * time.Hour,
+}
+
+const (
+	ltiMaxAttempts     = 12               // then the score fails
+	ltiPostTimeout     = 30 * time.Second // per score, with the access token request
+	ltiLease           = 2 * time.Minute
+	ltiBatchSize       = 20 // scores claimed together
+	ltiPollInterval    = 10 * time.Second
+	ltiScoreRetention  = 30 * 24 * time.Hour // sent and failed scores are then removed
+	ltiPlatformMissing = "the platform is no longer configured"
+)
+
+// LTIWorker posts the queued scores to the line items of the platforms (Assignment and Grade Services)
+// Several workers (one per instance) can run against the same database
+type LTIWorker struct {
+	repo      *repositories.LTIRepository
+	keys      *auth.KeySet // Signs the client assertions of the access token requests
+	platforms map[string]*lti.Platform
+}
+
+// NewLTIWorker creates a new LTIWorker instance
+func NewLTIWorker(repo *repositories.LTIRepository, keys *auth.KeySet, platforms []*lti.Platform) *LTIWorker {
+	w := &LTIWorker{repo: repo, keys: keys, platforms: map[string]*lti.Platform{}}
+	for _, p := range platforms {
+		w.platforms[p.Name] = p
+	}
+	return w
+}
+
+// Run posts the due scores until the context is cancelled
+func (w *LTIWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(ltiPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		n, err := w.PostDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("LTIWorker: %v", err)
+		}
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if _, err := w.repo.DeleteFinishedScoresBefore(ctx, time.Now().Add(-ltiScoreRetention)); err != nil && ctx.Err() == nil {
+				log.Printf("LTIWorker: could not purge the sent scores: %v", err)
+			}
+		}
+		if n == ltiBatchSize {
+			continue // more may be due
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PostDue posts a batch of due scores and returns how many it attempted
+func (w *LTIWorker) PostDue(ctx context.Context) (int, error) {
+	scores, err := w.repo.ClaimDueScores(ctx, ltiBatchSize, time.Now().Add(ltiLease))
+	if err != nil || len(scores) == 0 {
+		return 0, err
+	}
+	for _, s := range scores {
+		w.post(ctx, s)
+	}
+	return len(scores), nil
+}
+
+func (w *LTIWorker) post(ctx context.Context, s models.LTIScore) {
+	platform, ok := w.platforms[s.Platform]
+	var err error
+	if ok {
+		postCtx, cancel := context.WithTimeout(ctx, ltiPostTimeout)
+		err = platform.PostScore(postCtx, w.keys, s.LineItem, lti.NewScore(s.UserSubject, s.Score, s.ScoreMaximum, s.CreatedAt))
+		cancel()
+	}
+
+	// The outcome is recorded even when the worker is being stopped
+	recordCtx := context.WithoutCancel(ctx)
+	if ok && err == nil {
+		if err := w.repo.MarkScoreSent(recordCtx, s.ID); err != nil {
+			// The lease runs out and the score is posted again, which the platform accepts
+			log.Printf("LTIWorker: could not mark score %d as sent: %v", s.ID, err)
+		}
+		return
+	}
+
+	lastError := ltiPlatformMissing
+	if err != nil {
+		lastError = err.Error()
+	}
+	failed := !ok || s.Attempts >= ltiMaxAttempts || lti.IsRejected(err)
+	if failed {
+		log.Printf("LTIWorker: gave up on score %d for %s after %d attempt(s): %s", s.ID, s.LineItem, s.Attempts, lastError)
+	} else {
+		log.Printf("LTIWorker: could not post score %d to %s: %s", s.ID, s.LineItem, lastError)
+	}
+	next := time.Now().Add(LTIScoreRetryBackoff.Delay(s.Attempts))
+	if err := w.repo.MarkScoreFailed(recordCtx, s.ID, lastError, next, failed); err != nil {
+		log.Printf("LTIWorker: could not record the failure of score %d: %v", s.ID, err)
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+var (
+	ErrInvalidUnsubscribeToken     = errors.New("invalid unsubscribe link")
+	ErrNotificationNotFound        = errors.New("notification not found")
+	ErrNotificationTypeUnavailable = errors.New("notification type not available to this account")
+)
+
+const (
+	maxNotificationsPage      = 50
+	notificationReadRetention = 90 * 24 * time.Hour // read notifications are then removed
+)
+
+// NotificationService manages which notifications users get, and their notification center
+// fed by the domain events of the classrooms and tests
+// The unsubscribe links of the emails are signed (HMAC) over the user and the notification type:
+// they need no storage and do not expire
+type NotificationService struct {
+	repo      *repositories.NotificationRepository // Notification preferences
+	secret    []byte                               // Signs the unsubscribe links
+	baseURL   string                               // Public URL of the API, the links point to
+	validator *validator.Validate                  // Validates request structs
+}
+
+// NewNotificationService creates a new NotificationService instance
+func NewNotificationService(repo *repositories.NotificationRepository, secret []byte, baseURL string) *NotificationService {
+	return &NotificationService{
+		repo:      repo,
+		secret:    secret,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		validator: validator.New(),
+	}
+}
+
+// GetPreferences returns the preference of a user for every notification type of their role,
+// with only the channels of each type
+func (s *NotificationService) GetPreferences(ctx context.Context, userID int, role string) ([]models.NotificationPreference, error) {
+	set, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		kind := models.NotificationKinds[notificationType]
+		if !slices.Contains(kind.Roles, role) {
+			continue
+		}
+		email, inApp := true, true
+		preference := models.NotificationPreference{Type: notificationType, Channels: kind.Channels}
+		for _, p := range set {
+			if p.Type == notificationType {
+				email, inApp = *p.Email, *p.InApp
+				preference.UpdatedAt = p.UpdatedAt
+			}
+		}
+		if slices.Contains(kind.Channels, models.ChannelEmail) {
+			preference.Email = &email
+		}
+		if slices.Contains(kind.Channels, models.ChannelInApp) {
+			preference.InApp = &inApp
+		}
+		preferences = append(preferences, preference)
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences changes some notification preferences of a user and returns all of them
+func (s *NotificationService) UpdatePreferences(ctx context.Context, userID int, role string, req *models.UpdateNotificationPreferencesRequest) ([]models.NotificationPreference, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	for _, p := range req.Preferences {
+		if !slices.Contains(models.NotificationKinds[p.Type].Roles, role) {
+			return nil, ErrNotificationTypeUnavailable
+		}
+	}
+	for i := range req.Preferences {
+		if err := s.repo.SetPreference(ctx, userID, &req.Preferences[i]); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetPreferences(ctx, userID, role)
+}
+
+// GetNotifications returns a page of the notifications of a user, newest first, with the unread count
+// beforeID pages through them: the id of the last notification of the previous page, or 0 for the first page
+func (s *NotificationService) GetNotifications(ctx context.Context, userID int, unreadOnly bool, beforeID int64, limit int) (*models.NotificationList, error) {
+	if limit <= 0 || limit > maxNotificationsPage {
+		limit = maxNotificationsPage
+	}
+	notifications, err := s.repo.GetNotifications(ctx, userID, unreadOnly, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.repo.CountUnread(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.NotificationList{Notifications: notifications, Unread: unread}, nil
+}
+
+// CountUnread returns how many notifications of a user are unread
+func (s *NotificationService) CountUnread(ctx context.Context, userID int) (int, error) {
+	return s.repo.CountUnread(ctx, userID)
+}
+
+// MarkRead marks a notification of a user as read
+func (s *NotificationService) MarkRead(ctx context.Context, userID int, id int64) error {
+	found, err := s.repo.MarkRead(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all the notifications of a user as read and returns how many were unread
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	return s.repo.MarkAllRead(ctx, userID)
+}
+
+// Run removes the notifications read for longer than notificationReadRetention, daily, until the context is cancelled
+func (s *NotificationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		removed, err := s.repo.DeleteReadBefore(ctx, time.Now().Add(-notificationReadRetention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("NotificationService: could not purge the read notifications: %v", err)
+		} else if removed > 0 {
+			log.Printf("NotificationService: purged %d read notification(s)", removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleEvent notifies the users concerned by a domain event of the classrooms and tests
+func (s *NotificationService) HandleEvent(ctx context.Context, e events.Event) {
+	var userIDs []int
+	var n models.Notification
+	var data any
+	switch p := e.Data.(type) {
+	case events.ClassroomTest:
+		userIDs, data = p.StudentIDs, map[string]int{"classroom_id": p.ClassroomID, "test_id": p.TestID}
+		n.Link = "/dashboard"
+		switch e.Type {
+		case events.TestAssigned:
+			n.Type, n.Title = models.NotificationTestAssigned, "New test: "+p.Test
+			n.Body = fmt.Sprintf("%s was assigned to you in %s.", p.Test, p.Classroom)
+		case events.TestUnassigned:
+			n.Type, n.Title = models.NotificationTestChanged, "Test removed: "+p.Test
+			n.Body = fmt.Sprintf("%s is no longer assigned in %s.", p.Test, p.Classroom)
+		}
+	case events.TestChange:
+		userIDs, data = p.StudentIDs, map[string]int{"test_id": p.TestID}
+		n.Type, n.Link = models.NotificationTestChanged, "/dashboard"
+		switch e.Type {
+		case events.TestUpdated:
+			n.Title, n.Body = "Test updated: "+p.Test, fmt.Sprintf("Your teacher changed %s.", p.Test)
+		case events.TestDeleted:
+			n.Title, n.Body = "Test removed: "+p.Test, fmt.Sprintf("Your teacher deleted %s.", p.Test)
+		}
+	case events.ClassroomMember:
+		data = map[string]int{"classroom_id": p.ClassroomID, "student_id": p.StudentID}
+		switch e.Type {
+		case events.ClassroomJoined:
+			userIDs = []int{p.TeacherID}
+			n.Type, n.Title, n.Link = models.NotificationStudentJoined, "New student in "+p.Classroom, "/teacher-classrooms"
+			n.Body = fmt.Sprintf("%s joined %s.", p.Student, p.Classroom)
+		case events.StudentRemoved:
+			userIDs = []int{p.StudentID}
+			n.Type, n.Title, n.Link = models.NotificationClassroomRemoved, "Removed from "+p.Classroom, "/dashboard"
+			n.Body = fmt.Sprintf("Your teacher removed you from %s.", p.Classroom)
+		}
+	case events.TestResult:
+		userIDs, data = []int{p.TeacherID}, map[string]int{"test_id": p.TestID, "student_id": p.StudentID}
+		n.Type, n.Title, n.Link = models.NotificationTestCompleted, p.Student+" completed "+p.Test, "/teacher-classrooms"
+		n.Body = fmt.Sprintf("%s scored %.0f%% (%d/%d) on %s.", p.Student, p.Score, p.CorrectAnswers, p.TotalQuestions, p.Test)
+	}
+	if n.Type == "" || len(userIDs) == 0 {
+		return
+	}
+
+	n.Data, _ = json.Marshal(data)
+	if _, err := s.repo.CreateNotifications(ctx, userIDs, &n); err != nil {
+		log.Printf("NotificationService: could not create the %s notifications of %s: %v", n.Type, e.Type, err)
+	}
+}
+
+// UnsubscribeURL returns the link turning off a type of email for a user
+func (s *NotificationService) UnsubscribeURL(userID int, notificationType string) string {
+	token := fmt.Sprintf("%d.%s.%s", userID, notificationType, s.signature(userID, notificationType))
+	return s.baseURL + "/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// Unsubscribe turns off the type of email of an unsubscribe link and returns the type
+func (s *NotificationService) Unsubscribe(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	notificationType := parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(userID, notificationType))) {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	off := false
+	if err := s.repo.SetPreference(ctx, userID, &models.NotificationPreference{Type: notificationType, Email: &off}); err != nil {
+		return "", err
+	}
+	log.Printf("NotificationService: userID %d unsubscribed from %s emails", userID, notificationType)
+	return notificationType, nil
+}
+
+func (s *NotificationService) signature(userID int, notificationType string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "unsubscribe|%d|%s", userID, notificationType)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
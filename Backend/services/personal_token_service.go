@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+const (
+	maxPersonalTokens       = 20
+	personalTokenPrefixSize = len(auth.PersonalTokenPrefix) + 6 // shown in the token list
+)
+
+var (
+	ErrPersonalTokenNotFound   = errors.New("personal access token not found")
+	ErrTooManyPersonalTokens   = errors.New("too many active personal access tokens: revoke one first")
+	ErrPersonalTokensForbidden = errors.New("only teachers can create personal access tokens")
+)
+
+// PersonalTokenService manages the personal access tokens of teachers and authenticates requests made with them
+type PersonalTokenService struct {
+	repo      *repositories.PersonalTokenRepository // Stores the hashed tokens
+	userRepo  *repositories.UserRepository          // Checks the role of the token owner
+	events    *repositories.SecurityEventRepository // Records created and revoked tokens
+	validator *validator.Validate                   // Validates request structs
+}
+
+// NewPersonalTokenService creates a new PersonalTokenService instance
+func NewPersonalTokenService(repo *repositories.PersonalTokenRepository, userRepo *repositories.UserRepository, events *repositories.SecurityEventRepository) *PersonalTokenService {
+	return &PersonalTokenService{
+		repo:      repo,
+		userRepo:  userRepo,
+		events:    events,
+		validator: validator.New(),
+	}
+}
+
+// CreateToken creates a personal access token; the token is only returned here
+func (s *PersonalTokenService) CreateToken(ctx context.Context, userID int, req *models.CreatePersonalTokenRequest) (*models.CreatedPersonalToken, error) {
+	// Validate request
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Role != models.RoleTeacher {
+		return nil, ErrPersonalTokensForbidden
+	}
+	active, err := s.repo.CountActiveTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxPersonalTokens {
+		return nil, ErrTooManyPersonalTokens
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := auth.PersonalTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	created := &models.CreatedPersonalToken{
+		PersonalToken: models.PersonalToken{
+			UserID: userID,
+			Name:   req.Name,
+			Prefix: token[:personalTokenPrefixSize],
+			Scopes: uniqueStrings(req.Scopes),
+		},
+		Token: token,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		created.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateToken(ctx, &created.PersonalToken, hashToken(token)); err != nil {
+		return nil, err
+	}
+	s.record(ctx, userID, "created "+created.Prefix+" ("+req.Name+")")
+	return created, nil
+}
+
+// GetTokens returns the personal access tokens of a user, without their secret
+func (s *PersonalTokenService) GetTokens(ctx context.Context, userID int) ([]models.PersonalToken, error) {
+	return s.repo.GetTokensByUser(ctx, userID)
+}
+
+// RevokeToken revokes a personal access token of the user
+func (s *PersonalTokenService) RevokeToken(ctx context.Context, userID, tokenID int) error {
+	revoked, err := s.repo.RevokeToken(ctx, userID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrPersonalTokenNotFound
+	}
+	s.record(ctx, userID, "revoked token "+strconv.Itoa(tokenID))
+	return nil
+}
+
+// ResolvePersonalToken authenticates a personal access token for the auth middleware
+// The claims carry the current role of the user, so that role checks apply to the token too
+func (s *PersonalTokenService) ResolvePersonalToken(ctx context.Context, token string) (*auth.Claims, error) {
+	t, user, err := s.repo.UseToken(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Claims{
+		UserID:          user.ID,
+		Username:        user.Username,
+		Role:            user.Role,
+		PersonalTokenID: t.ID,
+		Scopes:          t.Scopes,
+	}, nil
+}
+
+func (s *PersonalTokenService) record(ctx context.Context, userID int, details string) {
+	event := &models.SecurityEvent{EventType: models.EventPersonalTokenChange, UserID: &userID, ActorID: &userID, Details: details}
+	if err := s.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("PersonalTokenService: could not record %s event: %v", event.EventType, err)
+	}
+}
+
+// uniqueStrings removes repeated values (scopes, events), keeping their order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/timing"
+)
+
+// expectedTimesTTL is how long the expected response times are kept before being fitted again
+const expectedTimesTTL = time.Hour
+
+// ResponseTimeService normalizes response times by the expected time of each question
+type ResponseTimeService struct {
+	repo     *repositories.ResponseTimeRepository // Reads the answer log and question features
+	mu       sync.Mutex                           // Guards model and fittedAt
+	model    *timing.Model                        // Expected times fitted on the answer log
+	fittedAt time.Time
+}
+
+// NewResponseTimeService creates a new ResponseTimeService instance
+func NewResponseTimeService(repo *repositories.ResponseTimeRepository) *ResponseTimeService {
+	return &ResponseTimeService{repo: repo}
+}
+
+// Model returns the expected times model, fitting it again from the answer log when it is stale
+// A stale model is kept if the answer log cannot be read
+func (s *ResponseTimeService) Model(ctx context.Context) (*timing.Model, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.model != nil && time.Since(s.fittedAt) < expectedTimesTTL {
+		return s.model, nil
+	}
+
+	answers, err := s.repo.GetTimedAnswers(ctx)
+	if err != nil {
+		if s.model != nil {
+			return s.model, nil
+		}
+		return nil, err
+	}
+	observations := make([]timing.Observation, len(answers))
+	for i, a := range answers {
+		observations[i] = timing.Observation{Question: toTimingQuestion(a.QuestionFeatures), Seconds: a.ResponseTime}
+	}
+	s.model = timing.Fit(observations)
+	s.fittedAt = time.Now()
+	return s.model, nil
+}
+
+// SpeedRatio returns the response time of the answers over the expected time of their questions
+// avgTime (raw seconds) is used when none of the answers is timed
+func (s *ResponseTimeService) SpeedRatio(ctx context.Context, answers []models.TimedAnswer, avgTime float64) (float64, error) {
+	model, err := s.Model(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]int, len(answers))
+	for i, a := range answers {
+		ids[i] = a.QuestionID
+	}
+	features, err := s.repo.GetQuestionFeatures(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	timed := make([]timing.Answer, 0, len(answers))
+	for _, a := range answers {
+		f, ok := features[a.QuestionID]
+		if !ok {
+			continue // Unknown question
+		}
+		timed = append(timed, timing.Answer{Question: toTimingQuestion(f), Seconds: a.ResponseTime})
+	}
+	ratio, used := model.SpeedRatio(timed)
+	if used == 0 {
+		return timing.ReferenceRatio(avgTime), nil
+	}
+	return ratio, nil
+}
+
+func toTimingQuestion(f models.QuestionFeatures) timing.Question {
+	return timing.Question{
+		ID:         f.QuestionID,
+		Type:       f.QuestionType,
+		Length:     f.TextLength,
+		Difficulty: f.Difficulty,
+	}
+}
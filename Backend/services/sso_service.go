@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/oidc"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcLoginTTL is the time a user has to sign in at the identity provider
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidSSOState = errors.New("invalid or expired sign-in, please try again")
+	ErrSSONoEmail      = errors.New("the identity provider did not share an email address")
+	ErrSSOEmailTaken   = errors.New("an account with this email already exists: sign in with your password")
+)
+
+// SSOService signs users in with OpenID Connect identity providers
+// External identities are linked to users: on first sign-in, to the user with the same
+// email when the provider verified it, otherwise to a new student (or teacher) account
+type SSOService struct {
+	repo      *repositories.IdentityRepository      // Linked identities and pending logins
+	userRepo  *repositories.UserRepository          // Reads users and checks usernames
+	events    *repositories.SecurityEventRepository // Security audit log
+	providers map[string]*oidc.Provider
+	order     []string // provider names in configuration order
+}
+
+// NewSSOService creates a new SSOService instance
+func NewSSOService(repo *repositories.IdentityRepository, userRepo *repositories.UserRepository, events *repositories.SecurityEventRepository, providers []*oidc.Provider) *SSOService {
+	s := &SSOService{
+		repo:      repo,
+		userRepo:  userRepo,
+		events:    events,
+		providers: map[string]*oidc.Provider{},
+	}
+	for _, p := range providers {
+		s.providers[p.Name] = p
+		s.order = append(s.order, p.Name)
+	}
+	return s
+}
+
+// Providers lists the identity providers
+func (s *SSOService) Providers() []models.SSOProvider {
+	providers := []models.SSOProvider{}
+	for _, name := range s.order {
+		providers = append(providers, models.SSOProvider{
+			Name:        name,
+			DisplayName: s.providers[name].DisplayName,
+			LoginURL:    "/auth/oidc/" + name + "/login",
+		})
+	}
+	return providers
+}
+
+// BeginLogin stores a pending login and returns the provider URL to redirect the user to, and its state
+func (s *SSOService) BeginLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	login := &models.OIDCLoginState{Provider: providerName, ExpiresAt: time.Now().Add(oidcLoginTTL)}
+	var err error
+	if login.State, err = oidc.RandomString(32); err != nil {
+		return "", "", err
+	}
+	if login.Nonce, err = oidc.RandomString(32); err != nil {
+		return "", "", err
+	}
+	if login.CodeVerifier, err = oidc.RandomString(48); err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, login.State, login.Nonce, oidc.CodeChallenge(login.CodeVerifier))
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.repo.CreateLoginState(ctx, login); err != nil {
+		return "", "", err
+	}
+	return authURL, login.State, nil
+}
+
+// CompleteLogin redeems the authorization code of a pending login and returns the user signed in
+func (s *SSOService) CompleteLogin(ctx context.Context, providerName, state, code string) (*models.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	login, err := s.repo.ConsumeLoginState(ctx, state, providerName)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil || code == "" {
+		return nil, ErrInvalidSSOState
+	}
+	token, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.SignInIdentity(ctx, providerName, token, provider.IsTeacher(token))
+}
+
+// SignInIdentity returns the user a verified external identity is linked to; on first sign-in the identity is
+// linked to the account of the same email when the issuer verified it, otherwise a new account is provisioned
+// teacher promotes the user to teacher; LTI launches sign in through it too
+func (s *SSOService) SignInIdentity(ctx context.Context, providerName string, token *oidc.IDToken, teacher bool) (*models.User, error) {
+	// Already linked
+	user, err := s.repo.GetUserByIdentity(ctx, providerName, token.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if err := s.repo.TouchIdentity(ctx, providerName, token.Subject, token.Email); err != nil {
+			return nil, err
+		}
+		// The claim promotes students to teachers; it never demotes (teachers own tests and classrooms)
+		if teacher && user.Role == "student" {
+			if err := s.repo.SetUserRole(ctx, user.ID, "teacher"); err != nil {
+				return nil, err
+			}
+			log.Printf("SSO: userID %d promoted to teacher by %s", user.ID, providerName)
+			user.Role = "teacher"
+		}
+		return user, nil
+	}
+
+	identity := &models.Identity{Provider: providerName, Subject: token.Subject, Email: token.Email}
+	if token.Email == "" {
+		return nil, ErrSSONoEmail
+	}
+
+	// Link to the account of the same email, only if both the provider and the account verified it:
+	// whoever registered an unverified email could know the password of the account, and keep using it
+	// once the owner of the email signs in
+	if token.EmailVerified {
+		user, err := s.userRepo.GetUserByEmail(ctx, token.Email)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			if !user.EmailVerified() {
+				s.record(ctx, user.ID, fmt.Sprintf("%s identity not linked: the email of the account is not verified", providerName))
+				return nil, ErrSSOEmailTaken
+			}
+			identity.UserID = user.ID
+			if err := s.repo.LinkIdentity(ctx, identity); err != nil {
+				return nil, err
+			}
+			s.record(ctx, user.ID, fmt.Sprintf("%s identity linked by verified email", providerName))
+			return user, nil
+		}
+	}
+
+	// Provision a new account
+	user, err = s.provision(ctx, token, teacher, identity)
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, user.ID, fmt.Sprintf("account provisioned from %s", providerName))
+	return user, nil
+}
+
+// provision creates the account of an external identity
+// It has no usable password: the user signs in with the provider or resets the password by email
+func (s *SSOService) provision(ctx context.Context, token *oidc.IDToken, teacher bool, identity *models.Identity) (*models.User, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	username, err := s.availableUsername(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		Username: username,
+		Email:    token.Email,
+		Password: string(hash),
+		Role:     "student",
+	}
+	if teacher {
+		user.Role = "teacher"
+	}
+	if token.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.repo.CreateUserWithIdentity(ctx, user, identity); err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" && pgErr.Constraint == "users_email_key" {
+			return nil, ErrSSOEmailTaken
+		}
+		return nil, err
+	}
+	log.Printf("SSO: provisioned userID %d (%s) from %s", user.ID, user.Role, identity.Provider)
+	user.Password = ""
+	return user, nil
+}
+
+// availableUsername derives a free username (3-50 alphanumeric characters) from the claims
+func (s *SSOService) availableUsername(ctx context.Context, token *oidc.IDToken) (string, error) {
+	base := ""
+	for _, candidate := range []string{token.Username, strings.Split(token.Email, "@")[0], token.Name} {
+		if base = sanitizeUsername(candidate); len(base) >= 3 {
+			break
+		}
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 44 {
+		base = base[:44]
+	}
+	username := base
+	for i := 0; i < 10; i++ {
+		existing, err := s.userRepo.GetUserByUsername(ctx, username)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return username, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", err
+		}
+		username = fmt.Sprintf("%s%d", base, n.Int64())
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// GetUserIdentities returns the external identities linked to a user
+func (s *SSOService) GetUserIdentities(ctx context.Context, userID int) ([]models.Identity, error) {
+	return s.repo.GetUserIdentities(ctx, userID)
+}
+
+func (s *SSOService) record(ctx context.Context, userID int, details string) {
+	event := &models.SecurityEvent{EventType: models.EventIdentityLinked, UserID: &userID, Details: details}
+	if err := s.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("SSO: could not record %s event: %v", event.EventType, err)
+	}
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -3,8 +3,10 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
 	"github.com/panosmaurikos/personalisedenglish/backend/models"
 	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
 )
@@ -13,14 +15,16 @@ import (
 type TestService struct {
 	repo      *repositories.TestRepository // Handles test data operations
 	userRepo  *repositories.UserRepository // Handles user data operations
+	bus       *events.Bus                  // Tells the students about changes to their tests
 	validator *validator.Validate          // Validates request structs
 }
 
 // NewTestService creates a new TestService instance
-func NewTestService(repo *repositories.TestRepository, userRepo *repositories.UserRepository) *TestService {
+func NewTestService(repo *repositories.TestRepository, userRepo *repositories.UserRepository, bus *events.Bus) *TestService {
 	return &TestService{
 		repo:      repo,
 		userRepo:  userRepo,
+		bus:       bus,
 		validator: validator.New(),
 	}
 }
@@ -111,9 +115,26 @@ func (s *TestService) UpdateTest(ctx context.Context, userID, testID int, req *m
 	if err := s.repo.UpdateTest(ctx, test); err != nil {
 		return nil, err
 	}
+	s.publishTestChange(ctx, events.TestUpdated, test)
 	return test, nil
 }
 
+// publishTestChange publishes a change to a test, to the students it is assigned to
+// It must be called while the test is still assigned
+func (s *TestService) publishTestChange(ctx context.Context, eventType string, test *models.Test) {
+	students, err := s.repo.GetAssignedStudentIDs(ctx, test.ID)
+	if err != nil {
+		log.Printf("TestService: could not get the students of testID %d for %s: %v", test.ID, eventType, err)
+		return
+	}
+	s.bus.Publish(ctx, eventType, events.TestChange{
+		TestID:     test.ID,
+		Test:       test.Title,
+		TeacherID:  test.TeacherID,
+		StudentIDs: students,
+	})
+}
+
 // DeleteTest deletes a test if the user is authorized
 func (s *TestService) DeleteTest(ctx context.Context, userID, testID int) error {
 	test, err := s.repo.GetTestByID(ctx, testID)
@@ -124,7 +145,21 @@ func (s *TestService) DeleteTest(ctx context.Context, userID, testID int) error
 	if test == nil || test.TeacherID != userID {
 		return errors.New("test not found or unauthorized")
 	}
-	return s.repo.DeleteTest(ctx, testID)
+	// The students are gathered before the deletion unassigns the test
+	students, err := s.repo.GetAssignedStudentIDs(ctx, testID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTest(ctx, testID); err != nil {
+		return err
+	}
+	s.bus.Publish(ctx, events.TestDeleted, events.TestChange{
+		TestID:     test.ID,
+		Test:       test.Title,
+		TeacherID:  test.TeacherID,
+		StudentIDs: students,
+	})
+	return nil
 }
 
 // GetTestByID returns a test by ID without authorization checks (for students to take tests)
@@ -0,0 +1,18 @@
+package services
+
+import (
+	"context"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/testformat"
+)
+
+// ExportTest writes a test of the teacher to a QTI 2.1 package, Moodle XML or a print-ready page
+// with its answer key. With a variant code, the questions and options are shuffled the same way
+// each time the code is given
+func (s *TestService) ExportTest(ctx context.Context, userID, testID int, format, variant string) (*testformat.File, error) {
+	test, err := s.GetTest(ctx, userID, testID)
+	if err != nil {
+		return nil, err
+	}
+	return testformat.Export(format, test, variant)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/testformat"
+)
+
+var (
+	ErrImportQuestionType = errors.New("question_type is required to import a mixed test")
+	ErrNothingToImport    = errors.New("no question of the file could be imported")
+)
+
+// ImportTest converts a file of another quiz system (QTI 2.1, Moodle XML, GIFT or Aiken) to a test of
+// the teacher, and creates it unless preview is set. The items which could not be converted are
+// reported in Skipped; with none converted, ErrNothingToImport is returned along with the report
+func (s *TestService) ImportTest(ctx context.Context, userID int, req *models.ImportTestRequest, filename string, data []byte, preview bool) (*models.TestImport, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	// The files do not tell what their questions practise
+	questionType := req.QuestionType
+	if questionType == "" {
+		if req.Type == "mixed" {
+			return nil, ErrImportQuestionType
+		}
+		questionType = req.Type
+	}
+
+	imported, err := testformat.Parse(req.Format, filename, data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range imported.Questions {
+		imported.Questions[i].QuestionType = questionType
+	}
+	title := req.Title
+	if title == "" {
+		title = imported.Title
+	}
+	if title == "" {
+		title = strings.TrimSpace(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+	}
+	if title == "" || title == "." {
+		title = "Imported test"
+	}
+
+	result := &models.TestImport{
+		Format: imported.Format,
+		Test: models.CreateTestRequest{
+			Title:       title,
+			Description: req.Description,
+			Type:        req.Type,
+			Questions:   imported.Questions,
+		},
+		Skipped: imported.Skipped,
+	}
+	if result.Skipped == nil {
+		result.Skipped = []models.ImportIssue{}
+	}
+	if len(imported.Questions) == 0 {
+		return result, ErrNothingToImport
+	}
+	if preview {
+		return result, nil
+	}
+	result.Created, err = s.CreateTest(ctx, userID, &result.Test)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
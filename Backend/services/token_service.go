@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/panosmaurikos/personalisedenglish/backend/auth"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+)
+
+const (
+	// DefaultAccessTokenTTL is the lifetime of access tokens when not configured
+	DefaultAccessTokenTTL = 15 * time.Minute
+	refreshTokenTTL       = 7 * 24 * time.Hour  // a session stays open as long as it is refreshed weekly
+	sessionTTL            = 30 * 24 * time.Hour // after which the user logs in again
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token reused: session revoked")
+
+// TokenService issues short-lived access tokens and rotating refresh tokens
+// Each login opens a session (token family); revoking it invalidates all its tokens
+type TokenService struct {
+	repo      *repositories.SessionRepository // Stores sessions and hashed refresh tokens
+	userRepo  *repositories.UserRepository    // Reads the user on refresh
+	keys      *auth.KeySet                    // Signs access tokens
+	accessTTL time.Duration
+}
+
+// NewTokenService creates a new TokenService instance
+func NewTokenService(repo *repositories.SessionRepository, userRepo *repositories.UserRepository, keys *auth.KeySet, accessTTL time.Duration) *TokenService {
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	return &TokenService{
+		repo:      repo,
+		userRepo:  userRepo,
+		keys:      keys,
+		accessTTL: accessTTL,
+	}
+}
+
+// IssueTokens opens a new session for the user and returns its first token pair
+// It is the last check of every login (password, two-factor, single sign-on): disabled accounts are refused
+func (s *TokenService) IssueTokens(ctx context.Context, user *models.User) (*models.TokenPair, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	session := &models.Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	refresh, token, err := s.newRefreshToken(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSession(ctx, session, token); err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, session.ID, refresh)
+}
+
+// Refresh rotates a refresh token: it is consumed and a new token pair of the same session is returned
+// Presenting an already rotated token revokes the whole session, as it may have been stolen
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	token, session, err := s.repo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	if token.UsedAt != nil {
+		return nil, s.reuseDetected(ctx, session)
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return nil, auth.ErrSessionRevoked
+	}
+	if now.After(token.ExpiresAt) {
+		return nil, auth.ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	refresh, next, err := s.newRefreshToken(session)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.RotateRefreshToken(ctx, token.ID, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Used concurrently by someone else
+		return nil, s.reuseDetected(ctx, session)
+	}
+	return s.tokenPair(user, session.ID, refresh)
+}
+
+// reuseDetected revokes the session of a replayed refresh token
+func (s *TokenService) reuseDetected(ctx context.Context, session *models.Session) error {
+	log.Printf("Refresh token reused for session %s of user %d, revoking the session", session.ID, session.UserID)
+	if err := s.repo.RevokeSession(ctx, session.ID, "refresh token reuse"); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout revokes a session
+func (s *TokenService) Logout(ctx context.Context, sessionID string) error {
+	return s.repo.RevokeSession(ctx, sessionID, "logout")
+}
+
+// RevokeUserSessions revokes all the sessions of a user (logout everywhere, compromised account)
+func (s *TokenService) RevokeUserSessions(ctx context.Context, userID int, reason string) error {
+	return s.repo.RevokeUserSessions(ctx, userID, reason)
+}
+
+// tokenPair signs an access token of the session and pairs it with the refresh token
+func (s *TokenService) tokenPair(user *models.User, sessionID, refresh string) (*models.TokenPair, error) {
+	now := time.Now()
+	claims := &auth.Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}
+	access, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// newRefreshToken generates a random refresh token of the session
+// The token is returned to the client and only its hash is stored
+func (s *TokenService) newRefreshToken(session *models.Session) (string, *models.RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(b)
+	expiresAt := time.Now().Add(refreshTokenTTL)
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	return refresh, &models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refresh),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// hashToken returns the SHA-256 of a token (tokens are random, so no salt is needed)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
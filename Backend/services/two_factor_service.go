@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+	"github.com/panosmaurikos/personalisedenglish/backend/totp"
+)
+
+// TwoFactorCodePolicy slows down guessing the codes of a user, on top of the login throttling
+// It also covers the codes asked by the routes of signed in users (disable, recovery codes)
+var TwoFactorCodePolicy = throttle.Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutFailures: 10,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken         = errors.New("invalid or expired login, please log in again")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for teachers")
+	ErrNoTwoFactorEnrollment   = errors.New("no two-factor enrolment in progress")
+)
+
+// TwoFactorFailure is a wrong code on the second step of a login of a user
+type TwoFactorFailure struct {
+	UserID int
+}
+
+func (e *TwoFactorFailure) Error() string { return ErrInvalidTwoFactorCode.Error() }
+func (e *TwoFactorFailure) Unwrap() error { return ErrInvalidTwoFactorCode }
+
+// LoginChallenge is the second step a login needs after the password
+type LoginChallenge struct {
+	Token     string
+	Purpose   string // models.MFAPurposeVerify or models.MFAPurposeEnroll
+	ExpiresIn int    // seconds
+}
+
+// SecondStepResult is a login completed with its second step
+type SecondStepResult struct {
+	User          *models.User
+	RecoveryCodes []string // set when the second step was the (required) enrolment
+}
+
+// TwoFactorService manages TOTP two-factor authentication
+// Secrets are encrypted at rest; recovery codes are stored hashed and are single use
+type TwoFactorService struct {
+	repo            *repositories.TwoFactorRepository     // Enrolments, recovery codes and login challenges
+	userRepo        *repositories.UserRepository          // Reads the user of a challenge
+	events          *repositories.SecurityEventRepository // Security audit log
+	store           throttle.Store                        // Failed codes (Postgres or in memory)
+	aead            cipher.AEAD                           // Encrypts the TOTP secrets
+	issuer          string                                // Shown in authenticator apps
+	requireTeachers bool                                  // Deployment setting: teachers must use 2FA
+}
+
+// NewTwoFactorService creates a new TwoFactorService instance
+// The secrets are encrypted with an AES-256 key derived from encryptionKey
+func NewTwoFactorService(repo *repositories.TwoFactorRepository, userRepo *repositories.UserRepository, events *repositories.SecurityEventRepository, store throttle.Store, encryptionKey []byte, issuer string, requireTeachers bool) *TwoFactorService {
+	key := sha256.Sum256(encryptionKey)
+	block, _ := aes.NewCipher(key[:]) // cannot fail with a 32 byte key
+	aead, _ := cipher.NewGCM(block)
+	return &TwoFactorService{
+		repo:            repo,
+		userRepo:        userRepo,
+		events:          events,
+		store:           store,
+		aead:            aead,
+		issuer:          issuer,
+		requireTeachers: requireTeachers,
+	}
+}
+
+// Required tells whether the deployment requires 2FA for the user
+func (s *TwoFactorService) Required(user *models.User) bool {
+	return s.requireTeachers && user.Role == "teacher"
+}
+
+// Status returns the 2FA status of a user
+func (s *TwoFactorService) Status(ctx context.Context, userID int) (*models.TwoFactorStatus, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &models.TwoFactorStatus{Required: s.Required(user)}
+	enrollment, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment != nil && enrollment.ConfirmedAt != nil {
+		status.Enabled = true
+		status.ConfirmedAt = enrollment.ConfirmedAt
+		if status.RecoveryCodesRemaining, err = s.repo.CountRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Enroll starts the enrolment of a user: a new secret is stored, unconfirmed until a first code is given
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int) (*models.TwoFactorSetup, error) {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.enroll(ctx, user)
+}
+
+func (s *TwoFactorService) enroll(ctx context.Context, user *models.User) (*models.TwoFactorSetup, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.repo.SaveTOTP(ctx, user.ID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return &models.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables the enrolment of a user with a first code and returns their recovery codes
+// The recovery codes are only shown once
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	enrollment, err := s.enrollment(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		return nil, ErrNoTwoFactorEnrollment
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := totp.Validate(enrollment.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.repo.ConfirmTOTP(ctx, userID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	s.record(ctx, userID, "enabled")
+	return codes, nil
+}
+
+// Disable turns 2FA off, with a valid code; it cannot be turned off when the deployment requires it
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, req *models.TwoFactorCodeRequest) error {
+	user, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.Required(user) {
+		return ErrTwoFactorRequired
+	}
+	if err := s.verify(ctx, user.ID, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+	s.record(ctx, user.ID, "disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user, with a valid code
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, req *models.TwoFactorCodeRequest) ([]string, error) {
+	if err := s.verify(ctx, userID, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	s.record(ctx, userID, "recovery codes regenerated")
+	return codes, nil
+}
+
+// LoginChallenge returns the second step of a login once the password is checked, nil if none is needed:
+// a code for enrolled users, the enrolment for teachers when the deployment requires 2FA
+func (s *TwoFactorService) LoginChallenge(ctx context.Context, user *models.User) (*LoginChallenge, error) {
+	enrollment, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	purpose := ""
+	switch {
+	case enrollment != nil && enrollment.ConfirmedAt != nil:
+		purpose = models.MFAPurposeVerify
+	case s.Required(user):
+		purpose = models.MFAPurposeEnroll
+	default:
+		return nil, nil
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	challenge := &models.MFAChallenge{UserID: user.ID, Purpose: purpose, ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	if err := s.repo.CreateChallenge(ctx, hashToken(token), challenge); err != nil {
+		return nil, err
+	}
+	return &LoginChallenge{Token: token, Purpose: purpose, ExpiresIn: int(mfaChallengeTTL.Seconds())}, nil
+}
+
+// PendingLogin returns the user ID of a pending second step, so that the caller can check its throttling first
+func (s *TwoFactorService) PendingLogin(ctx context.Context, token string) (int, error) {
+	challenge, err := s.repo.GetChallenge(ctx, hashToken(token), maxChallengeAttempts)
+	if err != nil {
+		return 0, err
+	}
+	if challenge == nil {
+		return 0, ErrInvalidMFAToken
+	}
+	return challenge.UserID, nil
+}
+
+// ChallengeUser returns the user of a pending second step (counting an attempt on it)
+func (s *TwoFactorService) ChallengeUser(ctx context.Context, token string) (*models.User, *models.MFAChallenge, error) {
+	challenge, err := s.repo.ClaimChallengeAttempt(ctx, hashToken(token), maxChallengeAttempts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge == nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	user, err := s.user(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			err = ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	return user, challenge, nil
+}
+
+// EnrollWithChallenge starts the required enrolment of a user during their login
+func (s *TwoFactorService) EnrollWithChallenge(ctx context.Context, token string) (*models.TwoFactorSetup, error) {
+	user, challenge, err := s.ChallengeUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Purpose != models.MFAPurposeEnroll {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return s.enroll(ctx, user)
+}
+
+// CompleteLogin checks the code of the second step of a login
+// Wrong codes return a *TwoFactorFailure, so that the caller can throttle the account
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, req *models.LoginSecondStepRequest) (*SecondStepResult, error) {
+	user, challenge, err := s.ChallengeUser(ctx, req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SecondStepResult{User: user}
+	if challenge.Purpose == models.MFAPurposeEnroll {
+		result.RecoveryCodes, err = s.Confirm(ctx, user.ID, req.Code)
+	} else {
+		err = s.verify(ctx, user.ID, req.Code, req.RecoveryCode)
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return nil, &TwoFactorFailure{UserID: user.ID}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteChallenge(ctx, hashToken(req.MFAToken)); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return result, nil
+}
+
+// verify checks a TOTP code (each time step is accepted once) or consumes a recovery code
+// Wrong codes are throttled per user with the TwoFactorCodePolicy
+func (s *TwoFactorService) verify(ctx context.Context, userID int, code, recoveryCode string) error {
+	enrollment, err := s.enrollment(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil || enrollment.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	key := "2fa:" + strconv.Itoa(userID)
+	now := time.Now()
+	d, failures, err := TwoFactorCodePolicy.Take(ctx, s.store, key, now)
+	if err != nil {
+		return err
+	}
+	if !d.Allowed {
+		return &LoginThrottledError{Locked: d.Locked, RetryAfter: d.RetryAfter}
+	}
+	recovery, err := checkCode(ctx, s.repo, enrollment, code, recoveryCode, now)
+	if recovery && err == nil {
+		s.record(ctx, userID, "recovery code used")
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if _, ferr := TwoFactorCodePolicy.Lockout(ctx, s.store, key, failures, now); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	if err != nil {
+		if ferr := s.store.Forgive(ctx, key); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	return s.store.Reset(ctx, key)
+}
+
+// usedCodes marks the time steps and the recovery codes which were used (TwoFactorRepository)
+type usedCodes interface {
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+}
+
+// checkCode accepts a TOTP code at now whose time step was not used yet, or an unused recovery code
+func checkCode(ctx context.Context, used usedCodes, enrollment *models.TOTPEnrollment, code, recoveryCode string, now time.Time) (recovery bool, err error) {
+	if recoveryCode != "" {
+		ok, err := used.UseRecoveryCode(ctx, enrollment.UserID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return true, err
+		}
+		if !ok {
+			return true, ErrInvalidTwoFactorCode
+		}
+		return true, nil
+	}
+	step, ok := totp.Validate(enrollment.Secret, code, now)
+	if !ok {
+		return false, ErrInvalidTwoFactorCode
+	}
+	fresh, err := used.UseStep(ctx, enrollment.UserID, step)
+	if err != nil {
+		return false, err
+	}
+	if !fresh {
+		return false, ErrInvalidTwoFactorCode // Replayed code
+	}
+	return false, nil
+}
+
+// user returns a user by ID
+func (s *TwoFactorService) user(ctx context.Context, userID int) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// enrollment returns the enrolment of a user with its secret decrypted
+func (s *TwoFactorService) enrollment(ctx context.Context, userID int) (*models.TOTPEnrollment, error) {
+	enrollment, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil || enrollment == nil {
+		return nil, err
+	}
+	if enrollment.Secret, err = s.open(enrollment.Secret); err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// record writes a 2FA change of a user to the security audit log
+func (s *TwoFactorService) record(ctx context.Context, userID int, details string) {
+	event := &models.SecurityEvent{EventType: models.EventTwoFactorChange, UserID: &userID, Details: details}
+	if err := s.events.RecordEvent(ctx, event); err != nil {
+		log.Printf("TwoFactor: could not record event for userID %d: %v", userID, err)
+	}
+}
+
+func (s *TwoFactorService) seal(secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *TwoFactorService) open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("corrupted two-factor secret")
+	}
+	plain, err := s.aead.Open(nil, data[:s.aead.NonceSize()], data[s.aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("two-factor secret cannot be decrypted (was TOTP_ENCRYPTION_KEY changed?)")
+	}
+	return string(plain), nil
+}
+
+// newRecoveryCodes returns recovery codes (80 random bits, as xxxx-xxxx-xxxx-xxxx) and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b)) // 16 characters
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes with or without dashes, in any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/totp"
+)
+
+// fakeUsedCodes keeps what TwoFactorRepository stores: the last used step (user_totp.last_step) and
+// the recovery codes with whether they were used
+type fakeUsedCodes struct {
+	lastStep int64
+	recovery map[string]bool // hash -> used
+}
+
+func (f *fakeUsedCodes) UseStep(_ context.Context, _ int, step int64) (bool, error) {
+	if f.lastStep >= step {
+		return false, nil
+	}
+	f.lastStep = step
+	return true, nil
+}
+
+func (f *fakeUsedCodes) UseRecoveryCode(_ context.Context, _ int, hash string) (bool, error) {
+	used, ok := f.recovery[hash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recovery[hash] = true
+	return true, nil
+}
+
+func TestCheckCode(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	step := totp.Step(now)
+	codeAt := func(s int64) string {
+		code, err := totp.Code(secret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	wrong := "000000"
+	for wrong == codeAt(step-1) || wrong == codeAt(step) || wrong == codeAt(step+1) {
+		wrong = "111111"
+	}
+
+	// Each case runs on the state the previous ones left
+	used := &fakeUsedCodes{recovery: map[string]bool{hashToken("abcd1234efgh5678"): false}}
+	enrollment := &models.TOTPEnrollment{UserID: 1, Secret: secret}
+	tests := []struct {
+		name         string
+		code         string
+		recoveryCode string
+		wantErr      error
+	}{
+		{"previous step", codeAt(step - 1), "", nil},
+		{"current step", codeAt(step), "", nil},
+		{"current step replayed", codeAt(step), "", ErrInvalidTwoFactorCode},
+		{"earlier step after a later one", codeAt(step - 1), "", ErrInvalidTwoFactorCode},
+		{"wrong code", wrong, "", ErrInvalidTwoFactorCode},
+		{"next step", codeAt(step + 1), "", nil},
+		{"unknown recovery code", "", "aaaa-bbbb-cccc-dddd", ErrInvalidTwoFactorCode},
+		{"recovery code", "", "ABCD-1234-efgh-5678", nil},
+		{"recovery code used again", "", "abcd1234efgh5678", ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		recovery, err := checkCode(context.Background(), used, enrollment, tt.code, tt.recoveryCode, now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if recovery != (tt.recoveryCode != "") {
+			t.Errorf("%s: recovery = %v", tt.name, recovery)
+		}
+	}
+	if used.lastStep != step+1 {
+		t.Errorf("last step = %d, want %d", used.lastStep, step+1)
+	}
+}
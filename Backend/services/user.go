@@ -2,10 +2,12 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -15,6 +17,20 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	resetCodeTTL        = 10 * time.Minute
+	resetResendInterval = time.Minute      // a new code replaces the previous one at most once a minute
+	maxResetAttempts    = 5                // wrong codes before the code is invalidated
+	resetLockout        = 30 * time.Minute // during which no new code is issued
+)
+
+var (
+	ErrInvalidResetCode      = errors.New("invalid or expired code")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrAccountDisabled       = errors.New("this account has been disabled, please contact your administrator")
+	ErrPasswordResetRequired = errors.New("a password reset is required: use \"Forgot Password?\" to set a new password")
+)
+
 // UserService provides methods for user management and authentication
 type UserService struct {
 	repo      *repositories.UserRepository // Handles user data operations
@@ -84,16 +100,24 @@ func (s *UserService) Authenticate(ctx context.Context, identifier, password str
 		return nil, err
 	}
 	if user == nil {
-		log.Printf("Authenticate: user not found: %s", identifier)
+		log.Printf("Authenticate: unknown identifier")
 		return nil, errors.New("user not found")
 	}
 	log.Printf("Authenticate: user found: %s", user.Username)
 	// Compare password hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		log.Printf("Authenticate: invalid password for user: %s", identifier)
+		log.Printf("Authenticate: invalid password for userID: %d", user.ID)
 		return nil, errors.New("invalid credentials")
 	}
+	// Only told once the password is right
+	if user.Disabled() {
+		log.Printf("Authenticate: disabled account userID: %d", user.ID)
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
 	log.Printf("Authenticate: successful login for user: %s", user.Username)
 	user.Password = ""
 	return user, nil
@@ -104,42 +128,91 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models
 	return s.repo.GetUserByEmail(ctx, email)
 }
 
-// CreatePasswordResetOTP generates and stores a password reset OTP for a user
-func (s *UserService) CreatePasswordResetOTP(ctx context.Context, email string) (string, error) {
-	user, err := s.repo.GetUserByEmail(ctx, email)
-	if err != nil || user == nil {
-		return "", errors.New("user not found")
-	}
-	// Generate 6-digit OTP
-	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
-	expiresAt := time.Now().Add(10 * time.Minute)
-	// Store OTP in repository
-	if err := s.repo.CreatePasswordResetOTP(ctx, user.ID, otp, expiresAt); err != nil {
+// RequestPasswordReset generates a reset code for the account of an email
+// It returns an empty code, and no error, when no code is to be sent: unknown email,
+// locked out user or a code requested less than a minute ago, so that the caller
+// answers the same way in every case
+func (s *UserService) RequestPasswordReset(ctx context.Context, req *models.ForgotPasswordRequest) (string, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return "", err
+	}
+	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", nil
+	}
+
+	code, err := newResetCode()
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	reset := &models.PasswordReset{
+		UserID:    user.ID,
+		Email:     user.Email,
+		CodeHash:  string(hash),
+		ExpiresAt: now.Add(resetCodeTTL),
+	}
+	created, err := s.repo.CreatePasswordReset(ctx, reset, now.Add(-resetResendInterval))
+	if err != nil {
 		return "", err
 	}
-	return otp, nil
+	if !created {
+		log.Printf("RequestPasswordReset: no code issued for userID %d (locked out or requested too often)", user.ID)
+		return "", nil
+	}
+	return code, nil
 }
 
-// ResetPasswordWithOTP resets a user's password using a valid OTP
-func (s *UserService) ResetPasswordWithOTP(ctx context.Context, otp, newPassword string) error {
-	// Get user ID by OTP
-	userID, err := s.repo.GetUserIDByOTP(ctx, otp)
-	if err != nil || userID == 0 {
-		log.Printf("ResetPasswordWithOTP: invalid or expired code: %s", otp)
-		return errors.New("invalid or expired code")
+// ResetPasswordWithOTP resets a user's password with the code sent to their email
+// Each try counts against the code; once the attempts are exhausted the code is invalidated
+// and no new code is issued for the lockout period
+func (s *UserService) ResetPasswordWithOTP(ctx context.Context, req *models.ResetPasswordRequest) error {
+	if err := s.validator.Struct(req); err != nil {
+		return err
+	}
+	reset, err := s.repo.ClaimPasswordResetAttempt(ctx, req.Email, maxResetAttempts)
+	if err != nil {
+		return err
+	}
+	if reset == nil {
+		return ErrInvalidResetCode
 	}
-	// Hash new password
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if bcrypt.CompareHashAndPassword([]byte(reset.CodeHash), []byte(req.Code)) != nil {
+		if reset.Attempts >= maxResetAttempts {
+			log.Printf("ResetPasswordWithOTP: attempts exhausted for userID %d, locking password resets", reset.UserID)
+			if err := s.repo.LockPasswordReset(ctx, reset.ID, time.Now().Add(resetLockout)); err != nil {
+				return err
+			}
+		}
+		return ErrInvalidResetCode
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("ResetPasswordWithOTP: bcrypt error: %v", err)
 		return err
 	}
-	// Update password in repository
-	if err := s.repo.UpdateUserPassword(ctx, userID, string(hash)); err != nil {
-		log.Printf("ResetPasswordWithOTP: update password error: %v", err)
+	if err := s.repo.ResetPassword(ctx, reset.ID, reset.UserID, string(hash)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetCode
+		}
 		return err
 	}
-	log.Printf("ResetPasswordWithOTP: password updated for userID: %d", userID)
-	// Delete OTP after successful reset
-	return s.repo.DeletePasswordResetOTP(ctx, otp)
+	log.Printf("ResetPasswordWithOTP: password updated for userID: %d", reset.UserID)
+	return nil
+}
+
+// newResetCode returns a 6-digit code from a cryptographically secure source
+func newResetCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/webhooks"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrTooManyWebhooks         = errors.New("too many webhooks, delete one first")
+	ErrInvalidWebhookURL       = errors.New("webhook URL must be an absolute https URL")
+)
+
+const (
+	maxWebhooksPerTeacher = 10
+	webhookDeliveriesPage = 100 // deliveries shown in the log of a subscription
+)
+
+// WebhookService manages the webhook subscriptions of teachers and queues the events
+// they subscribed to, for the WebhookWorker to deliver
+type WebhookService struct {
+	repo          *repositories.WebhookRepository   // Subscriptions and deliveries
+	classroomRepo *repositories.ClassroomRepository // Finds the teachers of a student
+	allowHTTP     bool                              // Accept plain http URLs (development)
+	validator     *validator.Validate               // Validates request structs
+}
+
+// NewWebhookService creates a new WebhookService instance
+func NewWebhookService(repo *repositories.WebhookRepository, classroomRepo *repositories.ClassroomRepository, allowHTTP bool) *WebhookService {
+	return &WebhookService{
+		repo:          repo,
+		classroomRepo: classroomRepo,
+		allowHTTP:     allowHTTP,
+		validator:     validator.New(),
+	}
+}
+
+// newWebhookSecret returns a random secret signing the requests of a subscription
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateSubscription subscribes an endpoint of a teacher to some events; the secret is returned only here
+func (s *WebhookService) CreateSubscription(ctx context.Context, teacherID int, req *models.CreateWebhookRequest) (*models.WebhookSubscription, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	if err := webhooks.ValidateURL(req.URL, s.allowHTTP); err != nil {
+		return nil, ErrInvalidWebhookURL
+	}
+	count, err := s.repo.CountSubscriptions(ctx, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooksPerTeacher {
+		return nil, ErrTooManyWebhooks
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := &models.WebhookSubscription{
+		TeacherID:   teacherID,
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      uniqueStrings(req.Events),
+		Active:      true,
+		Secret:      secret,
+	}
+	if err := s.repo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	log.Printf("WebhookService: teacherID %d subscribed webhook %d to %v", teacherID, subscription.ID, subscription.Events)
+	return subscription, nil
+}
+
+// GetSubscriptions returns the subscriptions of a teacher
+func (s *WebhookService) GetSubscriptions(ctx context.Context, teacherID int) ([]models.WebhookSubscription, error) {
+	return s.repo.GetSubscriptions(ctx, teacherID)
+}
+
+// GetSubscription returns a subscription of a teacher
+func (s *WebhookService) GetSubscription(ctx context.Context, teacherID, id int) (*models.WebhookSubscription, error) {
+	subscription, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil || subscription.TeacherID != teacherID {
+		return nil, ErrWebhookNotFound
+	}
+	return subscription, nil
+}
+
+// UpdateSubscription changes the URL, description, events or state of a subscription of a teacher
+// Deliveries of a paused subscription wait until it is active again
+func (s *WebhookService) UpdateSubscription(ctx context.Context, teacherID, id int, req *models.UpdateWebhookRequest) (*models.WebhookSubscription, error) {
+	if err := s.validator.Struct(req); err != nil {
+		return nil, err
+	}
+	subscription, err := s.GetSubscription(ctx, teacherID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL != nil {
+		if err := webhooks.ValidateURL(*req.URL, s.allowHTTP); err != nil {
+			return nil, ErrInvalidWebhookURL
+		}
+		subscription.URL = *req.URL
+	}
+	if req.Description != nil {
+		subscription.Description = *req.Description
+	}
+	if len(req.Events) > 0 {
+		subscription.Events = uniqueStrings(req.Events)
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	if err := s.repo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// RotateSecret gives a subscription of a teacher a new secret, returned only here
+// The deliveries not attempted yet are signed with the new secret
+func (s *WebhookService) RotateSecret(ctx context.Context, teacherID, id int) (*models.WebhookSubscription, error) {
+	subscription, err := s.GetSubscription(ctx, teacherID, id)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetSecret(ctx, id, secret); err != nil {
+		return nil, err
+	}
+	subscription.Secret = secret
+	return subscription, nil
+}
+
+// DeleteSubscription removes a subscription of a teacher and its delivery log
+func (s *WebhookService) DeleteSubscription(ctx context.Context, teacherID, id int) error {
+	if _, err := s.GetSubscription(ctx, teacherID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+// GetDeliveries returns the delivery log of a subscription of a teacher, latest first
+func (s *WebhookService) GetDeliveries(ctx context.Context, teacherID, id int) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetSubscription(ctx, teacherID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDeliveries(ctx, id, webhookDeliveriesPage)
+}
+
+// Redeliver sends a delivery of a subscription of a teacher again, with the same event id and payload
+func (s *WebhookService) Redeliver(ctx context.Context, teacherID, id int, deliveryID int64) (*models.WebhookDelivery, error) {
+	if _, err := s.GetSubscription(ctx, teacherID, id); err != nil {
+		return nil, err
+	}
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil || delivery.SubscriptionID != id {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return s.repo.Redeliver(ctx, deliveryID)
+}
+
+// Ping queues a ping event to a subscription of a teacher, to test the endpoint
+func (s *WebhookService) Ping(ctx context.Context, teacherID, id int) error {
+	if _, err := s.GetSubscription(ctx, teacherID, id); err != nil {
+		return err
+	}
+	return s.enqueue(ctx, []int{id}, models.WebhookPing, time.Now(), map[string]int{"subscription_id": id})
+}
+
+// HandleEvent queues the domain events webhooks can subscribe to, for the subscriptions of the teachers concerned:
+// the teacher of the test or classroom, or the teachers of the student for placements and levels
+func (s *WebhookService) HandleEvent(ctx context.Context, e events.Event) {
+	var teacherIDs []int
+	switch p := e.Data.(type) {
+	case events.TestResult:
+		teacherIDs = []int{p.TeacherID}
+	case events.ClassroomMember:
+		if e.Type != events.ClassroomJoined {
+			return
+		}
+		teacherIDs = []int{p.TeacherID}
+	case events.LevelResult:
+		teacherIDs = s.teachersOf(ctx, p.StudentID)
+	case events.LevelChange:
+		teacherIDs = s.teachersOf(ctx, p.StudentID)
+	default:
+		return
+	}
+	if len(teacherIDs) == 0 {
+		return
+	}
+
+	subscriptions, err := s.repo.GetActiveSubscriptions(ctx, teacherIDs, e.Type)
+	if err != nil {
+		log.Printf("WebhookService: could not get the subscriptions to %s: %v", e.Type, err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+	ids := make([]int, len(subscriptions))
+	for i := range subscriptions {
+		ids[i] = subscriptions[i].ID
+	}
+	if err := s.enqueue(ctx, ids, e.Type, e.OccurredAt, e.Data); err != nil {
+		log.Printf("WebhookService: could not queue %s for webhooks %v: %v", e.Type, ids, err)
+	}
+}
+
+// enqueue queues an event for some subscriptions, with a new event id
+func (s *WebhookService) enqueue(ctx context.Context, subscriptionIDs []int, eventType string, occurredAt time.Time, data any) error {
+	payload := models.WebhookPayload{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: occurredAt.UTC(),
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.repo.EnqueueDeliveries(ctx, subscriptionIDs, payload.ID, eventType, body)
+}
+
+func (s *WebhookService) teachersOf(ctx context.Context, studentID int) []int {
+	teacherIDs, err := s.classroomRepo.GetTeacherIDsOfStudent(ctx, studentID)
+	if err != nil {
+		log.Printf("WebhookService: could not get the teachers of studentID %d: %v", studentID, err)
+		return nil
+	}
+	return teacherIDs
+}
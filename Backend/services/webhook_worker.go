@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+	"github.com/panosmaurikos/personalisedenglish/backend/webhooks"
+)
+
+// WebhookRetryBackoff spaces the attempts of a delivery: 1 minute after the first failure,
+// doubled on each failure up to 6 hours
+var WebhookRetryBackoff = throttle.Policy{
+	BaseDelay: time.Minute,
+	MaxDelay:  6 * time.Hour,
+}
+
+const (
+	webhookMaxAttempts  = 8 // then the delivery fails, until it is redelivered
+	webhookLease        = 2 * time.Minute
+	webhookBatchSize    = 20
+	webhookPollInterval = 5 * time.Second
+	webhookLogRetention = 30 * 24 * time.Hour // finished deliveries are then removed from the log
+)
+
+// WebhookWorker delivers the queued webhook deliveries
+// Several workers (one per instance) can run against the same database
+type WebhookWorker struct {
+	repo   *repositories.WebhookRepository
+	client *webhooks.Client
+}
+
+// NewWebhookWorker creates a new WebhookWorker instance
+func NewWebhookWorker(repo *repositories.WebhookRepository, client *webhooks.Client) *WebhookWorker {
+	return &WebhookWorker{repo: repo, client: client}
+}
+
+// Run delivers the due deliveries until the context is cancelled
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		n, err := w.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("WebhookWorker: %v", err)
+		}
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if _, err := w.repo.DeleteFinishedBefore(ctx, time.Now().Add(-webhookLogRetention)); err != nil && ctx.Err() == nil {
+				log.Printf("WebhookWorker: could not purge the delivery log: %v", err)
+			}
+		}
+		if n == webhookBatchSize {
+			continue // more may be due
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts a batch of due deliveries and returns how many it attempted
+func (w *WebhookWorker) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := w.repo.ClaimDue(ctx, webhookBatchSize, time.Now().Add(webhookLease))
+	if err != nil {
+		return 0, err
+	}
+	for i := range deliveries {
+		w.deliver(ctx, &deliveries[i])
+	}
+	return len(deliveries), nil
+}
+
+func (w *WebhookWorker) deliver(ctx context.Context, d *models.WebhookDelivery) {
+	result, err := w.client.Deliver(ctx, d.URL, d.Secret, d.EventID, d.EventType, d.Payload)
+
+	// The outcome is recorded even when the worker is being stopped
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		if err := w.repo.MarkDelivered(ctx, d.ID, result.StatusCode, result.Response); err != nil {
+			// The lease runs out and the event is sent again, with the same id
+			log.Printf("WebhookWorker: could not mark delivery %d as delivered: %v", d.ID, err)
+		}
+		return
+	}
+
+	var statusCode *int
+	if result.StatusCode != 0 {
+		statusCode = &result.StatusCode
+	}
+	failed := d.Attempts >= webhookMaxAttempts
+	next := time.Now().Add(WebhookRetryBackoff.Delay(d.Attempts))
+	if failed {
+		log.Printf("WebhookWorker: gave up on %s delivery %d to webhook %d after %d attempt(s): %v", d.EventType, d.ID, d.SubscriptionID, d.Attempts, err)
+	}
+	if err := w.repo.MarkFailed(ctx, d.ID, statusCode, result.Response, err.Error(), next, failed); err != nil {
+		log.Printf("WebhookWorker: could not record the failure of delivery %d: %v", d.ID, err)
+	}
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/panosmaurikos/personalisedenglish/backend/events"
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/xapi"
+)
+
+// xapiPlatform is the platform of the statements
+const xapiPlatform = "Personalised English"
+
+// XAPIService records the learning of the students as xAPI statements, queued for the XAPIWorker to send
+// to the Learning Record Store: every answered question, completed test and assigned level
+type XAPIService struct {
+	repo          *repositories.XAPIRepository      // Queued statements
+	levelRepo     *repositories.LevelRepository     // Answers of the placement and personalized tests
+	classroomRepo *repositories.ClassroomRepository // Answers of the classroom tests
+	base          string                            // Prefix of the IRIs, and home page of the accounts of the students
+}
+
+// NewXAPIService creates a new XAPIService instance; the IRIs of the activities start with base
+func NewXAPIService(repo *repositories.XAPIRepository, levelRepo *repositories.LevelRepository, classroomRepo *repositories.ClassroomRepository, base string) *XAPIService {
+	return &XAPIService{
+		repo:          repo,
+		levelRepo:     levelRepo,
+		classroomRepo: classroomRepo,
+		base:          strings.TrimRight(base, "/"),
+	}
+}
+
+// HandleEvent queues the statements of a completed test (its answers, the test and the level it gave)
+// or of a level confirmed by a teacher
+func (s *XAPIService) HandleEvent(ctx context.Context, e events.Event) {
+	var statements []xapi.Statement
+	var err error
+	switch p := e.Data.(type) {
+	case events.TestResult:
+		statements, err = s.classroomTestStatements(ctx, p, e.OccurredAt)
+	case events.LevelResult:
+		statements, err = s.levelTestStatements(ctx, p)
+	case events.LevelChange:
+		// Levels given by a test are recorded with the test
+		if p.ConfirmedBy == nil {
+			return
+		}
+		statements = []xapi.Statement{s.confirmedLevelStatement(p, e.OccurredAt)}
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("XAPIService: could not build the statements of %s: %v", e.Type, err)
+		return
+	}
+	if err := s.enqueue(ctx, statements); err != nil {
+		log.Printf("XAPIService: could not queue the statements of %s: %v", e.Type, err)
+	}
+}
+
+// classroomTestStatements records a classroom test completed by a student, with its answers
+func (s *XAPIService) classroomTestStatements(ctx context.Context, p events.TestResult, at time.Time) ([]xapi.Statement, error) {
+	answers, err := s.classroomRepo.GetTeacherResultAnswers(ctx, p.ResultID)
+	if err != nil {
+		return nil, err
+	}
+	test := xapi.NewActivity(s.iri("activities/tests/%d", p.TestID), xapi.ActivityAssessment, p.Test)
+	actor := xapi.NewAgent(s.base, p.StudentID)
+
+	statements := make([]xapi.Statement, 0, len(answers)+1)
+	for i, a := range answers {
+		question := s.questionActivity(s.iri("activities/tests/%d/questions/%d", p.TestID, a.QuestionID), fmt.Sprintf("%s, question %d", p.Test, i+1), a)
+		statements = append(statements, s.answerStatement(fmt.Sprintf("teacher-test-answers/%d", a.ID), actor, question, test, a))
+	}
+	statements = append(statements, xapi.Statement{
+		ID:        s.statementID("teacher-test-results/%d/completed", p.ResultID),
+		Actor:     actor,
+		Verb:      xapi.Completed,
+		Object:    test,
+		Result:    testResult(p.Score, p.CorrectAnswers, p.TotalQuestions, answers),
+		Context:   &xapi.Context{Platform: xapiPlatform},
+		Timestamp: at.UTC(),
+	})
+	return statements, nil
+}
+
+// levelTestStatements records a placement or personalized test, with its answers and the level it gave
+func (s *XAPIService) levelTestStatements(ctx context.Context, p events.LevelResult) ([]xapi.Statement, error) {
+	answers, err := s.levelRepo.GetResultAnswers(ctx, p.ResultID)
+	if err != nil {
+		return nil, err
+	}
+	name := "Placement test"
+	if p.TestType == "personalized" {
+		name = "Personalized test"
+	}
+	test := xapi.NewActivity(s.iri("activities/placement-tests/%s", url.PathEscape(p.TestType)), xapi.ActivityAssessment, name)
+	actor := xapi.NewAgent(s.base, p.StudentID)
+
+	statements := make([]xapi.Statement, 0, len(answers)+2)
+	for _, a := range answers {
+		question := s.questionActivity(s.iri("activities/placement-questions/%d", a.QuestionID), fmt.Sprintf("Placement question %d", a.QuestionID), a)
+		statements = append(statements, s.answerStatement(fmt.Sprintf("test-answers/%d", a.ID), actor, question, test, a))
+	}
+	correct := 0
+	for _, a := range answers {
+		if a.IsCorrect {
+			correct++
+		}
+	}
+	statements = append(statements, xapi.Statement{
+		ID:        s.statementID("level-results/%d/completed", p.ResultID),
+		Actor:     actor,
+		Verb:      xapi.Completed,
+		Object:    test,
+		Result:    testResult(p.Score, correct, len(answers), answers),
+		Context:   &xapi.Context{Platform: xapiPlatform},
+		Timestamp: p.TakenAt.UTC(),
+	})
+
+	level := s.levelStatement(fmt.Sprintf("level-results/%d/level", p.ResultID), actor, p.Level, p.TakenAt)
+	level.Context.ContextActivities = &xapi.ContextActivities{Parent: []xapi.Activity{test}}
+	if p.LevelScore != nil {
+		level.Result = &xapi.Result{Extensions: map[string]any{s.iri("extensions/level-score"): *p.LevelScore}}
+	}
+	return append(statements, level), nil
+}
+
+// confirmedLevelStatement records a teacher confirming another level for a result of a student
+func (s *XAPIService) confirmedLevelStatement(p events.LevelChange, at time.Time) xapi.Statement {
+	statement := s.levelStatement(fmt.Sprintf("level-results/%d/confirmed/%s/%d", p.ResultID, p.To, at.UnixNano()), xapi.NewAgent(s.base, p.StudentID), p.To, at)
+	instructor := xapi.NewAgent(s.base, *p.ConfirmedBy)
+	statement.Context.Instructor = &instructor
+	statement.Context.Extensions = map[string]any{s.iri("extensions/previous-level"): p.From}
+	return statement
+}
+
+// levelStatement records a student being assigned a level
+func (s *XAPIService) levelStatement(key string, actor xapi.Agent, level string, at time.Time) xapi.Statement {
+	return xapi.Statement{
+		ID:    s.statementID("%s", key),
+		Actor: actor,
+		Verb: xapi.Verb{
+			ID:      s.iri("verbs/was-assigned"),
+			Display: xapi.LanguageMap{"en-US": "was assigned"},
+		},
+		Object:    xapi.NewActivity(s.iri("activities/levels/%s", url.PathEscape(level)), xapi.ActivityObjective, level),
+		Context:   &xapi.Context{Platform: xapiPlatform},
+		Timestamp: at.UTC(),
+	}
+}
+
+// questionActivity describes a multiple choice question
+func (s *XAPIService) questionActivity(id, name string, a models.AnsweredQuestion) xapi.Activity {
+	question := xapi.NewActivity(id, xapi.ActivityInteraction, name)
+	question.Definition.Description = xapi.LanguageMap{"en-US": a.QuestionText}
+	question.Definition.InteractionType = "choice"
+	if a.CorrectAnswer != "" {
+		question.Definition.CorrectResponsesPattern = []string{a.CorrectAnswer}
+	}
+	letters := make([]string, 0, len(a.Options))
+	for letter := range a.Options {
+		letters = append(letters, letter)
+	}
+	sort.Strings(letters)
+	for _, letter := range letters {
+		question.Definition.Choices = append(question.Definition.Choices, xapi.InteractionComponent{
+			ID:          letter,
+			Description: xapi.LanguageMap{"en-US": a.Options[letter]},
+		})
+	}
+	return question
+}
+
+// answerStatement records an answered question of a test
+func (s *XAPIService) answerStatement(key string, actor xapi.Agent, question, test xapi.Activity, a models.AnsweredQuestion) xapi.Statement {
+	completion := true
+	isCorrect := a.IsCorrect
+	result := &xapi.Result{Success: &isCorrect, Completion: &completion, Response: a.Selected}
+	if a.ResponseTime != nil && *a.ResponseTime > 0 {
+		result.Duration = xapi.Duration(seconds(*a.ResponseTime))
+	}
+	statement := xapi.Statement{
+		ID:     s.statementID("%s", key),
+		Actor:  actor,
+		Verb:   xapi.Answered,
+		Object: question,
+		Result: result,
+		Context: &xapi.Context{
+			ContextActivities: &xapi.ContextActivities{Parent: []xapi.Activity{test}},
+			Platform:          xapiPlatform,
+		},
+		Timestamp: a.AnsweredAt.UTC(),
+	}
+	if a.QuestionType != "" {
+		statement.Context.Extensions = map[string]any{s.iri("extensions/question-type"): a.QuestionType}
+	}
+	return statement
+}
+
+// testResult is the result of a completed test: its score (a percentage), the correct answers and the time spent answering
+func testResult(score float64, correct, total int, answers []models.AnsweredQuestion) *xapi.Result {
+	completion := true
+	scaled := min(max(score/100, 0), 1)
+	raw, lowest, highest := float64(correct), 0.0, float64(total)
+	result := &xapi.Result{
+		Score:      &xapi.Score{Scaled: &scaled, Raw: &raw, Min: &lowest, Max: &highest},
+		Completion: &completion,
+	}
+	var spent time.Duration
+	for _, a := range answers {
+		if a.ResponseTime != nil && *a.ResponseTime > 0 {
+			spent += seconds(*a.ResponseTime)
+		}
+	}
+	if spent > 0 {
+		result.Duration = xapi.Duration(spent)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// iri returns an IRI of the platform, under <base>/xapi/
+func (s *XAPIService) iri(format string, args ...any) string {
+	return s.base + "/xapi/" + fmt.Sprintf(format, args...)
+}
+
+// statementID derives the id of a statement from what it records, so that it is queued once
+// and an LRS receiving it twice keeps one
+func (s *XAPIService) statementID(format string, args ...any) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(s.iri("statements/"+format, args...))).String()
+}
+
+func (s *XAPIService) enqueue(ctx context.Context, statements []xapi.Statement) error {
+	queued := make([]models.XAPIStatement, len(statements))
+	for i := range statements {
+		body, err := json.Marshal(&statements[i])
+		if err != nil {
+			return err
+		}
+		queued[i] = models.XAPIStatement{StatementID: statements[i].ID, Statement: body}
+	}
+	return s.repo.Enqueue(ctx, queued)
+}
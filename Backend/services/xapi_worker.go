@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+	"github.com/panosmaurikos/personalisedenglish/backend/repositories"
+	"github.com/panosmaurikos/personalisedenglish/backend/throttle"
+	"github.com/panosmaurikos/personalisedenglish/backend/xapi"
+)
+
+// XAPIRetryBackoff spaces the attempts to send a statement: 1 minute after the first failure,
+// doubled on each failure up to 6 hours
+var XAPIRetryBackoff = throttle.Policy{
+	BaseDelay: time.Minute,
+	MaxDelay:  6 * time.Hour,
+}
+
+const (
+	xapiMaxAttempts  = 12               // then the statement fails
+	xapiSendTimeout  = 30 * time.Second // per batch
+	xapiLease        = 2 * time.Minute
+	xapiBatchSize    = 50 // statements posted together
+	xapiPollInterval = 10 * time.Second
+	xapiLogRetention = 30 * 24 * time.Hour // sent and failed statements are then removed
+)
+
+// XAPIWorker sends the queued xAPI statements to the sink in batches
+// Several workers (one per instance) can run against the same database
+type XAPIWorker struct {
+	repo *repositories.XAPIRepository
+	sink xapi.Sink
+}
+
+// NewXAPIWorker creates a new XAPIWorker instance
+func NewXAPIWorker(repo *repositories.XAPIRepository, sink xapi.Sink) *XAPIWorker {
+	return &XAPIWorker{repo: repo, sink: sink}
+}
+
+// Run sends the due statements until the context is cancelled
+func (w *XAPIWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(xapiPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		n, err := w.SendDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("XAPIWorker: %v", err)
+		}
+		if time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if _, err := w.repo.DeleteFinishedBefore(ctx, time.Now().Add(-xapiLogRetention)); err != nil && ctx.Err() == nil {
+				log.Printf("XAPIWorker: could not purge the sent statements: %v", err)
+			}
+		}
+		if n == xapiBatchSize {
+			continue // more may be due
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue sends a batch of due statements and returns how many it attempted
+func (w *XAPIWorker) SendDue(ctx context.Context) (int, error) {
+	statements, err := w.repo.ClaimDue(ctx, xapiBatchSize, time.Now().Add(xapiLease))
+	if err != nil || len(statements) == 0 {
+		return 0, err
+	}
+	w.send(ctx, statements)
+	return len(statements), nil
+}
+
+func (w *XAPIWorker) send(ctx context.Context, statements []models.XAPIStatement) {
+	bodies := make([]json.RawMessage, len(statements))
+	ids := make([]int64, len(statements))
+	for i, s := range statements {
+		bodies[i], ids[i] = s.Statement, s.ID
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, xapiSendTimeout)
+	err := w.sink.Send(sendCtx, bodies)
+	cancel()
+
+	// The outcome is recorded even when the worker is being stopped
+	recordCtx := context.WithoutCancel(ctx)
+	// A conflict on a single statement is the LRS already having it: it was sent before its delivery was recorded
+	if err == nil || (len(statements) == 1 && xapi.IsConflict(err)) {
+		if err := w.repo.MarkSent(recordCtx, ids); err != nil {
+			// The lease runs out and the statements are sent again, with the same ids
+			log.Printf("XAPIWorker: could not mark %d statement(s) as sent: %v", len(ids), err)
+		}
+		return
+	}
+	if len(statements) > 1 && xapi.IsRejected(err) {
+		// The LRS rejects a whole batch for one statement: they are sent one by one to find it
+		for i := range statements {
+			w.send(ctx, statements[i:i+1])
+		}
+		return
+	}
+
+	log.Printf("XAPIWorker: could not send %d statement(s): %v", len(statements), err)
+	for _, s := range statements {
+		failed := s.Attempts >= xapiMaxAttempts || xapi.IsRejected(err)
+		if failed {
+			log.Printf("XAPIWorker: gave up on statement %s after %d attempt(s): %v", s.StatementID, s.Attempts, err)
+		}
+		next := time.Now().Add(XAPIRetryBackoff.Delay(s.Attempts))
+		if err := w.repo.MarkFailed(recordCtx, s.ID, err.Error(), next, failed); err != nil {
+			log.Printf("XAPIWorker: could not record the failure of statement %s: %v", s.StatementID, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package testformat
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	aikenOption = regexp.MustCompile(`^([A-Z])[.)]\s+(.*)$`)
+	aikenAnswer = regexp.MustCompile(`^ANSWER:\s*([A-Z])$`)
+)
+
+// parseAiken reads questions in the Aiken format: the question, its options "A." or "A)" on their own
+// lines, then "ANSWER: A"
+func parseAiken(s string) []item {
+	var (
+		items   []item
+		it      item
+		letters string // of the options of the current question
+		started bool
+	)
+	finish := func() {
+		items = append(items, it)
+		it, letters, started = item{}, "", false
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := aikenAnswer.FindStringSubmatch(line); m != nil && started {
+			if i := strings.Index(letters, m[1]); i >= 0 {
+				it.correct = []int{i}
+			} else if it.unsupported == "" {
+				it.unsupported = "the answer " + m[1] + " is not one of the options"
+			}
+			finish()
+			continue
+		}
+		if m := aikenOption.FindStringSubmatch(line); m != nil && started {
+			letters += m[1]
+			it.choices = append(it.choices, plainText(m[2]))
+			continue
+		}
+		if len(it.choices) > 0 {
+			// A new question while the previous one had options but no answer
+			it.unsupported = "the question has no ANSWER line"
+			finish()
+		}
+		started = true
+		it.text = strings.TrimSpace(it.text + "\n" + plainText(line))
+	}
+	if started {
+		it.unsupported = "the question has no ANSWER line"
+		finish()
+	}
+	return items
+}
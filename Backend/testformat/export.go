@@ -0,0 +1,145 @@
+package testformat
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+// Print is the format of the print-ready page of a test with its answer key
+const Print = "html"
+
+// ExportFormats are the formats tests are exported to
+var ExportFormats = []string{QTI, MoodleXML, Print}
+
+var (
+	ErrUnknownExportFormat = errors.New("unknown export format, choose one of qti, moodle or html")
+	ErrInvalidVariant      = errors.New("a variant code has 1 to 12 letters or digits")
+)
+
+// File is an exported test
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Export writes a test in a format. With a variant code, the questions and their options are
+// shuffled, the same way for the same test and code
+func Export(format string, test *models.Test, variant string) (*File, error) {
+	if variant != "" {
+		var err error
+		if test, err = Variant(test, variant); err != nil {
+			return nil, err
+		}
+		variant = strings.ToUpper(variant)
+	}
+	name := fileName(test.Title, variant)
+	switch format {
+	case QTI:
+		data, err := exportQTI(test)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Name: name + ".zip", ContentType: "application/zip", Data: data}, nil
+	case MoodleXML:
+		data, err := exportMoodle(test)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Name: name + ".xml", ContentType: "application/xml; charset=utf-8", Data: data}, nil
+	case Print:
+		data, err := exportPrint(test, variant)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Name: name + ".html", ContentType: "text/html; charset=utf-8", Data: data}, nil
+	}
+	return nil, ErrUnknownExportFormat
+}
+
+var variantCode = regexp.MustCompile(`^[A-Z0-9]{1,12}$`)
+
+// Variant returns a copy of a test with its questions and their options shuffled. The order follows
+// from the test and the variant code (case insensitive), so that a variant printed again matches its
+// answer key
+func Variant(test *models.Test, code string) (*models.Test, error) {
+	code = strings.ToUpper(code)
+	if !variantCode.MatchString(code) {
+		return nil, ErrInvalidVariant
+	}
+	seed := sha256.Sum256(fmt.Appendf(nil, "%d:%s", test.ID, code))
+	random := rand.New(rand.NewPCG(binary.BigEndian.Uint64(seed[:8]), binary.BigEndian.Uint64(seed[8:16])))
+
+	variant := *test
+	variant.Questions = make([]models.Question, len(test.Questions))
+	for i, j := range random.Perm(len(test.Questions)) {
+		q := test.Questions[j]
+		q.OrderIndex = i
+		letters := optionLetters(q)
+		q.Options = make(map[string]string, len(letters))
+		for k, from := range random.Perm(len(letters)) {
+			q.Options[letter(k)] = test.Questions[j].Options[letters[from]]
+			if letters[from] == test.Questions[j].CorrectAnswer {
+				q.CorrectAnswer = letter(k)
+			}
+		}
+		variant.Questions[i] = q
+	}
+	return &variant, nil
+}
+
+// optionLetters returns the letters of the options of a question which have a text, in order
+func optionLetters(q models.Question) []string {
+	var letters []string
+	for l, text := range q.Options {
+		if strings.TrimSpace(text) != "" {
+			letters = append(letters, l)
+		}
+	}
+	slices.Sort(letters)
+	return letters
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fileName returns the name of the file of a test, without extension
+func fileName(title, variant string) string {
+	name := strings.Trim(nonWord.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	name = strings.TrimRight(truncate(name, 60), "…-")
+	if name == "" {
+		name = "test"
+	}
+	if variant != "" {
+		name += "-variant-" + strings.ToLower(variant)
+	}
+	return name
+}
+
+// paragraphs splits a text into its non-empty lines
+func paragraphs(text string) []string {
+	return strings.Split(plainText(text), "\n")
+}
+
+// writeXML writes an XML document, indented
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,163 @@
+package testformat
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The escaped special characters of GIFT are replaced by private use characters while a question is
+// split, then restored
+var (
+	giftEscape = strings.NewReplacer(`\\`, "\ue000", `\~`, "\ue001", `\=`, "\ue002", `\#`, "\ue003",
+		`\{`, "\ue004", `\}`, "\ue005", `\:`, "\ue006", `\n`, "\n")
+	giftUnescape = strings.NewReplacer("\ue000", `\`, "\ue001", "~", "\ue002", "=", "\ue003", "#",
+		"\ue004", "{", "\ue005", "}", "\ue006", ":")
+)
+
+// parseGIFT reads questions in the GIFT format of Moodle, separated by blank lines:
+//
+//	::Title::Question text {=right answer ~wrong answer ~wrong answer}
+//
+// Answers within the text ("missing word" questions) become a blank in the question text
+func parseGIFT(s string) []item {
+	var (
+		items []item
+		block []string
+	)
+	flush := func() {
+		if len(block) > 0 {
+			items = append(items, parseGIFTQuestion(strings.Join(block, "\n")))
+			block = nil
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "//"):
+			continue
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			flush()
+		default:
+			block = append(block, line)
+		}
+	}
+	flush()
+	return items
+}
+
+func parseGIFTQuestion(s string) item {
+	var it item
+	s = strings.TrimSpace(giftEscape.Replace(s))
+	if rest, ok := strings.CutPrefix(s, "::"); ok {
+		if title, text, found := strings.Cut(rest, "::"); found {
+			it.title = plainText(giftUnescape.Replace(title))
+			s = strings.TrimSpace(text)
+		}
+	}
+	markup := ""
+	if strings.HasPrefix(s, "[") {
+		if end := strings.Index(s, "]"); end > 0 {
+			markup, s = s[1:end], s[end+1:]
+		}
+	}
+	text := func(t string) string {
+		t = giftUnescape.Replace(t)
+		if markup == "html" || markup == "moodle" {
+			if htmlMedia.MatchString(t) {
+				it.unsupported = mediaReason
+			}
+			return htmlText(t)
+		}
+		return plainText(t)
+	}
+
+	open, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if open < 0 || end < open {
+		it.text = text(s)
+		it.unsupported = "descriptions without answers are not supported"
+		return it
+	}
+	before, answers, after := s[:open], s[open+1:end], s[end+1:]
+	if strings.TrimSpace(after) != "" {
+		it.text = text(strings.TrimRight(before, " \t") + " _____" + after)
+	} else {
+		it.text = text(before)
+	}
+
+	answers, _, _ = strings.Cut(answers, "####") // general feedback
+	answers = strings.TrimSpace(answers)
+	switch {
+	case answers == "":
+		it.unsupported = "essay questions are not supported"
+		return it
+	case strings.HasPrefix(answers, "#"):
+		it.unsupported = "numerical questions are not supported"
+		return it
+	}
+	value, _, _ := strings.Cut(answers, "#")
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "T", "TRUE":
+		it.choices, it.correct = []string{"True", "False"}, []int{0}
+		return it
+	case "F", "FALSE":
+		it.choices, it.correct = []string{"True", "False"}, []int{1}
+		return it
+	}
+	if !strings.Contains(answers, "~") {
+		if strings.Contains(answers, "->") {
+			it.unsupported = "matching questions are not supported"
+		} else {
+			it.unsupported = "short answer questions are not supported"
+		}
+		return it
+	}
+
+	start := strings.IndexAny(answers, "=~")
+	if start < 0 {
+		it.unsupported = "the answers could not be read"
+		return it
+	}
+	for _, answer := range splitGIFTAnswers(answers[start:]) {
+		right := answer[0] == '='
+		body := answer[1:]
+		if weighted, ok := strings.CutPrefix(body, "%"); ok {
+			weight, rest, _ := strings.Cut(weighted, "%")
+			w, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+			if err != nil {
+				it.unsupported = "the answer weight " + weight + " could not be read"
+				return it
+			}
+			switch {
+			case w >= 100:
+				right = true
+			case w > 0:
+				it.unsupported = "questions with several correct options are not supported"
+				return it
+			}
+			body = rest
+		}
+		body, _, _ = strings.Cut(body, "#") // feedback of the answer
+		if right {
+			it.correct = append(it.correct, len(it.choices))
+		}
+		it.choices = append(it.choices, text(body))
+	}
+	return it
+}
+
+// splitGIFTAnswers splits answers at each = or ~, keeping the sign with its answer
+func splitGIFTAnswers(s string) []string {
+	var answers []string
+	for len(s) > 0 {
+		next := strings.IndexAny(s[1:], "=~")
+		if next < 0 {
+			answers = append(answers, s)
+			break
+		}
+		answers = append(answers, s[:next+1])
+		s = s[next+1:]
+	}
+	return answers
+}
@@ -0,0 +1,114 @@
+package testformat
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// moodleText is a text of Moodle XML, in the format of its format attribute (html by default)
+type moodleText struct {
+	Format string `xml:"format,attr"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswer struct {
+	Fraction string `xml:"fraction,attr"`
+	moodleText
+}
+
+type moodleQuestion struct {
+	Type         string         `xml:"type,attr"`
+	Category     moodleText     `xml:"category"` // of the questions which follow, for type category
+	Name         moodleText     `xml:"name"`
+	QuestionText moodleText     `xml:"questiontext"`
+	DefaultGrade string         `xml:"defaultgrade"`
+	Single       string         `xml:"single"`
+	Answers      []moodleAnswer `xml:"answer"`
+}
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// parseMoodle reads the multiple choice and true/false questions of a Moodle XML export
+// The test is named after the first category of the file
+func parseMoodle(data []byte) (string, []item, error) {
+	var quiz moodleQuiz
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return "", nil, err
+	}
+	var (
+		title string
+		items []item
+	)
+	for _, q := range quiz.Questions {
+		if q.Type == "category" {
+			if title == "" {
+				// Slashes of the names are doubled
+				category := strings.ReplaceAll(strings.TrimSpace(q.Category.Text), "//", "\x00")
+				title = strings.ReplaceAll(category[strings.LastIndex(category, "/")+1:], "\x00", "/")
+				if strings.HasPrefix(title, "$") {
+					title = "" // $course$, $system$... alone
+				}
+			}
+			continue
+		}
+		items = append(items, moodleItem(q))
+	}
+	return title, items, nil
+}
+
+func moodleItem(q moodleQuestion) item {
+	it := item{title: plainText(q.Name.Text)}
+	it.text = it.moodleText(q.QuestionText)
+	it.points, _ = strconv.ParseFloat(strings.TrimSpace(q.DefaultGrade), 64)
+	switch q.Type {
+	case "multichoice", "truefalse":
+	case "":
+		it.unsupported = "the question has no type"
+		return it
+	default:
+		it.unsupported = q.Type + " questions are not supported"
+		return it
+	}
+
+	for _, answer := range q.Answers {
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(answer.Fraction), 64)
+		if err != nil {
+			it.unsupported = "the answer fraction " + answer.Fraction + " could not be read"
+			return it
+		}
+		switch {
+		case fraction >= 100:
+			it.correct = append(it.correct, len(it.choices))
+		case fraction > 0:
+			it.unsupported = "questions with several correct options are not supported"
+			return it
+		}
+		text := it.moodleText(answer.moodleText)
+		if q.Type == "truefalse" {
+			switch strings.ToLower(text) {
+			case "true":
+				text = "True"
+			case "false":
+				text = "False"
+			}
+		}
+		it.choices = append(it.choices, text)
+	}
+	return it
+}
+
+// moodleText returns the plain text of a Moodle text, marking the item unsupported if it holds media
+func (it *item) moodleText(t moodleText) string {
+	switch t.Format {
+	case "plain_text", "markdown":
+		return plainText(t.Text)
+	}
+	if htmlMedia.MatchString(t.Text) {
+		it.unsupported = mediaReason
+	}
+	return htmlText(t.Text)
+}
@@ -0,0 +1,81 @@
+package testformat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"strings"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type moodleTextOut struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswerOut struct {
+	Fraction int    `xml:"fraction,attr"`
+	Format   string `xml:"format,attr"`
+	Text     string `xml:"text"`
+}
+
+type moodleQuestionOut struct {
+	Type           string            `xml:"type,attr"`
+	Category       *moodleTextOut    `xml:"category,omitempty"`
+	Name           *moodleTextOut    `xml:"name,omitempty"`
+	QuestionText   *moodleTextOut    `xml:"questiontext,omitempty"`
+	DefaultGrade   int               `xml:"defaultgrade,omitempty"`
+	Single         string            `xml:"single,omitempty"`
+	ShuffleAnswers string            `xml:"shuffleanswers,omitempty"`
+	Numbering      string            `xml:"answernumbering,omitempty"`
+	Answers        []moodleAnswerOut `xml:"answer"`
+}
+
+type moodleQuizOut struct {
+	XMLName   xml.Name            `xml:"quiz"`
+	Questions []moodleQuestionOut `xml:"question"`
+}
+
+// exportMoodle writes a test as a Moodle XML question export: a category named after the test,
+// then a single answer multiple choice question per question, in the order of the test
+func exportMoodle(test *models.Test) ([]byte, error) {
+	quiz := moodleQuizOut{Questions: []moodleQuestionOut{{
+		Type: "category",
+		// Moodle escapes the slashes of category names by doubling them
+		Category: &moodleTextOut{Text: "$course$/top/" + strings.ReplaceAll(test.Title, "/", "//")},
+	}}}
+	for _, q := range test.Questions {
+		out := moodleQuestionOut{
+			Type:           "multichoice",
+			Name:           &moodleTextOut{Text: truncate(strings.ReplaceAll(plainText(q.QuestionText), "\n", " "), labelLength)},
+			QuestionText:   &moodleTextOut{Format: "html", Text: moodleHTML(q.QuestionText)},
+			DefaultGrade:   q.Points,
+			Single:         "true",
+			ShuffleAnswers: "0",
+			Numbering:      "ABCD",
+		}
+		for _, l := range optionLetters(q) {
+			answer := moodleAnswerOut{Format: "html", Text: moodleHTML(q.Options[l])}
+			if l == q.CorrectAnswer {
+				answer.Fraction = 100
+			}
+			out.Answers = append(out.Answers, answer)
+		}
+		quiz.Questions = append(quiz.Questions, out)
+	}
+	var buf bytes.Buffer
+	if err := writeXML(&buf, quiz); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// moodleHTML returns a text as HTML, a paragraph per line
+func moodleHTML(text string) string {
+	var b strings.Builder
+	for _, line := range paragraphs(text) {
+		b.WriteString("<p>" + html.EscapeString(line) + "</p>")
+	}
+	return b.String()
+}
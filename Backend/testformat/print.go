@@ -0,0 +1,107 @@
+package testformat
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+type printOption struct {
+	Letter string
+	Text   string
+}
+
+type printQuestion struct {
+	Number  int
+	Lines   []string
+	Options []printOption
+	Answer  string
+	Points  int
+}
+
+type printTest struct {
+	Title       string
+	Description string
+	Variant     string
+	Questions   []printQuestion
+	Total       int
+}
+
+// exportPrint writes the print-ready page of a test: the questions for the students, then the
+// answer key on a page of its own. Browsers print it, or save it as PDF
+func exportPrint(test *models.Test, variant string) ([]byte, error) {
+	data := printTest{Title: test.Title, Description: test.Description, Variant: variant}
+	for i, q := range test.Questions {
+		pq := printQuestion{Number: i + 1, Lines: paragraphs(q.QuestionText), Answer: q.CorrectAnswer, Points: q.Points}
+		for _, l := range optionLetters(q) {
+			pq.Options = append(pq.Options, printOption{l, q.Options[l]})
+		}
+		data.Questions = append(data.Questions, pq)
+		data.Total += q.Points
+	}
+	var buf bytes.Buffer
+	if err := printPage.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var printPage = template.Must(template.New("print").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}{{if .Variant}} - Variant {{.Variant}}{{end}}</title>
+<style>
+@page { size: A4; margin: 18mm 16mm; }
+body { font-family: Georgia, "Times New Roman", serif; font-size: 12pt; color: #000; max-width: 180mm; margin: 0 auto; padding: 1em; }
+header { border-bottom: 2px solid #000; margin-bottom: 1.2em; }
+h1 { font-size: 18pt; margin: 0 0 .3em; }
+.variant { float: right; font-size: 12pt; border: 1px solid #000; padding: .2em .6em; }
+.student { display: flex; gap: 2em; margin: 1em 0 .6em; }
+.student span { flex: 1; border-bottom: 1px solid #000; padding-bottom: .2em; }
+.question { break-inside: avoid; page-break-inside: avoid; margin-bottom: 1.1em; }
+.question p { margin: 0 0 .3em; }
+.points { float: right; font-size: 10pt; color: #444; }
+.options { list-style: none; padding-left: 1.5em; margin: .3em 0 0; }
+.options li { margin: .2em 0; }
+.box { display: inline-block; width: .9em; height: .9em; border: 1px solid #000; margin-right: .5em; vertical-align: -.1em; }
+.key { break-before: page; page-break-before: always; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #000; padding: .3em .6em; text-align: left; }
+.toolbar { text-align: right; margin-bottom: 1em; }
+@media print { .toolbar { display: none; } body { padding: 0; } }
+</style>
+</head>
+<body>
+<div class="toolbar"><button onclick="window.print()">Print</button></div>
+<header>
+{{if .Variant}}<span class="variant">Variant {{.Variant}}</span>{{end}}
+<h1>{{.Title}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<div class="student"><span>Name:</span><span>Class:</span><span>Date:</span></div>
+<p>{{len .Questions}} questions, {{.Total}} points. Tick one answer per question.</p>
+</header>
+<main>
+{{range .Questions}}{{$number := .Number}}<section class="question">
+<span class="points">{{.Points}} {{if eq .Points 1}}point{{else}}points{{end}}</span>
+{{range $i, $line := .Lines}}<p>{{if eq $i 0}}<strong>{{$number}}.</strong> {{end}}{{$line}}</p>
+{{end}}<ul class="options">
+{{range .Options}}<li><span class="box"></span>{{.Letter}}) {{.Text}}</li>
+{{end}}</ul>
+</section>
+{{end}}</main>
+<section class="key">
+<h1>Answer key</h1>
+<p>{{.Title}}{{if .Variant}} - Variant {{.Variant}}{{end}}</p>
+<table>
+<thead><tr><th>Question</th><th>Answer</th><th>Points</th></tr></thead>
+<tbody>
+{{range .Questions}}<tr><td>{{.Number}}</td><td>{{.Answer}}</td><td>{{.Points}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><th colspan="2">Total</th><th>{{.Total}}</th></tr></tfoot>
+</table>
+</section>
+</body>
+</html>
+`))
@@ -0,0 +1,320 @@
+package testformat
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var errPackageTooLarge = errors.New("the package is too large")
+
+const (
+	maxPackageFiles    = 2000
+	maxPackageFileSize = 5 << 20  // decompressed
+	maxPackageSize     = 50 << 20 // decompressed, all files together
+)
+
+// qtiNode is an element of a QTI document, with its raw content for the text of its mixed content
+type qtiNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+	Nodes   []qtiNode  `xml:",any"`
+}
+
+func (n *qtiNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the descendants of n for which match is true, in document order
+func (n *qtiNode) find(match func(*qtiNode) bool) []*qtiNode {
+	var found []*qtiNode
+	for i := range n.Nodes {
+		child := &n.Nodes[i]
+		if match(child) {
+			found = append(found, child)
+		}
+		found = append(found, child.find(match)...)
+	}
+	return found
+}
+
+func named(local string) func(*qtiNode) bool {
+	return func(n *qtiNode) bool { return n.XMLName.Local == local }
+}
+
+// qtiNonText are the elements of an item body which are not part of the question text
+var qtiNonText = []string{"choiceInteraction", "feedbackInline", "feedbackBlock", "modalFeedback", "rubricBlock", "templateInline", "templateBlock"}
+
+// qtiBlocks are the XHTML elements of item bodies which start a new line
+var qtiBlocks = []string{"p", "div", "br", "li", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "pre"}
+
+// qtiText returns the text of the content of a QTI element without the elements named skip
+func qtiText(inner string, skip ...string) string {
+	decoder := xml.NewDecoder(strings.NewReader("<text>" + inner + "</text>"))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	var (
+		b        strings.Builder
+		skipping int // depth within a skipped element
+	)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipping > 0 || slices.Contains(skip, t.Name.Local) {
+				skipping++
+			} else if slices.Contains(qtiBlocks, t.Name.Local) {
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if skipping > 0 {
+				skipping--
+			} else if slices.Contains(qtiBlocks, t.Name.Local) {
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if skipping == 0 {
+				b.WriteString(whitespace.ReplaceAllString(string(t), " "))
+			}
+		}
+	}
+	return plainText(b.String())
+}
+
+// parseQTI reads a QTI 2.1 assessment item, or the items of a content package (zip) in the order
+// of its assessment test
+func parseQTI(data []byte) (string, []item, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseQTIPackage(data)
+	}
+	var root qtiNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return "", nil, err
+	}
+	switch root.XMLName.Local {
+	case "assessmentItem":
+		return "", []item{qtiItem(&root)}, nil
+	case "assessmentTest":
+		return "", nil, errors.New("an assessment test refers to its items in other files, import the content package (zip)")
+	}
+	return "", nil, fmt.Errorf("expected an assessmentItem, found %s", root.XMLName.Local)
+}
+
+type qtiManifest struct {
+	Resources []struct {
+		Type string `xml:"type,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"resources>resource"`
+}
+
+func parseQTIPackage(data []byte) (string, []item, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(archive.File) > maxPackageFiles {
+		return "", nil, fmt.Errorf("the package has more than %d files", maxPackageFiles)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[path.Clean(f.Name)] = f
+	}
+	budget := int64(maxPackageSize)
+	read := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing from the package", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(io.LimitReader(rc, min(maxPackageFileSize, budget)+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) > min(maxPackageFileSize, budget) {
+			return nil, errPackageTooLarge
+		}
+		budget -= int64(len(content))
+		return content, nil
+	}
+
+	var (
+		title        string
+		hrefs        []string
+		fromManifest bool
+	)
+	if _, fromManifest = files["imsmanifest.xml"]; fromManifest {
+		content, err := read("imsmanifest.xml")
+		if err != nil {
+			return "", nil, err
+		}
+		var manifest qtiManifest
+		if err := xml.Unmarshal(content, &manifest); err != nil {
+			return "", nil, fmt.Errorf("imsmanifest.xml: %v", err)
+		}
+		for _, resource := range manifest.Resources {
+			if strings.HasPrefix(resource.Type, "imsqti_test_xmlv2p1") {
+				title, hrefs, err = qtiTest(read, packagePath("", resource.Href))
+				if err != nil {
+					return "", nil, err
+				}
+				break
+			}
+		}
+		if hrefs == nil {
+			for _, resource := range manifest.Resources {
+				if strings.HasPrefix(resource.Type, "imsqti_item_xmlv2p1") {
+					hrefs = append(hrefs, packagePath("", resource.Href))
+				}
+			}
+		}
+	} else {
+		// Without manifest, the XML files of the package in the order of their names
+		for name := range files {
+			if strings.EqualFold(path.Ext(name), ".xml") {
+				hrefs = append(hrefs, name)
+			}
+		}
+		slices.Sort(hrefs)
+	}
+
+	var items []item
+	for _, href := range hrefs {
+		content, err := read(href)
+		if errors.Is(err, errPackageTooLarge) {
+			return "", nil, err
+		}
+		var root qtiNode
+		if err == nil {
+			err = xml.Unmarshal(content, &root)
+		}
+		switch {
+		case err != nil:
+			items = append(items, item{title: href, unsupported: "the item could not be read: " + err.Error()})
+		case root.XMLName.Local == "assessmentItem":
+			items = append(items, qtiItem(&root))
+		case fromManifest:
+			items = append(items, item{title: href, unsupported: "the file is not an assessment item"})
+		}
+		// Without manifest, the other XML files of the package are not items
+	}
+	if len(items) == 0 {
+		return "", nil, errors.New("the package has no assessment item")
+	}
+	return title, items, nil
+}
+
+// qtiTest reads the title of an assessment test and the paths of its items, in their order
+func qtiTest(read func(string) ([]byte, error), name string) (string, []string, error) {
+	content, err := read(name)
+	if err != nil {
+		return "", nil, err
+	}
+	var root qtiNode
+	if err := xml.Unmarshal(content, &root); err != nil {
+		return "", nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var hrefs []string
+	for _, ref := range root.find(named("assessmentItemRef")) {
+		hrefs = append(hrefs, packagePath(path.Dir(name), ref.attr("href")))
+	}
+	return root.attr("title"), hrefs, nil
+}
+
+// packagePath resolves a relative URL of a file of a package
+func packagePath(dir, href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Clean(path.Join(dir, href))
+}
+
+// qtiItem converts an assessment item with a single choice interaction
+func qtiItem(root *qtiNode) item {
+	it := item{title: plainText(root.attr("title")), points: 1}
+	bodies := root.find(named("itemBody"))
+	if len(bodies) == 0 {
+		it.unsupported = "the item has no body"
+		return it
+	}
+	body := bodies[0]
+	if htmlMedia.MatchString(body.Inner) {
+		it.unsupported = mediaReason
+	}
+	interactions := body.find(func(n *qtiNode) bool { return strings.HasSuffix(n.XMLName.Local, "Interaction") })
+	switch {
+	case len(interactions) == 0:
+		it.text = qtiText(body.Inner, qtiNonText...)
+		it.unsupported = "the item has no interaction"
+		return it
+	case len(interactions) > 1:
+		it.unsupported = "items with several interactions are not supported"
+		return it
+	}
+	interaction := interactions[0]
+	// The text before the interaction, then its prompt
+	it.text = qtiText(body.Inner, append(qtiNonText, interaction.XMLName.Local)...)
+	if prompts := interaction.find(named("prompt")); len(prompts) > 0 {
+		it.text = strings.TrimSpace(it.text + "\n" + qtiText(prompts[0].Inner))
+	}
+	if interaction.XMLName.Local != "choiceInteraction" {
+		it.unsupported = interaction.XMLName.Local + " items are not supported"
+		return it
+	}
+	if maxChoices := interaction.attr("maxChoices"); maxChoices != "" && maxChoices != "1" {
+		it.unsupported = "questions with several correct options are not supported"
+		return it
+	}
+
+	var correct []string
+	responseID := interaction.attr("responseIdentifier")
+	for _, declaration := range root.find(named("responseDeclaration")) {
+		if declaration.attr("identifier") != responseID {
+			continue
+		}
+		if cardinality := declaration.attr("cardinality"); cardinality != "" && cardinality != "single" {
+			it.unsupported = "questions with several correct options are not supported"
+			return it
+		}
+		for _, response := range declaration.find(named("correctResponse")) {
+			for _, value := range response.find(named("value")) {
+				correct = append(correct, strings.TrimSpace(value.Inner))
+			}
+		}
+	}
+	for _, choice := range interaction.find(named("simpleChoice")) {
+		if slices.Contains(correct, choice.attr("identifier")) {
+			it.correct = append(it.correct, len(it.choices))
+		}
+		it.choices = append(it.choices, qtiText(choice.Inner, qtiNonText...))
+	}
+
+	for _, outcome := range root.find(named("outcomeDeclaration")) {
+		if outcome.attr("identifier") == "SCORE" {
+			if maximum, err := strconv.ParseFloat(outcome.attr("normalMaximum"), 64); err == nil {
+				it.points = maximum
+			}
+		}
+	}
+	return it
+}
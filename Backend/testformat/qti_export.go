@@ -0,0 +1,217 @@
+package testformat
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+const (
+	qtiNamespace      = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	qtiSchemaLocation = "http://www.imsglobal.org/xsd/imsqti_v2p1 http://www.imsglobal.org/xsd/qti/qtiv2p1/imsqti_v2p1.xsd"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	cpNamespace       = "http://www.imsglobal.org/xsd/imscp_v1p1"
+)
+
+// The elements of the exported packages, with what the export writes only
+
+type qtiRef struct {
+	Identifier string `xml:"identifier,attr,omitempty"`
+	Href       string `xml:"href,attr"`
+}
+
+type qtiDependency struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+type qtiResourceOut struct {
+	Identifier   string          `xml:"identifier,attr"`
+	Type         string          `xml:"type,attr"`
+	Href         string          `xml:"href,attr"`
+	File         qtiRef          `xml:"file"`
+	Dependencies []qtiDependency `xml:"dependency"`
+}
+
+type qtiManifestOut struct {
+	XMLName       xml.Name         `xml:"manifest"`
+	Xmlns         string           `xml:"xmlns,attr"`
+	Identifier    string           `xml:"identifier,attr"`
+	Schema        string           `xml:"metadata>schema"`
+	SchemaVersion string           `xml:"metadata>schemaversion"`
+	Organizations struct{}         `xml:"organizations"`
+	Resources     []qtiResourceOut `xml:"resources>resource"`
+}
+
+type qtiSection struct {
+	Identifier string   `xml:"identifier,attr"`
+	Title      string   `xml:"title,attr"`
+	Visible    bool     `xml:"visible,attr"`
+	ItemRefs   []qtiRef `xml:"assessmentItemRef"`
+}
+
+type qtiTestPart struct {
+	Identifier     string     `xml:"identifier,attr"`
+	NavigationMode string     `xml:"navigationMode,attr"`
+	SubmissionMode string     `xml:"submissionMode,attr"`
+	Section        qtiSection `xml:"assessmentSection"`
+}
+
+type qtiTestOut struct {
+	XMLName        xml.Name    `xml:"assessmentTest"`
+	Xmlns          string      `xml:"xmlns,attr"`
+	XmlnsXSI       string      `xml:"xmlns:xsi,attr"`
+	SchemaLocation string      `xml:"xsi:schemaLocation,attr"`
+	Identifier     string      `xml:"identifier,attr"`
+	Title          string      `xml:"title,attr"`
+	TestPart       qtiTestPart `xml:"testPart"`
+}
+
+type qtiResponseDeclaration struct {
+	Identifier  string `xml:"identifier,attr"`
+	Cardinality string `xml:"cardinality,attr"`
+	BaseType    string `xml:"baseType,attr"`
+	Correct     string `xml:"correctResponse>value"`
+}
+
+type qtiOutcomeDeclaration struct {
+	Identifier    string `xml:"identifier,attr"`
+	Cardinality   string `xml:"cardinality,attr"`
+	BaseType      string `xml:"baseType,attr"`
+	NormalMaximum int    `xml:"normalMaximum,attr"`
+	Default       string `xml:"defaultValue>value"`
+}
+
+type qtiChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	Text       string `xml:",chardata"`
+}
+
+type qtiInteraction struct {
+	ResponseIdentifier string      `xml:"responseIdentifier,attr"`
+	Shuffle            bool        `xml:"shuffle,attr"`
+	MaxChoices         int         `xml:"maxChoices,attr"`
+	Choices            []qtiChoice `xml:"simpleChoice"`
+}
+
+type qtiBaseValue struct {
+	BaseType string `xml:"baseType,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type qtiSetOutcome struct {
+	Identifier string       `xml:"identifier,attr"`
+	Value      qtiBaseValue `xml:"baseValue"`
+}
+
+type qtiVariable struct {
+	Identifier string `xml:"identifier,attr"`
+}
+
+// qtiScoring sets the score to the points of the question for the correct choice, to 0 otherwise
+type qtiScoring struct {
+	Variable qtiVariable   `xml:"responseCondition>responseIf>match>variable"`
+	Correct  qtiVariable   `xml:"responseCondition>responseIf>match>correct"`
+	IfSet    qtiSetOutcome `xml:"responseCondition>responseIf>setOutcomeValue"`
+	ElseSet  qtiSetOutcome `xml:"responseCondition>responseElse>setOutcomeValue"`
+}
+
+type qtiItemOut struct {
+	XMLName        xml.Name               `xml:"assessmentItem"`
+	Xmlns          string                 `xml:"xmlns,attr"`
+	XmlnsXSI       string                 `xml:"xmlns:xsi,attr"`
+	SchemaLocation string                 `xml:"xsi:schemaLocation,attr"`
+	Identifier     string                 `xml:"identifier,attr"`
+	Title          string                 `xml:"title,attr"`
+	Adaptive       bool                   `xml:"adaptive,attr"`
+	TimeDependent  bool                   `xml:"timeDependent,attr"`
+	Response       qtiResponseDeclaration `xml:"responseDeclaration"`
+	Score          qtiOutcomeDeclaration  `xml:"outcomeDeclaration"`
+	Paragraphs     []string               `xml:"itemBody>p"`
+	Interaction    qtiInteraction         `xml:"itemBody>choiceInteraction"`
+	Processing     qtiScoring             `xml:"responseProcessing"`
+}
+
+// exportQTI writes a test as a QTI 2.1 content package: its manifest, the assessment test and an
+// assessment item per question, scored with the points of the question
+func exportQTI(test *models.Test) ([]byte, error) {
+	manifest := qtiManifestOut{
+		Xmlns:         cpNamespace,
+		Identifier:    fmt.Sprintf("MANIFEST-TEST-%d", test.ID),
+		Schema:        "QTIv2.1 Package",
+		SchemaVersion: "1.0.0",
+	}
+	testResource := qtiResourceOut{Identifier: "TEST", Type: "imsqti_test_xmlv2p1", Href: "test.xml", File: qtiRef{Href: "test.xml"}}
+	assessment := qtiTestOut{
+		Xmlns:          qtiNamespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: qtiSchemaLocation,
+		Identifier:     fmt.Sprintf("TEST-%d", test.ID),
+		Title:          test.Title,
+		TestPart: qtiTestPart{
+			Identifier:     "PART-1",
+			NavigationMode: "nonlinear",
+			SubmissionMode: "simultaneous",
+			Section:        qtiSection{Identifier: "SECTION-1", Title: test.Title, Visible: true},
+		},
+	}
+
+	type entry struct {
+		name string
+		doc  any
+	}
+	var items []entry
+	for i, q := range test.Questions {
+		id := fmt.Sprintf("ITEM-%d", i+1)
+		href := fmt.Sprintf("items/item-%d.xml", i+1)
+		items = append(items, entry{href, qtiItemOf(q, id, fmt.Sprintf("Question %d", i+1))})
+		manifest.Resources = append(manifest.Resources, qtiResourceOut{Identifier: id, Type: "imsqti_item_xmlv2p1", Href: href, File: qtiRef{Href: href}})
+		testResource.Dependencies = append(testResource.Dependencies, qtiDependency{id})
+		assessment.TestPart.Section.ItemRefs = append(assessment.TestPart.Section.ItemRefs, qtiRef{Identifier: id, Href: href})
+	}
+	manifest.Resources = append([]qtiResourceOut{testResource}, manifest.Resources...)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, e := range append([]entry{{"imsmanifest.xml", manifest}, {"test.xml", assessment}}, items...) {
+		w, err := archive.Create(e.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeXML(w, e.doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// qtiItemOf returns the assessment item of a question, with a single choice interaction
+func qtiItemOf(q models.Question, id, title string) qtiItemOut {
+	it := qtiItemOut{
+		Xmlns:          qtiNamespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: qtiSchemaLocation,
+		Identifier:     id,
+		Title:          title,
+		Response:       qtiResponseDeclaration{Identifier: "RESPONSE", Cardinality: "single", BaseType: "identifier", Correct: q.CorrectAnswer},
+		Score:          qtiOutcomeDeclaration{Identifier: "SCORE", Cardinality: "single", BaseType: "float", NormalMaximum: q.Points, Default: "0"},
+		Paragraphs:     paragraphs(q.QuestionText),
+		Interaction:    qtiInteraction{ResponseIdentifier: "RESPONSE", MaxChoices: 1},
+		Processing: qtiScoring{
+			Variable: qtiVariable{"RESPONSE"},
+			Correct:  qtiVariable{"RESPONSE"},
+			IfSet:    qtiSetOutcome{"SCORE", qtiBaseValue{"float", strconv.Itoa(q.Points)}},
+			ElseSet:  qtiSetOutcome{"SCORE", qtiBaseValue{"float", "0"}},
+		},
+	}
+	for _, l := range optionLetters(q) {
+		it.Interaction.Choices = append(it.Interaction.Choices, qtiChoice{l, q.Options[l]})
+	}
+	return it
+}
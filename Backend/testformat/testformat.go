@@ -0,0 +1,211 @@
+// Package testformat converts teacher tests from the formats of other quiz systems (QTI 2.1,
+// Moodle XML, GIFT and Aiken), and exports them to QTI 2.1, Moodle XML and print-ready pages
+package testformat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+// Formats of the imported files
+const (
+	QTI       = "qti"    // IMS QTI 2.1 items, alone or in a content package (zip)
+	MoodleXML = "moodle" // Moodle XML question export
+	GIFT      = "gift"
+	Aiken     = "aiken"
+)
+
+// Formats are the formats tests are imported from
+var Formats = []string{QTI, MoodleXML, GIFT, Aiken}
+
+const (
+	maxChoices     = 4  // questions have the options A to D
+	maxPoints      = 10 // points of a question, as for the questions written by hand
+	maxTitleLength = 255
+	labelLength    = 60 // of the question text naming a skipped item without title
+)
+
+var (
+	ErrUnknownFormat = errors.New("unrecognised file format, choose one of qti, moodle, gift or aiken")
+	ErrInvalidFile   = errors.New("the file could not be read")
+)
+
+// Import is the content of an imported file
+type Import struct {
+	Format    string
+	Title     string            // of the test, empty if the file has none
+	Questions []models.Question // without question type, which the file does not know
+	Skipped   []models.ImportIssue
+}
+
+// item is a question of an imported file before it is converted
+type item struct {
+	title       string
+	text        string
+	choices     []string
+	correct     []int   // indexes of the correct choices
+	points      float64 // 0 when the file gives none
+	unsupported string  // why the item cannot be converted, e.g. its question type
+}
+
+// Parse reads the questions of a file in a format, or in the format detected from its name and content
+// when format is empty. The items which are not single answer multiple choice questions with 2 to 4
+// options are reported in Skipped
+func Parse(format, filename string, data []byte) (*Import, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		format = Detect(filename, data)
+	}
+	var (
+		title string
+		items []item
+		err   error
+	)
+	switch format {
+	case QTI:
+		title, items, err = parseQTI(data)
+	case MoodleXML:
+		title, items, err = parseMoodle(data)
+	case GIFT:
+		items = parseGIFT(string(data))
+	case Aiken:
+		items = parseAiken(string(data))
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w as %s: %v", ErrInvalidFile, format, err)
+	}
+
+	imported := &Import{Format: format, Title: truncate(strings.TrimSpace(title), maxTitleLength)}
+	for i, it := range items {
+		q, reason := it.question()
+		if reason != "" {
+			imported.Skipped = append(imported.Skipped, models.ImportIssue{Item: i + 1, Title: it.label(), Reason: reason})
+			continue
+		}
+		q.OrderIndex = len(imported.Questions)
+		imported.Questions = append(imported.Questions, q)
+	}
+	return imported, nil
+}
+
+var aikenAnswerLine = regexp.MustCompile(`(?m)^\s*ANSWER:\s*[A-Z]\s*$`)
+
+// Detect guesses the format of a file from its extension and content, empty if unknown
+func Detect(filename string, data []byte) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".zip", ".imscc":
+		return QTI
+	case ".gift":
+		return GIFT
+	}
+	head := data[:min(len(data), 4096)]
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return QTI
+	case bytes.Contains(head, []byte("<quiz")):
+		return MoodleXML
+	case bytes.Contains(head, []byte("assessmentItem")), bytes.Contains(head, []byte("assessmentTest")):
+		return QTI
+	case aikenAnswerLine.Match(data):
+		return Aiken
+	case bytes.ContainsRune(data, '{'):
+		return GIFT
+	}
+	return ""
+}
+
+// question converts an item, or tells why it cannot be
+func (it item) question() (models.Question, string) {
+	switch {
+	case it.unsupported != "":
+		return models.Question{}, it.unsupported
+	case it.text == "":
+		return models.Question{}, "the question has no text"
+	case len(it.choices) < 2:
+		return models.Question{}, "the question has fewer than 2 options"
+	case len(it.choices) > maxChoices:
+		return models.Question{}, fmt.Sprintf("the question has %d options, at most %d are supported", len(it.choices), maxChoices)
+	case len(it.correct) == 0:
+		return models.Question{}, "the question has no correct option"
+	case len(it.correct) > 1:
+		return models.Question{}, "questions with several correct options are not supported"
+	}
+	options := make(map[string]string, len(it.choices))
+	for i, choice := range it.choices {
+		if choice == "" {
+			return models.Question{}, fmt.Sprintf("option %s is empty", letter(i))
+		}
+		options[letter(i)] = choice
+	}
+	points := int(math.Round(it.points))
+	if points < 1 {
+		points = 1
+	}
+	return models.Question{
+		QuestionText:  it.text,
+		Options:       options,
+		CorrectAnswer: letter(it.correct[0]),
+		Points:        min(points, maxPoints),
+	}, ""
+}
+
+// label names an item in the import report
+func (it item) label() string {
+	if it.title != "" {
+		return it.title
+	}
+	return truncate(strings.ReplaceAll(it.text, "\n", " "), labelLength)
+}
+
+func letter(i int) string {
+	return string(rune('A' + i))
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6]|tr|blockquote)>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+	htmlMedia  = regexp.MustCompile(`(?i)<(img|audio|video|object|embed|iframe|math)\b`)
+	blanks     = regexp.MustCompile(`[ \t\x{00a0}]+`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// mediaReason is why items with images, audio or formulas are skipped: their text alone would be misleading
+const mediaReason = "questions with images, audio or formulas are not supported"
+
+// htmlText returns the text of an HTML fragment, a line per paragraph
+func htmlText(s string) string {
+	s = whitespace.ReplaceAllString(s, " ")
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	return plainText(html.UnescapeString(s))
+}
+
+// plainText trims each line of a text, collapses its blanks and drops its empty lines
+func plainText(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(blanks.ReplaceAllString(line, " ")); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.ToValidUTF8(strings.Join(kept, "\n"), "")
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
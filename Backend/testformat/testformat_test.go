@@ -0,0 +1,350 @@
+package testformat
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/panosmaurikos/personalisedenglish/backend/models"
+)
+
+const (
+	reasonOptions = "the question has 5 options, at most 4 are supported"
+	reasonSeveral = "questions with several correct options are not supported"
+)
+
+// skipped lists the reasons of the skipped items of an import, in their order
+func skipped(imported *Import) []string {
+	var reasons []string
+	for _, issue := range imported.Skipped {
+		reasons = append(reasons, issue.Reason)
+	}
+	return reasons
+}
+
+// checkImport compares the questions and the skipped items of an import with the expected ones
+func checkImport(t *testing.T, imported *Import, format string, want []models.Question, wantSkipped []string) {
+	t.Helper()
+	if imported.Format != format {
+		t.Errorf("Format = %q, want %q", imported.Format, format)
+	}
+	if len(imported.Questions) != len(want) {
+		t.Fatalf("got %d questions, want %d: %+v", len(imported.Questions), len(want), imported.Questions)
+	}
+	for i, q := range imported.Questions {
+		w := want[i]
+		if q.QuestionText != w.QuestionText || q.CorrectAnswer != w.CorrectAnswer || q.Points != w.Points || q.OrderIndex != i {
+			t.Errorf("question %d = %q, answer %s, %d points, order %d; want %q, answer %s, %d points, order %d",
+				i, q.QuestionText, q.CorrectAnswer, q.Points, q.OrderIndex, w.QuestionText, w.CorrectAnswer, w.Points, i)
+		}
+		if fmt.Sprint(q.Options) != fmt.Sprint(w.Options) {
+			t.Errorf("question %d options = %v, want %v", i, q.Options, w.Options)
+		}
+	}
+	if got := skipped(imported); !slices.Equal(got, wantSkipped) {
+		t.Errorf("skipped = %q, want %q", got, wantSkipped)
+	}
+}
+
+const giftFixture = `// Unit 3
+$CATEGORY: Grammar
+
+::Past::She {=went ~goes ~going} to school yesterday.
+
+::Five::Pick a colour {=red ~blue ~green ~yellow ~black}
+
+::Several::Which are fruits? {~%50%apple ~%50%pear ~carrot}
+
+::Picture::[html]<p>What is this?</p><img src\="cat.png"> {=a cat ~a dog}
+
+::Truth::The sun is a star {T}
+`
+
+func TestParseGIFT(t *testing.T) {
+	imported, err := Parse("", "unit3.gift", []byte(giftFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImport(t, imported, GIFT, []models.Question{
+		{QuestionText: "She _____ to school yesterday.", Options: map[string]string{"A": "went", "B": "goes", "C": "going"}, CorrectAnswer: "A", Points: 1},
+		{QuestionText: "The sun is a star", Options: map[string]string{"A": "True", "B": "False"}, CorrectAnswer: "A", Points: 1},
+	}, []string{reasonOptions, reasonSeveral, mediaReason})
+	if imported.Skipped[0].Item != 2 || imported.Skipped[0].Title != "Five" {
+		t.Errorf("first skipped item = %+v, want item 2 named Five", imported.Skipped[0])
+	}
+}
+
+const aikenFixture = `What is the plural of child?
+A. childs
+B. children
+C. childes
+ANSWER: B
+
+Pick a number
+A) one
+B) two
+C) three
+D) four
+E) five
+ANSWER: A
+
+Which word is a verb?
+A. run
+B. table
+ANSWER: C
+`
+
+func TestParseAiken(t *testing.T) {
+	imported, err := Parse("", "quiz.txt", []byte(aikenFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Aiken has one answer per question and no markup, so neither several answers nor media
+	checkImport(t, imported, Aiken, []models.Question{
+		{QuestionText: "What is the plural of child?", Options: map[string]string{"A": "childs", "B": "children", "C": "childes"}, CorrectAnswer: "B", Points: 1},
+	}, []string{reasonOptions, "the answer C is not one of the options"})
+}
+
+const moodleFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<quiz>
+  <question type="category"><category><text>$course$/Grammar//Vocabulary</text></category></question>
+  <question type="multichoice">
+    <name><text>Opposite</text></name>
+    <questiontext format="html"><text><![CDATA[<p>The opposite of <b>hot</b> is</p>]]></text></questiontext>
+    <defaultgrade>2</defaultgrade>
+    <single>true</single>
+    <answer fraction="0"><text>warm</text></answer>
+    <answer fraction="100"><text>cold</text></answer>
+  </question>
+  <question type="multichoice">
+    <name><text>Five</text></name>
+    <questiontext format="plain_text"><text>Pick one</text></questiontext>
+    <answer fraction="100"><text>a</text></answer>
+    <answer fraction="0"><text>b</text></answer>
+    <answer fraction="0"><text>c</text></answer>
+    <answer fraction="0"><text>d</text></answer>
+    <answer fraction="0"><text>e</text></answer>
+  </question>
+  <question type="multichoice">
+    <name><text>Several</text></name>
+    <questiontext format="plain_text"><text>Which are animals?</text></questiontext>
+    <single>false</single>
+    <answer fraction="50"><text>cat</text></answer>
+    <answer fraction="50"><text>dog</text></answer>
+    <answer fraction="-100"><text>tree</text></answer>
+  </question>
+  <question type="multichoice">
+    <name><text>Picture</text></name>
+    <questiontext format="html"><text><![CDATA[<p>What is this? <img src="@@PLUGINFILE@@/cat.png"></p>]]></text></questiontext>
+    <answer fraction="100"><text>a cat</text></answer>
+    <answer fraction="0"><text>a dog</text></answer>
+  </question>
+  <question type="truefalse">
+    <name><text>Truth</text></name>
+    <questiontext format="plain_text"><text>Water boils at 100 °C</text></questiontext>
+    <answer fraction="100"><text>true</text></answer>
+    <answer fraction="0"><text>false</text></answer>
+  </question>
+  <question type="essay">
+    <name><text>Essay</text></name>
+    <questiontext format="plain_text"><text>Describe your town</text></questiontext>
+  </question>
+</quiz>
+`
+
+func TestParseMoodle(t *testing.T) {
+	imported, err := Parse("", "questions.xml", []byte(moodleFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImport(t, imported, MoodleXML, []models.Question{
+		{QuestionText: "The opposite of hot is", Options: map[string]string{"A": "warm", "B": "cold"}, CorrectAnswer: "B", Points: 2},
+		{QuestionText: "Water boils at 100 °C", Options: map[string]string{"A": "True", "B": "False"}, CorrectAnswer: "A", Points: 1},
+	}, []string{reasonOptions, reasonSeveral, mediaReason, "essay questions are not supported"})
+	if imported.Title != "Grammar/Vocabulary" {
+		t.Errorf("Title = %q, want the category Grammar/Vocabulary", imported.Title)
+	}
+}
+
+// qtiItemXML writes an assessment item with a choice interaction
+func qtiItemXML(title, body, cardinality string, correct []string, choices ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="%s" title="%s">
+  <responseDeclaration identifier="RESPONSE" cardinality="%s" baseType="identifier"><correctResponse>`, title, title, cardinality)
+	for _, c := range correct {
+		fmt.Fprintf(&b, "<value>%s</value>", c)
+	}
+	fmt.Fprintf(&b, `</correctResponse></responseDeclaration>
+  <outcomeDeclaration identifier="SCORE" cardinality="single" baseType="float" normalMaximum="3"/>
+  <itemBody>%s<choiceInteraction responseIdentifier="RESPONSE" shuffle="false" maxChoices="%d">`, body, len(correct))
+	for i, choice := range choices {
+		fmt.Fprintf(&b, `<simpleChoice identifier="%s">%s</simpleChoice>`, letter(i), choice)
+	}
+	b.WriteString("</choiceInteraction></itemBody>\n</assessmentItem>\n")
+	return b.String()
+}
+
+// zipFiles writes a zip archive of files, in the order of the names
+func zipFiles(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseQTI(t *testing.T) {
+	item := qtiItemXML("Plural", "<p>The plural of mouse is</p>", "single", []string{"B"}, "mouses", "mice", "mousen")
+	imported, err := Parse("", "plural.xml", []byte(item))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plural := models.Question{QuestionText: "The plural of mouse is", Options: map[string]string{"A": "mouses", "B": "mice", "C": "mousen"}, CorrectAnswer: "B", Points: 3}
+	checkImport(t, imported, QTI, []models.Question{plural}, nil)
+
+	manifest := `<?xml version="1.0" encoding="UTF-8"?>
+<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1"><resources>
+  <resource identifier="test" type="imsqti_test_xmlv2p1" href="tests/unit.xml"/>
+</resources></manifest>`
+	test := `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentTest xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="unit" title="Unit 4">
+  <testPart identifier="part" navigationMode="linear" submissionMode="individual"><assessmentSection identifier="s" title="s" visible="true">
+    <assessmentItemRef identifier="i1" href="../items/plural.xml"/>
+    <assessmentItemRef identifier="i2" href="../items/five.xml"/>
+    <assessmentItemRef identifier="i3" href="../items/several.xml"/>
+    <assessmentItemRef identifier="i4" href="../items/picture.xml"/>
+    <assessmentItemRef identifier="i5" href="../items/missing.xml"/>
+  </assessmentSection></testPart>
+</assessmentTest>`
+	pkg := zipFiles(t, map[string][]byte{
+		"imsmanifest.xml":    []byte(manifest),
+		"tests/unit.xml":     []byte(test),
+		"items/plural.xml":   []byte(item),
+		"items/five.xml":     []byte(qtiItemXML("Five", "<p>Pick one</p>", "single", []string{"A"}, "a", "b", "c", "d", "e")),
+		"items/several.xml":  []byte(qtiItemXML("Several", "<p>Which are animals?</p>", "multiple", []string{"A", "B"}, "cat", "dog", "tree")),
+		"items/picture.xml":  []byte(qtiItemXML("Picture", `<p>What is this?</p><p><img src="cat.png" alt=""/></p>`, "single", []string{"A"}, "a cat", "a dog")),
+		"items/unrelated.md": []byte("not part of the test"),
+	})
+	imported, err = Parse("", "unit4.zip", pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImport(t, imported, QTI, []models.Question{plural},
+		[]string{reasonOptions, reasonSeveral, mediaReason, "the item could not be read: items/missing.xml is missing from the package"})
+	if imported.Title != "Unit 4" {
+		t.Errorf("Title = %q, want the title of the assessment test", imported.Title)
+	}
+}
+
+func TestParseQTIPackageLimits(t *testing.T) {
+	item := []byte(qtiItemXML("Plural", "<p>The plural of mouse is</p>", "single", []string{"B"}, "mouses", "mice"))
+
+	many := make(map[string][]byte, maxPackageFiles+1)
+	for i := range maxPackageFiles + 1 {
+		many[fmt.Sprintf("items/%04d.xml", i)] = item
+	}
+	within := make(map[string][]byte, maxPackageFiles)
+	for i := range maxPackageFiles {
+		within[fmt.Sprintf("items/%04d.xml", i)] = item
+	}
+	// Zeros compress well: the archives stay small while their content is not
+	padded := append(slices.Clone(item), make([]byte, maxPackageFileSize)...)
+	large := map[string][]byte{"items/a.xml": item, "items/b.xml": padded}
+	total := map[string][]byte{}
+	for i := range maxPackageSize/maxPackageFileSize + 1 {
+		total[fmt.Sprintf("items/%02d.xml", i)] = append(slices.Clone(item), make([]byte, maxPackageFileSize-len(item))...)
+	}
+
+	tests := []struct {
+		name      string
+		files     map[string][]byte
+		wantError string
+	}{
+		{"as many files as allowed", within, ""},
+		{"too many files", many, fmt.Sprintf("the package has more than %d files", maxPackageFiles)},
+		{"file too large", large, errPackageTooLarge.Error()},
+		{"package too large", total, errPackageTooLarge.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imported, err := Parse(QTI, "package.zip", zipFiles(t, tt.files))
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(imported.Questions) != len(tt.files) {
+					t.Errorf("got %d questions, want %d", len(imported.Questions), len(tt.files))
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidFile) || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Parse = %v, want ErrInvalidFile for %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	pkg := zipFiles(t, map[string][]byte{"item.xml": []byte("<assessmentItem/>")})
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     string
+	}{
+		{"zip extension", "unit.zip", "", QTI},
+		{"common cartridge", "course.IMSCC", "", QTI},
+		{"gift extension", "unit.gift", "no braces", GIFT},
+		{"zip content", "upload.bin", string(pkg), QTI},
+		{"moodle xml", "questions.xml", moodleFixture, MoodleXML},
+		{"qti item", "item.xml", qtiItemXML("Item", "", "single", []string{"A"}, "yes", "no"), QTI},
+		{"qti test", "test.xml", `<assessmentTest identifier="t"/>`, QTI},
+		{"aiken", "quiz.txt", aikenFixture, Aiken},
+		{"gift content", "quiz.txt", giftFixture, GIFT},
+		{"unknown", "notes.txt", "Just some notes", ""},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.filename, []byte(tt.data)); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("", "notes.txt", []byte("Just some notes")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Parse of an unknown format = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse("word", "quiz.docx", nil); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Parse(word) = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse(MoodleXML, "questions.xml", []byte("<quiz><question>")); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("Parse of truncated XML = %v, want ErrInvalidFile", err)
+	}
+	if _, err := Parse(QTI, "test.xml", []byte(`<assessmentTest identifier="t"/>`)); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("Parse of an assessment test alone = %v, want ErrInvalidFile", err)
+	}
+}
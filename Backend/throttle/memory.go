@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the failure records in memory
+// It suits a single server instance; records are lost on restart
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+	window time.Duration // records idle for longer are swept
+	swept  time.Time
+}
+
+// NewMemoryStore creates a MemoryStore sweeping records idle for longer than window
+func NewMemoryStore(window time.Duration) *MemoryStore {
+	return &MemoryStore{states: map[string]State{}, window: window}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[key], nil
+}
+
+func (m *MemoryStore) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recordFailure(key, now, windowStart), nil
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, now, windowStart time.Time, allow func(State) bool) (State, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state := m.states[key]; !allow(state) {
+		return state, false, nil
+	}
+	m.recordFailure(key, now, windowStart)
+	return m.states[key], true, nil
+}
+
+func (m *MemoryStore) Forgive(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state, ok := m.states[key]; ok && state.Failures > 0 {
+		state.Failures--
+		m.states[key] = state
+	}
+	return nil
+}
+
+// recordFailure counts a failure of a key; m.mu must be held
+func (m *MemoryStore) recordFailure(key string, now, windowStart time.Time) int {
+	m.sweep(now)
+	state := m.states[key]
+	if state.LastFailure.Before(windowStart) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailure = now
+	m.states[key] = state
+	return state.Failures
+}
+
+func (m *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.states[key]
+	state.LockedUntil = until
+	m.states[key] = state
+	return nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+	return nil
+}
+
+// sweep drops the records neither failed nor locked recently, at most once per window
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.swept) < m.window {
+		return
+	}
+	m.swept = now
+	for key, state := range m.states {
+		if now.Sub(state.LastFailure) > m.window && now.After(state.LockedUntil) {
+			delete(m.states, key)
+		}
+	}
+}
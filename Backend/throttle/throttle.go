@@ -0,0 +1,114 @@
+// Package throttle slows down repeated events (failed logins, emails sent) and locks keys out
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// State is the failure record of a key
+type State struct {
+	Failures    int       // consecutive failures within the window
+	LastFailure time.Time // zero if none
+	LockedUntil time.Time // zero if not locked
+}
+
+// Store keeps the failure records; implementations must be safe for concurrent use
+type Store interface {
+	// Get returns the record of a key (the zero State if there is none)
+	Get(ctx context.Context, key string) (State, error)
+	// RecordFailure counts a failure at now and returns the number of failures of the key
+	// Failures older than windowStart are forgotten first
+	RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error)
+	// Take calls allow with the record of a key and, if it returns true, counts a failure at now as
+	// RecordFailure does, in one atomic step; it returns the record after the count, or the refused one
+	Take(ctx context.Context, key string, now, windowStart time.Time, allow func(State) bool) (State, bool, error)
+	// Forgive removes a failure counted by Take, for an attempt which did not fail after all
+	Forgive(ctx context.Context, key string) error
+	// Lock locks a key out until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the record of a key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy defines how fast a key is slowed down and when it is locked out
+type Policy struct {
+	FreeFailures    int           // failures allowed before any delay
+	BaseDelay       time.Duration // delay after the first failure beyond the free ones, doubled on each failure
+	MaxDelay        time.Duration
+	LockoutFailures int // failures after which the key is locked out
+	LockoutDuration time.Duration
+	Window          time.Duration // failures older than this are forgotten
+}
+
+// Delay returns the time to wait after the last failure before the next attempt
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.FreeFailures {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeFailures + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Decision is the outcome of checking a key before an attempt
+type Decision struct {
+	Allowed    bool
+	Locked     bool          // the key is locked out (rather than slowed down)
+	RetryAfter time.Duration // when not allowed
+}
+
+// Check tells whether an attempt on a key with the given record is allowed at now
+func (p Policy) Check(state State, now time.Time) Decision {
+	if now.Before(state.LockedUntil) {
+		return Decision{Locked: true, RetryAfter: state.LockedUntil.Sub(now)}
+	}
+	if state.Failures == 0 || now.Sub(state.LastFailure) > p.Window {
+		return Decision{Allowed: true}
+	}
+	next := state.LastFailure.Add(p.Delay(state.Failures))
+	if now.Before(next) {
+		return Decision{RetryAfter: next.Sub(now)}
+	}
+	return Decision{Allowed: true}
+}
+
+// Fail records a failure of a key and locks it out once it reaches the lockout threshold
+// It returns true when the key has just been locked
+func (p Policy) Fail(ctx context.Context, store Store, key string, now time.Time) (bool, error) {
+	failures, err := store.RecordFailure(ctx, key, now, now.Add(-p.Window))
+	if err != nil {
+		return false, err
+	}
+	return p.Lockout(ctx, store, key, failures, now)
+}
+
+// Take checks an attempt on a key and, when it is allowed, counts it as a failure in the same step,
+// so that concurrent attempts are delayed by each other rather than all checked against the record
+// before any of them failed. An attempt which then succeeds is given back with Forgive or Reset
+// It returns the decision and the failures of the key, the attempt included
+func (p Policy) Take(ctx context.Context, store Store, key string, now time.Time) (Decision, int, error) {
+	var decision Decision
+	state, _, err := store.Take(ctx, key, now, now.Add(-p.Window), func(state State) bool {
+		decision = p.Check(state, now)
+		return decision.Allowed
+	})
+	if err != nil {
+		return Decision{}, 0, err
+	}
+	return decision, state.Failures, nil
+}
+
+// Lockout locks a key out when its failures reach the lockout threshold
+// It returns true when the key has just been locked
+func (p Policy) Lockout(ctx context.Context, store Store, key string, failures int, now time.Time) (bool, error) {
+	if p.LockoutFailures <= 0 || failures < p.LockoutFailures {
+		return false, nil
+	}
+	return true, store.Lock(ctx, key, now.Add(p.LockoutDuration))
+}
@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutFailures: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// A burst of concurrent attempts gets the free failures only, not one check each against an empty record
+func TestTakeConcurrentBurst(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	now := time.Now()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, _, err := testPolicy.Take(context.Background(), store, "user:1", now)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if d.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != testPolicy.FreeFailures+1 {
+		t.Errorf("%d attempts allowed, want %d", allowed, testPolicy.FreeFailures+1)
+	}
+}
+
+func TestTakeForgiveAndLockout(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Hour)
+	now := time.Now()
+
+	// Attempts which did not fail are given back
+	for range 5 {
+		if d, _, _ := testPolicy.Take(ctx, store, "k", now); !d.Allowed {
+			t.Fatal("attempt refused after forgiven ones")
+		}
+		if err := store.Forgive(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var failures int
+	for i := range testPolicy.LockoutFailures {
+		d, n, err := testPolicy.Take(ctx, store, "k", now.Add(time.Duration(i)*time.Hour/20))
+		if err != nil || !d.Allowed {
+			t.Fatalf("attempt %d refused: %+v %v", i+1, d, err)
+		}
+		failures = n
+	}
+	locked, err := testPolicy.Lockout(ctx, store, "k", failures, now)
+	if err != nil || !locked {
+		t.Fatalf("not locked after %d failures", failures)
+	}
+	if d, _, _ := testPolicy.Take(ctx, store, "k", now.Add(time.Minute)); !d.Locked {
+		t.Errorf("attempt allowed on a locked key: %+v", d)
+	}
+}
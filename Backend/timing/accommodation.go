@@ -0,0 +1,35 @@
+package timing
+
+import "math"
+
+// Accommodation is the extra time a student is entitled to
+type Accommodation struct {
+	Multiplier float64 // time multiplier (>= 1)
+	Untimed    bool    // no time limit and time is not taken into account
+}
+
+// multiplier returns the multiplier, ignoring values which would reduce the time
+func (a Accommodation) multiplier() float64 {
+	if a.Multiplier < 1 || math.IsNaN(a.Multiplier) {
+		return 1
+	}
+	return a.Multiplier
+}
+
+// TimeLimit returns the time limit in seconds granted for a limit of the given seconds
+// timed is false if the student has no time limit
+func (a Accommodation) TimeLimit(seconds int) (limit int, timed bool) {
+	if a.Untimed {
+		return 0, false
+	}
+	return int(math.Ceil(float64(seconds) * a.multiplier())), true
+}
+
+// SpeedRatio converts the speed ratio of a student to the pace they are entitled to
+// An untimed student is always at the expected pace
+func (a Accommodation) SpeedRatio(ratio float64) float64 {
+	if a.Untimed {
+		return 1
+	}
+	return ratio / a.multiplier()
+}
@@ -0,0 +1,200 @@
+package timing
+
+import "math"
+
+// ReferenceSeconds is the response time of a typical question
+// It is the centre of the normal set of the original engine and is used when there is no answer log
+const ReferenceSeconds = 8.0
+
+const (
+	minTypeObservations = 20 // below, a question type uses the pooled coefficients
+	minGroupOutliers    = 5  // below, outliers are not searched for in a group
+	priorWeight         = 10 // weight (in answers) of the model prediction against a question's own answers
+	ridge               = 1e-3
+)
+
+// Question holds the features which explain the response time of a question
+type Question struct {
+	ID         int
+	Type       string
+	Length     int // length of the question text in characters
+	Difficulty int
+}
+
+// Observation is a response time from the answer log
+type Observation struct {
+	Question
+	Seconds float64
+}
+
+// coefficients of log(seconds) = c0 + c1*log(1+length) + c2*difficulty
+type coefficients [3]float64
+
+func (c coefficients) predict(q Question) float64 {
+	x := features(q)
+	return c[0]*x[0] + c[1]*x[1] + c[2]*x[2]
+}
+
+func features(q Question) [3]float64 {
+	return [3]float64{1, math.Log1p(float64(q.Length)), float64(q.Difficulty)}
+}
+
+// Model gives the expected response time of questions
+// Expected times are fitted on the log of the response times, once outliers are discarded
+type Model struct {
+	pooled    *coefficients
+	types     map[string]coefficients
+	questions map[int]float64 // expected log seconds of the questions found in the log
+	kept      int
+	discarded int
+}
+
+// Fit builds a model from the answer log
+func Fit(observations []Observation) *Model {
+	m := &Model{types: map[string]coefficients{}, questions: map[int]float64{}}
+
+	// Discard the outliers of each question type on the log scale (times are skewed)
+	byType := map[string][]Observation{}
+	for _, o := range observations {
+		if o.Seconds <= 0 || math.IsNaN(o.Seconds) || math.IsInf(o.Seconds, 0) {
+			m.discarded++
+			continue
+		}
+		byType[o.Type] = append(byType[o.Type], o)
+	}
+	var clean []Observation
+	cleanByType := map[string][]Observation{}
+	for t, group := range byType {
+		kept := group
+		if len(group) >= minGroupOutliers {
+			logs := make([]float64, len(group))
+			for i, o := range group {
+				logs[i] = math.Log(o.Seconds)
+			}
+			idx := Inliers(logs)
+			kept = make([]Observation, len(idx))
+			for i, j := range idx {
+				kept[i] = group[j]
+			}
+		}
+		m.discarded += len(group) - len(kept)
+		cleanByType[t] = kept
+		clean = append(clean, kept...)
+	}
+	m.kept = len(clean)
+	if len(clean) == 0 {
+		return m
+	}
+
+	pooled := fit(clean)
+	m.pooled = &pooled
+	for t, group := range cleanByType {
+		if len(group) >= minTypeObservations {
+			m.types[t] = fit(group)
+		}
+	}
+
+	// Questions with their own answers are pulled towards their median,
+	// proportionally to the number of answers
+	byQuestion := map[int][]float64{}
+	questions := map[int]Question{}
+	for _, o := range clean {
+		byQuestion[o.ID] = append(byQuestion[o.ID], math.Log(o.Seconds))
+		questions[o.ID] = o.Question
+	}
+	for qid, logs := range byQuestion {
+		n := float64(len(logs))
+		prediction := m.predictLog(questions[qid])
+		m.questions[qid] = (n*Median(logs) + priorWeight*prediction) / (n + priorWeight)
+	}
+	return m
+}
+
+// predictLog returns the expected log seconds from the question features only
+func (m *Model) predictLog(q Question) float64 {
+	if c, ok := m.types[q.Type]; ok {
+		return c.predict(q)
+	}
+	if m.pooled != nil {
+		return m.pooled.predict(q)
+	}
+	return math.Log(ReferenceSeconds)
+}
+
+// Expected returns the expected response time of a question in seconds
+func (m *Model) Expected(q Question) float64 {
+	if v, ok := m.questions[q.ID]; ok {
+		return math.Exp(v)
+	}
+	return math.Exp(m.predictLog(q))
+}
+
+// Kept returns the number of observations the model was fitted on
+func (m *Model) Kept() int {
+	return m.kept
+}
+
+// Discarded returns the number of observations discarded as outliers or invalid
+func (m *Model) Discarded() int {
+	return m.discarded
+}
+
+// fit solves the ridge regularised least squares of log(seconds) on the question features
+func fit(observations []Observation) coefficients {
+	var a [3][3]float64
+	var b [3]float64
+	logs := make([]float64, len(observations))
+	for i, o := range observations {
+		x := features(o.Question)
+		y := math.Log(o.Seconds)
+		logs[i] = y
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				a[r][c] += x[r] * x[c]
+			}
+			b[r] += x[r] * y
+		}
+	}
+	// The intercept is not regularised
+	for r := 1; r < 3; r++ {
+		a[r][r] += ridge * float64(len(observations))
+	}
+	c, ok := solve3(a, b)
+	if !ok {
+		return coefficients{Median(logs), 0, 0}
+	}
+	return c
+}
+
+// solve3 solves a 3x3 linear system with gaussian elimination and partial pivoting
+func solve3(a [3][3]float64, b [3]float64) (coefficients, bool) {
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for r := col + 1; r < 3; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return coefficients{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < 3; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < 3; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	var x coefficients
+	for r := 2; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < 3; c++ {
+			sum -= a[r][c] * x[c]
+		}
+		x[r] = sum / a[r][r]
+	}
+	return x, true
+}
@@ -0,0 +1,40 @@
+package timing
+
+import "math"
+
+// Answer is a timed answer of a student
+type Answer struct {
+	Question Question
+	Seconds  float64
+}
+
+// SpeedRatio returns how slow a student answered compared with the expected times
+// 1 is the expected pace, 2 twice as slow, 0.5 twice as fast
+// It is the geometric mean of the per answer ratios, once the outliers of the
+// student (e.g. the tab left open on one question) are discarded
+// used is the number of answers taken into account (0 if no answer is timed)
+func (m *Model) SpeedRatio(answers []Answer) (ratio float64, used int) {
+	logs := make([]float64, 0, len(answers))
+	for _, a := range answers {
+		if a.Seconds <= 0 || math.IsNaN(a.Seconds) || math.IsInf(a.Seconds, 0) {
+			continue
+		}
+		logs = append(logs, math.Log(a.Seconds/m.Expected(a.Question)))
+	}
+	if len(logs) == 0 {
+		return 0, 0
+	}
+
+	idx := Inliers(logs)
+	var sum float64
+	for _, i := range idx {
+		sum += logs[i]
+	}
+	return math.Exp(sum / float64(len(idx))), len(idx)
+}
+
+// ReferenceRatio converts a raw average response time into a speed ratio
+// It is used for results recorded without their answers
+func ReferenceRatio(avgSeconds float64) float64 {
+	return avgSeconds / ReferenceSeconds
+}
@@ -0,0 +1,51 @@
+package timing
+
+import (
+	"math"
+	"sort"
+)
+
+// OutlierThreshold is the modified z-score above which a response time is discarded
+// 3.5 is the usual cut-off of Iglewicz and Hoaglin
+const OutlierThreshold = 3.5
+
+// madScale makes the MAD a consistent estimator of the standard deviation of normal data
+const madScale = 1.4826
+
+// Median returns the median of values (0 if empty)
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// MAD returns the median absolute deviation around the median
+func MAD(values []float64) float64 {
+	med := Median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	return Median(deviations)
+}
+
+// Inliers returns the indexes of the values whose modified z-score is below OutlierThreshold
+// All values are kept when the MAD is zero (more than half of the values are equal)
+func Inliers(values []float64) []int {
+	med := Median(values)
+	spread := madScale * MAD(values)
+	kept := make([]int, 0, len(values))
+	for i, v := range values {
+		if spread == 0 || math.Abs(v-med)/spread <= OutlierThreshold {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,188 @@
+// Package webhooks signs and delivers the webhook requests sent to the systems of the schools,
+// and verifies their signatures on the receiving side
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers of the webhook requests
+const (
+	SignatureHeader = "X-Webhook-Signature" // t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+	EventHeader     = "X-Webhook-Event"     // the type of the event
+	DeliveryHeader  = "X-Webhook-Id"        // the id of the event, the same on every attempt and redelivery
+)
+
+const (
+	requestTimeout  = 10 * time.Second
+	maxResponseBody = 1024 // bytes of the response kept in the delivery log
+)
+
+var (
+	ErrInvalidURL       = errors.New("webhook URL must be an absolute http(s) URL")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrPrivateAddress   = errors.New("webhook URL resolves to a private address")
+)
+
+// Sign returns the signature header of a body sent at a time
+// Signing the time with the body lets receivers reject replayed requests
+func Sign(secret string, at time.Time, body []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header of a received body, signed at most tolerance before now
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v1 == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ValidateURL checks that a webhook URL can be delivered to; plain http is refused unless allowHTTP
+func ValidateURL(raw string, allowHTTP bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	if u.Scheme != "https" && !(allowHTTP && u.Scheme == "http") {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Result is the outcome of a delivery attempt
+type Result struct {
+	StatusCode int    // 0 when no response was received
+	Response   string // the start of the response body
+}
+
+// Client delivers webhook requests
+// Unless it allows private addresses, it refuses to connect to loopback, private and link-local addresses,
+// so that webhooks cannot reach the internal network of the deployment
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a webhook client
+func NewClient(allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		// Checked on the resolved address of every connection, redirects being refused anyway
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Client{http: &http.Client{
+		Timeout:   requestTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// refusePrivate is the dialer control of the clients which refuse private addresses
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// blockedNets are the ranges which are not public, besides the ones net.IP knows of
+var blockedNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "this network", reaches the local host on some systems
+	mustParseCIDR("100.64.0.0/10"), // shared address space (carrier-grade NAT, some cloud networks)
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Deliver posts a signed event; it fails unless the receiver answers with a 2xx status
+func (c *Client) Deliver(ctx context.Context, endpoint, secret, eventID, eventType string, body []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PersonalisedEnglish-Webhooks/1")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, eventID)
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result := Result{StatusCode: resp.StatusCode, Response: strings.ToValidUTF8(string(response), "")}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("webhook: receiver answered %s", resp.Status)
+	}
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"test.completed"}`)
+	at := time.Unix(1700000000, 0)
+	header := Sign("secret", at, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{"round trip", "secret", header, body, at, false},
+		{"within tolerance", "secret", header, body, at.Add(5 * time.Minute), false},
+		{"clock of the receiver behind", "secret", header, body, at.Add(-5 * time.Minute), false},
+		{"too old", "secret", header, body, at.Add(5*time.Minute + time.Second), true},
+		{"from the future", "secret", header, body, at.Add(-5*time.Minute - time.Second), true},
+		{"wrong secret", "other", header, body, at, true},
+		{"tampered body", "secret", header, []byte(`{"type":"test.deleted"}`), at, true},
+		{"time changed", "secret", Sign("secret", at.Add(time.Second), nil)[:13] + header[13:], body, at, true},
+		{"no signature", "secret", "t=1700000000", body, at, true},
+		{"no time", "secret", header[13:], body, at, true},
+		{"empty", "secret", "", body, at, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("Verify(%q) = %v, want error %v", tt.header, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify(%q) = %v, want ErrInvalidSignature", tt.header, err)
+			}
+		})
+	}
+}
+
+func TestRefusePrivate(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"100.63.255.255:443", true},
+		{"100.128.0.1:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"[fe80::1]:443", false},
+		{"[fc00::1]:443", false},
+		{"0.0.0.0:80", false},
+		{"0.1.2.3:80", false},
+		{"100.64.0.1:443", false},
+		{"100.127.255.254:443", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:10.0.0.1]:80", false},
+		{"224.0.0.1:80", false},
+		{"localhost:80", false}, // only resolved addresses are dialed
+	}
+	for _, tt := range tests {
+		err := refusePrivate("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("%s refused: %v", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("%s: err = %v, want ErrPrivateAddress", tt.address, err)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	body := []byte(`{"id":"evt-1"}`)
+
+	// The test server listens on a loopback address
+	if _, err := NewClient(false).Deliver(context.Background(), server.URL, "secret", "evt-1", "test.completed", body); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("delivered to a loopback address: %v", err)
+	}
+
+	result, err := NewClient(true).Deliver(context.Background(), server.URL, "secret", "evt-1", "test.completed", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StatusCode != http.StatusOK || result.Response != "ok" {
+		t.Errorf("result = %+v", result)
+	}
+	if got.Header.Get(EventHeader) != "test.completed" || got.Header.Get(DeliveryHeader) != "evt-1" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if err := Verify("secret", got.Header.Get(SignatureHeader), gotBody, time.Minute, time.Now()); err != nil {
+		t.Errorf("signature of the delivery: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package xapi
+
+import (
+	"fmt"
+	"os"
+)
+
+// LoadSink builds the sink of the statements from the environment:
+//
+//	XAPI_SINK           lrs or file (default: no statements are recorded)
+//	XAPI_LRS_ENDPOINT   xAPI endpoint of the LRS, the statements are posted to <endpoint>/statements
+//	XAPI_LRS_USERNAME   HTTP Basic credentials of the LRS (key and secret), with XAPI_LRS_PASSWORD
+//	XAPI_FILE           file the file sink appends the statements to (default xapi-statements.jsonl)
+//
+// The sink is nil when XAPI_SINK is not set
+func LoadSink() (Sink, error) {
+	switch kind := os.Getenv("XAPI_SINK"); kind {
+	case "":
+		return nil, nil
+	case "lrs":
+		endpoint := os.Getenv("XAPI_LRS_ENDPOINT")
+		if endpoint == "" {
+			return nil, fmt.Errorf("XAPI_LRS_ENDPOINT is required for XAPI_SINK=lrs")
+		}
+		return NewLRS(endpoint, os.Getenv("XAPI_LRS_USERNAME"), os.Getenv("XAPI_LRS_PASSWORD")), nil
+	case "file":
+		path := os.Getenv("XAPI_FILE")
+		if path == "" {
+			path = "xapi-statements.jsonl"
+		}
+		return &FileSink{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown XAPI_SINK %q (lrs or file)", kind)
+	}
+}
@@ -0,0 +1,30 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends the statements to a file, one JSON statement per line, instead of an LRS
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSink) Send(ctx context.Context, statements []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, statement := range statements {
+		if _, err := f.Write(append(append([]byte{}, statement...), '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
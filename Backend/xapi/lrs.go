@@ -0,0 +1,64 @@
+package xapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	requestTimeout  = 30 * time.Second
+	maxResponseBody = 1024 // bytes of an error response kept in the error
+)
+
+// LRS posts the statements to the statements resource of a Learning Record Store, with HTTP Basic
+// authentication when a username is set
+type LRS struct {
+	Endpoint string // e.g. https://lrs.example/xapi/
+	Username string
+	Password string
+	client   *http.Client
+}
+
+// NewLRS creates an LRS sink
+func NewLRS(endpoint, username, password string) *LRS {
+	return &LRS{
+		Endpoint: endpoint,
+		Username: username,
+		Password: password,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Send posts a batch of statements; the LRS stores all of them or none
+func (l *LRS) Send(ctx context.Context, statements []json.RawMessage) error {
+	body, err := json.Marshal(statements)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(l.Endpoint, "/")+"/statements", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Experience-API-Version", Version)
+	if l.Username != "" {
+		req.SetBasicAuth(l.Username, l.Password)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return &StatusError{StatusCode: resp.StatusCode, Body: strings.ToValidUTF8(string(response), "")}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package xapi builds xAPI (Experience API 1.0.3) statements and sends them to a Learning Record Store,
+// or to a file for testing
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Version is the xAPI version of the statements, sent in the X-Experience-API-Version header
+const Version = "1.0.3"
+
+// Verbs of the statements
+var (
+	Answered  = Verb{ID: "http://adlnet.gov/expapi/verbs/answered", Display: LanguageMap{"en-US": "answered"}}
+	Completed = Verb{ID: "http://adlnet.gov/expapi/verbs/completed", Display: LanguageMap{"en-US": "completed"}}
+)
+
+// Activity types
+const (
+	ActivityAssessment  = "http://adlnet.gov/expapi/activities/assessment"
+	ActivityInteraction = "http://adlnet.gov/expapi/activities/cmi.interaction"
+	ActivityObjective   = "http://adlnet.gov/expapi/activities/objective"
+)
+
+// LanguageMap maps language tags to the text in that language
+type LanguageMap map[string]string
+
+// Statement is an xAPI statement: an actor did something (verb) to an object, with an optional result
+type Statement struct {
+	ID        string    `json:"id"`
+	Actor     Agent     `json:"actor"`
+	Verb      Verb      `json:"verb"`
+	Object    Activity  `json:"object"`
+	Result    *Result   `json:"result,omitempty"`
+	Context   *Context  `json:"context,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Agent identifies a user by an account on the platform, not by email
+type Agent struct {
+	ObjectType string  `json:"objectType"`
+	Account    Account `json:"account"`
+}
+
+// Account is the account of a user on a system, identified by its home page
+type Account struct {
+	HomePage string `json:"homePage"`
+	Name     string `json:"name"`
+}
+
+// NewAgent returns the agent of a user of the platform at homePage
+func NewAgent(homePage string, userID int) Agent {
+	return Agent{ObjectType: "Agent", Account: Account{HomePage: homePage, Name: strconv.Itoa(userID)}}
+}
+
+type Verb struct {
+	ID      string      `json:"id"`
+	Display LanguageMap `json:"display"`
+}
+
+// Activity is the object of a statement
+type Activity struct {
+	ObjectType string              `json:"objectType"`
+	ID         string              `json:"id"`
+	Definition *ActivityDefinition `json:"definition,omitempty"`
+}
+
+// NewActivity returns an activity of a type with an English name
+func NewActivity(id, activityType, name string) Activity {
+	return Activity{
+		ObjectType: "Activity",
+		ID:         id,
+		Definition: &ActivityDefinition{Name: LanguageMap{"en-US": name}, Type: activityType},
+	}
+}
+
+// ActivityDefinition describes an activity; questions are "choice" interactions
+type ActivityDefinition struct {
+	Name                    LanguageMap            `json:"name,omitempty"`
+	Description             LanguageMap            `json:"description,omitempty"`
+	Type                    string                 `json:"type,omitempty"`
+	InteractionType         string                 `json:"interactionType,omitempty"`
+	CorrectResponsesPattern []string               `json:"correctResponsesPattern,omitempty"`
+	Choices                 []InteractionComponent `json:"choices,omitempty"`
+}
+
+type InteractionComponent struct {
+	ID          string      `json:"id"`
+	Description LanguageMap `json:"description"`
+}
+
+// Result is the outcome of a statement
+type Result struct {
+	Score      *Score         `json:"score,omitempty"`
+	Success    *bool          `json:"success,omitempty"`
+	Completion *bool          `json:"completion,omitempty"`
+	Response   string         `json:"response,omitempty"`
+	Duration   string         `json:"duration,omitempty"` // ISO 8601, see Duration
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Score is a score; Scaled is between -1 and 1, Raw between Min and Max
+type Score struct {
+	Scaled *float64 `json:"scaled,omitempty"`
+	Raw    *float64 `json:"raw,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// Context places a statement, e.g. the test a question belongs to
+type Context struct {
+	Instructor        *Agent             `json:"instructor,omitempty"`
+	ContextActivities *ContextActivities `json:"contextActivities,omitempty"`
+	Platform          string             `json:"platform,omitempty"`
+	Extensions        map[string]any     `json:"extensions,omitempty"`
+}
+
+type ContextActivities struct {
+	Parent   []Activity `json:"parent,omitempty"`
+	Grouping []Activity `json:"grouping,omitempty"`
+}
+
+// Duration formats a duration as ISO 8601 with the precision of xAPI (0.01 second), e.g. PT12.5S
+func Duration(d time.Duration) string {
+	seconds := math.Round(d.Seconds()*100) / 100
+	return "PT" + strconv.FormatFloat(seconds, 'f', -1, 64) + "S"
+}
+
+// Sink stores statements, already encoded as JSON; implementations must be safe for concurrent use
+type Sink interface {
+	Send(ctx context.Context, statements []json.RawMessage) error
+}
+
+// StatusError is a request the LRS answered with an error status
+type StatusError struct {
+	StatusCode int
+	Body       string // the start of the response
+}
+
+func (e *StatusError) Error() string {
+	return "xapi: LRS answered " + strconv.Itoa(e.StatusCode) + ": " + e.Body
+}
+
+// IsRejected tells whether the LRS rejected the statements themselves (400, 409, 413):
+// sending them again as they are fails again, though a batch may fail because of one statement
+func IsRejected(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && (status.StatusCode == 400 || status.StatusCode == 409 || status.StatusCode == 413)
+}
+
+// IsConflict tells whether the LRS already has a statement with the same id (409)
+// The ids of the statements are derived from what they record, so it is a statement sent before
+func IsConflict(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.StatusCode == 409
+}
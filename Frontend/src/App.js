@@ -23,6 +23,10 @@ import ContactPopup from "./components/ContactPopup";
 import ContactFab from "./components/ContactFab";
 import RecommendedTest from "./pages/RecommendedTest";
 import ClassroomTest from "./pages/ClassroomTest";
+import OidcCallback from "./components/Auth/OidcCallback";
+import Account from "./pages/Account";
+import GuardianDashboard from "./pages/GuardianDashboard";
+import Notifications from "./pages/Notifications";
 
 function App() {
   const location = useLocation();
@@ -101,6 +105,8 @@ function App() {
       // If teacher tries to access student route, redirect to teacher-dashboard
       if (user?.role === "teacher")
         return <Navigate to="/teacher-dashboard" replace />;
+      if (user?.role === "guardian")
+        return <Navigate to="/guardian-dashboard" replace />;
       // If student tries to access teacher route, redirect to dashboard
       return <Navigate to="/dashboard" replace />;
     }
@@ -156,6 +162,8 @@ function App() {
             )
           }
         />
+        {/* Single sign-on landing page */}
+        <Route path="/oidc/callback" element={<OidcCallback />} />
         {/* Student-only routes */}
         <Route
           path="/tests"
@@ -207,6 +215,30 @@ function App() {
             </PrivateRoute>
           }
         />
+        <Route
+          path="/guardian-dashboard"
+          element={
+            <PrivateRoute requiredRole="guardian">
+              <GuardianDashboard handleToast={handleToast} />
+            </PrivateRoute>
+          }
+        />
+        <Route
+          path="/account"
+          element={
+            <PrivateRoute>
+              <Account logout={logout} handleToast={handleToast} />
+            </PrivateRoute>
+          }
+        />
+        <Route
+          path="/notifications"
+          element={
+            <PrivateRoute>
+              <Notifications handleToast={handleToast} />
+            </PrivateRoute>
+          }
+        />
         <Route
           path="/classroom-test/:testId"
           element={
@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import "../../css/Login.css";
 
 const Login = ({ onToggle, login, handleToast }) => {
@@ -9,6 +9,37 @@ const Login = ({ onToggle, login, handleToast }) => {
   const [otpSent, setOtpSent] = useState(false);
   const [otp, setOtp] = useState("");
   const [newPassword, setNewPassword] = useState("");
+  const [ssoProviders, setSsoProviders] = useState([]);
+  // Second step of a two-factor login
+  const [twoFactor, setTwoFactor] = useState(null);
+  const [twoFactorSetup, setTwoFactorSetup] = useState(null);
+  const [twoFactorCode, setTwoFactorCode] = useState("");
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
+
+  // A single sign-on which needs a two-factor code continues here (see OidcCallback)
+  useEffect(() => {
+    const pending = sessionStorage.getItem("pending_two_factor");
+    if (!pending) return;
+    sessionStorage.removeItem("pending_two_factor");
+    try {
+      const challenge = JSON.parse(pending);
+      setTwoFactor(challenge);
+      if (challenge.two_factor_enrollment_required) {
+        startTwoFactorEnrollment(challenge.mfa_token);
+      }
+    } catch {
+      showError("Sign-in failed, please try again");
+    }
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
+  // Identity providers configured for single sign-on
+  useEffect(() => {
+    fetch(`${process.env.REACT_APP_API_URL}/auth/oidc/providers`)
+      .then((res) => (res.ok ? res.json() : []))
+      .then(setSsoProviders)
+      .catch(() => setSsoProviders([]));
+  }, []);
 
   const handleChange = (e) => {
     setForm({ ...form, [e.target.name]: e.target.value });
@@ -26,7 +57,14 @@ const Login = ({ onToggle, login, handleToast }) => {
       return;
     }
     try {
-      await login(form);
+      const result = await login(form);
+      if (result?.twoFactor) {
+        setTwoFactor(result.twoFactor);
+        if (result.twoFactor.two_factor_enrollment_required) {
+          await startTwoFactorEnrollment(result.twoFactor.mfa_token);
+        }
+        return;
+      }
       setForm({ username: "", password: "" });
       setError("");
     } catch (err) {
@@ -34,6 +72,65 @@ const Login = ({ onToggle, login, handleToast }) => {
     }
   };
 
+  // Teachers who must use two-factor authentication set it up on their first login
+  const startTwoFactorEnrollment = async (mfaToken) => {
+    const res = await fetch(
+      `${process.env.REACT_APP_API_URL}/login/2fa/enroll`,
+      {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ mfa_token: mfaToken }),
+      }
+    );
+    if (res.ok) {
+      setTwoFactorSetup(await res.json());
+    } else {
+      showError("Could not start the two-factor setup. Please log in again.");
+    }
+  };
+
+  const resetTwoFactor = () => {
+    setTwoFactor(null);
+    setTwoFactorSetup(null);
+    setTwoFactorCode("");
+    setUseRecoveryCode(false);
+  };
+
+  const handleTwoFactorSubmit = async (e) => {
+    e.preventDefault();
+    if (!twoFactorCode) {
+      showError("Code is required");
+      return;
+    }
+    const body = { mfa_token: twoFactor.mfa_token };
+    if (useRecoveryCode) {
+      body.recovery_code = twoFactorCode;
+    } else {
+      body.code = twoFactorCode;
+    }
+    const result = await login(body, "/login/2fa");
+    if (result?.success) {
+      if (result.recoveryCodes) {
+        window.alert(
+          "Save these recovery codes, each one can be used once if you lose your authenticator:\n\n" +
+            result.recoveryCodes.join("\n")
+        );
+      }
+      const next = twoFactor.next || "";
+      resetTwoFactor();
+      setForm({ username: "", password: "" });
+      // Pages of the app only, as on the single sign-on callback
+      if (/^\/(?![/\\])/.test(next)) {
+        window.location.replace(next);
+      }
+    } else if (result?.error?.code === 401 && result.error.message !== "Invalid two-factor code") {
+      // The login expired or ran out of attempts
+      resetTwoFactor();
+    } else {
+      setTwoFactorCode("");
+    }
+  };
+
   const showError = (msg) => {
     setError(msg);
     setTimeout(() => setError(""), 3500);
@@ -58,7 +155,10 @@ const Login = ({ onToggle, login, handleToast }) => {
       if (!res.ok) throw new Error("Failed to send code");
       setOtpSent(true);
       showError("");
-      handleToast("A reset code was sent to your email.", "info");
+      handleToast(
+        "If an account exists for this email, a reset code was sent to it.",
+        "info"
+      );
     } catch {
       showError("Failed to send reset code. Please check your email.");
     }
@@ -76,7 +176,11 @@ const Login = ({ onToggle, login, handleToast }) => {
         {
           method: "POST",
           headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ code: otp, new_password: newPassword }),
+          body: JSON.stringify({
+            email: forgotEmail,
+            code: otp,
+            new_password: newPassword,
+          }),
         }
       );
       if (!res.ok) throw new Error("Failed to reset password");
@@ -93,6 +197,80 @@ const Login = ({ onToggle, login, handleToast }) => {
   };
 
   // UI rendering
+  if (twoFactor) {
+    const enrolling = twoFactor.two_factor_enrollment_required;
+    return (
+      <div className="login-bg">
+        <form className="text-center w-100" onSubmit={handleTwoFactorSubmit}>
+          {error && (
+            <div className="alert alert-danger py-2 mb-3" role="alert">
+              {error}
+            </div>
+          )}
+          <h2 className="login-title mb-2">Two-Factor Authentication</h2>
+          <p className="text-muted small mb-4">
+            {enrolling
+              ? "Your account requires two-factor authentication. Add this key to your authenticator app, then enter the code it shows."
+              : useRecoveryCode
+              ? "Enter one of your recovery codes."
+              : "Enter the code from your authenticator app."}
+          </p>
+          {enrolling && twoFactorSetup && (
+            <div className="mb-3">
+              <code className="d-block mb-2">{twoFactorSetup.secret}</code>
+              <a href={twoFactorSetup.provisioning_uri} className="small">
+                Open in authenticator app
+              </a>
+            </div>
+          )}
+          <div className="mb-4">
+            <input
+              type="text"
+              name="twoFactorCode"
+              autoComplete="one-time-code"
+              className="form-control form-control-lg shadow-sm login-input"
+              placeholder={useRecoveryCode ? "Recovery Code" : "6-digit Code"}
+              value={twoFactorCode}
+              onChange={(e) => {
+                setTwoFactorCode(e.target.value.trim());
+                setError("");
+              }}
+            />
+          </div>
+          <button
+            type="submit"
+            className="btn btn-primary btn-lg w-100 shadow-sm login-btn"
+          >
+            Verify
+          </button>
+          <div className="mt-3 text-center">
+            {!enrolling && (
+              <button
+                type="button"
+                className="btn btn-link small"
+                onClick={() => {
+                  setUseRecoveryCode(!useRecoveryCode);
+                  setTwoFactorCode("");
+                }}
+              >
+                {useRecoveryCode
+                  ? "Use authenticator code"
+                  : "Use a recovery code"}
+              </button>
+            )}
+            <button
+              type="button"
+              className="btn btn-link small"
+              onClick={resetTwoFactor}
+            >
+              Back to Login
+            </button>
+          </div>
+        </form>
+      </div>
+    );
+  }
+
   if (showForgot) {
     return (
       <div className="login-bg">
@@ -252,6 +430,17 @@ const Login = ({ onToggle, login, handleToast }) => {
           Log In
         </button>
 
+        {/* Single sign-on buttons */}
+        {ssoProviders.map((provider) => (
+          <a
+            key={provider.name}
+            href={`${process.env.REACT_APP_API_URL}${provider.login_url}`}
+            className="btn btn-outline-primary btn-lg w-100 shadow-sm mt-3"
+          >
+            Sign in with {provider.display_name}
+          </a>
+        ))}
+
         {/* Sign-up link */}
         <div className="mt-4 text-center">
           <span className="text-muted small">
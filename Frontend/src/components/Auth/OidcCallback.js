@@ -0,0 +1,65 @@
+import { useEffect, useState } from "react";
+import { storeTokens } from "../../session";
+
+// Receives the tokens of a single sign-on from the URL fragment set by the backend, or the
+// two-factor challenge of the account
+const OidcCallback = () => {
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    // Remove the tokens from the address bar and the history
+    window.history.replaceState(null, "", window.location.pathname);
+
+    // Accounts with two-factor authentication continue with their code on the login page
+    if (params.get("two_factor_required") === "true") {
+      sessionStorage.setItem(
+        "pending_two_factor",
+        JSON.stringify({
+          two_factor_required: true,
+          two_factor_enrollment_required:
+            params.get("two_factor_enrollment_required") === "true",
+          mfa_token: params.get("mfa_token"),
+          next: params.get("next") || "",
+        })
+      );
+      window.location.replace("/login");
+      return;
+    }
+    if (params.get("error") || !params.get("token")) {
+      setError(params.get("error") || "Sign-in failed, please try again");
+      return;
+    }
+    storeTokens({
+      token: params.get("token"),
+      refresh_token: params.get("refresh_token"),
+    });
+    // Pages of the app only (e.g. the test an LMS launched), never another site
+    const next = params.get("next") || "";
+    const home =
+      params.get("role") === "teacher" ? "/teacher-dashboard" : "/dashboard";
+    // Reload so that the session is picked up from the stored token
+    window.location.replace(
+      /^\/(?![/\\])/.test(next) ? next : home
+    );
+  }, []);
+
+  return (
+    <div className="container text-center mt-5">
+      {error ? (
+        <>
+          <div className="alert alert-danger" role="alert">
+            {error}
+          </div>
+          <a href="/login" className="btn btn-primary">
+            Back to Login
+          </a>
+        </>
+      ) : (
+        <p className="text-muted">Signing you in...</p>
+      )}
+    </div>
+  );
+};
+
+export default OidcCallback;
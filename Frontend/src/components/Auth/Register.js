@@ -118,6 +118,7 @@ const Register = ({ onToggle, register, handleToast }) => {
             <option value="">Select Role</option>
             <option value="student">Student</option>
             <option value="teacher">Teacher</option>
+            <option value="guardian">Parent / Guardian</option>
           </select>
         </div>
 
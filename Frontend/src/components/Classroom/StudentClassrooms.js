@@ -10,6 +10,7 @@ function StudentClassrooms() {
   const [selectedClassroom, setSelectedClassroom] = useState(null);
   const [isViewOpen, setIsViewOpen] = useState(false);
   const [showJoinForm, setShowJoinForm] = useState(false);
+  const [needsVerification, setNeedsVerification] = useState(false);
   const navigate = useNavigate();
 
   useEffect(() => {
@@ -67,6 +68,8 @@ function StudentClassrooms() {
         setTimeout(() => setSuccess(""), 3000);
       } else {
         const data = await res.json();
+        // Unverified accounts cannot join classrooms
+        setNeedsVerification(res.status === 403);
         setError(data.error || "Invalid invite code. Please check and try again.");
       }
     } catch (err) {
@@ -75,6 +78,31 @@ function StudentClassrooms() {
     }
   };
 
+  const handleResendVerification = async () => {
+    try {
+      const token = localStorage.getItem("jwt");
+      const res = await fetch(
+        `${process.env.REACT_APP_API_URL}/verify-email/resend`,
+        {
+          method: "POST",
+          headers: { Authorization: `Bearer ${token}` },
+        }
+      );
+      const data = await res.json();
+      if (res.ok) {
+        setError("");
+        setNeedsVerification(false);
+        setSuccess("Verification email sent. Please check your inbox.");
+        setTimeout(() => setSuccess(""), 5000);
+      } else {
+        setError(data.message || "Could not send the verification email");
+      }
+    } catch (err) {
+      setError("Error sending the verification email");
+      console.error(err);
+    }
+  };
+
   const fetchClassroomDetails = async (classroomId) => {
     try {
       const token = localStorage.getItem("jwt");
@@ -149,6 +177,15 @@ function StudentClassrooms() {
               </button>
             </form>
             {error && <div className={styles.error}>{error}</div>}
+            {needsVerification && (
+              <button
+                type="button"
+                className={styles.submitBtn}
+                onClick={handleResendVerification}
+              >
+                Resend verification email
+              </button>
+            )}
             <p className={styles.hint}>
               💡 Ask your teacher for the classroom invite code
             </p>
@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useNavigate, useLocation } from "react-router-dom";
 import styles from "../css/Navbar.module.css";
 
@@ -16,6 +16,26 @@ function Navbar({
   const [isCollapsed, setIsCollapsed] = useState(true);
   const navigate = useNavigate();
   const location = useLocation();
+  const [unread, setUnread] = useState(0);
+
+  // Unread notifications, refreshed every minute and when some are read
+  useEffect(() => {
+    if (!isAuthenticated) return;
+    const refresh = () =>
+      fetch(`${process.env.REACT_APP_API_URL}/notifications/unread-count`, {
+        headers: { Authorization: `Bearer ${localStorage.getItem("jwt")}` },
+      })
+        .then((res) => (res.ok ? res.json() : Promise.reject()))
+        .then((data) => setUnread(data.unread))
+        .catch(() => {});
+    refresh();
+    const interval = setInterval(refresh, 60000);
+    window.addEventListener("notifications-read", refresh);
+    return () => {
+      clearInterval(interval);
+      window.removeEventListener("notifications-read", refresh);
+    };
+  }, [isAuthenticated, location.pathname]);
 
   const handleTestsClick = (e) => {
     e.preventDefault();
@@ -31,6 +51,8 @@ function Navbar({
     e.preventDefault();
     if (user?.role === "teacher") {
       navigate("/teacher-dashboard");
+    } else if (user?.role === "guardian") {
+      navigate("/guardian-dashboard");
     } else {
       navigate("/dashboard");
     }
@@ -152,9 +174,30 @@ function Navbar({
 
       {isAuthenticated ? (
         <div className="d-flex align-items-center">
-          <span className="me-3 text-muted">
+          <a
+            className="me-3 text-muted"
+            href="/account"
+            onClick={(e) => {
+              e.preventDefault();
+              navigate("/account");
+            }}
+            title="My Account"
+          >
             Welcome, {user?.username || "User"}!
-          </span>
+          </a>
+          <button
+            className="btn btn-outline-secondary position-relative"
+            onClick={() => navigate("/notifications")}
+            title="Notifications"
+            type="button"
+          >
+            &#128276;
+            {unread > 0 && (
+              <span className="position-absolute top-0 start-100 translate-middle badge rounded-pill bg-danger">
+                {unread > 99 ? "99+" : unread}
+              </span>
+            )}
+          </button>
           <button
             className={`btn btn-outline-danger rounded-circle ms-3 ${styles["btn-user"]}`}
             onClick={logout}
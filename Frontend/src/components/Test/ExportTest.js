@@ -0,0 +1,125 @@
+import { useState } from "react";
+import styles from "../../css/TestForm.module.css";
+
+// Letters and digits which are not mistaken for each other on paper
+const CODE_CHARS = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789";
+
+const newVariantCode = () =>
+  Array.from(
+    { length: 4 },
+    () => CODE_CHARS[Math.floor(Math.random() * CODE_CHARS.length)]
+  ).join("");
+
+// Export of a test to QTI 2.1, Moodle XML or a print-ready page with its answer key
+// A variant code shuffles the questions and options, the same way each time it is given
+function ExportTest({ test, onClose }) {
+  const [format, setFormat] = useState("html");
+  const [variant, setVariant] = useState("");
+  const [error, setError] = useState("");
+  const [busy, setBusy] = useState(false);
+
+  const handleExport = async () => {
+    setBusy(true);
+    setError("");
+    // The page is opened before the request, as browsers block the windows opened later
+    const printWindow = format === "html" ? window.open("", "_blank") : null;
+    try {
+      const token = localStorage.getItem("jwt");
+      const params = new URLSearchParams({ format });
+      if (variant) params.append("variant", variant);
+      const res = await fetch(
+        `${process.env.REACT_APP_API_URL}/teacher/tests/${test.id}/export?${params}`,
+        { headers: { Authorization: `Bearer ${token}` } }
+      );
+      if (!res.ok) {
+        const data = await res.json().catch(() => ({}));
+        setError(data.error || `Export failed (status ${res.status})`);
+        if (printWindow) printWindow.close();
+        return;
+      }
+      const url = URL.createObjectURL(await res.blob());
+      if (printWindow) {
+        printWindow.location.href = url;
+      } else {
+        const filename =
+          /filename="?([^";]+)"?/.exec(
+            res.headers.get("Content-Disposition") || ""
+          )?.[1] || `test-${test.id}`;
+        const link = document.createElement("a");
+        link.href = url;
+        link.download = filename;
+        link.click();
+      }
+      setTimeout(() => URL.revokeObjectURL(url), 60000);
+    } catch (err) {
+      setError("Error exporting the test");
+      if (printWindow) printWindow.close();
+      console.error(err);
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  return (
+    <div className={styles.formContainer}>
+      <h3 className={styles.formTitle}>Export "{test.title}"</h3>
+      {error && <div className="alert alert-danger">{error}</div>}
+      <div className={styles.formGroup}>
+        <label>Format</label>
+        <select
+          value={format}
+          onChange={(e) => setFormat(e.target.value)}
+          className={styles.select}
+        >
+          <option value="html">Print (answer key on a separate page)</option>
+          <option value="qti">QTI 2.1 package (zip)</option>
+          <option value="moodle">Moodle XML</option>
+        </select>
+        {format === "html" && (
+          <p className={styles.formHint}>
+            The page opens in a new tab; print it or save it as PDF from the
+            print dialog.
+          </p>
+        )}
+      </div>
+      <div className={styles.formGroup}>
+        <label>Variant code (optional)</label>
+        <input
+          type="text"
+          value={variant}
+          maxLength={12}
+          placeholder="Original order"
+          onChange={(e) =>
+            setVariant(e.target.value.toUpperCase().replace(/[^A-Z0-9]/g, ""))
+          }
+          className={styles.input}
+        />
+        <button
+          type="button"
+          onClick={() => setVariant(newVariantCode())}
+          className={styles.addBtn}
+        >
+          New Code
+        </button>
+        <p className={styles.formHint}>
+          A code shuffles the questions and their options. The same code always
+          gives the same variant, so note it to print the variant and its
+          answer key again.
+        </p>
+      </div>
+      <button
+        type="button"
+        disabled={busy}
+        onClick={handleExport}
+        className={styles.submitBtn}
+      >
+        {busy ? "Exporting..." : "Export"}
+      </button>
+      <button onClick={onClose} className={styles.cancelBtn}>
+        Cancel
+      </button>
+    </div>
+  );
+}
+
+export default ExportTest;
@@ -0,0 +1,194 @@
+import { useState } from "react";
+import styles from "../../css/TestForm.module.css";
+
+// Import of a test from a file of another quiz system (QTI 2.1, Moodle XML, GIFT or Aiken)
+// The preview can be reviewed in the test form (onReview) or imported as it is (onImported)
+function ImportTest({ onReview, onImported, onClose }) {
+  const [file, setFile] = useState(null);
+  const [format, setFormat] = useState("");
+  const [type, setType] = useState("mixed");
+  const [questionType, setQuestionType] = useState("vocabulary");
+  const [result, setResult] = useState(null);
+  const [error, setError] = useState("");
+  const [busy, setBusy] = useState(false);
+
+  const send = async (preview) => {
+    if (!file) {
+      setError("Choose a file first");
+      return;
+    }
+    const body = new FormData();
+    body.append("file", file);
+    body.append("format", format);
+    body.append("type", type);
+    if (type === "mixed") body.append("question_type", questionType);
+    setBusy(true);
+    setError("");
+    try {
+      const token = localStorage.getItem("jwt");
+      const res = await fetch(
+        `${process.env.REACT_APP_API_URL}/teacher/tests/import${
+          preview ? "?preview=true" : ""
+        }`,
+        {
+          method: "POST",
+          headers: { Authorization: `Bearer ${token}` },
+          body,
+        }
+      );
+      const data = await res.json().catch(() => ({}));
+      if (!res.ok) {
+        setError(data.error || `Import failed (status ${res.status})`);
+        setResult(data.skipped ? { test: null, skipped: data.skipped } : null);
+        return;
+      }
+      if (preview) {
+        setResult(data);
+      } else {
+        onImported(data.created);
+      }
+    } catch (err) {
+      setError("Error importing the test");
+      console.error(err);
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  return (
+    <div className={styles.formContainer}>
+      <h3 className={styles.formTitle}>Import Test</h3>
+      {error && <div className="alert alert-danger">{error}</div>}
+      <div className={styles.formGroup}>
+        <label>File</label>
+        <input
+          type="file"
+          accept=".xml,.zip,.txt,.gift"
+          onChange={(e) => {
+            setFile(e.target.files[0] || null);
+            setResult(null);
+          }}
+          className={styles.input}
+        />
+        <p className={styles.formHint}>
+          Multiple choice questions with up to 4 options (A-D) and a single
+          correct answer are imported, true/false questions as two options.
+          Other questions are listed in the preview.
+        </p>
+      </div>
+      <div className={styles.formGroup}>
+        <label>Format</label>
+        <select
+          value={format}
+          onChange={(e) => {
+            setFormat(e.target.value);
+            setResult(null);
+          }}
+          className={styles.select}
+        >
+          <option value="">Detect automatically</option>
+          <option value="qti">QTI 2.1 (item or zip package)</option>
+          <option value="moodle">Moodle XML</option>
+          <option value="gift">GIFT</option>
+          <option value="aiken">Aiken</option>
+        </select>
+      </div>
+      <div className={styles.formGroup}>
+        <label>Type</label>
+        <select
+          value={type}
+          onChange={(e) => {
+            setType(e.target.value);
+            setResult(null);
+          }}
+          className={styles.select}
+        >
+          <option value="vocabulary">Vocabulary</option>
+          <option value="grammar">Grammar</option>
+          <option value="reading">Reading</option>
+          <option value="listening">Listening</option>
+          <option value="mixed">Mixed</option>
+        </select>
+      </div>
+      {type === "mixed" && (
+        <div className={styles.formGroup}>
+          <label>Category of the questions</label>
+          <select
+            value={questionType}
+            onChange={(e) => {
+              setQuestionType(e.target.value);
+              setResult(null);
+            }}
+            className={styles.select}
+          >
+            <option value="vocabulary">Vocabulary</option>
+            <option value="grammar">Grammar</option>
+            <option value="reading">Reading</option>
+            <option value="listening">Listening</option>
+          </select>
+          <p className={styles.formHint}>
+            You can change the category of each question when reviewing them.
+          </p>
+        </div>
+      )}
+
+      {result && (
+        <div className={styles.formGroup}>
+          {result.test && (
+            <p>
+              <strong>{result.test.questions.length}</strong> question(s) will
+              be imported into "{result.test.title}".
+            </p>
+          )}
+          {result.skipped.length > 0 && (
+            <>
+              <label>Not imported</label>
+              <ul>
+                {result.skipped.map((issue) => (
+                  <li key={issue.item}>
+                    Item {issue.item}
+                    {issue.title && ` (${issue.title})`}: {issue.reason}
+                  </li>
+                ))}
+              </ul>
+            </>
+          )}
+        </div>
+      )}
+
+      {result?.test ? (
+        <>
+          <button
+            type="button"
+            onClick={() => onReview(result.test)}
+            className={styles.addBtn}
+          >
+            Review and Edit
+          </button>
+          <button
+            type="button"
+            disabled={busy}
+            onClick={() => send(false)}
+            className={styles.submitBtn}
+          >
+            Import
+          </button>
+        </>
+      ) : (
+        <button
+          type="button"
+          disabled={busy}
+          onClick={() => send(true)}
+          className={styles.submitBtn}
+        >
+          {busy ? "Reading..." : "Preview"}
+        </button>
+      )}
+      <button onClick={onClose} className={styles.cancelBtn}>
+        Cancel
+      </button>
+    </div>
+  );
+}
+
+export default ImportTest;
@@ -1,6 +1,13 @@
 import styles from "../../css/TestCard.module.css";
 
-function TestCard({ test, onView, onEdit, onDelete, onResults }) {
+function TestCard({
+  test,
+  onView,
+  onEdit,
+  onDelete,
+  onResults,
+  onExport,
+}) {
   return (
     <div className={styles.card}>
       <h3 className={styles.title}>{test.title}</h3>
@@ -22,6 +29,9 @@ function TestCard({ test, onView, onEdit, onDelete, onResults }) {
         <button onClick={onResults} className={styles.resultsBtn}>
           Results
         </button>
+        <button onClick={onExport} className={styles.exportBtn}>
+          Export
+        </button>
         <button onClick={onDelete} className={styles.deleteBtn}>
           Delete
         </button>
@@ -118,11 +118,14 @@ function TestForm({ form, setForm, onSubmit, onClose, title }) {
             <>
               {["A", "B", "C", "D"].map((key) => (
                 <div key={key} className={styles.formGroup}>
-                  <label>Option {key}</label>
+                  <label>
+                    Option {key}
+                    {(key === "C" || key === "D") && " (optional)"}
+                  </label>
                   <input
                     value={q.options[key] || ""}
                     onChange={(e) => handleOptionChange(index, key, e)}
-                    required
+                    required={key === "A" || key === "B"}
                     className={styles.input}
                   />
                 </div>
@@ -0,0 +1,257 @@
+import { useEffect, useState } from "react";
+
+const statusBadges = {
+  pending: "bg-secondary",
+  delivered: "bg-success",
+  failed: "bg-danger",
+};
+
+// Webhook subscriptions of a teacher, with their delivery log
+// send(path, method, body) calls the API and returns the response, or null after showing the error
+function Webhooks({ send }) {
+  const [webhooks, setWebhooks] = useState([]);
+  const [events, setEvents] = useState([]);
+  const [newWebhook, setNewWebhook] = useState({
+    url: "",
+    description: "",
+    events: [],
+  });
+  const [secret, setSecret] = useState(null);
+  const [openLog, setOpenLog] = useState(null);
+  const [deliveries, setDeliveries] = useState([]);
+
+  const load = async () => {
+    const data = await send("/teacher/webhooks", "GET");
+    if (!data) return;
+    setWebhooks(data.webhooks);
+    setEvents(data.events);
+  };
+
+  useEffect(() => {
+    load();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
+  const loadLog = async (id) => {
+    const data = await send(`/teacher/webhooks/${id}/deliveries`, "GET");
+    if (data) setDeliveries(data);
+  };
+
+  const toggleLog = (id) => {
+    if (openLog === id) {
+      setOpenLog(null);
+      return;
+    }
+    setOpenLog(id);
+    setDeliveries([]);
+    loadLog(id);
+  };
+
+  const toggleEvent = (event) =>
+    setNewWebhook({
+      ...newWebhook,
+      events: newWebhook.events.includes(event)
+        ? newWebhook.events.filter((e) => e !== event)
+        : [...newWebhook.events, event],
+    });
+
+  const handleCreate = async (e) => {
+    e.preventDefault();
+    const data = await send("/teacher/webhooks", "POST", newWebhook);
+    if (!data) return;
+    setSecret({ id: data.id, secret: data.secret });
+    setNewWebhook({ url: "", description: "", events: [] });
+    load();
+  };
+
+  const handleActive = async (webhook) => {
+    const data = await send(`/teacher/webhooks/${webhook.id}`, "PUT", {
+      active: !webhook.active,
+    });
+    if (data) load();
+  };
+
+  const handleRotate = async (webhook) => {
+    if (
+      !window.confirm(
+        "Replace the secret? Your system must verify with the new one."
+      )
+    )
+      return;
+    const data = await send(`/teacher/webhooks/${webhook.id}/secret`, "POST");
+    if (data) setSecret({ id: data.id, secret: data.secret });
+  };
+
+  const handlePing = async (webhook) => {
+    const data = await send(`/teacher/webhooks/${webhook.id}/ping`, "POST");
+    if (data && openLog === webhook.id) setTimeout(() => loadLog(webhook.id), 2000);
+  };
+
+  const handleDelete = async (webhook) => {
+    if (!window.confirm(`Delete the webhook to ${webhook.url}?`)) return;
+    const data = await send(`/teacher/webhooks/${webhook.id}`, "DELETE");
+    if (data) load();
+  };
+
+  const handleRedeliver = async (webhook, delivery) => {
+    const data = await send(
+      `/teacher/webhooks/${webhook.id}/deliveries/${delivery.id}/redeliver`,
+      "POST"
+    );
+    if (data) loadLog(webhook.id);
+  };
+
+  return (
+    <div className="mb-5">
+      <h5>Webhooks</h5>
+      <p className="text-muted small">
+        Webhooks push events of your classrooms to your school's systems. Each
+        request is signed: the <code>X-Webhook-Signature</code> header holds{" "}
+        <code>t=&lt;time&gt;,v1=&lt;HMAC-SHA256 of "t.body"&gt;</code> with your
+        webhook secret. Failed deliveries are retried for about a day.
+      </p>
+      <ul className="list-group mb-2">
+        {webhooks.map((w) => (
+          <li key={w.id} className="list-group-item">
+            <div className="d-flex justify-content-between align-items-center">
+              <span className="text-break">
+                <strong>{w.url}</strong>{" "}
+                {!w.active && <span className="badge bg-secondary">Paused</span>}
+              </span>
+              <span className="text-nowrap">
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-secondary ms-1"
+                  onClick={() => toggleLog(w.id)}
+                >
+                  Deliveries
+                </button>
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-secondary ms-1"
+                  onClick={() => handlePing(w)}
+                >
+                  Ping
+                </button>
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-secondary ms-1"
+                  onClick={() => handleActive(w)}
+                >
+                  {w.active ? "Pause" : "Resume"}
+                </button>
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-secondary ms-1"
+                  onClick={() => handleRotate(w)}
+                >
+                  New Secret
+                </button>
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-danger ms-1"
+                  onClick={() => handleDelete(w)}
+                >
+                  Delete
+                </button>
+              </span>
+            </div>
+            <div className="text-muted small">
+              {w.description && `${w.description} · `}
+              {w.events.join(", ")}
+            </div>
+            {secret && secret.id === w.id && (
+              <div className="alert alert-warning py-2 mt-2 mb-0 text-break">
+                Copy the secret now, it will not be shown again:{" "}
+                <code>{secret.secret}</code>
+              </div>
+            )}
+            {openLog === w.id && (
+              <table className="table table-sm small mt-2 mb-0">
+                <thead>
+                  <tr>
+                    <th>Event</th>
+                    <th>Status</th>
+                    <th>Attempts</th>
+                    <th>Response</th>
+                    <th>Created</th>
+                    <th></th>
+                  </tr>
+                </thead>
+                <tbody>
+                  {deliveries.length === 0 && (
+                    <tr>
+                      <td colSpan="6" className="text-muted">
+                        No deliveries yet.
+                      </td>
+                    </tr>
+                  )}
+                  {deliveries.map((d) => (
+                    <tr key={d.id}>
+                      <td>{d.event_type}</td>
+                      <td>
+                        <span className={`badge ${statusBadges[d.status]}`}>
+                          {d.status}
+                        </span>
+                      </td>
+                      <td>{d.attempts}</td>
+                      <td className="text-break">
+                        {d.last_status_code || ""} {d.last_error || ""}
+                      </td>
+                      <td>{new Date(d.created_at).toLocaleString()}</td>
+                      <td>
+                        {d.status !== "pending" && (
+                          <button
+                            type="button"
+                            className="btn btn-sm btn-link p-0"
+                            onClick={() => handleRedeliver(w, d)}
+                          >
+                            Redeliver
+                          </button>
+                        )}
+                      </td>
+                    </tr>
+                  ))}
+                </tbody>
+              </table>
+            )}
+          </li>
+        ))}
+      </ul>
+      <form onSubmit={handleCreate}>
+        <input
+          className="form-control mb-2"
+          placeholder="https://sis.school.example/webhooks"
+          value={newWebhook.url}
+          onChange={(e) => setNewWebhook({ ...newWebhook, url: e.target.value })}
+        />
+        <input
+          className="form-control mb-2"
+          placeholder="Description (optional)"
+          value={newWebhook.description}
+          onChange={(e) =>
+            setNewWebhook({ ...newWebhook, description: e.target.value })
+          }
+        />
+        <div className="mb-2">
+          {events.map((event) => (
+            <label key={event} className="form-check form-check-inline">
+              <input
+                type="checkbox"
+                className="form-check-input"
+                checked={newWebhook.events.includes(event)}
+                onChange={() => toggleEvent(event)}
+              />
+              <span className="form-check-label">{event}</span>
+            </label>
+          ))}
+        </div>
+        <button type="submit" className="btn btn-outline-primary">
+          Add Webhook
+        </button>
+      </form>
+    </div>
+  );
+}
+
+export default Webhooks;
@@ -1,6 +1,7 @@
 import { useEffect, useState } from "react";
 import axios from "axios";
 import { jwtDecode } from "jwt-decode";
+import { clearTokens, storeTokens } from "../session";
 
 const useAuth = (handleToast) => {
   // State to control the visibility of the authentication modal
@@ -47,11 +48,12 @@ const useAuth = (handleToast) => {
   };
 
   // Function to handle user login
-  const login = async (credentials) => {
+  // The second step of a two-factor login posts its code to "/login/2fa" the same way
+  const login = async (credentials, endpoint = "/login") => {
     try {
       // Send a POST request to the login endpoint with user credentials
       const response = await axios.post(
-        "http://localhost:8081/login",
+        `http://localhost:8081${endpoint}`,
         credentials,
         {
           headers: {
@@ -64,22 +66,29 @@ const useAuth = (handleToast) => {
       if (response.status === 200) {
         const userData = response.data; // Extract user data from the response
 
-        console.log("Login successful:", userData);
-        if (userData.token) {
-          localStorage.setItem("jwt", userData.token);
+        // The password is right but a two-factor code is needed
+        if (userData.two_factor_required) {
+          return { success: false, twoFactor: userData };
         }
+
+        console.log("Login successful:", userData);
+        storeTokens(userData);
         setUser(userData); // Set the user data
         setIsAuthenticated(true); // Mark the user as authenticated
         closeAuth(); // Close the authentication modal
         handleToast("Login successful!", "success"); // Displays a success toast message upon successful login
-        return { success: true }; // Indicate success
+        return { success: true, recoveryCodes: userData.recovery_codes }; // Indicate success
       } else {
         handleToast("Login failed. Please try again.", "danger"); // Show error toast
         return { success: false, error: "Invalid credentials" }; // Handle invalid credentials
       }
     } catch (error) {
       console.error("Login error:", error);
-      handleToast("Login failed. Please try again.", "danger"); // Show error toast
+      // Throttled and locked accounts get the reason and when to try again
+      handleToast(
+        error.response?.data?.message || "Login failed. Please try again.",
+        "danger"
+      ); // Show error toast
       if (error.response) {
         return {
           success: false,
@@ -111,7 +120,7 @@ const useAuth = (handleToast) => {
         console.log("Registration successful:", newUser);
 
         if (newUser.token) {
-          localStorage.setItem("jwt", newUser.token);
+          storeTokens(newUser);
           try {
             // Decode JWT to get username and role
             const decoded = jwtDecode(newUser.token);
@@ -145,10 +154,22 @@ const useAuth = (handleToast) => {
   };
 
   // Function to log out the user
-  const logout = () => {
+  // The session is revoked on the server, so that its refresh token cannot renew it anymore
+  const logout = async () => {
+    const token = localStorage.getItem("jwt");
+    if (token) {
+      try {
+        await fetch(`${process.env.REACT_APP_API_URL}/logout`, {
+          method: "POST",
+          headers: { Authorization: `Bearer ${token}` },
+        });
+      } catch (error) {
+        console.error("Logout error:", error);
+      }
+    }
+    clearTokens();
     setUser(null); // Clear the user data
     setIsAuthenticated(false); // Mark the user as unauthenticated
-    localStorage.removeItem("jwt");
     handleToast("Logged out successfully.", "info"); // Show info toast
   };
 
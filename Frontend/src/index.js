@@ -5,6 +5,10 @@ import App from "./App";
 import reportWebVitals from "./reportWebVitals";
 import "bootstrap/dist/css/bootstrap.min.css";
 import { BrowserRouter } from "react-router-dom";
+import { installTokenRefresh } from "./session";
+
+// Expired access tokens are renewed with the refresh token
+installTokenRefresh();
 
 const root = ReactDOM.createRoot(document.getElementById("root"));
 root.render(
@@ -0,0 +1,469 @@
+import { useEffect, useState } from "react";
+import Webhooks from "../components/Webhooks";
+
+const API = process.env.REACT_APP_API_URL;
+
+const notificationLabels = {
+  test_assigned: "A test is assigned to me",
+  test_changed: "An assigned test is changed or removed",
+  classroom_removed: "I am removed from a classroom",
+  student_joined: "A student joins one of my classrooms",
+  test_completed: "A student completes one of my tests",
+  weekly_digest: "Weekly progress digest",
+};
+
+const channelLabels = { in_app: "In app", email: "Email" };
+
+// Account settings: profile, password, data download and account deletion
+function Account({ logout, handleToast }) {
+  const [profile, setProfile] = useState({ username: "", email: "" });
+  const [savedEmail, setSavedEmail] = useState("");
+  const [profilePassword, setProfilePassword] = useState("");
+  const [passwords, setPasswords] = useState({ current: "", next: "" });
+  const [deletePassword, setDeletePassword] = useState("");
+  const [error, setError] = useState("");
+  const [role, setRole] = useState("");
+  const [locale, setLocale] = useState("en");
+  const [notifications, setNotifications] = useState([]);
+  const [guardians, setGuardians] = useState([]);
+  const [invite, setInvite] = useState(null);
+  const [inviteEmail, setInviteEmail] = useState("");
+  const [tokens, setTokens] = useState([]);
+  const [scopes, setScopes] = useState([]);
+  const [newToken, setNewToken] = useState({ name: "", scopes: [] });
+  const [createdToken, setCreatedToken] = useState("");
+
+  const authHeaders = () => ({
+    "Content-Type": "application/json",
+    Authorization: `Bearer ${localStorage.getItem("jwt")}`,
+  });
+
+  useEffect(() => {
+    fetch(`${API}/user`, {
+      headers: { Authorization: `Bearer ${localStorage.getItem("jwt")}` },
+    })
+      .then((res) => (res.ok ? res.json() : Promise.reject()))
+      .then((data) => {
+        setProfile({ username: data.username, email: data.email });
+        setSavedEmail(data.email);
+        setRole(data.role);
+        setLocale(data.locale || "en");
+      })
+      .catch(() => setError("Failed to load your profile"));
+    fetch(`${API}/account/notifications`, {
+      headers: { Authorization: `Bearer ${localStorage.getItem("jwt")}` },
+    })
+      .then((res) => (res.ok ? res.json() : Promise.reject()))
+      .then(setNotifications)
+      .catch(() => setError("Failed to load your notification settings"));
+  }, []);
+
+  useEffect(() => {
+    if (role !== "student") return;
+    fetch(`${API}/guardians`, { headers: authHeaders() })
+      .then((res) => (res.ok ? res.json() : Promise.reject()))
+      .then(setGuardians)
+      .catch(() => setError("Failed to load your guardians"));
+  }, [role]);
+
+  const loadTokens = () =>
+    fetch(`${API}/teacher/tokens`, { headers: authHeaders() })
+      .then((res) => (res.ok ? res.json() : Promise.reject()))
+      .then((data) => {
+        setTokens(data.tokens);
+        setScopes(data.scopes);
+      })
+      .catch(() => setError("Failed to load your access tokens"));
+
+  useEffect(() => {
+    if (role === "teacher") loadTokens();
+  }, [role]);
+
+  // Sends a change and shows the server error, if any
+  const send = async (path, method, body) => {
+    setError("");
+    const res = await fetch(`${API}${path}`, {
+      method,
+      headers: authHeaders(),
+      body: JSON.stringify(body),
+    });
+    const data = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      setError(data.error || "Something went wrong");
+      return null;
+    }
+    return data;
+  };
+
+  const handleProfile = async (e) => {
+    e.preventDefault();
+    const data = await send("/account/profile", "PUT", {
+      username: profile.username,
+      email: profile.email,
+      current_password: profilePassword,
+    });
+    if (!data) return;
+    setProfilePassword("");
+    setProfile({ username: data.username, email: data.email });
+    setSavedEmail(data.email);
+    handleToast(
+      data.email !== savedEmail
+        ? "Profile saved. Check your inbox to verify your email."
+        : "Profile saved.",
+      "success"
+    );
+  };
+
+  const handlePassword = async (e) => {
+    e.preventDefault();
+    const data = await send("/account/password", "POST", {
+      current_password: passwords.current,
+      new_password: passwords.next,
+    });
+    if (!data) return;
+    setPasswords({ current: "", next: "" });
+    handleToast(data.message, "success");
+  };
+
+  const handleLocale = async (e) => {
+    const data = await send("/account/preferences", "PUT", {
+      locale: e.target.value,
+    });
+    if (!data) return;
+    setLocale(data.locale);
+    handleToast("Email language saved.", "success");
+  };
+
+  const handleNotification = async (type, channel, on) => {
+    const data = await send("/account/notifications", "PUT", {
+      preferences: [{ type, [channel]: on }],
+    });
+    if (data) setNotifications(data);
+  };
+
+  const handleInvite = async () => {
+    const data = await send(
+      "/guardian-invites",
+      "POST",
+      inviteEmail ? { email: inviteEmail } : undefined
+    );
+    if (!data) return;
+    setInvite(data);
+    setInviteEmail("");
+  };
+
+  const handleRemoveGuardian = async (guardian) => {
+    if (!window.confirm(`Stop sharing your progress with ${guardian.username}?`))
+      return;
+    const data = await send(`/guardians/${guardian.guardian_id}`, "DELETE");
+    if (!data) return;
+    setGuardians(guardians.filter((g) => g.guardian_id !== guardian.guardian_id));
+  };
+
+  const toggleScope = (scope) =>
+    setNewToken({
+      ...newToken,
+      scopes: newToken.scopes.includes(scope)
+        ? newToken.scopes.filter((s) => s !== scope)
+        : [...newToken.scopes, scope],
+    });
+
+  const handleCreateToken = async (e) => {
+    e.preventDefault();
+    const data = await send("/teacher/tokens", "POST", newToken);
+    if (!data) return;
+    setCreatedToken(data.token);
+    setNewToken({ name: "", scopes: [] });
+    loadTokens();
+  };
+
+  const handleRevokeToken = async (token) => {
+    if (!window.confirm(`Revoke "${token.name}"? Scripts using it will stop working.`))
+      return;
+    const data = await send(`/teacher/tokens/${token.id}`, "DELETE");
+    if (data) loadTokens();
+  };
+
+  const handleExport = async () => {
+    setError("");
+    const res = await fetch(`${API}/account/export`, {
+      headers: authHeaders(),
+    });
+    if (!res.ok) {
+      setError("Failed to download your data");
+      return;
+    }
+    const url = URL.createObjectURL(await res.blob());
+    const link = document.createElement("a");
+    link.href = url;
+    link.download = "personalisedenglish-data.json";
+    link.click();
+    URL.revokeObjectURL(url);
+  };
+
+  const handleDelete = async (e) => {
+    e.preventDefault();
+    if (
+      !window.confirm(
+        "Delete your account? You will not be able to log in again. Your teachers keep your results without your name."
+      )
+    )
+      return;
+    const data = await send("/account", "DELETE", { password: deletePassword });
+    if (!data) return;
+    handleToast("Your account was deleted.", "info");
+    logout();
+  };
+
+  return (
+    <div className="container py-5" style={{ maxWidth: 560 }}>
+      <h2 className="mb-4">My Account</h2>
+      {error && <div className="alert alert-danger py-2">{error}</div>}
+
+      <form className="mb-5" onSubmit={handleProfile}>
+        <h5>Profile</h5>
+        <input
+          className="form-control mb-2"
+          placeholder="Username"
+          value={profile.username}
+          onChange={(e) => setProfile({ ...profile, username: e.target.value })}
+        />
+        <input
+          type="email"
+          className="form-control mb-2"
+          placeholder="Email"
+          value={profile.email}
+          onChange={(e) => setProfile({ ...profile, email: e.target.value })}
+        />
+        <input
+          type="password"
+          className="form-control mb-2"
+          placeholder="Current password"
+          value={profilePassword}
+          onChange={(e) => setProfilePassword(e.target.value)}
+        />
+        <button type="submit" className="btn btn-primary">
+          Save Profile
+        </button>
+      </form>
+
+      <form className="mb-5" onSubmit={handlePassword}>
+        <h5>Change Password</h5>
+        <input
+          type="password"
+          className="form-control mb-2"
+          placeholder="Current password"
+          value={passwords.current}
+          onChange={(e) =>
+            setPasswords({ ...passwords, current: e.target.value })
+          }
+        />
+        <input
+          type="password"
+          className="form-control mb-2"
+          placeholder="New password (8 characters or more)"
+          value={passwords.next}
+          onChange={(e) => setPasswords({ ...passwords, next: e.target.value })}
+        />
+        <button type="submit" className="btn btn-primary">
+          Change Password
+        </button>
+      </form>
+
+      <div className="mb-5">
+        <h5>Email Language</h5>
+        <p className="text-muted small">
+          The language of the emails we send you.
+        </p>
+        <select className="form-select" value={locale} onChange={handleLocale}>
+          <option value="en">English</option>
+          <option value="el">Ελληνικά</option>
+        </select>
+      </div>
+
+      <div className="mb-5">
+        <h5>Notifications</h5>
+        {notifications.map((n) => (
+          <div className="mb-2" key={n.type}>
+            <div>{notificationLabels[n.type] || n.type}</div>
+            {n.channels.map((channel) => (
+              <div className="form-check form-check-inline" key={channel}>
+                <input
+                  type="checkbox"
+                  className="form-check-input"
+                  id={`notification-${n.type}-${channel}`}
+                  checked={n[channel]}
+                  onChange={(e) =>
+                    handleNotification(n.type, channel, e.target.checked)
+                  }
+                />
+                <label
+                  className="form-check-label"
+                  htmlFor={`notification-${n.type}-${channel}`}
+                >
+                  {channelLabels[channel]}
+                </label>
+              </div>
+            ))}
+          </div>
+        ))}
+      </div>
+
+      {role === "student" && (
+        <div className="mb-5">
+          <h5>Guardians</h5>
+          <p className="text-muted small">
+            Guardians can see your results, levels, mistakes and assignments,
+            but cannot change anything.
+          </p>
+          <ul className="list-group mb-2">
+            {guardians.map((g) => (
+              <li
+                key={g.guardian_id}
+                className="list-group-item d-flex justify-content-between align-items-center"
+              >
+                {g.username}
+                <button
+                  type="button"
+                  className="btn btn-sm btn-outline-danger"
+                  onClick={() => handleRemoveGuardian(g)}
+                >
+                  Remove
+                </button>
+              </li>
+            ))}
+          </ul>
+          {invite && (
+            <div className="alert alert-info py-2">
+              Invite code: <strong>{invite.code}</strong> (valid until{" "}
+              {new Date(invite.expires_at).toLocaleDateString()}, single use)
+              {invite.email_sent && " and sent by email"}
+            </div>
+          )}
+          <input
+            type="email"
+            className="form-control mb-2"
+            placeholder="Guardian's email (optional, to send them the code)"
+            value={inviteEmail}
+            onChange={(e) => setInviteEmail(e.target.value)}
+          />
+          <button
+            type="button"
+            className="btn btn-outline-primary"
+            onClick={handleInvite}
+          >
+            Invite a Guardian
+          </button>
+        </div>
+      )}
+
+      {role === "teacher" && (
+        <div className="mb-5">
+          <h5>Personal Access Tokens</h5>
+          <p className="text-muted small">
+            Tokens let scripts and spreadsheets read your results or manage
+            your tests. Send them as <code>Authorization: Bearer &lt;token&gt;</code>.
+          </p>
+          <ul className="list-group mb-2">
+            {tokens.map((t) => (
+              <li key={t.id} className="list-group-item">
+                <div className="d-flex justify-content-between align-items-center">
+                  <span>
+                    <strong>{t.name}</strong>{" "}
+                    <code className="small">{t.prefix}…</code>
+                  </span>
+                  {t.revoked_at ? (
+                    <span className="text-muted small">Revoked</span>
+                  ) : (
+                    <button
+                      type="button"
+                      className="btn btn-sm btn-outline-danger"
+                      onClick={() => handleRevokeToken(t)}
+                    >
+                      Revoke
+                    </button>
+                  )}
+                </div>
+                <div className="text-muted small">
+                  {t.scopes.join(", ")} · last used{" "}
+                  {t.last_used_at
+                    ? new Date(t.last_used_at).toLocaleString()
+                    : "never"}
+                  {t.expires_at &&
+                    ` · expires ${new Date(t.expires_at).toLocaleDateString()}`}
+                </div>
+              </li>
+            ))}
+          </ul>
+          {createdToken && (
+            <div className="alert alert-warning py-2 text-break">
+              Copy your new token now, it will not be shown again:{" "}
+              <code>{createdToken}</code>
+            </div>
+          )}
+          <form onSubmit={handleCreateToken}>
+            <input
+              className="form-control mb-2"
+              placeholder="Token name (e.g. Results spreadsheet)"
+              value={newToken.name}
+              onChange={(e) => setNewToken({ ...newToken, name: e.target.value })}
+            />
+            <div className="mb-2">
+              {scopes.map((scope) => (
+                <label key={scope} className="form-check form-check-inline">
+                  <input
+                    type="checkbox"
+                    className="form-check-input"
+                    checked={newToken.scopes.includes(scope)}
+                    onChange={() => toggleScope(scope)}
+                  />
+                  <span className="form-check-label">{scope}</span>
+                </label>
+              ))}
+            </div>
+            <button type="submit" className="btn btn-outline-primary">
+              Create Token
+            </button>
+          </form>
+        </div>
+      )}
+
+      {role === "teacher" && <Webhooks send={send} />}
+
+      <div className="mb-5">
+        <h5>My Data</h5>
+        <p className="text-muted small">
+          Download your results, answers, preferences and classrooms as a JSON
+          file.
+        </p>
+        <button
+          type="button"
+          className="btn btn-outline-primary"
+          onClick={handleExport}
+        >
+          Download My Data
+        </button>
+      </div>
+
+      <form onSubmit={handleDelete}>
+        <h5 className="text-danger">Delete Account</h5>
+        <p className="text-muted small">
+          Your name, email and personal data are erased. Your test results stay
+          in your classrooms anonymously.
+        </p>
+        <input
+          type="password"
+          className="form-control mb-2"
+          placeholder="Password"
+          value={deletePassword}
+          onChange={(e) => setDeletePassword(e.target.value)}
+        />
+        <button type="submit" className="btn btn-danger">
+          Delete My Account
+        </button>
+      </form>
+    </div>
+  );
+}
+
+export default Account;
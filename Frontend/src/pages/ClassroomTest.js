@@ -1,4 +1,4 @@
-import { useEffect, useState } from "react";
+import { useEffect, useRef, useState } from "react";
 import { useNavigate, useParams } from "react-router-dom";
 import styles from "../css/Tests.module.css";
 
@@ -14,11 +14,32 @@ function ClassroomTest() {
   const [showResult, setShowResult] = useState(false);
   const [error, setError] = useState("");
   const [loading, setLoading] = useState(true);
+  // Time limit granted to the student, counted from the start of the attempt on the server
+  const [timeLimit, setTimeLimit] = useState(null);
+  const [deadline, setDeadline] = useState(null);
+  const [remaining, setRemaining] = useState(null);
+  const submitted = useRef(false);
 
   useEffect(() => {
     fetchTestQuestions();
+    startAttempt();
   }, [testId]);
 
+  // Countdown of a timed test; the answers given so far are submitted when the time is up
+  useEffect(() => {
+    if (deadline === null || showResult) return;
+    const tick = () => {
+      const left = Math.max(0, Math.round((deadline - Date.now()) / 1000));
+      setRemaining(left);
+      if (left === 0 && questions.length > 0) {
+        submitTestWithAnswers(answers, endTimes);
+      }
+    };
+    tick();
+    const timer = setInterval(tick, 1000);
+    return () => clearInterval(timer);
+  }, [deadline, showResult, questions, answers, endTimes]);
+
 
   // Record start time when question changes
   useEffect(() => {
@@ -58,6 +79,30 @@ function ClassroomTest() {
     }
   };
 
+  const startAttempt = async () => {
+    try {
+      const token = localStorage.getItem("jwt");
+      const res = await fetch(
+        `${process.env.REACT_APP_API_URL}/tests/${testId}/start`,
+        {
+          method: "POST",
+          headers: { Authorization: `Bearer ${token}` },
+        }
+      );
+      if (!res.ok) return;
+      const attempt = await res.json();
+      if (attempt.time_limit_seconds) {
+        setTimeLimit(attempt.time_limit_seconds);
+        setDeadline(Date.now() + (attempt.remaining_seconds || 0) * 1000);
+      }
+    } catch (err) {
+      console.error("Error starting the test:", err);
+    }
+  };
+
+  const formatTime = (seconds) =>
+    `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, "0")}`;
+
   const handleOption = (optionLetter) => {
     const currentQuestion = questions[currentStep];
     const currentEndTime = Date.now();
@@ -88,6 +133,8 @@ function ClassroomTest() {
   };
 
   const submitTestWithAnswers = async (finalAnswers, finalEndTimes) => {
+    if (submitted.current) return;
+    submitted.current = true;
     const answersPayload = questions.map((q) => {
       const startTime = startTimes[q.id];
       const endTime = finalEndTimes[q.id];
@@ -128,9 +175,11 @@ function ClassroomTest() {
       } else {
         const data = await res.json();
         setError(data.error || "Failed to submit test");
+        submitted.current = false;
       }
     } catch (err) {
       setError("Error submitting test");
+      submitted.current = false;
       console.error(err);
     }
   };
@@ -214,6 +263,16 @@ function ClassroomTest() {
         <p className={styles["test-desc"]}>
           Answer all questions to complete the test. Good luck!
         </p>
+        {timeLimit && !showResult && (
+          <div
+            className={`alert ${remaining <= 60 ? "alert-warning" : "alert-info"}`}
+            role="timer"
+          >
+            Time left: <strong>{formatTime(remaining ?? timeLimit)}</strong> of{" "}
+            {formatTime(timeLimit)}. Your answers are submitted when the time
+            is up.
+          </div>
+        )}
         {error && <div className="alert alert-danger">{error}</div>}
         {!showResult ? (
           questions.length > 0 && questions[currentStep] ? (
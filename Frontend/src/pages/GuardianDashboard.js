@@ -0,0 +1,172 @@
+import { useEffect, useState } from "react";
+
+const API = process.env.REACT_APP_API_URL;
+
+// Read-only progress of the students linked to a guardian
+function GuardianDashboard({ handleToast }) {
+  const [students, setStudents] = useState([]);
+  const [selected, setSelected] = useState(null);
+  const [progress, setProgress] = useState(null);
+  const [code, setCode] = useState("");
+  const [error, setError] = useState("");
+
+  const authHeaders = () => ({
+    "Content-Type": "application/json",
+    Authorization: `Bearer ${localStorage.getItem("jwt")}`,
+  });
+
+  const loadStudents = () =>
+    fetch(`${API}/guardian/students`, { headers: authHeaders() })
+      .then((res) => (res.ok ? res.json() : Promise.reject()))
+      .then(setStudents)
+      .catch(() => setError("Failed to load your students"));
+
+  useEffect(() => {
+    loadStudents();
+  }, []);
+
+  const selectStudent = async (student) => {
+    setSelected(student);
+    setProgress(null);
+    setError("");
+    try {
+      const base = `${API}/guardian/students/${student.student_id}`;
+      const [history, levels, mistakes, assignments] = await Promise.all(
+        ["history", "levels", "mistakes", "assignments"].map((part) =>
+          fetch(`${base}/${part}`, { headers: authHeaders() }).then((res) =>
+            res.ok ? res.json() : Promise.reject()
+          )
+        )
+      );
+      setProgress({ history, levels, mistakes, assignments });
+    } catch {
+      setError("Failed to load the progress of " + student.username);
+    }
+  };
+
+  const handleLink = async (e) => {
+    e.preventDefault();
+    setError("");
+    const res = await fetch(`${API}/guardian/links`, {
+      method: "POST",
+      headers: authHeaders(),
+      body: JSON.stringify({ code }),
+    });
+    const data = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      setError(data.error || "Could not use this invite code");
+      return;
+    }
+    setCode("");
+    handleToast(`You can now follow ${data.username}.`, "success");
+    loadStudents();
+  };
+
+  const latestLevel = (levels) =>
+    levels.length ? levels[0].confirmed_level || levels[0].fuzzy_level : "-";
+
+  return (
+    <div className="container py-5">
+      <h2 className="mb-4">My Students</h2>
+      {error && <div className="alert alert-danger py-2">{error}</div>}
+
+      <form className="d-flex gap-2 mb-4" onSubmit={handleLink}>
+        <input
+          className="form-control"
+          style={{ maxWidth: 260 }}
+          placeholder="Invite code"
+          value={code}
+          onChange={(e) => setCode(e.target.value)}
+        />
+        <button type="submit" className="btn btn-primary">
+          Add Student
+        </button>
+      </form>
+
+      {students.length === 0 && (
+        <p className="text-muted">
+          Ask your child or their teacher for an invite code to follow their
+          progress.
+        </p>
+      )}
+      <div className="list-group mb-4">
+        {students.map((s) => (
+          <button
+            key={s.student_id}
+            type="button"
+            className={`list-group-item list-group-item-action ${
+              selected?.student_id === s.student_id ? "active" : ""
+            }`}
+            onClick={() => selectStudent(s)}
+          >
+            {s.username}
+          </button>
+        ))}
+      </div>
+
+      {selected && progress && (
+        <div>
+          <h4>{selected.username}</h4>
+          <p>
+            Current level: <strong>{latestLevel(progress.levels)}</strong>
+          </p>
+
+          <h5>Test History</h5>
+          <table className="table table-sm">
+            <thead>
+              <tr>
+                <th>Date</th>
+                <th>Type</th>
+                <th>Score</th>
+                <th>Level</th>
+              </tr>
+            </thead>
+            <tbody>
+              {progress.history.map((h) => (
+                <tr key={h.test_id}>
+                  <td>{new Date(h.completed_at).toLocaleDateString()}</td>
+                  <td>{h.test_type}</td>
+                  <td>{Math.round(h.score)}%</td>
+                  <td>{h.level}</td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+
+          <h5>Most Frequent Mistakes</h5>
+          <ul>
+            {progress.mistakes.categories.map((m) => (
+              <li key={m.category}>
+                {m.category}: {m.count}
+              </li>
+            ))}
+          </ul>
+
+          <h5>Classroom Assignments</h5>
+          <table className="table table-sm">
+            <thead>
+              <tr>
+                <th>Classroom</th>
+                <th>Test</th>
+                <th>Status</th>
+              </tr>
+            </thead>
+            <tbody>
+              {progress.assignments.map((a) => (
+                <tr key={`${a.classroom_id}-${a.test_id}`}>
+                  <td>{a.classroom_name}</td>
+                  <td>{a.title}</td>
+                  <td>
+                    {a.completed ? `Done (${Math.round(a.score)}%)` : "To do"}
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      )}
+    </div>
+  );
+}
+
+export default GuardianDashboard;
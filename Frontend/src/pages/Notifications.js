@@ -0,0 +1,152 @@
+import { useEffect, useState } from "react";
+import { useNavigate } from "react-router-dom";
+
+const API = process.env.REACT_APP_API_URL;
+
+const PAGE_SIZE = 20;
+
+// Notification center: the notifications of the user, newest first
+function Notifications({ handleToast }) {
+  const [notifications, setNotifications] = useState([]);
+  const [unread, setUnread] = useState(0);
+  const [unreadOnly, setUnreadOnly] = useState(false);
+  const [hasMore, setHasMore] = useState(false);
+  const [error, setError] = useState("");
+  const navigate = useNavigate();
+
+  const authHeaders = () => ({
+    Authorization: `Bearer ${localStorage.getItem("jwt")}`,
+  });
+
+  const load = async (before = 0) => {
+    const params = new URLSearchParams({ limit: PAGE_SIZE });
+    if (unreadOnly) params.set("unread", "true");
+    if (before) params.set("before", before);
+    try {
+      const res = await fetch(`${API}/notifications?${params}`, {
+        headers: authHeaders(),
+      });
+      if (!res.ok) throw new Error();
+      const data = await res.json();
+      setNotifications((prev) =>
+        before ? [...prev, ...data.notifications] : data.notifications
+      );
+      setUnread(data.unread);
+      setHasMore(data.notifications.length === PAGE_SIZE);
+    } catch {
+      setError("Failed to load your notifications");
+    }
+  };
+
+  useEffect(() => {
+    load();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [unreadOnly]);
+
+  const markRead = async (n) => {
+    if (n.read_at) return true;
+    const res = await fetch(`${API}/notifications/${n.id}/read`, {
+      method: "POST",
+      headers: authHeaders(),
+    });
+    if (!res.ok) return false;
+    const readAt = new Date().toISOString();
+    setNotifications((prev) =>
+      prev.map((p) => (p.id === n.id ? { ...p, read_at: readAt } : p))
+    );
+    setUnread((u) => Math.max(0, u - 1));
+    window.dispatchEvent(new Event("notifications-read"));
+    return true;
+  };
+
+  const handleOpen = async (n) => {
+    await markRead(n);
+    if (n.link) navigate(n.link);
+  };
+
+  const handleMarkAll = async () => {
+    const res = await fetch(`${API}/notifications/read-all`, {
+      method: "POST",
+      headers: authHeaders(),
+    });
+    if (!res.ok) {
+      handleToast("Failed to mark the notifications as read", "danger");
+      return;
+    }
+    window.dispatchEvent(new Event("notifications-read"));
+    if (unreadOnly) {
+      setNotifications([]);
+      setHasMore(false);
+    } else {
+      const readAt = new Date().toISOString();
+      setNotifications((prev) =>
+        prev.map((p) => (p.read_at ? p : { ...p, read_at: readAt }))
+      );
+    }
+    setUnread(0);
+  };
+
+  return (
+    <div className="container py-5" style={{ maxWidth: 720 }}>
+      <div className="d-flex justify-content-between align-items-center mb-4">
+        <h2 className="mb-0">Notifications</h2>
+        <button
+          className="btn btn-outline-primary btn-sm"
+          onClick={handleMarkAll}
+          disabled={unread === 0}
+        >
+          Mark all as read
+        </button>
+      </div>
+      {error && <div className="alert alert-danger">{error}</div>}
+
+      <div className="form-check form-switch mb-3">
+        <input
+          type="checkbox"
+          className="form-check-input"
+          id="unread-only"
+          checked={unreadOnly}
+          onChange={(e) => setUnreadOnly(e.target.checked)}
+        />
+        <label className="form-check-label" htmlFor="unread-only">
+          Unread only ({unread})
+        </label>
+      </div>
+
+      {notifications.length === 0 ? (
+        <p className="text-muted">No notifications.</p>
+      ) : (
+        <ul className="list-group mb-3">
+          {notifications.map((n) => (
+            <li
+              key={n.id}
+              className={`list-group-item list-group-item-action${
+                n.read_at ? "" : " list-group-item-light fw-semibold"
+              }`}
+              style={{ cursor: "pointer" }}
+              onClick={() => handleOpen(n)}
+            >
+              <div className="d-flex justify-content-between">
+                <span>{n.title}</span>
+                <small className="text-muted">
+                  {new Date(n.created_at).toLocaleString()}
+                </small>
+              </div>
+              <div className="small fw-normal">{n.body}</div>
+            </li>
+          ))}
+        </ul>
+      )}
+      {hasMore && (
+        <button
+          className="btn btn-outline-secondary btn-sm"
+          onClick={() => load(notifications[notifications.length - 1].id)}
+        >
+          Load more
+        </button>
+      )}
+    </div>
+  );
+}
+
+export default Notifications;
@@ -507,6 +507,11 @@ function TeacherClassrooms() {
                             <td>{result.avg_time?.toFixed(2) || "N/A"}</td>
                             <td>
                               {new Date(result.completed_at).toLocaleString()}
+                              {result.timing?.over_time && (
+                                <span className="badge bg-warning text-dark ms-2">
+                                  Over time
+                                </span>
+                              )}
                             </td>
                             <td>
                               <button
@@ -562,6 +567,14 @@ function TeacherClassrooms() {
               <div className={styles.detailsStat}>
                 <strong>Completed At:</strong> {new Date(studentDetails.completed_at).toLocaleString()}
               </div>
+              {studentDetails.timing?.time_limit_seconds && (
+                <div className={styles.detailsStat}>
+                  <strong>Time Limit:</strong> {Math.round(studentDetails.timing.time_limit_seconds / 60)} min
+                  {studentDetails.timing.over_time && (
+                    <span className="badge bg-warning text-dark ms-2">Submitted over time</span>
+                  )}
+                </div>
+              )}
             </div>
 
             <h4 className={styles.sectionTitle}>Question-by-Question Breakdown</h4>
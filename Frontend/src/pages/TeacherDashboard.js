@@ -4,6 +4,8 @@ import styles from "../css/TeacherDashboard.module.css";
 import TestCard from "../components/Test/TestCard";
 import TestForm from "../components/Test/TestForm";
 import ViewTest from "../components/Test/ViewTest";
+import ImportTest from "../components/Test/ImportTest";
+import ExportTest from "../components/Test/ExportTest";
 
 function TeacherDashboard() {
   const [tests, setTests] = useState([]);
@@ -17,6 +19,8 @@ function TeacherDashboard() {
   const [isCreateOpen, setIsCreateOpen] = useState(false);
   const [isEditOpen, setIsEditOpen] = useState(false);
   const [isViewOpen, setIsViewOpen] = useState(false);
+  const [isImportOpen, setIsImportOpen] = useState(false);
+  const [exportedTest, setExportedTest] = useState(null);
   const [error, setError] = useState("");
   const [isResultsOpen, setIsResultsOpen] = useState(false);
   const [testResults, setTestResults] = useState(null);
@@ -54,17 +58,23 @@ function TeacherDashboard() {
     if (form.questions.length === 0) return "At least one question is required";
     for (const q of form.questions) {
       if (!q.question_text?.trim()) return "Question text is required";
-      // Always MCQ
-      for (const key of ["A", "B", "C", "D"]) {
-        if (!q.options?.[key]?.trim()) return "All options (A-D) are required";
-      }
-      if (!q.correct_answer || !["A", "B", "C", "D"].includes(q.correct_answer))
-        return "Valid correct answer required (A-D)";
+      // Always MCQ, with options A and B at least (imported true/false questions have two)
+      const filled = ["A", "B", "C", "D"].filter((key) => q.options?.[key]?.trim());
+      if (filled.length < 2 || filled.join("") !== "ABCD".slice(0, filled.length))
+        return "Options A and B are required, and C before D";
+      if (!q.correct_answer || !filled.includes(q.correct_answer))
+        return "Valid correct answer required among the options";
       if (Number(q.points) < 1) return "Points must be at least 1";
     }
     return null;
   };
 
+  // Options left empty are not sent
+  const filledOptions = (options) =>
+    Object.fromEntries(
+      Object.entries(options || {}).filter(([, text]) => text?.trim())
+    );
+
   const handleCreate = async (e) => {
     e.preventDefault();
     const validationError = validateForm();
@@ -79,7 +89,7 @@ function TeacherDashboard() {
         questions: form.questions.map((q) => ({
           ...q,
           question_type: q.category || q.question_type || "vocabulary", // Fallback to ensure question_type is set
-          options: q.options || { A: "", B: "", C: "", D: "" },
+          options: filledOptions(q.options),
         })),
       };
       console.log("Creating test with payload:", payload);
@@ -144,6 +154,7 @@ function TeacherDashboard() {
         questions: form.questions.map((q) => ({
           ...q,
           question_type: q.category || q.question_type || "vocabulary",
+          options: filledOptions(q.options),
         })),
       };
       const res = await fetch(
@@ -303,6 +314,22 @@ function TeacherDashboard() {
     }
   };
 
+  // The converted questions of an import are reviewed in the create form
+  const reviewImport = (test) => {
+    setForm({
+      title: test.title,
+      description: test.description || "",
+      type: test.type,
+      questions: test.questions.map((q) => ({
+        ...q,
+        category: q.question_type,
+      })),
+    });
+    setIsImportOpen(false);
+    setIsCreateOpen(true);
+    setError("");
+  };
+
   const resetForm = () => {
     setForm({ title: "", description: "", type: "mixed", questions: [] });
   };
@@ -370,6 +397,13 @@ function TeacherDashboard() {
         >
           Create New Test
         </button>
+        <button
+          className={styles.createBtn}
+          style={{ background: "#6f42c1" }}
+          onClick={() => setIsImportOpen(true)}
+        >
+          Import Test
+        </button>
       </div>
 
       <div className={styles.testGrid}>
@@ -386,6 +420,7 @@ function TeacherDashboard() {
             onEdit={() => openEdit(test)}
             onDelete={() => handleDelete(test.id)}
             onResults={() => openResults(test)}
+            onExport={() => setExportedTest(test)}
           />
         ))}
       </div>
@@ -405,6 +440,34 @@ function TeacherDashboard() {
         </div>
       )}
 
+      {/* Import Modal */}
+      {isImportOpen && (
+        <div className={styles.modalOverlay}>
+          <div className={styles.modal}>
+            <ImportTest
+              onReview={reviewImport}
+              onImported={() => {
+                fetchTests();
+                setIsImportOpen(false);
+              }}
+              onClose={() => setIsImportOpen(false)}
+            />
+          </div>
+        </div>
+      )}
+
+      {/* Export Modal */}
+      {exportedTest && (
+        <div className={styles.modalOverlay}>
+          <div className={styles.modal}>
+            <ExportTest
+              test={exportedTest}
+              onClose={() => setExportedTest(null)}
+            />
+          </div>
+        </div>
+      )}
+
       {/* Edit Modal */}
       {isEditOpen && (
         <div className={styles.modalOverlay}>
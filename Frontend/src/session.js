@@ -0,0 +1,71 @@
+// Tokens of the signed in user: the short-lived access token ("jwt") and the refresh token which
+// renews it (POST /refresh). A refresh token is used once: each refresh returns a new one
+const API_URL = process.env.REACT_APP_API_URL;
+
+// The fetch of the browser, without the retry installed below
+let originalFetch = (...args) => window.fetch(...args);
+
+export const storeTokens = ({ token, refresh_token }) => {
+  if (token) localStorage.setItem("jwt", token);
+  if (refresh_token) localStorage.setItem("refresh_token", refresh_token);
+};
+
+export const clearTokens = () => {
+  localStorage.removeItem("jwt");
+  localStorage.removeItem("refresh_token");
+};
+
+// Requests failing at the same time share one refresh, as the reuse of a refresh token revokes the
+// session. Resolves to the new access token, or null when the session is over
+let refreshing = null;
+
+export const refreshTokens = () => {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = localStorage.getItem("refresh_token");
+      if (!refreshToken) return null;
+      try {
+        const res = await originalFetch(`${API_URL}/refresh`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (!res.ok) {
+          clearTokens();
+          return null;
+        }
+        const tokens = await res.json();
+        storeTokens(tokens);
+        return tokens.token;
+      } catch {
+        return null; // Offline: keep the tokens for the next attempt
+      }
+    })().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+};
+
+// installTokenRefresh makes the API requests with an expired access token refresh the session and
+// retry once with the new token
+export const installTokenRefresh = () => {
+  const fetch = window.fetch.bind(window);
+  originalFetch = fetch;
+  window.fetch = async (input, init = {}) => {
+    const res = await fetch(input, init);
+    const url = typeof input === "string" ? input : input.url;
+    const headers = new Headers(init.headers);
+    if (
+      res.status !== 401 ||
+      !url.startsWith(API_URL) ||
+      !headers.get("Authorization")?.startsWith("Bearer ")
+    ) {
+      return res;
+    }
+    const token = await refreshTokens();
+    if (!token) return res;
+    headers.set("Authorization", `Bearer ${token}`);
+    return fetch(input, { ...init, headers });
+  };
+};
@@ -4,18 +4,153 @@ CREATE TABLE
         username VARCHAR(255) UNIQUE NOT NULL,
         email VARCHAR(255) UNIQUE NOT NULL,
         password VARCHAR(255) NOT NULL,
+        -- 'student', 'teacher', 'guardian' or 'admin'
         role VARCHAR(50) NOT NULL,
-        create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        -- NULL until the user confirms the email address
+        email_verified_at TIMESTAMP,
+        -- Set while an administrator has disabled the account
+        disabled_at TIMESTAMP,
+        -- Password logins are refused until the password is reset with an emailed code
+        password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+        -- Set once the user deleted their account: it is anonymised and disabled, its results are kept
+        deleted_at TIMESTAMP,
+        -- Language of the emails sent to the user ('en' or 'el')
+        locale VARCHAR(10) NOT NULL DEFAULT 'en'
     );
 
 CREATE TABLE
     IF NOT EXISTS password_resets (
         id SERIAL PRIMARY KEY,
-        user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
-        token VARCHAR(255) NOT NULL,
+        -- A single active code per user: a new request replaces the previous code
+        user_id INTEGER UNIQUE NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        -- The email the code was sent to; the code is only valid with it
+        email VARCHAR(255) NOT NULL,
+        -- bcrypt hash of the code
+        code_hash VARCHAR(255) NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL,
+        -- Set when the attempts are exhausted; no new code is issued before
+        locked_until TIMESTAMP
+    );
+
+-- Login sessions: each one is the family of the refresh tokens rotated from a login
+CREATE TABLE
+    IF NOT EXISTS auth_sessions (
+        id UUID PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL,
+        revoked_at TIMESTAMP,
+        revoked_reason VARCHAR(50)
+    );
+
+CREATE INDEX IF NOT EXISTS auth_sessions_user_id_idx ON auth_sessions (user_id);
+
+-- Refresh tokens are single use and stored as SHA-256 hashes
+CREATE TABLE
+    IF NOT EXISTS refresh_tokens (
+        id SERIAL PRIMARY KEY,
+        session_id UUID NOT NULL REFERENCES auth_sessions (id) ON DELETE CASCADE,
+        token_hash CHAR(64) UNIQUE NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP
+    );
+
+-- TOTP two-factor authentication; the secret is encrypted (AES-GCM)
+CREATE TABLE
+    IF NOT EXISTS user_totp (
+        user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+        secret TEXT NOT NULL,
+        -- NULL while the enrolment is not confirmed with a first code
+        confirmed_at TIMESTAMP,
+        -- Last time step used, codes of this step or before are rejected (replay)
+        last_step BIGINT NOT NULL DEFAULT 0,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
+-- Single use recovery codes, stored as SHA-256 hashes
+CREATE TABLE
+    IF NOT EXISTS totp_recovery_codes (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        code_hash CHAR(64) NOT NULL,
+        used_at TIMESTAMP,
+        UNIQUE (user_id, code_hash)
+    );
+
+-- Second step of a login: issued once the password is checked, redeemed with a TOTP or recovery code
+CREATE TABLE
+    IF NOT EXISTS mfa_challenges (
+        token_hash CHAR(64) PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        -- 'verify' (enrolled user) or 'enroll' (2FA required but not set up yet)
+        purpose VARCHAR(20) NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
         expires_at TIMESTAMP NOT NULL
     );
 
+-- External identities (OpenID Connect) linked to users
+CREATE TABLE
+    IF NOT EXISTS user_identities (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        provider VARCHAR(50) NOT NULL,
+        subject VARCHAR(255) NOT NULL,
+        email VARCHAR(255),
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        last_login_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (provider, subject)
+    );
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- Pending OpenID Connect logins, consumed by the callback
+CREATE TABLE
+    IF NOT EXISTS oidc_login_states (
+        state VARCHAR(64) PRIMARY KEY,
+        provider VARCHAR(50) NOT NULL,
+        nonce VARCHAR(64) NOT NULL,
+        code_verifier VARCHAR(128) NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL
+    );
+
+-- Throttling records: failed logins per account ('user:<id>' or 'login:<identifier>')
+-- and per IP ('ip:<address>'), verification emails sent ('verify:<id>')
+CREATE TABLE
+    IF NOT EXISTS throttle_records (
+        key VARCHAR(320) PRIMARY KEY,
+        failures INTEGER NOT NULL DEFAULT 0,
+        last_failure TIMESTAMP NOT NULL,
+        locked_until TIMESTAMP
+    );
+
+-- Audit log of security events (failed logins, lockouts, unlocks)
+CREATE TABLE
+    IF NOT EXISTS security_events (
+        id SERIAL PRIMARY KEY,
+        event_type VARCHAR(50) NOT NULL,
+        user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        actor_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        ip VARCHAR(64),
+        details TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE INDEX IF NOT EXISTS security_events_user_id_idx ON security_events (user_id, created_at);
+
+CREATE TABLE
+    IF NOT EXISTS fuzzy_engine_versions (
+        version VARCHAR(64) PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        definition JSONB NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
 CREATE TABLE
     IF NOT EXISTS test_results_level (
         id SERIAL PRIMARY KEY,
@@ -23,16 +158,36 @@ CREATE TABLE
         teacher_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
         score REAL NOT NULL,
         avg_response_time REAL,
+        speed_ratio REAL, -- before the accommodation is applied
+        time_multiplier REAL NOT NULL DEFAULT 1,
+        untimed BOOLEAN NOT NULL DEFAULT FALSE,
         vocabulary_pct REAL,
         grammar_pct REAL,
         reading_pct REAL,
         listening_pct REAL,
         difficulty INTEGER,
         fuzzy_level VARCHAR(50),
+        level_score REAL,
+        engine_version VARCHAR(64) REFERENCES fuzzy_engine_versions (version),
         test_type VARCHAR(32) NOT NULL DEFAULT 'regular',
+        confirmed_level VARCHAR(50),
+        confirmed_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        confirmed_at TIMESTAMP,
         taken_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );
 
+-- Previous levels of results recomputed under a new engine version
+CREATE TABLE
+    IF NOT EXISTS test_results_level_history (
+        id SERIAL PRIMARY KEY,
+        result_id INTEGER NOT NULL REFERENCES test_results_level (id) ON DELETE CASCADE,
+        fuzzy_level VARCHAR(50),
+        level_score REAL,
+        engine_version VARCHAR(64) REFERENCES fuzzy_engine_versions (version),
+        replaced_by VARCHAR(64) NOT NULL REFERENCES fuzzy_engine_versions (version),
+        replaced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+
 INSERT INTO
     users (username, email, password, role)
 VALUES
@@ -1891,10 +2046,192 @@ CREATE TABLE
         id SERIAL PRIMARY KEY,
         classroom_id INTEGER NOT NULL REFERENCES Classrooms (id) ON DELETE CASCADE,
         test_id INTEGER NOT NULL REFERENCES Teachers_tests (id) ON DELETE CASCADE,
+        time_limit_minutes INTEGER, -- NULL for untimed assignments
         assigned_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
         UNIQUE (classroom_id, test_id)
     );
 
+-- Personal access tokens of teachers for scripts and integrations, stored as SHA-256 hashes
+CREATE TABLE
+    IF NOT EXISTS personal_access_tokens (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        name VARCHAR(100) NOT NULL,
+        token_hash CHAR(64) UNIQUE NOT NULL,
+        token_prefix VARCHAR(16) NOT NULL,
+        scopes TEXT[] NOT NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP WITHOUT TIME ZONE,
+        last_used_at TIMESTAMP WITHOUT TIME ZONE,
+        revoked_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE INDEX IF NOT EXISTS personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+-- Guardians (parents) with read-only access to the progress of linked students
+CREATE TABLE
+    IF NOT EXISTS guardian_links (
+        guardian_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        student_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        -- The student or teacher whose invite code created the link
+        invited_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (guardian_id, student_id)
+    );
+
+CREATE INDEX IF NOT EXISTS guardian_links_student_id_idx ON guardian_links (student_id);
+
+-- Single use invite codes linking a guardian to a student, stored as SHA-256 hashes
+CREATE TABLE
+    IF NOT EXISTS guardian_invites (
+        id SERIAL PRIMARY KEY,
+        student_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        created_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        code_hash CHAR(64) UNIQUE NOT NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+        used_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+-- Emails waiting to be delivered by the outbox worker, rendered when queued
+-- The idempotency key makes queuing the same email twice a no-op; the bodies of sent emails are erased
+CREATE TABLE
+    IF NOT EXISTS email_outbox (
+        id BIGSERIAL PRIMARY KEY,
+        idempotency_key VARCHAR(255) UNIQUE NOT NULL,
+        recipients TEXT[] NOT NULL,
+        subject TEXT NOT NULL,
+        text_body TEXT NOT NULL,
+        html_body TEXT NOT NULL DEFAULT '',
+        unsubscribe_url TEXT, -- sent as List-Unsubscribe
+        template VARCHAR(50) NOT NULL,
+        locale VARCHAR(10) NOT NULL,
+        status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+        attempts INTEGER NOT NULL DEFAULT 0,
+        -- Also the end of the lease of a worker delivering it
+        next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        last_error TEXT,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        sent_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx ON email_outbox (next_attempt_at) WHERE status = 'pending';
+
+-- Notification choices of users by type; without a row a notification is on
+CREATE TABLE
+    IF NOT EXISTS notification_preferences (
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        type VARCHAR(50) NOT NULL,
+        email BOOLEAN NOT NULL DEFAULT TRUE,
+        in_app BOOLEAN NOT NULL DEFAULT TRUE,
+        updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, type)
+    );
+
+-- Notification center of users, fed by the events of the classrooms and tests
+CREATE TABLE
+    IF NOT EXISTS notifications (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        type VARCHAR(50) NOT NULL,
+        title VARCHAR(255) NOT NULL,
+        body TEXT NOT NULL,
+        link VARCHAR(255) NOT NULL DEFAULT '',
+        data JSONB NOT NULL DEFAULT '{}',
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        read_at TIMESTAMP WITHOUT TIME ZONE -- NULL while unread
+    );
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, id DESC);
+
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- Weekly digests sent, by the Monday starting the week they cover, so that one instance sends each week
+CREATE TABLE
+    IF NOT EXISTS digest_runs (
+        week_start DATE PRIMARY KEY,
+        started_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        completed_at TIMESTAMP WITHOUT TIME ZONE,
+        emails_queued INTEGER
+    );
+
+-- Webhook endpoints of teachers, with the secret signing their requests
+CREATE TABLE
+    IF NOT EXISTS webhook_subscriptions (
+        id SERIAL PRIMARY KEY,
+        teacher_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        url TEXT NOT NULL,
+        description VARCHAR(255) NOT NULL DEFAULT '',
+        events TEXT[] NOT NULL,
+        secret VARCHAR(100) NOT NULL,
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_teacher_id_idx ON webhook_subscriptions (teacher_id);
+
+-- Events sent to the webhooks, delivered by a background worker with retries; also the delivery log
+CREATE TABLE
+    IF NOT EXISTS webhook_deliveries (
+        id BIGSERIAL PRIMARY KEY,
+        subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+        event_id UUID NOT NULL, -- shared by the retries and redeliveries of an event
+        event_type VARCHAR(50) NOT NULL,
+        payload TEXT NOT NULL, -- the exact body that is signed
+        status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, delivered or failed
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP, -- also the lease of a claimed delivery
+        last_status_code INTEGER,
+        last_error TEXT,
+        last_response TEXT,
+        redelivery_of BIGINT REFERENCES webhook_deliveries (id) ON DELETE SET NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        delivered_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, id DESC);
+
+-- xAPI statements waiting to be sent to the Learning Record Store by the xAPI worker, in batches
+-- The statement id is derived from what the statement records, so it is queued once
+CREATE TABLE
+    IF NOT EXISTS xapi_statements (
+        id BIGSERIAL PRIMARY KEY,
+        statement_id UUID UNIQUE NOT NULL,
+        statement TEXT NOT NULL,
+        status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+        attempts INTEGER NOT NULL DEFAULT 0,
+        -- Also the end of the lease of a worker sending it
+        next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        last_error TEXT,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        sent_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE INDEX IF NOT EXISTS xapi_statements_due_idx ON xapi_statements (id) WHERE status = 'pending';
+
+-- Time accommodations of students, set by their teachers
+CREATE TABLE
+    IF NOT EXISTS student_accommodations (
+        user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+        time_multiplier REAL NOT NULL DEFAULT 1 CHECK (time_multiplier >= 1),
+        untimed BOOLEAN NOT NULL DEFAULT FALSE,
+        notes TEXT,
+        updated_by INTEGER REFERENCES users (id) ON DELETE SET NULL,
+        updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+-- Attempts of students at classroom tests, from their start to their submission (time limits)
+CREATE TABLE
+    IF NOT EXISTS teacher_test_attempts (
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        test_id INTEGER NOT NULL REFERENCES Teachers_tests (id) ON DELETE CASCADE,
+        started_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, test_id)
+    );
+
 -- Table to store student results from teacher tests
 CREATE TABLE
     IF NOT EXISTS Teacher_test_results (
@@ -1905,6 +2242,11 @@ CREATE TABLE
         total_questions INTEGER NOT NULL,
         correct_answers INTEGER NOT NULL,
         avg_response_time REAL,
+        time_limit_seconds INTEGER, -- granted to the student, NULL if untimed
+        time_multiplier REAL NOT NULL DEFAULT 1,
+        untimed BOOLEAN NOT NULL DEFAULT FALSE,
+        started_at TIMESTAMP WITHOUT TIME ZONE, -- of the attempt, NULL if untimed
+        over_time BOOLEAN NOT NULL DEFAULT FALSE, -- submitted after the time limit
         taken_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
     );
 
@@ -1918,4 +2260,87 @@ CREATE TABLE
         is_correct BOOLEAN NOT NULL,
         response_time REAL,
         answered_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
-    );
\ No newline at end of file
+    );
+
+-- Pending LTI launches, from the login initiation of the platform to the launch
+CREATE TABLE
+    IF NOT EXISTS lti_launch_states (
+        state VARCHAR(64) PRIMARY KEY,
+        platform VARCHAR(50) NOT NULL,
+        nonce VARCHAR(64) NOT NULL,
+        target_link_uri TEXT NOT NULL,
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+    );
+
+-- Courses of the LTI platforms (LMS) mapped to classrooms
+CREATE TABLE
+    IF NOT EXISTS lti_contexts (
+        id SERIAL PRIMARY KEY,
+        platform VARCHAR(50) NOT NULL,
+        context_id VARCHAR(255) NOT NULL,
+        classroom_id INTEGER NOT NULL REFERENCES Classrooms (id) ON DELETE CASCADE,
+        title VARCHAR(255) NOT NULL DEFAULT '',
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (platform, context_id)
+    );
+
+-- Placements of the tool in the courses, launching a teacher test; the line item receives its scores
+CREATE TABLE
+    IF NOT EXISTS lti_resource_links (
+        id SERIAL PRIMARY KEY,
+        platform VARCHAR(50) NOT NULL,
+        resource_link_id VARCHAR(255) NOT NULL,
+        deployment_id VARCHAR(255) NOT NULL,
+        context_id INTEGER REFERENCES lti_contexts (id) ON DELETE CASCADE,
+        test_id INTEGER REFERENCES Teachers_tests (id) ON DELETE SET NULL,
+        line_item TEXT NOT NULL DEFAULT '',
+        title VARCHAR(255) NOT NULL DEFAULT '',
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (platform, resource_link_id)
+    );
+
+-- Students who launched a resource link, with their user id at the platform for the score passback
+CREATE TABLE
+    IF NOT EXISTS lti_link_users (
+        resource_link_id INTEGER NOT NULL REFERENCES lti_resource_links (id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        subject VARCHAR(255) NOT NULL,
+        last_launch_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (resource_link_id, user_id)
+    );
+
+CREATE INDEX IF NOT EXISTS lti_link_users_user_id_idx ON lti_link_users (user_id);
+
+-- Deep Linking requests of teachers, waiting for the choice of a test
+CREATE TABLE
+    IF NOT EXISTS lti_deep_link_requests (
+        id VARCHAR(64) PRIMARY KEY,
+        platform VARCHAR(50) NOT NULL,
+        deployment_id VARCHAR(255) NOT NULL,
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        return_url TEXT NOT NULL,
+        data TEXT NOT NULL DEFAULT '',
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+    );
+
+-- Scores of classroom tests waiting to be posted to the line items of the platforms by the LTI worker
+CREATE TABLE
+    IF NOT EXISTS lti_scores (
+        id BIGSERIAL PRIMARY KEY,
+        resource_link_id INTEGER NOT NULL REFERENCES lti_resource_links (id) ON DELETE CASCADE,
+        result_id INTEGER NOT NULL REFERENCES Teacher_test_results (id) ON DELETE CASCADE,
+        user_subject VARCHAR(255) NOT NULL,
+        score REAL NOT NULL,
+        score_maximum REAL NOT NULL,
+        status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+        attempts INTEGER NOT NULL DEFAULT 0,
+        -- Also the end of the lease of a worker posting it
+        next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        last_error TEXT,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        sent_at TIMESTAMP WITHOUT TIME ZONE,
+        UNIQUE (resource_link_id, result_id)
+    );
+
+CREATE INDEX IF NOT EXISTS lti_scores_due_idx ON lti_scores (next_attempt_at) WHERE status = 'pending';
\ No newline at end of file